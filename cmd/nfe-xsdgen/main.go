@@ -0,0 +1,68 @@
+// Comando nfe-xsdgen: gera as structs Go a partir do pacote de schemas XSD da NFe.
+//
+// A cada nova Nota Técnica, basta copiar o pacote de liberação para xsd/schemas e
+// regerar os tipos:
+//
+//	go run ./cmd/nfe-xsdgen -pl PL_009_V4 -o leiaute/leiaute.go
+//
+// Também é possível ler os schemas diretamente do disco:
+//
+//	go run ./cmd/nfe-xsdgen -xsd /caminho/PL_010_V1/nfe_v4.00.xsd -pkg leiaute -o leiaute/leiaute.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/eugustavokeller/nfe-go/xsd"
+)
+
+func main() {
+	arquivoXSD := flag.String("xsd", "", "arquivo XSD raiz no disco (os includes são lidos do mesmo diretório)")
+	pl := flag.String("pl", xsd.PacoteNFe, "pacote de schemas embutido, usado quando -xsd não é informado")
+	raiz := flag.String("raiz", "nfe_v4.00.xsd", "arquivo XSD raiz dentro do pacote embutido")
+	pacote := flag.String("pkg", "leiaute", "nome do pacote Go gerado")
+	namespace := flag.String("ns", "http://www.portalfiscal.inf.br/nfe", "namespace principal do schema")
+	saida := flag.String("o", "", "arquivo de saída (padrão: saída padrão)")
+	flag.Parse()
+
+	var schema *xsd.Schema
+	var origem string
+	var err error
+	if *arquivoXSD != "" {
+		origem = filepath.Base(*arquivoXSD)
+		schema, err = xsd.Carregar(os.DirFS(filepath.Dir(*arquivoXSD)), origem)
+	} else {
+		origem = path.Join(*pl, *raiz)
+		schema, err = xsd.CarregarPacote(*pl, *raiz)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao carregar os schemas: %v\n", err)
+		os.Exit(1)
+	}
+
+	codigo := &bytes.Buffer{}
+	err = schema.GerarGo(codigo, xsd.OpcoesGeracao{Pacote: *pacote, Namespace: *namespace, Origem: origem})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao gerar os tipos: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *saida == "" {
+		os.Stdout.Write(codigo.Bytes())
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(*saida), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao criar o diretório de saída: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(*saida, codigo.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao gravar %s: %v\n", *saida, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,175 @@
+package danfe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// GerarCCe desenha em w a Carta de Correção Eletrônica do procEventoNFe, no formato do DANFE:
+// chave com código de barras, dados do registro do evento, texto da correção e condições
+// de uso. nfe é o nfeProc da nota corrigida, usado para o emitente e o destinatário (opcional)
+func GerarCCe(w io.Writer, proc *services.ProcEventoNFe, nfe *services.NFeProc) error {
+	if proc == nil {
+		return errors.New("procEventoNFe não informado")
+	}
+	evento := proc.Evento.InfEvento
+	if evento.TpEvento != services.TpEventoCCe {
+		return fmt.Errorf("o evento %s não é uma carta de correção", evento.TpEvento)
+	}
+	if nfe != nil && strings.TrimPrefix(nfe.NFe.InfNFe.Id, "NFe") != evento.ChNFe {
+		return errors.New("o nfeProc não corresponde à chave da carta de correção")
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margem, margem, margem)
+	pdf.SetAutoPageBreak(false, margem)
+	pdf.SetLineWidth(0.2)
+	fixarData(pdf, proc.RetEvento.InfEvento.DhRegEvento, evento.DhEvento)
+	pdf.SetTitle("CC-e "+evento.ChNFe+" "+evento.NSeqEvento, true)
+	largura, altura := pdf.GetPageSize()
+	d := &documento{
+		pdf:     pdf,
+		tr:      pdf.UnicodeTranslatorFromDescriptor(""),
+		proc:    nfe,
+		x0:      margem,
+		largura: largura - 2*margem,
+		base:    altura - margem,
+	}
+	if nfe != nil {
+		d.nfe = nfe.NFe.InfNFe
+	} else {
+		d.nfe.Ide.TpAmb = evento.TpAmb
+	}
+	pdf.AddPage()
+	d.marcaDagua(margem, d.base)
+	d.cartaCorrecao(proc)
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("erro ao gerar a CC-e: %v", err)
+	}
+	return pdf.Output(w)
+}
+
+func (d *documento) cartaCorrecao(proc *services.ProcEventoNFe) {
+	evento := proc.Evento.InfEvento
+	ret := proc.RetEvento.InfEvento
+	y := margem
+
+	// Emitente e identificação do documento, como no cabeçalho do DANFE
+	wEmitente := d.largura * 0.45
+	d.pdf.Rect(d.x0, y, wEmitente, alturaCabecalho, "D")
+	emitente := []string{cpfCNPJ(evento.CNPJ, evento.CPF)}
+	nome := ""
+	if d.proc != nil {
+		emit := d.nfe.Emit
+		ender := emit.EnderEmit
+		nome = emit.XNome
+		emitente = []string{
+			ender.XLgr + ", " + ender.Nro + " - " + ender.XBairro,
+			ender.XMun + " - " + ender.UF + " - CEP " + cep(ender.CEP),
+			"CNPJ / CPF: " + cpfCNPJ(emit.CNPJ, emit.CPF) + "   IE: " + emit.IE,
+		}
+	}
+	yTexto := y + 5
+	if nome != "" {
+		d.pdf.SetFont("Helvetica", "B", 9)
+		for _, linha := range d.pdf.SplitLines([]byte(d.tr(nome)), wEmitente-2) {
+			d.pdf.SetXY(d.x0+1, yTexto)
+			d.pdf.CellFormat(wEmitente-2, 4, string(linha), "", 0, "C", false, 0, "")
+			yTexto += 4
+		}
+	}
+	d.pdf.SetFont("Helvetica", "", 7)
+	for _, linha := range emitente {
+		d.pdf.SetXY(d.x0+1, yTexto+1)
+		d.pdf.CellFormat(wEmitente-2, 3.2, d.caber(linha, wEmitente-2), "", 0, "C", false, 0, "")
+		yTexto += 3.2
+	}
+
+	x := d.x0 + wEmitente
+	wCarta := d.x0 + d.largura - x
+	d.pdf.Rect(x, y, wCarta, alturaCabecalho, "D")
+	d.pdf.SetFont("Helvetica", "B", 11)
+	d.pdf.SetXY(x, y+2)
+	d.pdf.CellFormat(wCarta, 5, d.tr("CARTA DE CORREÇÃO ELETRÔNICA"), "", 0, "C", false, 0, "")
+	d.pdf.SetFont("Helvetica", "", 7)
+	d.pdf.SetXY(x, y+7)
+	d.pdf.CellFormat(wCarta, 3.5, d.tr("Documento auxiliar do evento 110110 da NF-e"), "", 0, "C", false, 0, "")
+	d.codigoBarras(x+4, y+13, wCarta-8, 14, evento.ChNFe)
+	y += alturaCabecalho
+	y = d.linhaCampos(y, [3]string{"CHAVE DE ACESSO DA NF-E", chaveFormatada(evento.ChNFe), "C"})
+
+	// NF-e corrigida: pelo nfeProc ou, na falta dele, pelos campos da chave
+	numeroNF, serieNF, emissao := "", "", ""
+	if c, err := services.ParseChaveAcesso(evento.ChNFe); err == nil {
+		numeroNF, serieNF = numeroNota(c.NNF), serie(c.Serie)
+	}
+	if d.proc != nil {
+		numeroNF, serieNF = numeroNota(d.nfe.Ide.NNF), serie(d.nfe.Ide.Serie)
+		emissao, _ = dataHora(d.nfe.Ide.DhEmi)
+	}
+	y = d.linhaCamposProporcional(y, []float64{0.3, 0.2, 0.25, 0.25},
+		[3]string{"NÚMERO DA NF-E", numeroNF, "C"},
+		[3]string{"SÉRIE", serieNF, "C"},
+		[3]string{"DATA DA EMISSÃO", emissao, "C"},
+		[3]string{"AMBIENTE", map[string]string{"1": "1 - PRODUÇÃO", "2": "2 - HOMOLOGAÇÃO"}[evento.TpAmb], "C"},
+	)
+	if d.proc != nil {
+		dest := d.nfe.Dest
+		identificacao := cpfCNPJ(dest.CNPJ, dest.CPF)
+		if identificacao == "" {
+			identificacao = dest.IdEstrangeiro
+		}
+		y = d.titulo(y, "DESTINATÁRIO")
+		y = d.linhaCamposProporcional(y, []float64{0.6, 0.25, 0.15},
+			[3]string{"NOME / RAZÃO SOCIAL", dest.XNome, "L"},
+			[3]string{"CNPJ / CPF", identificacao, "L"},
+			[3]string{"UF", dest.EnderDest.UF, "C"},
+		)
+	}
+
+	y = d.titulo(y, "EVENTO")
+	dhEvento, horaEvento := dataHora(evento.DhEvento)
+	dhRegistro, horaRegistro := dataHora(ret.DhRegEvento)
+	y = d.linhaCamposProporcional(y, []float64{0.2, 0.15, 0.2, 0.25, 0.2},
+		[3]string{"TIPO DO EVENTO", evento.TpEvento, "C"},
+		[3]string{"SEQUÊNCIA", evento.NSeqEvento, "C"},
+		[3]string{"DATA/HORA DO EVENTO", strings.TrimSpace(dhEvento + " " + horaEvento), "C"},
+		[3]string{"PROTOCOLO DE REGISTRO", ret.NProt, "C"},
+		[3]string{"DATA/HORA DO REGISTRO", strings.TrimSpace(dhRegistro + " " + horaRegistro), "C"},
+	)
+	y = d.linhaCampos(y, [3]string{"SITUAÇÃO", strings.TrimSpace(ret.CStat + " - " + ret.XMotivo), "L"})
+
+	y = d.titulo(y, "CORREÇÃO")
+	y = d.quadroTexto(y, evento.DetEvento.XCorrecao, 9, 4.2)
+	y = d.titulo(y, "CONDIÇÕES DE USO")
+	d.quadroTexto(y, evento.DetEvento.XCondUso, 7, 3.2)
+}
+
+// Quadro com o texto quebrado em linhas na largura útil, retornando o fim do quadro
+func (d *documento) quadroTexto(y float64, texto string, tamanho, alturaLinhaTexto float64) float64 {
+	d.pdf.SetFont("Helvetica", "", tamanho)
+	var linhas [][]byte
+	for _, paragrafo := range strings.Split(texto, "\n") {
+		linhas = append(linhas, d.pdf.SplitLines([]byte(d.tr(paragrafo)), d.largura-4)...)
+	}
+	altura := float64(len(linhas))*alturaLinhaTexto + 3
+	if y+altura > d.base {
+		altura = d.base - y
+	}
+	d.pdf.Rect(d.x0, y, d.largura, altura, "D")
+	yTexto := y + 1.5
+	for _, linha := range linhas {
+		if yTexto+alturaLinhaTexto > y+altura {
+			break
+		}
+		d.pdf.SetXY(d.x0+2, yTexto)
+		d.pdf.CellFormat(d.largura-4, alturaLinhaTexto, string(linha), "", 0, "L", false, 0, "")
+		yTexto += alturaLinhaTexto
+	}
+	return y + altura
+}
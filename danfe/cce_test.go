@@ -0,0 +1,71 @@
+package danfe
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+func lerCCe(t *testing.T) *services.ProcEventoNFe {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "cce_proc.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := services.ParseProcEventoNFe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proc
+}
+
+func TestGerarCCe(t *testing.T) {
+	casos := []struct {
+		arquivo string
+		nfe     *services.NFeProc
+	}{
+		{"cce.pdf", lerProc(t)},
+		{"cce_sem_nfe.pdf", nil},
+	}
+	for _, c := range casos {
+		t.Run(c.arquivo, func(t *testing.T) {
+			saida := &bytes.Buffer{}
+			if err := GerarCCe(saida, lerCCe(t), c.nfe); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(paginaPDF.FindAll(saida.Bytes(), -1)); n != 1 {
+				t.Fatalf("CC-e com %d páginas, esperada 1", n)
+			}
+			conferirReferencia(t, c.arquivo, saida.Bytes())
+		})
+	}
+}
+
+func TestGerarCCeInvalida(t *testing.T) {
+	outraNota := lerProc(t)
+	outraNota.NFe.InfNFe.Id = "NFe41240706101244000490550010000067271091023595"
+	cancelamento := lerCCe(t)
+	cancelamento.Evento.InfEvento.TpEvento = services.TpEventoCancelamento
+	casos := []struct {
+		nome string
+		proc *services.ProcEventoNFe
+		nfe  *services.NFeProc
+		erro string
+	}{
+		{"sem procEventoNFe", nil, nil, "não informado"},
+		{"outro evento", cancelamento, nil, "não é uma carta de correção"},
+		{"nfeProc de outra chave", lerCCe(t), outraNota, "não corresponde"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			err := GerarCCe(&bytes.Buffer{}, c.proc, c.nfe)
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, c.erro)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package danfe
+
+// Larguras (em módulos) das barras e espaços de cada símbolo do Code 128, alternando
+// barra e espaço a partir da barra. O símbolo de parada tem uma barra final a mais
+var padroesCode128 = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128TrocaC  = 99
+	code128TrocaB  = 100
+	code128InicioB = 104
+	code128InicioC = 105
+	code128Parada  = 106
+)
+
+// Códigos dos símbolos do Code 128 para o texto, incluindo início, verificador e parada.
+// A chave numérica sai inteira no subconjunto C (pares de dígitos), como exige o DANFE;
+// a chave com CNPJ alfanumérico alterna para o subconjunto B nos trechos com letras
+func code128(texto string) []int {
+	digitos := func(i int) int {
+		n := 0
+		for i+n < len(texto) && texto[i+n] >= '0' && texto[i+n] <= '9' {
+			n++
+		}
+		return n
+	}
+
+	var codigos []int
+	subconjuntoC := digitos(0) >= 4
+	if subconjuntoC {
+		codigos = append(codigos, code128InicioC)
+	} else {
+		codigos = append(codigos, code128InicioB)
+	}
+	for i := 0; i < len(texto); {
+		if subconjuntoC {
+			if digitos(i) < 2 {
+				codigos = append(codigos, code128TrocaB)
+				subconjuntoC = false
+				continue
+			}
+			codigos = append(codigos, int(texto[i]-'0')*10+int(texto[i+1]-'0'))
+			i += 2
+			continue
+		}
+		// Trecho numérico longo: volta ao subconjunto C, mantendo um número par de dígitos
+		if n := digitos(i); n >= 4 {
+			if n%2 == 1 {
+				codigos = append(codigos, int(texto[i])-32)
+				i++
+			}
+			codigos = append(codigos, code128TrocaC)
+			subconjuntoC = true
+			continue
+		}
+		codigos = append(codigos, int(texto[i])-32)
+		i++
+	}
+
+	verificador := codigos[0]
+	for i, codigo := range codigos[1:] {
+		verificador += (i + 1) * codigo
+	}
+	return append(codigos, verificador%103, code128Parada)
+}
+
+// Total de módulos dos símbolos, usado para distribuir a largura disponível
+func modulosCode128(codigos []int) int {
+	total := 0
+	for _, codigo := range codigos {
+		for _, largura := range padroesCode128[codigo] {
+			total += int(largura - '0')
+		}
+	}
+	return total
+}
@@ -0,0 +1,395 @@
+// Package danfe gera o Documento Auxiliar da NF-e (DANFE) a partir da nota autorizada.
+//
+// O PDF é desenhado em Go puro, nos formatos retrato e paisagem definidos pelo tpImp,
+// com o código de barras da chave de acesso, o protocolo de autorização e a marca
+// d'água das notas emitidas em homologação. Os itens que não cabem na primeira folha
+// continuam nas seguintes, que repetem o cabeçalho.
+package danfe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Opções de impressão do DANFE
+type Opcoes struct {
+	Logo []byte // Logotipo do emitente em PNG, JPEG ou GIF (opcional)
+}
+
+// Dimensões em milímetros
+const (
+	margem          = 5.0
+	alturaCanhoto   = 17.0
+	alturaCabecalho = 32.0
+	alturaLinha     = 7.0
+	alturaTitulo    = 3.5
+	alturaTopoItens = 6.0
+	linhaItem       = 2.6 // altura de cada linha de texto dos itens
+)
+
+// GerarPDF desenha o DANFE da nota do nfeProc em w. O formato segue o tpImp
+// (2 paisagem; 3 DANFE simplificado em etiqueta; demais retrato)
+func GerarPDF(w io.Writer, proc *services.NFeProc, opcoes Opcoes) error {
+	if proc == nil {
+		return errors.New("nfeProc não informado")
+	}
+	infNFe := proc.NFe.InfNFe
+	if infNFe.Ide.Mod == services.ModeloNFCe {
+		return errors.New("a NFC-e (modelo 65) usa o DANFE NFC-e, não o DANFE da NF-e")
+	}
+	if infNFe.Ide.TpImp == services.TpImpSimplificado {
+		return GerarEtiqueta(w, proc)
+	}
+
+	d := novoDocumento(proc, opcoes)
+	if err := d.carregarLogo(); err != nil {
+		return err
+	}
+	d.paginar()
+	for i := range d.paginas {
+		d.desenharPagina(i)
+	}
+	if err := d.pdf.Error(); err != nil {
+		return fmt.Errorf("erro ao gerar o DANFE: %v", err)
+	}
+	return d.pdf.Output(w)
+}
+
+// Estado do desenho de um DANFE
+type documento struct {
+	pdf      *gofpdf.Fpdf
+	tr       func(string) string // UTF-8 para a codificação das fontes padrão do PDF (cp1252)
+	proc     *services.NFeProc
+	nfe      services.InfNFe
+	opcoes   Opcoes
+	paisagem bool
+	logo     bool
+
+	x0, largura float64 // área útil, após o canhoto na paisagem
+	base        float64 // limite inferior da folha
+	colunas     []coluna
+	paginas     [][]item
+}
+
+// Coluna da tabela de itens
+type coluna struct {
+	rotulo      string
+	largura     float64
+	alinhamento string
+}
+
+// Item com a descrição já quebrada na largura da coluna
+type item struct {
+	det     services.Det
+	linhas  []string
+	altura  float64
+	valores []string
+}
+
+func novoDocumento(proc *services.NFeProc, opcoes Opcoes) *documento {
+	infNFe := proc.NFe.InfNFe
+	paisagem := infNFe.Ide.TpImp == services.TpImpPaisagem
+	orientacao := "P"
+	if paisagem {
+		orientacao = "L"
+	}
+	pdf := gofpdf.New(orientacao, "mm", "A4", "")
+	pdf.SetMargins(margem, margem, margem)
+	pdf.SetAutoPageBreak(false, margem)
+	pdf.SetLineWidth(0.2)
+	fixarDatas(pdf, proc)
+	pdf.SetTitle("DANFE "+strings.TrimPrefix(infNFe.Id, "NFe"), true)
+
+	largura, altura := pdf.GetPageSize()
+	d := &documento{
+		pdf:      pdf,
+		tr:       pdf.UnicodeTranslatorFromDescriptor(""),
+		proc:     proc,
+		nfe:      infNFe,
+		opcoes:   opcoes,
+		paisagem: paisagem,
+		x0:       margem,
+		largura:  largura - 2*margem,
+		base:     altura - margem,
+	}
+	if paisagem {
+		// Canhoto na lateral esquerda
+		d.x0 = margem + alturaCanhoto + 3
+		d.largura = largura - margem - d.x0
+	}
+	d.colunas = d.colunasItens()
+	return d
+}
+
+// Saída determinística: a data do PDF é a da autorização (ou da emissão) e os objetos
+// do catálogo saem em ordem fixa
+func fixarDatas(pdf *gofpdf.Fpdf, proc *services.NFeProc) {
+	fixarData(pdf, proc.ProtNFe.InfProt.DhRecbto, proc.NFe.InfNFe.Ide.DhEmi)
+}
+
+// Usa a primeira data válida entre as informadas
+func fixarData(pdf *gofpdf.Fpdf, datas ...string) {
+	pdf.SetCatalogSort(true)
+	dh := services.DataHora{Time: time.Unix(0, 0).UTC()}
+	for _, data := range datas {
+		if valida, err := services.ParseDataHora(data); err == nil {
+			dh = valida
+			break
+		}
+	}
+	pdf.SetCreationDate(dh.Time)
+	pdf.SetModificationDate(dh.Time)
+}
+
+func (d *documento) carregarLogo() error {
+	if len(d.opcoes.Logo) == 0 {
+		return nil
+	}
+	tipos := map[string]string{"image/png": "PNG", "image/jpeg": "JPG", "image/gif": "GIF"}
+	tipo, ok := tipos[http.DetectContentType(d.opcoes.Logo)]
+	if !ok {
+		return errors.New("formato do logotipo não suportado: use PNG, JPEG ou GIF")
+	}
+	d.pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: tipo}, bytes.NewReader(d.opcoes.Logo))
+	if err := d.pdf.Error(); err != nil {
+		return fmt.Errorf("erro ao carregar o logotipo: %v", err)
+	}
+	d.logo = true
+	return nil
+}
+
+// Colunas da tabela de itens. A descrição ocupa a largura que sobra das demais
+func (d *documento) colunasItens() []coluna {
+	colunas := []coluna{
+		{"CÓDIGO", 14, "L"}, {"DESCRIÇÃO DO PRODUTO / SERVIÇO", 0, "L"}, {"NCM/SH", 12, "C"},
+		{"O/CST", 8, "C"}, {"CFOP", 8, "C"}, {"UN", 8, "C"}, {"QUANT.", 14, "R"},
+		{"VALOR UNIT.", 14, "R"}, {"VALOR TOTAL", 14, "R"}, {"B.CÁLC. ICMS", 13, "R"},
+		{"VALOR ICMS", 11, "R"}, {"VALOR IPI", 10, "R"}, {"ALÍQ. ICMS", 9, "R"}, {"ALÍQ. IPI", 9, "R"},
+	}
+	ocupada := 0.0
+	for _, c := range colunas {
+		ocupada += c.largura
+	}
+	colunas[1].largura = d.largura - ocupada
+	return colunas
+}
+
+// Distribui os itens pelas folhas. A primeira folha tem todos os quadros; as seguintes
+// só o cabeçalho e a tabela de itens
+func (d *documento) paginar() {
+	d.pdf.SetFont("Helvetica", "", 6)
+	primeira := d.base - d.inicioItens(0) - d.alturaAdicionais() - alturaTitulo
+	seguintes := d.base - d.inicioItens(1)
+
+	pagina := []item{}
+	disponivel := primeira
+	for _, det := range d.nfe.Det {
+		it := d.montarItem(det)
+		if it.altura > disponivel && len(pagina) > 0 {
+			d.paginas = append(d.paginas, pagina)
+			pagina = []item{}
+			disponivel = seguintes
+		}
+		pagina = append(pagina, it)
+		disponivel -= it.altura
+	}
+	d.paginas = append(d.paginas, pagina)
+}
+
+func (d *documento) montarItem(det services.Det) item {
+	descricao := det.Prod.XProd
+	if det.InfAdProd != "" {
+		descricao += "\n" + det.InfAdProd
+	}
+	var linhas []string
+	for _, paragrafo := range strings.Split(descricao, "\n") {
+		for _, linha := range d.pdf.SplitLines([]byte(d.tr(paragrafo)), d.colunas[1].largura-1) {
+			linhas = append(linhas, string(linha))
+		}
+	}
+	if len(linhas) == 0 {
+		linhas = []string{""}
+	}
+
+	var icms services.ICMSGrupo
+	var ipi services.IPITrib
+	if imposto := det.Imposto; imposto != nil {
+		if imposto.ICMS != nil {
+			icms = imposto.ICMS.Grupo
+		}
+		if imposto.IPI != nil && imposto.IPI.IPITrib != nil {
+			ipi = *imposto.IPI.IPITrib
+		}
+	}
+	prod := det.Prod
+	return item{
+		det:    det,
+		linhas: linhas,
+		altura: float64(len(linhas))*linhaItem + 1,
+		valores: []string{
+			prod.CProd, "", prod.NCM, cstICMS(det.Imposto), prod.CFOP, prod.UCom,
+			numeroVariavel(prod.QCom, 2, 4), numeroVariavel(prod.VUnCom, 2, 10), moeda(prod.VProd),
+			moeda(icms.VBC), moeda(icms.VICMS), moeda(ipi.VIPI), numero(icms.PICMS, 2), numero(ipi.PIPI, 2),
+		},
+	}
+}
+
+// Posição vertical em que começa a área dos itens (abaixo do cabeçalho da tabela)
+func (d *documento) inicioItens(pagina int) float64 {
+	y := margem
+	if pagina == 0 && !d.paisagem {
+		y += alturaCanhoto + 3
+	}
+	y += alturaCabecalho + 2*alturaLinha
+	if pagina == 0 {
+		y += alturaTitulo + 3*alturaLinha // destinatário
+		y += d.alturaFatura()
+		y += alturaTitulo + 2*alturaLinha // cálculo do imposto
+		if d.nfe.Transp != nil {
+			y += alturaTitulo + 3*alturaLinha
+		}
+	}
+	return y + alturaTitulo + alturaTopoItens
+}
+
+func (d *documento) desenharPagina(pagina int) {
+	d.pdf.AddPage()
+	d.pdf.SetTextColor(0, 0, 0)
+	d.pdf.SetDrawColor(0, 0, 0)
+
+	inicio := d.inicioItens(pagina)
+	fim := d.base
+	if pagina == 0 {
+		fim = d.base - d.alturaAdicionais() - alturaTitulo
+	}
+	d.marcaDagua(inicio, fim)
+
+	y := margem
+	if pagina == 0 {
+		if d.paisagem {
+			d.pdf.TransformBegin()
+			d.pdf.TransformRotate(90, margem, d.base)
+			d.canhoto(margem, d.base, d.base-margem)
+			d.pdf.TransformEnd()
+		} else {
+			d.canhoto(margem, margem, d.largura)
+			y += alturaCanhoto + 3
+		}
+	}
+	y = d.cabecalho(y, pagina)
+	if pagina == 0 {
+		y = d.destinatario(y)
+		y = d.fatura(y)
+		y = d.calculoImposto(y)
+		y = d.transporte(y)
+	}
+	d.itens(y, fim, d.paginas[pagina])
+	if pagina == 0 {
+		d.adicionais(fim)
+	}
+}
+
+// Texto convertido para a codificação da fonte e truncado para caber na largura
+func (d *documento) caber(texto string, largura float64) string {
+	return d.ajustar(d.tr(texto), largura)
+}
+
+// Trunca o texto já convertido para a codificação da fonte
+func (d *documento) ajustar(texto string, largura float64) string {
+	if d.pdf.GetStringWidth(texto) <= largura {
+		return texto
+	}
+	for len(texto) > 0 && d.pdf.GetStringWidth(texto+"...") > largura {
+		texto = texto[:len(texto)-1]
+	}
+	return texto + "..."
+}
+
+// Quadro com rótulo pequeno no topo e o valor na parte de baixo
+func (d *documento) campo(x, y, w, h float64, rotulo, valor, alinhamento string) {
+	d.pdf.Rect(x, y, w, h, "D")
+	d.pdf.SetFont("Helvetica", "", 5)
+	d.pdf.SetXY(x+0.5, y+0.3)
+	d.pdf.CellFormat(w-1, 2.2, d.caber(rotulo, w-1), "", 0, "L", false, 0, "")
+	d.pdf.SetFont("Helvetica", "", 7.5)
+	d.pdf.SetXY(x+0.5, y+h-4)
+	d.pdf.CellFormat(w-1, 3.6, d.caber(valor, w-1), "", 0, alinhamento, false, 0, "")
+}
+
+// Linha de quadros de mesma altura, com as larguras em proporção da largura útil
+func (d *documento) linhaCampos(y float64, campos ...[3]string) float64 {
+	return d.linhaCamposProporcional(y, nil, campos...)
+}
+
+func (d *documento) linhaCamposProporcional(y float64, proporcoes []float64, campos ...[3]string) float64 {
+	x := d.x0
+	for i, c := range campos {
+		w := d.largura / float64(len(campos))
+		if proporcoes != nil {
+			w = d.largura * proporcoes[i]
+		}
+		if i == len(campos)-1 {
+			w = d.x0 + d.largura - x
+		}
+		d.campo(x, y, w, alturaLinha, c[0], c[1], c[2])
+		x += w
+	}
+	return y + alturaLinha
+}
+
+func (d *documento) titulo(y float64, texto string) float64 {
+	d.pdf.SetFont("Helvetica", "B", 6)
+	d.pdf.SetXY(d.x0, y)
+	d.pdf.CellFormat(d.largura, alturaTitulo, d.tr(texto), "", 0, "LM", false, 0, "")
+	return y + alturaTitulo
+}
+
+// "SEM VALOR FISCAL" na área dos itens das notas de homologação, desenhado antes do
+// conteúdo para ficar ao fundo
+func (d *documento) marcaDagua(topo, base float64) {
+	if d.nfe.Ide.TpAmb != "2" {
+		return
+	}
+	cx, cy := d.x0+d.largura/2, (topo+base)/2
+	d.pdf.SetTextColor(210, 210, 210)
+	d.pdf.TransformBegin()
+	d.pdf.TransformRotate(25, cx, cy)
+	// Fonte reduzida quando o texto não cabe na largura (etiqueta)
+	escala := 1.0
+	d.pdf.SetFont("Helvetica", "B", 42)
+	texto := d.tr("SEM VALOR FISCAL")
+	if largura := d.pdf.GetStringWidth(texto); largura > d.largura*0.9 {
+		escala = d.largura * 0.9 / largura
+		d.pdf.SetFont("Helvetica", "B", 42*escala)
+	}
+	d.pdf.Text(cx-d.pdf.GetStringWidth(texto)/2, cy, texto)
+	d.pdf.SetFont("Helvetica", "B", 16*escala)
+	texto = d.tr("AMBIENTE DE HOMOLOGAÇÃO")
+	d.pdf.Text(cx-d.pdf.GetStringWidth(texto)/2, cy+9*escala, texto)
+	d.pdf.TransformEnd()
+	d.pdf.SetTextColor(0, 0, 0)
+}
+
+// Barras do Code 128 ocupando a largura informada
+func (d *documento) codigoBarras(x, y, w, h float64, texto string) {
+	codigos := code128(texto)
+	modulo := w / float64(modulosCode128(codigos))
+	d.pdf.SetFillColor(0, 0, 0)
+	for _, codigo := range codigos {
+		for i, largura := range padroesCode128[codigo] {
+			espessura := float64(largura-'0') * modulo
+			if i%2 == 0 {
+				d.pdf.Rect(x, y, espessura, h, "F")
+			}
+			x += espessura
+		}
+	}
+}
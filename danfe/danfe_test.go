@@ -0,0 +1,122 @@
+package danfe
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Regrava as referências de testdata: go test ./danfe -atualizar
+var atualizar = flag.Bool("atualizar", false, "regrava os arquivos de referência em testdata")
+
+func lerProc(t *testing.T) *services.NFeProc {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "nfeproc.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := services.ParseNFeProc(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proc
+}
+
+// Compara a saída com o arquivo de referência byte a byte
+func conferirReferencia(t *testing.T, arquivo string, obtido []byte) {
+	t.Helper()
+	caminho := filepath.Join("testdata", arquivo)
+	if *atualizar {
+		if err := os.WriteFile(caminho, obtido, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	esperado, err := os.ReadFile(caminho)
+	if err != nil {
+		t.Fatalf("%v (gere as referências com go test ./danfe -atualizar)", err)
+	}
+	if !bytes.Equal(esperado, obtido) {
+		i := 0
+		for i < len(esperado) && i < len(obtido) && esperado[i] == obtido[i] {
+			i++
+		}
+		t.Fatalf("%s diverge da referência a partir do byte %d (%d bytes esperados, %d obtidos)", arquivo, i, len(esperado), len(obtido))
+	}
+}
+
+var paginaPDF = regexp.MustCompile(`/Type /Page\b[^s]`)
+
+func TestGerarPDF(t *testing.T) {
+	logo, err := os.ReadFile(filepath.Join("testdata", "logo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	casos := []struct {
+		arquivo string
+		ajustar func(proc *services.NFeProc)
+		opcoes  Opcoes
+		paginas int
+	}{
+		{arquivo: "danfe_retrato.pdf", paginas: 1},
+		{arquivo: "danfe_paisagem.pdf", paginas: 1, ajustar: func(proc *services.NFeProc) {
+			proc.NFe.InfNFe.Ide.TpImp = services.TpImpPaisagem
+		}},
+		{arquivo: "danfe_paginas.pdf", paginas: 3, ajustar: func(proc *services.NFeProc) {
+			det := proc.NFe.InfNFe.Det
+			for i := len(det); i < 150; i++ {
+				item := det[i%3]
+				item.NItem = strconv.Itoa(i + 1)
+				proc.NFe.InfNFe.Det = append(proc.NFe.InfNFe.Det, item)
+			}
+		}},
+		{arquivo: "danfe_homologacao.pdf", paginas: 1, ajustar: func(proc *services.NFeProc) {
+			proc.NFe.InfNFe.Ide.TpAmb = "2"
+			proc.ProtNFe.InfProt.TpAmb = "2"
+		}},
+		{arquivo: "danfe_logo.pdf", paginas: 1, opcoes: Opcoes{Logo: logo}},
+	}
+	for _, c := range casos {
+		t.Run(c.arquivo, func(t *testing.T) {
+			gerar := func() []byte {
+				proc := lerProc(t)
+				if c.ajustar != nil {
+					c.ajustar(proc)
+				}
+				buf := &bytes.Buffer{}
+				if err := GerarPDF(buf, proc, c.opcoes); err != nil {
+					t.Fatal(err)
+				}
+				return buf.Bytes()
+			}
+			pdf := gerar()
+			if !bytes.Equal(pdf, gerar()) {
+				t.Fatal("saída não determinística")
+			}
+			if n := len(paginaPDF.FindAll(pdf, -1)); n != c.paginas {
+				t.Errorf("%d páginas, esperadas %d", n, c.paginas)
+			}
+			conferirReferencia(t, c.arquivo, pdf)
+		})
+	}
+}
+
+func TestGerarPDFInvalido(t *testing.T) {
+	if err := GerarPDF(&bytes.Buffer{}, nil, Opcoes{}); err == nil {
+		t.Error("esperado erro sem o nfeProc")
+	}
+	proc := lerProc(t)
+	if err := GerarPDF(&bytes.Buffer{}, proc, Opcoes{Logo: []byte("não é imagem")}); err == nil {
+		t.Error("esperado erro com logotipo em formato não suportado")
+	}
+	proc.NFe.InfNFe.Ide.Mod = services.ModeloNFCe
+	if err := GerarPDF(&bytes.Buffer{}, proc, Opcoes{}); err == nil {
+		t.Error("esperado erro para a NFC-e")
+	}
+}
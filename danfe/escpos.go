@@ -0,0 +1,88 @@
+package danfe
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Comandos ESC/POS usados no DANFE NFC-e
+var (
+	escPosInicializar = []byte{0x1B, 0x40}       // ESC @
+	escPosPagina850   = []byte{0x1B, 0x74, 0x02} // ESC t 2: página de código 850
+	escPosCorte       = []byte{0x1D, 0x56, 0x42, 0x03}
+)
+
+// Caracteres acentuados do português na página de código 850
+var pagina850 = map[rune]byte{
+	'á': 0xA0, 'à': 0x85, 'â': 0x83, 'ã': 0xC6, 'ä': 0x84, 'é': 0x82, 'ê': 0x88, 'è': 0x8A,
+	'í': 0xA1, 'ó': 0xA2, 'ô': 0x93, 'õ': 0xE4, 'ö': 0x94, 'ú': 0xA3, 'ü': 0x81, 'ç': 0x87,
+	'Á': 0xB5, 'À': 0xB7, 'Â': 0xB6, 'Ã': 0xC7, 'É': 0x90, 'Ê': 0xD2, 'Í': 0xD6, 'Ó': 0xE0,
+	'Ô': 0xE2, 'Õ': 0xE5, 'Ú': 0xE9, 'Ü': 0x9A, 'Ç': 0x80, 'º': 0xA7, 'ª': 0xA6, '°': 0xF8,
+}
+
+// GerarEscPos escreve em w o DANFE NFC-e como comandos ESC/POS para impressoras térmicas,
+// com o QR Code impresso pelo comando nativo da impressora (GS ( k)
+func GerarEscPos(w io.Writer, proc *services.NFeProc, opcoes OpcoesNFCe) error {
+	c, err := montarCupom(proc, opcoes)
+	if err != nil {
+		return err
+	}
+	modulo := byte(5)
+	if c.colunas < 48 {
+		modulo = 4
+	}
+
+	var b bytes.Buffer
+	b.Write(escPosInicializar)
+	b.Write(escPosPagina850)
+	for _, linha := range c.linhas {
+		alinhamento := map[byte]byte{'L': 0, 'C': 1, 'R': 2}[linha.alinhamento]
+		b.Write([]byte{0x1B, 0x61, alinhamento}) // ESC a n
+		if linha.qrCode != "" {
+			escreverQRCodeEscPos(&b, linha.qrCode, modulo)
+			continue
+		}
+		if linha.negrito {
+			b.Write([]byte{0x1B, 0x45, 0x01}) // ESC E 1
+		}
+		b.Write(texto850(linha.texto))
+		if linha.negrito {
+			b.Write([]byte{0x1B, 0x45, 0x00})
+		}
+		b.WriteByte('\n')
+	}
+	b.Write([]byte{0x1B, 0x64, 0x04}) // ESC d 4: avança 4 linhas antes do corte
+	b.Write(escPosCorte)
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// QR Code modelo 2, correção de erros M, armazenado e impresso pela função 165 do GS ( k
+func escreverQRCodeEscPos(b *bytes.Buffer, conteudo string, modulo byte) {
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00}) // modelo 2
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, modulo})     // tamanho do módulo
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 0x31})       // nível M
+	tamanho := len(conteudo) + 3
+	b.Write([]byte{0x1D, 0x28, 0x6B, byte(tamanho % 256), byte(tamanho / 256), 0x31, 0x50, 0x30})
+	b.WriteString(conteudo)
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30}) // impressão
+	b.WriteByte('\n')
+}
+
+// Converte o texto para a página de código 850; caracteres sem equivalente saem como '?'
+func texto850(texto string) []byte {
+	saida := make([]byte, 0, len(texto))
+	for _, r := range texto {
+		switch {
+		case r < 0x80:
+			saida = append(saida, byte(r))
+		case pagina850[r] != 0:
+			saida = append(saida, pagina850[r])
+		default:
+			saida = append(saida, '?')
+		}
+	}
+	return saida
+}
@@ -0,0 +1,147 @@
+package danfe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Dimensões da etiqueta do DANFE simplificado, em milímetros
+const (
+	larguraEtiqueta = 100.0
+	alturaEtiqueta  = 150.0
+	margemEtiqueta  = 3.0
+)
+
+// GerarEtiqueta desenha o DANFE simplificado em formato de etiqueta (NT 2020.004), usado
+// nas remessas do comércio eletrônico: chave com código de barras, protocolo,
+// emitente, destinatário, valor total e os itens que couberem na etiqueta
+func GerarEtiqueta(w io.Writer, proc *services.NFeProc) error {
+	if proc == nil {
+		return errors.New("nfeProc não informado")
+	}
+	inf := proc.NFe.InfNFe
+	if inf.Ide.Mod == services.ModeloNFCe {
+		return errors.New("a NFC-e (modelo 65) usa o DANFE NFC-e, não o DANFE simplificado")
+	}
+
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           gofpdf.SizeType{Wd: larguraEtiqueta, Ht: alturaEtiqueta},
+	})
+	pdf.SetMargins(margemEtiqueta, margemEtiqueta, margemEtiqueta)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetLineWidth(0.2)
+	fixarDatas(pdf, proc)
+	pdf.SetTitle("DANFE Simplificado "+strings.TrimPrefix(inf.Id, "NFe"), true)
+	d := &documento{
+		pdf:     pdf,
+		tr:      pdf.UnicodeTranslatorFromDescriptor(""),
+		proc:    proc,
+		nfe:     inf,
+		x0:      margemEtiqueta,
+		largura: larguraEtiqueta - 2*margemEtiqueta,
+		base:    alturaEtiqueta - margemEtiqueta,
+	}
+	pdf.AddPage()
+	d.marcaDagua(margemEtiqueta, d.base)
+	d.etiqueta()
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("erro ao gerar o DANFE simplificado: %v", err)
+	}
+	return pdf.Output(w)
+}
+
+func (d *documento) etiqueta() {
+	ide := d.nfe.Ide
+	emit := d.nfe.Emit
+	dest := d.nfe.Dest
+	chave := strings.TrimPrefix(d.nfe.Id, "NFe")
+	y := margemEtiqueta
+
+	d.pdf.SetFont("Helvetica", "B", 9)
+	d.pdf.SetXY(d.x0, y)
+	d.pdf.CellFormat(d.largura, 5, "DANFE SIMPLIFICADO - ETIQUETA", "1", 0, "CM", false, 0, "")
+	y += 5
+
+	d.pdf.Rect(d.x0, y, d.largura, 16, "D")
+	d.codigoBarras(d.x0+3, y+2, d.largura-6, 12, chave)
+	y += 16
+	d.campo(d.x0, y, d.largura, alturaLinha, "CHAVE DE ACESSO", chaveFormatada(chave), "C")
+	y += alturaLinha
+
+	prot := d.proc.ProtNFe.InfProt
+	autorizacao := ""
+	if prot.DhRecbto != "" {
+		data, hora := dataHora(prot.DhRecbto)
+		autorizacao = data + " " + hora
+	}
+	y = d.linhaCamposProporcional(y, []float64{0.55, 0.45},
+		[3]string{"PROTOCOLO DE AUTORIZAÇÃO DE USO", prot.NProt, "C"},
+		[3]string{"DATA/HORA DA AUTORIZAÇÃO", autorizacao, "C"},
+	)
+	tipo := "1 - SAÍDA"
+	if ide.TpNF == "0" {
+		tipo = "0 - ENTRADA"
+	}
+	emissao, _ := dataHora(ide.DhEmi)
+	y = d.linhaCamposProporcional(y, []float64{0.25, 0.3, 0.15, 0.3},
+		[3]string{"TIPO", tipo, "C"},
+		[3]string{"NÚMERO", numeroNota(ide.NNF), "C"},
+		[3]string{"SÉRIE", serie(ide.Serie), "C"},
+		[3]string{"DATA DA EMISSÃO", emissao, "C"},
+	)
+
+	y = d.titulo(y, "EMITENTE")
+	y = d.linhaCampos(y, [3]string{"NOME / RAZÃO SOCIAL", emit.XNome, "L"})
+	y = d.linhaCamposProporcional(y, []float64{0.45, 0.4, 0.15},
+		[3]string{"CNPJ / CPF", cpfCNPJ(emit.CNPJ, emit.CPF), "L"},
+		[3]string{"INSCRIÇÃO ESTADUAL", emit.IE, "L"},
+		[3]string{"UF", emit.EnderEmit.UF, "C"},
+	)
+
+	ender := dest.EnderDest
+	endereco := ""
+	if ender.XLgr != "" {
+		endereco = ender.XLgr + ", " + ender.Nro + " - " + ender.XBairro + " - " + ender.XMun + " - CEP " + cep(ender.CEP)
+	}
+	identificacao := cpfCNPJ(dest.CNPJ, dest.CPF)
+	if identificacao == "" {
+		identificacao = dest.IdEstrangeiro
+	}
+	y = d.titulo(y, "DESTINATÁRIO")
+	y = d.linhaCampos(y, [3]string{"NOME / RAZÃO SOCIAL", dest.XNome, "L"})
+	y = d.linhaCamposProporcional(y, []float64{0.45, 0.4, 0.15},
+		[3]string{"CNPJ / CPF", identificacao, "L"},
+		[3]string{"INSCRIÇÃO ESTADUAL", dest.IE, "L"},
+		[3]string{"UF", ender.UF, "C"},
+	)
+	y = d.linhaCampos(y, [3]string{"ENDEREÇO", endereco, "L"})
+	y = d.linhaCampos(y, [3]string{"VALOR TOTAL DA NOTA", "R$ " + moeda(d.nfe.Total.ICMSTot.VNF), "R"})
+
+	// Itens enquanto couberem; os demais são indicados pela quantidade
+	y = d.titulo(y, "PRODUTOS")
+	d.pdf.Rect(d.x0, y, d.largura, d.base-y, "D")
+	d.pdf.SetFont("Helvetica", "", 6)
+	y += 0.5
+	for i, det := range d.nfe.Det {
+		if y+linhaItem > d.base || (i < len(d.nfe.Det)-1 && y+2*linhaItem > d.base) {
+			restantes := fmt.Sprintf("... e mais %d itens (relação completa no XML da NF-e)", len(d.nfe.Det)-i)
+			d.pdf.SetXY(d.x0+0.5, y)
+			d.pdf.CellFormat(d.largura-1, linhaItem, d.caber(restantes, d.largura-1), "", 0, "L", false, 0, "")
+			break
+		}
+		prod := det.Prod
+		valores := fmt.Sprintf("%s %s  %s", numeroVariavel(prod.QCom, 0, 4), prod.UCom, moeda(prod.VProd))
+		wValores := d.pdf.GetStringWidth(d.tr(valores)) + 1
+		d.pdf.SetXY(d.x0+0.5, y)
+		d.pdf.CellFormat(d.largura-wValores-1, linhaItem, d.caber(prod.CProd+" "+prod.XProd, d.largura-wValores-1), "", 0, "L", false, 0, "")
+		d.pdf.CellFormat(wValores, linhaItem, d.tr(valores), "", 0, "R", false, 0, "")
+		y += linhaItem
+	}
+}
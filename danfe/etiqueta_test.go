@@ -0,0 +1,68 @@
+package danfe
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+func TestGerarEtiqueta(t *testing.T) {
+	casos := []struct {
+		arquivo string
+		ajustar func(proc *services.NFeProc)
+	}{
+		{arquivo: "etiqueta.pdf"},
+		{arquivo: "etiqueta_homologacao.pdf", ajustar: func(proc *services.NFeProc) {
+			proc.NFe.InfNFe.Ide.TpAmb = "2"
+			proc.ProtNFe.InfProt.TpAmb = "2"
+		}},
+		// Itens além do espaço da etiqueta são resumidos em "... e mais N itens", sem nova página
+		{arquivo: "etiqueta_itens.pdf", ajustar: func(proc *services.NFeProc) {
+			det := proc.NFe.InfNFe.Det
+			for i := len(det); i < 60; i++ {
+				item := det[i%3]
+				item.NItem = strconv.Itoa(i + 1)
+				proc.NFe.InfNFe.Det = append(proc.NFe.InfNFe.Det, item)
+			}
+		}},
+	}
+	for _, c := range casos {
+		t.Run(c.arquivo, func(t *testing.T) {
+			gerar := func() []byte {
+				proc := lerProc(t)
+				if c.ajustar != nil {
+					c.ajustar(proc)
+				}
+				buf := &bytes.Buffer{}
+				if err := GerarEtiqueta(buf, proc); err != nil {
+					t.Fatal(err)
+				}
+				return buf.Bytes()
+			}
+			pdf := gerar()
+			if !bytes.Equal(pdf, gerar()) {
+				t.Fatal("saída não determinística")
+			}
+			if n := len(paginaPDF.FindAll(pdf, -1)); n != 1 {
+				t.Errorf("%d páginas, esperada 1", n)
+			}
+			if !bytes.Contains(pdf, []byte("/MediaBox [0 0 283.46 425.20]")) {
+				t.Error("página fora do tamanho da etiqueta (100 x 150 mm)")
+			}
+			conferirReferencia(t, c.arquivo, pdf)
+		})
+	}
+}
+
+func TestGerarEtiquetaInvalida(t *testing.T) {
+	if err := GerarEtiqueta(&bytes.Buffer{}, nil); err == nil {
+		t.Error("esperado erro sem o nfeProc")
+	}
+	proc := lerProc(t)
+	proc.NFe.InfNFe.Ide.Mod = services.ModeloNFCe
+	if err := GerarEtiqueta(&bytes.Buffer{}, proc); err == nil {
+		t.Error("esperado erro para a NFC-e")
+	}
+}
@@ -0,0 +1,158 @@
+package danfe
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Número com separador de milhar e vírgula decimal (1.234,56)
+func numero(valor float64, casas int) string {
+	texto := strconv.FormatFloat(math.Abs(valor), 'f', casas, 64)
+	inteiro, decimal := texto, ""
+	if i := strings.IndexByte(texto, '.'); i >= 0 {
+		inteiro, decimal = texto[:i], texto[i+1:]
+	}
+	var b strings.Builder
+	if valor < 0 && strings.Trim(texto, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range inteiro {
+		if i > 0 && (len(inteiro)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	if decimal != "" {
+		b.WriteByte(',')
+		b.WriteString(decimal)
+	}
+	return b.String()
+}
+
+func moeda(valor float64) string {
+	return numero(valor, 2)
+}
+
+// Valor com ao menos minimo casas decimais, mostrando as demais só quando significativas
+// (valores unitários e quantidades têm até 10 e 4 casas no leiaute)
+func numeroVariavel(valor float64, minimo, maximo int) string {
+	texto := strconv.FormatFloat(valor, 'f', maximo, 64)
+	casas := maximo
+	for casas > minimo && texto[len(texto)-1] == '0' {
+		texto = texto[:len(texto)-1]
+		casas--
+	}
+	return numero(valor, casas)
+}
+
+// Valor decimal informado como texto no XML (duplicatas, volumes)
+func numeroTexto(valor string, casas int) string {
+	if valor == "" {
+		return ""
+	}
+	v, err := strconv.ParseFloat(valor, 64)
+	if err != nil {
+		return valor
+	}
+	return numero(v, casas)
+}
+
+// CNPJ (numérico ou alfanumérico) ou CPF com a pontuação usual
+func cpfCNPJ(cnpj, cpf string) string {
+	switch {
+	case len(cnpj) == 14:
+		return cnpj[0:2] + "." + cnpj[2:5] + "." + cnpj[5:8] + "/" + cnpj[8:12] + "-" + cnpj[12:14]
+	case cnpj != "":
+		return cnpj
+	case len(cpf) == 11:
+		return cpf[0:3] + "." + cpf[3:6] + "." + cpf[6:9] + "-" + cpf[9:11]
+	}
+	return cpf
+}
+
+func cep(valor string) string {
+	if len(valor) == 8 {
+		return valor[:5] + "-" + valor[5:]
+	}
+	return valor
+}
+
+// Chave de acesso em grupos de 4 caracteres, como impressa no DANFE
+func chaveFormatada(chave string) string {
+	var grupos []string
+	for i := 0; i < len(chave); i += 4 {
+		fim := i + 4
+		if fim > len(chave) {
+			fim = len(chave)
+		}
+		grupos = append(grupos, chave[i:fim])
+	}
+	return strings.Join(grupos, " ")
+}
+
+// Número da nota com 9 dígitos agrupados de 3 em 3 (000.000.123)
+func numeroNota(nNF string) string {
+	n := nNF
+	if len(n) < 9 {
+		n = strings.Repeat("0", 9-len(n)) + n
+	}
+	if len(n) != 9 {
+		return nNF
+	}
+	return n[0:3] + "." + n[3:6] + "." + n[6:9]
+}
+
+func serie(valor string) string {
+	if len(valor) < 3 {
+		return strings.Repeat("0", 3-len(valor)) + valor
+	}
+	return valor
+}
+
+// Data (DD/MM/AAAA) e hora (hh:mm:ss) locais de um campo AAAA-MM-DDThh:mm:ssTZD
+func dataHora(valor string) (data string, hora string) {
+	dh, err := services.ParseDataHora(valor)
+	if err != nil {
+		return valor, ""
+	}
+	return dh.Format("02/01/2006"), dh.Format("15:04:05")
+}
+
+// Data no formato AAAA-MM-DD (vencimento das duplicatas) como DD/MM/AAAA
+func data(valor string) string {
+	if len(valor) == 10 && valor[4] == '-' && valor[7] == '-' {
+		return valor[8:10] + "/" + valor[5:7] + "/" + valor[0:4]
+	}
+	return valor
+}
+
+// Descrição da modalidade do frete (modFrete)
+func modalidadeFrete(modFrete string) string {
+	descricoes := map[string]string{
+		"0": "0-Por conta do Remetente",
+		"1": "1-Por conta do Destinatário",
+		"2": "2-Por conta de Terceiros",
+		"3": "3-Próprio por conta do Remetente",
+		"4": "4-Próprio por conta do Destinatário",
+		"9": "9-Sem Ocorrência de Transporte",
+	}
+	if descricao, ok := descricoes[modFrete]; ok {
+		return descricao
+	}
+	return modFrete
+}
+
+// Situação tributária do ICMS do item: origem seguida do CST ou do CSOSN
+func cstICMS(imposto *services.Imposto) string {
+	if imposto == nil || imposto.ICMS == nil {
+		return ""
+	}
+	grupo := imposto.ICMS.Grupo
+	if grupo.CSOSN != "" {
+		return grupo.Orig + grupo.CSOSN
+	}
+	return grupo.Orig + grupo.CST
+}
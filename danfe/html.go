@@ -0,0 +1,226 @@
+package danfe
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Dados já formatados para o modelo HTML
+type previa struct {
+	Avisos       []string // faixas de destaque: rascunho, rejeição, homologação
+	Autorizada   bool
+	Chave        string
+	Numero       string
+	Serie        string
+	Modelo       string
+	Emissao      string
+	TipoNF       string
+	NatOp        string
+	Protocolo    string
+	Emitente     parte
+	Destinatario parte
+	Itens        []itemPrevia
+	Totais       [][2]string
+	Transporte   [][2]string
+	Duplicatas   [][2]string
+	Adicionais   []string
+}
+
+type parte struct {
+	Nome, Documento, IE, Endereco string
+}
+
+type itemPrevia struct {
+	Numero, Codigo, Descricao, NCM, CST, CFOP, Unidade, Quantidade, ValorUnitario, ValorTotal string
+}
+
+// GerarHTML escreve em w uma pré-visualização do DANFE em HTML a partir da NFe, inclusive de
+// rascunhos não assinados ou rejeitados. prot é o protocolo da SEFAZ, ou nil se a nota ainda
+// não foi transmitida; qualquer situação diferente de autorizada é destacada como sem valor fiscal
+func GerarHTML(w io.Writer, nfe *services.NFe, prot *services.InfProt) error {
+	if nfe == nil {
+		return errors.New("NFe não informada")
+	}
+	return modeloHTML.Execute(w, montarPrevia(nfe, prot))
+}
+
+func montarPrevia(nfe *services.NFe, prot *services.InfProt) previa {
+	inf := nfe.InfNFe
+	ide := inf.Ide
+	p := previa{
+		Chave:  chaveFormatada(strings.TrimPrefix(inf.Id, "NFe")),
+		Numero: numeroNota(ide.NNF),
+		Serie:  serie(ide.Serie),
+		Modelo: ide.Mod,
+		NatOp:  ide.NatOp,
+		TipoNF: "1 - Saída",
+		Emitente: parte{
+			Nome:      inf.Emit.XNome,
+			Documento: cpfCNPJ(inf.Emit.CNPJ, inf.Emit.CPF),
+			IE:        inf.Emit.IE,
+			Endereco:  endereco(inf.Emit.EnderEmit.XLgr, inf.Emit.EnderEmit.Nro, inf.Emit.EnderEmit.XBairro, inf.Emit.EnderEmit.XMun, inf.Emit.EnderEmit.UF, inf.Emit.EnderEmit.CEP),
+		},
+		Destinatario: parte{
+			Nome:      inf.Dest.XNome,
+			Documento: cpfCNPJ(inf.Dest.CNPJ, inf.Dest.CPF),
+			IE:        inf.Dest.IE,
+			Endereco:  endereco(inf.Dest.EnderDest.XLgr, inf.Dest.EnderDest.Nro, inf.Dest.EnderDest.XBairro, inf.Dest.EnderDest.XMun, inf.Dest.EnderDest.UF, inf.Dest.EnderDest.CEP),
+		},
+	}
+	if p.Chave == "" {
+		p.Chave = "(chave de acesso ainda não gerada)"
+	}
+	if ide.TpNF == "0" {
+		p.TipoNF = "0 - Entrada"
+	}
+	emissao, hora := dataHora(ide.DhEmi)
+	p.Emissao = strings.TrimSpace(emissao + " " + hora)
+
+	switch {
+	case prot == nil && nfe.Signature == nil:
+		p.Avisos = append(p.Avisos, "RASCUNHO - NOTA NÃO ASSINADA - SEM VALOR FISCAL")
+	case prot == nil:
+		p.Avisos = append(p.Avisos, "PRÉ-VISUALIZAÇÃO - NOTA NÃO TRANSMITIDA À SEFAZ - SEM VALOR FISCAL")
+	case prot.CStat == "100" || prot.CStat == "150":
+		p.Autorizada = true
+		recebimento, hora := dataHora(prot.DhRecbto)
+		p.Protocolo = strings.TrimSpace(prot.NProt + " - " + recebimento + " " + hora)
+	case prot.CStat == "110" || prot.CStat == "301" || prot.CStat == "302" || prot.CStat == "303":
+		p.Avisos = append(p.Avisos, "USO DENEGADO - "+prot.CStat+" - "+prot.XMotivo)
+		p.Protocolo = prot.NProt
+	default:
+		p.Avisos = append(p.Avisos, "NOTA REJEITADA - "+prot.CStat+" - "+prot.XMotivo+" - SEM VALOR FISCAL")
+	}
+	if ide.TpAmb == "2" {
+		p.Avisos = append(p.Avisos, "EMITIDA EM AMBIENTE DE HOMOLOGAÇÃO - SEM VALOR FISCAL")
+	}
+
+	for _, det := range inf.Det {
+		prod := det.Prod
+		descricao := prod.XProd
+		if det.InfAdProd != "" {
+			descricao += " - " + det.InfAdProd
+		}
+		p.Itens = append(p.Itens, itemPrevia{
+			Numero: det.NItem, Codigo: prod.CProd, Descricao: descricao, NCM: prod.NCM,
+			CST: cstICMS(det.Imposto), CFOP: prod.CFOP, Unidade: prod.UCom,
+			Quantidade: numeroVariavel(prod.QCom, 2, 4), ValorUnitario: numeroVariavel(prod.VUnCom, 2, 10),
+			ValorTotal: moeda(prod.VProd),
+		})
+	}
+
+	tot := inf.Total.ICMSTot
+	p.Totais = [][2]string{
+		{"Base de cálculo do ICMS", moeda(tot.VBC)}, {"Valor do ICMS", moeda(tot.VICMS)},
+		{"Base de cálculo ICMS ST", moeda(tot.VBSCST)}, {"Valor do ICMS ST", moeda(tot.VST)},
+		{"Valor total dos produtos", moeda(tot.VProd)}, {"Valor do frete", moeda(tot.VFrete)},
+		{"Valor do seguro", moeda(tot.VSeg)}, {"Desconto", moeda(tot.VDesc)},
+		{"Outras despesas", moeda(tot.VOutro)}, {"Valor do IPI", moeda(tot.VIPI)},
+		{"Valor aproximado dos tributos", moeda(tot.VTotTrib)}, {"Valor total da nota", moeda(tot.VNF)},
+	}
+	if t := inf.Transp; t != nil {
+		p.Transporte = append(p.Transporte, [2]string{"Modalidade do frete", modalidadeFrete(t.ModFrete)})
+		if t.Transporta.XNome != "" {
+			p.Transporte = append(p.Transporte,
+				[2]string{"Transportador", t.Transporta.XNome},
+				[2]string{"CNPJ / CPF", cpfCNPJ(t.Transporta.CNPJ, t.Transporta.CPF)})
+		}
+		for _, vol := range t.Vol {
+			p.Transporte = append(p.Transporte, [2]string{"Volumes", strings.TrimSpace(vol.QVol + " " + vol.Esp)})
+		}
+	}
+	if c := inf.Cobr; c != nil {
+		for _, dup := range c.Dup {
+			p.Duplicatas = append(p.Duplicatas, [2]string{dup.NDup + " - " + data(dup.DVenc), numeroTexto(dup.VDup, 2)})
+		}
+	}
+	if a := inf.InfAdic; a != nil {
+		if a.InfAdFisco != "" {
+			p.Adicionais = append(p.Adicionais, "Inf. Fisco: "+a.InfAdFisco)
+		}
+		if a.InfCpl != "" {
+			p.Adicionais = append(p.Adicionais, a.InfCpl)
+		}
+		for _, obs := range a.ObsCont {
+			p.Adicionais = append(p.Adicionais, obs.XCampo+": "+obs.XTexto)
+		}
+	}
+	return p
+}
+
+func endereco(xLgr, nro, xBairro, xMun, uf, cepEndereco string) string {
+	if xLgr == "" {
+		return ""
+	}
+	return xLgr + ", " + nro + " - " + xBairro + " - " + xMun + "/" + uf + " - CEP " + cep(cepEndereco)
+}
+
+var modeloHTML = template.Must(template.New("danfe").Parse(`<!DOCTYPE html>
+<html lang="pt-BR">
+<head>
+<meta charset="utf-8">
+<title>DANFE {{.Numero}} - Série {{.Serie}}</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; font-size: 12px; margin: 16px; }
+.aviso { background: #fde2e2; border: 2px solid #c0392b; color: #c0392b; font-weight: bold; padding: 8px; margin-bottom: 8px; text-align: center; }
+.rascunho { position: fixed; top: 40%; left: 0; right: 0; text-align: center; font-size: 72px; color: rgba(192, 57, 43, 0.12); transform: rotate(-25deg); pointer-events: none; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 8px; }
+th, td { border: 1px solid #444; padding: 3px 5px; vertical-align: top; }
+th { background: #eee; font-size: 10px; text-align: left; }
+h2 { font-size: 12px; margin: 10px 0 4px; }
+.valor { text-align: right; white-space: nowrap; }
+</style>
+</head>
+<body>
+{{range .Avisos}}<div class="aviso">{{.}}</div>
+{{end}}{{if not .Autorizada}}<div class="rascunho">SEM VALOR FISCAL</div>
+{{end}}<table>
+<tr><th>DANFE - Documento Auxiliar da Nota Fiscal Eletrônica</th><th>Número</th><th>Série</th><th>Modelo</th><th>Tipo</th></tr>
+<tr><td>{{.Emitente.Nome}}<br>{{.Emitente.Endereco}}</td><td>{{.Numero}}</td><td>{{.Serie}}</td><td>{{.Modelo}}</td><td>{{.TipoNF}}</td></tr>
+</table>
+<table>
+<tr><th>Chave de acesso</th><th>Protocolo de autorização de uso</th></tr>
+<tr><td>{{.Chave}}</td><td>{{.Protocolo}}</td></tr>
+<tr><th>Natureza da operação</th><th>Data de emissão</th></tr>
+<tr><td>{{.NatOp}}</td><td>{{.Emissao}}</td></tr>
+</table>
+<table>
+<tr><th>Emitente - CNPJ / CPF</th><th>Inscrição estadual</th></tr>
+<tr><td>{{.Emitente.Documento}}</td><td>{{.Emitente.IE}}</td></tr>
+</table>
+<h2>Destinatário / Remetente</h2>
+<table>
+<tr><th>Nome / Razão social</th><th>CNPJ / CPF</th><th>Inscrição estadual</th></tr>
+<tr><td>{{.Destinatario.Nome}}</td><td>{{.Destinatario.Documento}}</td><td>{{.Destinatario.IE}}</td></tr>
+<tr><th colspan="3">Endereço</th></tr>
+<tr><td colspan="3">{{.Destinatario.Endereco}}</td></tr>
+</table>
+{{if .Duplicatas}}<h2>Fatura / Duplicatas</h2>
+<table>
+<tr><th>Duplicata - vencimento</th><th class="valor">Valor</th></tr>
+{{range .Duplicatas}}<tr><td>{{index . 0}}</td><td class="valor">{{index . 1}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Cálculo do imposto</h2>
+<table>
+{{range .Totais}}<tr><th>{{index . 0}}</th><td class="valor">{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Transporte}}<h2>Transportador / Volumes</h2>
+<table>
+{{range .Transporte}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Dados dos produtos / serviços</h2>
+<table>
+<tr><th>#</th><th>Código</th><th>Descrição</th><th>NCM/SH</th><th>O/CST</th><th>CFOP</th><th>UN</th><th class="valor">Quant.</th><th class="valor">Valor unit.</th><th class="valor">Valor total</th></tr>
+{{range .Itens}}<tr><td>{{.Numero}}</td><td>{{.Codigo}}</td><td>{{.Descricao}}</td><td>{{.NCM}}</td><td>{{.CST}}</td><td>{{.CFOP}}</td><td>{{.Unidade}}</td><td class="valor">{{.Quantidade}}</td><td class="valor">{{.ValorUnitario}}</td><td class="valor">{{.ValorTotal}}</td></tr>
+{{end}}</table>
+{{if .Adicionais}}<h2>Dados adicionais</h2>
+<table>
+{{range .Adicionais}}<tr><td>{{.}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
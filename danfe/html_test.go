@@ -0,0 +1,105 @@
+package danfe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+func TestGerarHTML(t *testing.T) {
+	const (
+		rascunho     = `<div class="aviso">RASCUNHO - NOTA NÃO ASSINADA - SEM VALOR FISCAL</div>`
+		naoEnviada   = `<div class="aviso">PRÉ-VISUALIZAÇÃO - NOTA NÃO TRANSMITIDA À SEFAZ - SEM VALOR FISCAL</div>`
+		rejeitada    = `<div class="aviso">NOTA REJEITADA - 225 - Rejeição: Falha no Schema XML da NFe - SEM VALOR FISCAL</div>`
+		denegada     = `<div class="aviso">USO DENEGADO - 302 - Uso Denegado: Irregularidade fiscal do destinatário</div>`
+		homologacao  = `<div class="aviso">EMITIDA EM AMBIENTE DE HOMOLOGAÇÃO - SEM VALOR FISCAL</div>`
+		marcaDagua   = `<div class="rascunho">SEM VALOR FISCAL</div>`
+		rejeicao     = "Rejeição: Falha no Schema XML da NFe"
+		denegacao    = "Uso Denegado: Irregularidade fiscal do destinatário"
+		semProtocolo = "<tr><td>4126 1011 2223 3300 0181 5500 1000 0045 2111 2345 6786</td><td></td></tr>"
+	)
+	casos := []struct {
+		nome      string
+		arquivo   string // referência em testdata, quando houver
+		ajustar   func(nfe *services.NFe, prot *services.InfProt) *services.InfProt
+		avisos    []string
+		marca     bool
+		protocolo string
+	}{
+		{"autorizada", "danfe_autorizada.html", func(_ *services.NFe, prot *services.InfProt) *services.InfProt {
+			return prot
+		}, nil, false, "<td>141260001234567 - 15/10/2026 09:31:12</td>"},
+		{"rascunho", "danfe_rascunho.html", func(nfe *services.NFe, _ *services.InfProt) *services.InfProt {
+			nfe.Signature = nil
+			return nil
+		}, []string{rascunho}, true, semProtocolo},
+		{"não transmitida", "", func(*services.NFe, *services.InfProt) *services.InfProt {
+			return nil
+		}, []string{naoEnviada}, true, semProtocolo},
+		{"rejeitada", "danfe_rejeitada.html", func(_ *services.NFe, prot *services.InfProt) *services.InfProt {
+			return &services.InfProt{TpAmb: prot.TpAmb, ChNFe: prot.ChNFe, DhRecbto: prot.DhRecbto, CStat: "225", XMotivo: rejeicao}
+		}, []string{rejeitada}, true, semProtocolo},
+		{"denegada", "", func(_ *services.NFe, prot *services.InfProt) *services.InfProt {
+			prot.CStat, prot.XMotivo = "302", denegacao
+			return prot
+		}, []string{denegada}, true, "<td>141260001234567</td>"},
+		{"homologação", "danfe_homologacao.html", func(nfe *services.NFe, prot *services.InfProt) *services.InfProt {
+			nfe.InfNFe.Ide.TpAmb, prot.TpAmb = "2", "2"
+			return prot
+		}, []string{homologacao}, false, "<td>141260001234567 - 15/10/2026 09:31:12</td>"},
+		{"rejeitada em homologação", "", func(nfe *services.NFe, prot *services.InfProt) *services.InfProt {
+			nfe.InfNFe.Ide.TpAmb = "2"
+			return &services.InfProt{TpAmb: "2", CStat: "225", XMotivo: rejeicao}
+		}, []string{rejeitada, homologacao}, true, semProtocolo},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			proc := lerProc(t)
+			prot := c.ajustar(&proc.NFe, &proc.ProtNFe.InfProt)
+			buf := &bytes.Buffer{}
+			if err := GerarHTML(buf, &proc.NFe, prot); err != nil {
+				t.Fatal(err)
+			}
+			html := buf.String()
+
+			// Faixas de aviso na ordem, e nenhuma outra
+			if n := strings.Count(html, `<div class="aviso">`); n != len(c.avisos) {
+				t.Errorf("%d faixas de aviso, esperadas %d", n, len(c.avisos))
+			}
+			fim := 0
+			for _, aviso := range c.avisos {
+				i := strings.Index(html[fim:], aviso)
+				if i < 0 {
+					t.Fatalf("faixa ausente ou fora de ordem: %s", aviso)
+				}
+				fim += i + len(aviso)
+			}
+			if strings.Contains(html, marcaDagua) != c.marca {
+				t.Errorf("marca d'água SEM VALOR FISCAL presente = %v, esperado %v", !c.marca, c.marca)
+			}
+			if !strings.Contains(html, c.protocolo) {
+				t.Errorf("protocolo esperado %s", c.protocolo)
+			}
+			if c.arquivo != "" {
+				conferirReferencia(t, c.arquivo, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestGerarHTMLEscape(t *testing.T) {
+	proc := lerProc(t)
+	proc.NFe.InfNFe.Dest.XNome = `<script>alert("x")</script> & CIA`
+	buf := &bytes.Buffer{}
+	if err := GerarHTML(buf, &proc.NFe, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<script>") || !strings.Contains(buf.String(), "&lt;script&gt;") {
+		t.Fatal("dados da nota inseridos no HTML sem escape")
+	}
+	if err := GerarHTML(&bytes.Buffer{}, nil, nil); err == nil {
+		t.Fatal("esperado erro sem a NFe")
+	}
+}
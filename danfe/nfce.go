@@ -0,0 +1,328 @@
+package danfe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jung-kurt/gofpdf"
+	"rsc.io/qr"
+)
+
+// Opções de impressão do DANFE NFC-e
+type OpcoesNFCe struct {
+	LarguraPapel int // Largura da bobina em mm: 80 (padrão) ou 58
+}
+
+// Colunas de texto por largura de bobina, na fonte padrão das impressoras térmicas
+var colunasBobina = map[int]int{80: 48, 58: 32}
+
+// Descrição dos meios de pagamento (tPag)
+var meiosPagamento = map[string]string{
+	"01": "Dinheiro",
+	"02": "Cheque",
+	"03": "Cartão de Crédito",
+	"04": "Cartão de Débito",
+	"05": "Crédito Loja",
+	"10": "Vale Alimentação",
+	"11": "Vale Refeição",
+	"12": "Vale Presente",
+	"13": "Vale Combustível",
+	"15": "Boleto Bancário",
+	"16": "Depósito Bancário",
+	"17": "PIX",
+	"18": "Transferência bancária",
+	"19": "Programa de fidelidade",
+	"90": "Sem pagamento",
+	"99": "Outros",
+}
+
+// Linha do cupom: texto já quebrado na largura da bobina ou o QR Code
+type linhaCupom struct {
+	texto       string
+	alinhamento byte // 'L', 'C' ou 'R'
+	negrito     bool
+	qrCode      string // conteúdo do QR Code, impresso no lugar do texto
+}
+
+// Leiaute do DANFE NFC-e em colunas de caracteres, comum à saída ESC/POS e ao PDF
+type cupom struct {
+	colunas int
+	linhas  []linhaCupom
+}
+
+func (c *cupom) texto(texto string, alinhamento byte, negrito bool) {
+	for _, linha := range quebrarTexto(texto, c.colunas) {
+		c.linhas = append(c.linhas, linhaCupom{texto: linha, alinhamento: alinhamento, negrito: negrito})
+	}
+}
+
+// Texto à esquerda e valor à direita na mesma linha
+func (c *cupom) duasColunas(esquerda, direita string, negrito bool) {
+	espaco := c.colunas - utf8.RuneCountInString(direita) - 1
+	if espaco < 1 {
+		c.texto(esquerda, 'L', negrito)
+		c.texto(direita, 'R', negrito)
+		return
+	}
+	linhas := quebrarTexto(esquerda, espaco)
+	for i, linha := range linhas {
+		if i == len(linhas)-1 {
+			linha += strings.Repeat(" ", c.colunas-utf8.RuneCountInString(linha)-utf8.RuneCountInString(direita)) + direita
+		}
+		c.linhas = append(c.linhas, linhaCupom{texto: linha, alinhamento: 'L', negrito: negrito})
+	}
+}
+
+func (c *cupom) separador() {
+	c.linhas = append(c.linhas, linhaCupom{texto: strings.Repeat("-", c.colunas), alinhamento: 'L'})
+}
+
+// Quebra o texto por palavras na largura em caracteres; palavras maiores que a linha são cortadas
+func quebrarTexto(texto string, largura int) []string {
+	var linhas []string
+	linha := ""
+	for _, palavra := range strings.Fields(texto) {
+		for utf8.RuneCountInString(palavra) > largura {
+			if linha != "" {
+				linhas = append(linhas, linha)
+				linha = ""
+			}
+			runas := []rune(palavra)
+			linhas = append(linhas, string(runas[:largura]))
+			palavra = string(runas[largura:])
+		}
+		switch {
+		case linha == "":
+			linha = palavra
+		case utf8.RuneCountInString(linha)+1+utf8.RuneCountInString(palavra) <= largura:
+			linha += " " + palavra
+		default:
+			linhas = append(linhas, linha)
+			linha = palavra
+		}
+	}
+	if linha != "" || len(linhas) == 0 {
+		linhas = append(linhas, linha)
+	}
+	return linhas
+}
+
+// Monta o DANFE NFC-e na ordem das divisões do Manual de Padrões Técnicos do DANFE NFC-e
+func montarCupom(proc *services.NFeProc, opcoes OpcoesNFCe) (*cupom, error) {
+	if proc == nil {
+		return nil, errors.New("nfeProc não informado")
+	}
+	nfe := proc.NFe
+	inf := nfe.InfNFe
+	if inf.Ide.Mod != services.ModeloNFCe {
+		return nil, fmt.Errorf("o DANFE NFC-e é exclusivo do modelo 65, a nota é modelo %s", inf.Ide.Mod)
+	}
+	if nfe.InfNFeSupl == nil || nfe.InfNFeSupl.QrCode == "" {
+		return nil, errors.New("a NFC-e não possui o grupo infNFeSupl com o QR Code")
+	}
+	largura := opcoes.LarguraPapel
+	if largura == 0 {
+		largura = 80
+	}
+	colunas, ok := colunasBobina[largura]
+	if !ok {
+		return nil, fmt.Errorf("largura de bobina não suportada: %dmm (use 80 ou 58)", largura)
+	}
+	c := &cupom{colunas: colunas}
+	ide := inf.Ide
+	emit := inf.Emit
+	tot := inf.Total.ICMSTot
+
+	// Emitente
+	c.texto(emit.XNome, 'C', true)
+	c.texto("CNPJ: "+cpfCNPJ(emit.CNPJ, emit.CPF)+" IE: "+emit.IE, 'C', false)
+	ender := emit.EnderEmit
+	c.texto(ender.XLgr+", "+ender.Nro+" - "+ender.XBairro+" - "+ender.XMun+" - "+ender.UF, 'C', false)
+	c.texto("Documento Auxiliar da Nota Fiscal de Consumidor Eletrônica", 'C', true)
+	c.separador()
+
+	// Itens
+	c.texto("# CÓDIGO DESCRIÇÃO", 'L', true)
+	c.duasColunas("QTD. UN. X VL. UNIT.", "VL. TOTAL", true)
+	for _, det := range inf.Det {
+		prod := det.Prod
+		nItem := det.NItem
+		if len(nItem) < 3 {
+			nItem = strings.Repeat("0", 3-len(nItem)) + nItem
+		}
+		c.texto(nItem+" "+prod.CProd+" "+prod.XProd, 'L', false)
+		c.duasColunas(numeroVariavel(prod.QCom, 0, 4)+" "+prod.UCom+" X "+numeroVariavel(prod.VUnCom, 2, 10), moeda(prod.VProd), false)
+	}
+	c.separador()
+
+	// Totais e pagamento
+	c.duasColunas("Qtde. total de itens", fmt.Sprint(len(inf.Det)), false)
+	c.duasColunas("Valor total R$", moeda(tot.VProd), false)
+	if tot.VDesc > 0 {
+		c.duasColunas("Desconto R$", moeda(tot.VDesc), false)
+	}
+	if acrescimos := tot.VFrete + tot.VSeg + tot.VOutro; acrescimos > 0 {
+		c.duasColunas("Acréscimos R$", moeda(acrescimos), false)
+	}
+	c.duasColunas("Valor a Pagar R$", moeda(tot.VNF), true)
+	c.duasColunas("FORMA PAGAMENTO", "VALOR PAGO R$", true)
+	if inf.Pag != nil {
+		for _, det := range inf.Pag.DetPag {
+			meio, ok := meiosPagamento[det.TPag]
+			if !ok {
+				meio = det.TPag
+			}
+			c.duasColunas(meio, numeroTexto(det.VPag, 2), false)
+		}
+		if inf.Pag.VTroco != "" {
+			c.duasColunas("Troco R$", numeroTexto(inf.Pag.VTroco, 2), false)
+		}
+	}
+	c.separador()
+
+	// Tributos aproximados (Lei 12.741/2012)
+	c.duasColunas("Informação dos Tributos Totais Incidentes (Lei Federal 12.741/2012) R$", moeda(tot.VTotTrib), false)
+	c.separador()
+
+	// Mensagens de contingência e de homologação
+	if ide.TpEmis == "9" {
+		c.texto("EMITIDA EM CONTINGÊNCIA", 'C', true)
+		c.texto("Pendente de autorização", 'C', false)
+	}
+	if ide.TpAmb == "2" {
+		c.texto("EMITIDA EM AMBIENTE DE HOMOLOGAÇÃO - SEM VALOR FISCAL", 'C', true)
+	}
+
+	// Consulta pela chave
+	chave := strings.TrimPrefix(inf.Id, "NFe")
+	c.texto("Consulte pela Chave de Acesso em", 'C', true)
+	c.texto(nfe.InfNFeSupl.UrlChave, 'C', false)
+	c.texto(chaveFormatada(chave), 'C', false)
+	c.separador()
+
+	// Consumidor
+	dest := inf.Dest
+	switch {
+	case dest.CNPJ != "" || dest.CPF != "":
+		c.texto(strings.TrimSpace("CONSUMIDOR - CNPJ/CPF "+cpfCNPJ(dest.CNPJ, dest.CPF)+" "+dest.XNome), 'C', true)
+	case dest.IdEstrangeiro != "":
+		c.texto(strings.TrimSpace("CONSUMIDOR - Id. Estrangeiro "+dest.IdEstrangeiro+" "+dest.XNome), 'C', true)
+	default:
+		c.texto("CONSUMIDOR NÃO IDENTIFICADO", 'C', true)
+	}
+	if dest.EnderDest.XLgr != "" {
+		ender := dest.EnderDest
+		c.texto(ender.XLgr+", "+ender.Nro+" - "+ender.XBairro+" - "+ender.XMun+" - "+ender.UF, 'C', false)
+	}
+	c.separador()
+
+	// Identificação e autorização
+	data, hora := dataHora(ide.DhEmi)
+	c.texto("NFC-e nº "+numeroNota(ide.NNF)+" Série "+serie(ide.Serie)+" "+data+" "+hora, 'C', true)
+	prot := proc.ProtNFe.InfProt
+	if prot.NProt != "" {
+		c.texto("Protocolo de autorização: "+prot.NProt, 'C', false)
+		data, hora := dataHora(prot.DhRecbto)
+		c.texto("Data de autorização: "+data+" "+hora, 'C', false)
+	} else if ide.TpEmis == "9" {
+		c.texto("Via consumidor", 'C', false)
+	}
+	c.linhas = append(c.linhas, linhaCupom{qrCode: nfe.InfNFeSupl.QrCode, alinhamento: 'C'})
+
+	// Informações complementares
+	if inf.InfAdic != nil && inf.InfAdic.InfCpl != "" {
+		c.separador()
+		c.texto(inf.InfAdic.InfCpl, 'L', false)
+	}
+	return c, nil
+}
+
+// GerarNFCePDF desenha o DANFE NFC-e em PDF na largura da bobina (80mm por padrão), com
+// altura ajustada ao conteúdo e o QR Code desenhado em vetor
+func GerarNFCePDF(w io.Writer, proc *services.NFeProc, opcoes OpcoesNFCe) error {
+	c, err := montarCupom(proc, opcoes)
+	if err != nil {
+		return err
+	}
+	papel := 80.0
+	margemBobina, ladoQRCode := 4.0, 32.0
+	if c.colunas < 48 {
+		papel, margemBobina, ladoQRCode = 58, 5, 28
+	}
+	util := papel - 2*margemBobina
+	// Courier tem largura de 0,6 em: a fonte é dimensionada para caberem as colunas da bobina
+	fonte := util / float64(c.colunas) / 0.6 * 72 / 25.4
+	altura := 3.2
+
+	total := 2 * margemBobina
+	for _, linha := range c.linhas {
+		if linha.qrCode != "" {
+			total += ladoQRCode + 4
+		} else {
+			total += altura
+		}
+	}
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           gofpdf.SizeType{Wd: papel, Ht: total},
+	})
+	pdf.SetMargins(margemBobina, margemBobina, margemBobina)
+	pdf.SetAutoPageBreak(false, 0)
+	fixarDatas(pdf, proc)
+	pdf.SetTitle("DANFE NFC-e "+strings.TrimPrefix(proc.NFe.InfNFe.Id, "NFe"), true)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	y := margemBobina
+	for _, linha := range c.linhas {
+		if linha.qrCode != "" {
+			if err := desenharQRCode(pdf, linha.qrCode, (papel-ladoQRCode)/2, y+2, ladoQRCode); err != nil {
+				return err
+			}
+			y += ladoQRCode + 4
+			continue
+		}
+		estilo := ""
+		if linha.negrito {
+			estilo = "B"
+		}
+		pdf.SetFont("Courier", estilo, fonte)
+		pdf.SetXY(margemBobina, y)
+		pdf.CellFormat(util, altura, tr(linha.texto), "", 0, string(linha.alinhamento), false, 0, "")
+		y += altura
+	}
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("erro ao gerar o DANFE NFC-e: %v", err)
+	}
+	return pdf.Output(w)
+}
+
+// Desenha o QR Code (correção de erros M) como módulos pretos no quadrado de lado informado
+func desenharQRCode(pdf *gofpdf.Fpdf, conteudo string, x, y, lado float64) error {
+	codigo, err := qr.Encode(conteudo, qr.M)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar o QR Code: %v", err)
+	}
+	modulo := lado / float64(codigo.Size)
+	pdf.SetFillColor(0, 0, 0)
+	for linha := 0; linha < codigo.Size; linha++ {
+		// Módulos pretos consecutivos da linha num único retângulo
+		for coluna := 0; coluna < codigo.Size; {
+			if !codigo.Black(coluna, linha) {
+				coluna++
+				continue
+			}
+			inicio := coluna
+			for coluna < codigo.Size && codigo.Black(coluna, linha) {
+				coluna++
+			}
+			pdf.Rect(x+float64(inicio)*modulo, y+float64(linha)*modulo, float64(coluna-inicio)*modulo, modulo, "F")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package danfe
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// NFC-e autorizada (nfeProc) ou emitida em contingência off-line, ainda sem protocolo
+func lerNFCe(t *testing.T, arquivo string) *services.NFeProc {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", arquivo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc, err := services.ParseNFeProc(data); err == nil {
+		return proc
+	}
+	nfe, err := services.ParseNFe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &services.NFeProc{NFe: *nfe}
+}
+
+func TestGerarNFCe(t *testing.T) {
+	casos := []struct {
+		nome     string
+		arquivo  string
+		contem   []string
+		ausentes []string
+	}{
+		{"online", "nfce_online.xml",
+			[]string{"141260009876543", "CONSUMIDOR - CNPJ/CPF", "123.456.789-09", "Troco R$"},
+			[]string{"EMITIDA EM CONTINGÊNCIA"}},
+		{"offline", "nfce_offline.xml",
+			[]string{"EMITIDA EM CONTINGÊNCIA", "Pendente de autorização", "Via consumidor", "CONSUMIDOR NÃO IDENTIFICADO"},
+			[]string{"Protocolo de autorização"}},
+	}
+	for _, c := range casos {
+		for _, largura := range []int{80, 58} {
+			t.Run(fmt.Sprintf("%s_%d", c.nome, largura), func(t *testing.T) {
+				proc := lerNFCe(t, c.arquivo)
+				opcoes := OpcoesNFCe{LarguraPapel: largura}
+
+				cupom, err := montarCupom(proc, opcoes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, linha := range cupom.linhas {
+					if n := utf8.RuneCountInString(linha.texto); n > colunasBobina[largura] {
+						t.Errorf("linha com %d colunas na bobina de %dmm: %q", n, largura, linha.texto)
+					}
+				}
+
+				escPos := &bytes.Buffer{}
+				if err := GerarEscPos(escPos, proc, opcoes); err != nil {
+					t.Fatal(err)
+				}
+				for _, texto := range c.contem {
+					if !bytes.Contains(escPos.Bytes(), texto850(texto)) {
+						t.Errorf("ESC/POS sem %q", texto)
+					}
+				}
+				for _, texto := range c.ausentes {
+					if bytes.Contains(escPos.Bytes(), texto850(texto)) {
+						t.Errorf("ESC/POS com %q", texto)
+					}
+				}
+				if !bytes.Contains(escPos.Bytes(), []byte(proc.NFe.InfNFeSupl.QrCode)) {
+					t.Error("ESC/POS sem o conteúdo do QR Code")
+				}
+				conferirReferencia(t, fmt.Sprintf("nfce_%s_%d.escpos", c.nome, largura), escPos.Bytes())
+
+				gerarPDF := func() []byte {
+					pdf := &bytes.Buffer{}
+					if err := GerarNFCePDF(pdf, proc, opcoes); err != nil {
+						t.Fatal(err)
+					}
+					return pdf.Bytes()
+				}
+				pdf := gerarPDF()
+				if !bytes.Equal(pdf, gerarPDF()) {
+					t.Fatal("PDF não determinístico")
+				}
+				conferirReferencia(t, fmt.Sprintf("nfce_%s_%d.pdf", c.nome, largura), pdf)
+			})
+		}
+	}
+}
+
+func TestGerarNFCeInvalida(t *testing.T) {
+	proc := lerNFCe(t, "nfce_online.xml")
+	if err := GerarEscPos(&bytes.Buffer{}, proc, OpcoesNFCe{LarguraPapel: 76}); err == nil {
+		t.Error("esperado erro com largura de bobina não suportada")
+	}
+	proc.NFe.InfNFeSupl = nil
+	if err := GerarNFCePDF(&bytes.Buffer{}, proc, OpcoesNFCe{}); err == nil {
+		t.Error("esperado erro sem o infNFeSupl")
+	}
+	if err := GerarEscPos(&bytes.Buffer{}, lerProc(t), OpcoesNFCe{}); err == nil {
+		t.Error("esperado erro para a NF-e modelo 55")
+	}
+}
@@ -0,0 +1,411 @@
+package danfe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Altura do quadro de dados adicionais, só na primeira folha
+func (d *documento) alturaAdicionais() float64 {
+	return 25
+}
+
+// Comprovante de entrega destacável. Na paisagem é desenhado com o sistema de
+// coordenadas girado, ocupando a lateral esquerda da folha
+func (d *documento) canhoto(x, y, w float64) {
+	ide := d.nfe.Ide
+	emissao, _ := dataHora(ide.DhEmi)
+	lateral := 40.0
+
+	d.pdf.Rect(x, y, w-lateral, alturaCanhoto/2, "D")
+	d.pdf.SetFont("Helvetica", "", 6)
+	d.pdf.SetXY(x+0.5, y+0.5)
+	texto := fmt.Sprintf("RECEBEMOS DE %s OS PRODUTOS E/OU SERVIÇOS CONSTANTES DA NOTA FISCAL ELETRÔNICA INDICADA AO LADO. "+
+		"EMISSÃO: %s VALOR TOTAL: R$ %s DESTINATÁRIO: %s", d.nfe.Emit.XNome, emissao, moeda(d.nfe.Total.ICMSTot.VNF), d.nfe.Dest.XNome)
+	linhas := d.pdf.SplitLines([]byte(d.tr(texto)), w-lateral-1)
+	for i, linha := range linhas {
+		if i == 3 {
+			break
+		}
+		d.pdf.SetXY(x+0.5, y+0.5+float64(i)*2.5)
+		d.pdf.CellFormat(w-lateral-1, 2.5, string(linha), "", 0, "L", false, 0, "")
+	}
+	d.campo(x, y+alturaCanhoto/2, 40, alturaCanhoto/2, "DATA DE RECEBIMENTO", "", "L")
+	d.campo(x+40, y+alturaCanhoto/2, w-lateral-40, alturaCanhoto/2, "IDENTIFICAÇÃO E ASSINATURA DO RECEBEDOR", "", "L")
+
+	d.pdf.Rect(x+w-lateral, y, lateral, alturaCanhoto, "D")
+	d.pdf.SetFont("Helvetica", "B", 10)
+	d.pdf.SetXY(x+w-lateral, y+2)
+	d.pdf.CellFormat(lateral, 4, "NF-e", "", 2, "C", false, 0, "")
+	d.pdf.SetFont("Helvetica", "B", 8)
+	d.pdf.CellFormat(lateral, 4, d.tr("Nº "+numeroNota(ide.NNF)), "", 2, "C", false, 0, "")
+	d.pdf.CellFormat(lateral, 4, d.tr("SÉRIE "+serie(ide.Serie)), "", 2, "C", false, 0, "")
+
+	d.pdf.SetDashPattern([]float64{1, 1}, 0)
+	d.pdf.Line(x, y+alturaCanhoto+1.5, x+w, y+alturaCanhoto+1.5)
+	d.pdf.SetDashPattern([]float64{}, 0)
+}
+
+// Quadros de identificação do emitente, do DANFE e da chave de acesso, seguidos da
+// natureza da operação, do protocolo e das inscrições do emitente
+func (d *documento) cabecalho(y float64, pagina int) float64 {
+	ide := d.nfe.Ide
+	emit := d.nfe.Emit
+	wEmitente := d.largura * 0.40
+	wDanfe := d.largura * 0.16
+	wChave := d.largura - wEmitente - wDanfe
+
+	// Emitente
+	x := d.x0
+	d.pdf.Rect(x, y, wEmitente, alturaCabecalho, "D")
+	texto := x + 1
+	if d.logo {
+		info := d.pdf.GetImageInfo("logo")
+		h := alturaCabecalho - 4
+		w := h * info.Width() / info.Height()
+		if w > wEmitente*0.4 {
+			w = wEmitente * 0.4
+			h = w * info.Height() / info.Width()
+		}
+		d.pdf.ImageOptions("logo", x+1, y+(alturaCabecalho-h)/2, w, h, false, gofpdf.ImageOptions{}, 0, "")
+		texto += w + 1
+	}
+	wTexto := x + wEmitente - texto - 1
+	d.pdf.SetFont("Helvetica", "B", 9)
+	linhas := d.pdf.SplitLines([]byte(d.tr(emit.XNome)), wTexto)
+	if len(linhas) > 2 {
+		linhas = linhas[:2]
+	}
+	yTexto := y + 4
+	for _, linha := range linhas {
+		d.pdf.SetXY(texto, yTexto)
+		d.pdf.CellFormat(wTexto, 4, string(linha), "", 0, "C", false, 0, "")
+		yTexto += 4
+	}
+	ender := emit.EnderEmit
+	logradouro := ender.XLgr + ", " + ender.Nro
+	if ender.XCpl != "" {
+		logradouro += " - " + ender.XCpl
+	}
+	endereco := []string{
+		logradouro,
+		ender.XBairro + " - CEP " + cep(ender.CEP),
+		ender.XMun + " - " + ender.UF,
+	}
+	if ender.Fone != "" {
+		endereco = append(endereco, "Fone: "+ender.Fone)
+	}
+	d.pdf.SetFont("Helvetica", "", 7)
+	for _, linha := range endereco {
+		d.pdf.SetXY(texto, yTexto+1)
+		d.pdf.CellFormat(wTexto, 3.2, d.caber(linha, wTexto), "", 0, "C", false, 0, "")
+		yTexto += 3.2
+	}
+
+	// DANFE
+	x += wEmitente
+	d.pdf.Rect(x, y, wDanfe, alturaCabecalho, "D")
+	d.pdf.SetFont("Helvetica", "B", 12)
+	d.pdf.SetXY(x, y+1.5)
+	d.pdf.CellFormat(wDanfe, 5, "DANFE", "", 2, "C", false, 0, "")
+	d.pdf.SetFont("Helvetica", "", 6)
+	for _, linha := range []string{"Documento Auxiliar da", "Nota Fiscal Eletrônica"} {
+		d.pdf.SetX(x)
+		d.pdf.CellFormat(wDanfe, 2.6, d.tr(linha), "", 2, "C", false, 0, "")
+	}
+	d.pdf.SetXY(x+2, y+14)
+	d.pdf.CellFormat(wDanfe-10, 2.6, "0 - ENTRADA", "", 2, "L", false, 0, "")
+	d.pdf.SetX(x + 2)
+	d.pdf.CellFormat(wDanfe-10, 2.6, d.tr("1 - SAÍDA"), "", 0, "L", false, 0, "")
+	d.pdf.SetFont("Helvetica", "B", 10)
+	d.pdf.SetXY(x+wDanfe-7, y+13.7)
+	d.pdf.CellFormat(5, 5, ide.TpNF, "1", 0, "C", false, 0, "")
+	d.pdf.SetFont("Helvetica", "B", 8)
+	d.pdf.SetXY(x, y+21)
+	d.pdf.CellFormat(wDanfe, 3.5, d.tr("Nº "+numeroNota(ide.NNF)), "", 2, "C", false, 0, "")
+	d.pdf.SetX(x)
+	d.pdf.CellFormat(wDanfe, 3.5, d.tr("SÉRIE "+serie(ide.Serie)), "", 2, "C", false, 0, "")
+	d.pdf.SetFont("Helvetica", "", 7)
+	d.pdf.SetX(x)
+	d.pdf.CellFormat(wDanfe, 3.5, fmt.Sprintf("FOLHA %d/%d", pagina+1, len(d.paginas)), "", 0, "C", false, 0, "")
+
+	// Código de barras e chave de acesso
+	x += wDanfe
+	chave := strings.TrimPrefix(d.nfe.Id, "NFe")
+	d.pdf.Rect(x, y, wChave, 13, "D")
+	d.codigoBarras(x+4, y+1.5, wChave-8, 10, chave)
+	d.campo(x, y+13, wChave, alturaLinha, "CHAVE DE ACESSO", chaveFormatada(chave), "C")
+	d.pdf.Rect(x, y+13+alturaLinha, wChave, alturaCabecalho-13-alturaLinha, "D")
+	d.pdf.SetFont("Helvetica", "", 7)
+	consulta := "Consulta de autenticidade no portal nacional da NF-e www.nfe.fazenda.gov.br/portal ou no site da Sefaz Autorizadora"
+	yConsulta := y + 13 + alturaLinha + 2
+	for _, linha := range d.pdf.SplitLines([]byte(d.tr(consulta)), wChave-2) {
+		d.pdf.SetXY(x+1, yConsulta)
+		d.pdf.CellFormat(wChave-2, 3, string(linha), "", 0, "C", false, 0, "")
+		yConsulta += 3
+	}
+	y += alturaCabecalho
+
+	prot := d.proc.ProtNFe.InfProt
+	protocolo := prot.NProt
+	if prot.DhRecbto != "" {
+		data, hora := dataHora(prot.DhRecbto)
+		protocolo = strings.TrimSpace(protocolo + " - " + data + " " + hora)
+	}
+	y = d.linhaCamposProporcional(y, []float64{0.6, 0.4},
+		[3]string{"NATUREZA DA OPERAÇÃO", ide.NatOp, "L"},
+		[3]string{"PROTOCOLO DE AUTORIZAÇÃO DE USO", protocolo, "C"},
+	)
+	return d.linhaCampos(y,
+		[3]string{"INSCRIÇÃO ESTADUAL", emit.IE, "L"},
+		[3]string{"INSCRIÇÃO ESTADUAL DO SUBST. TRIBUTÁRIO", emit.IEST, "L"},
+		[3]string{"CNPJ / CPF", cpfCNPJ(emit.CNPJ, emit.CPF), "L"},
+	)
+}
+
+func (d *documento) destinatario(y float64) float64 {
+	dest := d.nfe.Dest
+	ender := dest.EnderDest
+	emissao, _ := dataHora(d.nfe.Ide.DhEmi)
+	logradouro := strings.TrimSpace(ender.XLgr + ", " + ender.Nro)
+	if ender.XLgr == "" {
+		logradouro = ""
+	} else if ender.XCpl != "" {
+		logradouro += " - " + ender.XCpl
+	}
+	identificacao := cpfCNPJ(dest.CNPJ, dest.CPF)
+	if identificacao == "" {
+		identificacao = dest.IdEstrangeiro
+	}
+
+	y = d.titulo(y, "DESTINATÁRIO / REMETENTE")
+	y = d.linhaCamposProporcional(y, []float64{0.6, 0.22, 0.18},
+		[3]string{"NOME / RAZÃO SOCIAL", dest.XNome, "L"},
+		[3]string{"CNPJ / CPF", identificacao, "C"},
+		[3]string{"DATA DA EMISSÃO", emissao, "C"},
+	)
+	y = d.linhaCamposProporcional(y, []float64{0.47, 0.25, 0.1, 0.18},
+		[3]string{"ENDEREÇO", logradouro, "L"},
+		[3]string{"BAIRRO / DISTRITO", ender.XBairro, "L"},
+		[3]string{"CEP", cep(ender.CEP), "C"},
+		[3]string{"DATA DA SAÍDA/ENTRADA", "", "C"},
+	)
+	return d.linhaCamposProporcional(y, []float64{0.37, 0.2, 0.05, 0.2, 0.18},
+		[3]string{"MUNICÍPIO", ender.XMun, "L"},
+		[3]string{"FONE / FAX", ender.Fone, "L"},
+		[3]string{"UF", ender.UF, "C"},
+		[3]string{"INSCRIÇÃO ESTADUAL", dest.IE, "L"},
+		[3]string{"HORA DA SAÍDA/ENTRADA", "", "C"},
+	)
+}
+
+// Duplicatas por linha do quadro de fatura
+func (d *documento) duplicatasPorLinha() int {
+	if d.paisagem {
+		return 8
+	}
+	return 6
+}
+
+func (d *documento) alturaFatura() float64 {
+	cobr := d.nfe.Cobr
+	if cobr == nil {
+		return 0
+	}
+	linhas := (len(cobr.Dup) + d.duplicatasPorLinha() - 1) / d.duplicatasPorLinha()
+	if cobr.Fat.NFat != "" || cobr.Fat.VLiq != "" {
+		linhas++
+	}
+	if linhas == 0 {
+		return 0
+	}
+	return alturaTitulo + float64(linhas)*alturaLinha
+}
+
+func (d *documento) fatura(y float64) float64 {
+	cobr := d.nfe.Cobr
+	if d.alturaFatura() == 0 {
+		return y
+	}
+	y = d.titulo(y, "FATURA / DUPLICATAS")
+	if cobr.Fat.NFat != "" || cobr.Fat.VLiq != "" {
+		y = d.linhaCampos(y,
+			[3]string{"NÚMERO DA FATURA", cobr.Fat.NFat, "L"},
+			[3]string{"VALOR ORIGINAL", numeroTexto(cobr.Fat.VOrig, 2), "R"},
+			[3]string{"VALOR DO DESCONTO", numeroTexto(cobr.Fat.VDesc, 2), "R"},
+			[3]string{"VALOR LÍQUIDO", numeroTexto(cobr.Fat.VLiq, 2), "R"},
+		)
+	}
+	porLinha := d.duplicatasPorLinha()
+	w := d.largura / float64(porLinha)
+	for i, dup := range cobr.Dup {
+		x := d.x0 + float64(i%porLinha)*w
+		linha := y + float64(i/porLinha)*alturaLinha
+		d.campo(x, linha, w, alturaLinha, "DUPLICATA "+dup.NDup+" - VENC. "+data(dup.DVenc), "R$ "+numeroTexto(dup.VDup, 2), "R")
+	}
+	return y + float64((len(cobr.Dup)+porLinha-1)/porLinha)*alturaLinha
+}
+
+func (d *documento) calculoImposto(y float64) float64 {
+	tot := d.nfe.Total.ICMSTot
+	y = d.titulo(y, "CÁLCULO DO IMPOSTO")
+	y = d.linhaCampos(y,
+		[3]string{"BASE DE CÁLC. DO ICMS", moeda(tot.VBC), "R"},
+		[3]string{"VALOR DO ICMS", moeda(tot.VICMS), "R"},
+		[3]string{"BASE DE CÁLC. ICMS S.T.", moeda(tot.VBSCST), "R"},
+		[3]string{"VALOR DO ICMS SUBST.", moeda(tot.VST), "R"},
+		[3]string{"V. IMP. IMPORTAÇÃO", moeda(tot.VII), "R"},
+		[3]string{"V. APROX. DOS TRIBUTOS", moeda(tot.VTotTrib), "R"},
+		[3]string{"VALOR TOTAL DOS PRODUTOS", moeda(tot.VProd), "R"},
+	)
+	return d.linhaCampos(y,
+		[3]string{"VALOR DO FRETE", moeda(tot.VFrete), "R"},
+		[3]string{"VALOR DO SEGURO", moeda(tot.VSeg), "R"},
+		[3]string{"DESCONTO", moeda(tot.VDesc), "R"},
+		[3]string{"OUTRAS DESPESAS", moeda(tot.VOutro), "R"},
+		[3]string{"VALOR TOTAL DO IPI", moeda(tot.VIPI), "R"},
+		[3]string{"VALOR DO PIS / COFINS", moeda(tot.VPIS + tot.VCOFINS), "R"},
+		[3]string{"VALOR TOTAL DA NOTA", moeda(tot.VNF), "R"},
+	)
+}
+
+func (d *documento) transporte(y float64) float64 {
+	transp := d.nfe.Transp
+	if transp == nil {
+		return y
+	}
+	t := transp.Transporta
+
+	// Volumes somados; a espécie só é impressa quando é a mesma em todos
+	var quantidade int
+	var pesoL, pesoB float64
+	especie := ""
+	for i, vol := range transp.Vol {
+		q, _ := strconv.Atoi(vol.QVol)
+		quantidade += q
+		l, _ := strconv.ParseFloat(vol.PesoL, 64)
+		b, _ := strconv.ParseFloat(vol.PesoB, 64)
+		pesoL += l
+		pesoB += b
+		if i == 0 {
+			especie = vol.Esp
+		} else if vol.Esp != especie {
+			especie = "DIVERSOS"
+		}
+	}
+	qVol, pesoLiquido, pesoBruto := "", "", ""
+	if len(transp.Vol) > 0 {
+		qVol = strconv.Itoa(quantidade)
+		pesoLiquido = numero(pesoL, 3)
+		pesoBruto = numero(pesoB, 3)
+	}
+
+	y = d.titulo(y, "TRANSPORTADOR / VOLUMES TRANSPORTADOS")
+	y = d.linhaCamposProporcional(y, []float64{0.32, 0.2, 0.1, 0.1, 0.05, 0.23},
+		[3]string{"NOME / RAZÃO SOCIAL", t.XNome, "L"},
+		[3]string{"FRETE POR CONTA", modalidadeFrete(transp.ModFrete), "L"},
+		[3]string{"CÓDIGO ANTT", "", "C"},
+		[3]string{"PLACA DO VEÍCULO", "", "C"},
+		[3]string{"UF", "", "C"},
+		[3]string{"CNPJ / CPF", cpfCNPJ(t.CNPJ, t.CPF), "C"},
+	)
+	y = d.linhaCamposProporcional(y, []float64{0.42, 0.3, 0.05, 0.23},
+		[3]string{"ENDEREÇO", t.XEnder, "L"},
+		[3]string{"MUNICÍPIO", t.XMun, "L"},
+		[3]string{"UF", t.UF, "C"},
+		[3]string{"INSCRIÇÃO ESTADUAL", t.IE, "L"},
+	)
+	return d.linhaCampos(y,
+		[3]string{"QUANTIDADE", qVol, "R"},
+		[3]string{"ESPÉCIE", especie, "L"},
+		[3]string{"MARCA", "", "L"},
+		[3]string{"NUMERAÇÃO", "", "L"},
+		[3]string{"PESO BRUTO", pesoBruto, "R"},
+		[3]string{"PESO LÍQUIDO", pesoLiquido, "R"},
+	)
+}
+
+// Tabela de itens da folha, de y até fim
+func (d *documento) itens(y, fim float64, itens []item) {
+	y = d.titulo(y, "DADOS DOS PRODUTOS / SERVIÇOS")
+	d.pdf.Rect(d.x0, y, d.largura, fim-y, "D")
+	d.pdf.Line(d.x0, y+alturaTopoItens, d.x0+d.largura, y+alturaTopoItens)
+
+	d.pdf.SetFont("Helvetica", "", 5)
+	x := d.x0
+	for i, c := range d.colunas {
+		if i > 0 {
+			d.pdf.Line(x, y, x, fim)
+		}
+		d.pdf.SetXY(x, y)
+		d.pdf.CellFormat(c.largura, alturaTopoItens, d.caber(c.rotulo, c.largura-0.6), "", 0, "CM", false, 0, "")
+		x += c.largura
+	}
+	y += alturaTopoItens
+
+	d.pdf.SetFont("Helvetica", "", 6)
+	for _, it := range itens {
+		x := d.x0
+		for i, c := range d.colunas {
+			if i == 1 {
+				for n, linha := range it.linhas {
+					d.pdf.SetXY(x+0.5, y+0.5+float64(n)*linhaItem)
+					d.pdf.CellFormat(c.largura-1, linhaItem, linha, "", 0, "L", false, 0, "")
+				}
+			} else {
+				d.pdf.SetXY(x+0.3, y+0.5)
+				d.pdf.CellFormat(c.largura-0.6, linhaItem, d.caber(it.valores[i], c.largura-0.6), "", 0, c.alinhamento, false, 0, "")
+			}
+			x += c.largura
+		}
+		y += it.altura
+		d.pdf.SetDrawColor(200, 200, 200)
+		d.pdf.Line(d.x0, y, d.x0+d.largura, y)
+		d.pdf.SetDrawColor(0, 0, 0)
+	}
+}
+
+// Informações complementares e quadro reservado ao fisco, a partir de y
+func (d *documento) adicionais(y float64) {
+	var textos []string
+	if d.nfe.Ide.TpAmb == "2" {
+		textos = append(textos, "NF-E EMITIDA EM AMBIENTE DE HOMOLOGAÇÃO - SEM VALOR FISCAL")
+	}
+	if adic := d.nfe.InfAdic; adic != nil {
+		if adic.InfAdFisco != "" {
+			textos = append(textos, "Inf. Contribuinte: "+adic.InfAdFisco)
+		}
+		if adic.InfCpl != "" {
+			textos = append(textos, adic.InfCpl)
+		}
+		for _, obs := range adic.ObsCont {
+			textos = append(textos, obs.XCampo+": "+obs.XTexto)
+		}
+	}
+
+	y = d.titulo(y, "DADOS ADICIONAIS")
+	altura := d.alturaAdicionais()
+	wInf := d.largura * 0.65
+	d.campo(d.x0, y, wInf, altura, "INFORMAÇÕES COMPLEMENTARES", "", "L")
+	d.campo(d.x0+wInf, y, d.largura-wInf, altura, "RESERVADO AO FISCO", "", "L")
+
+	d.pdf.SetFont("Helvetica", "", 6)
+	maximo := int((altura - 3.5) / linhaItem)
+	var linhas []string
+	for _, texto := range textos {
+		for _, linha := range d.pdf.SplitLines([]byte(d.tr(texto)), wInf-1) {
+			linhas = append(linhas, string(linha))
+		}
+	}
+	if len(linhas) > maximo {
+		linhas = linhas[:maximo]
+		linhas[maximo-1] = d.ajustar(linhas[maximo-1]+" ...", wInf-1)
+	}
+	for i, linha := range linhas {
+		d.pdf.SetXY(d.x0+0.5, y+3+float64(i)*linhaItem)
+		d.pdf.CellFormat(wInf-1, linhaItem, linha, "", 0, "L", false, 0, "")
+	}
+}
@@ -3,11 +3,14 @@ module github.com/eugustavokeller/nfe-go
 go 1.23.1
 
 require (
-	github.com/beevik/etree v1.1.0 // indirect
-	github.com/hooklift/gowsdl v0.5.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/jonboulle/clockwork v0.2.2 // indirect
-	github.com/russellhaering/goxmldsig v1.4.0 // indirect
-	golang.org/x/crypto v0.11.0 // indirect
-	software.sslmate.com/src/go-pkcs12 v0.5.0 // indirect
+	github.com/beevik/etree v1.1.0
+	github.com/hooklift/gowsdl v0.5.0
+	github.com/joho/godotenv v1.5.1
+	github.com/jonboulle/clockwork v0.2.2
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/russellhaering/goxmldsig v1.4.0
+	rsc.io/qr v0.2.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
+
+require golang.org/x/crypto v0.11.0 // indirect
@@ -0,0 +1,6 @@
+// Package leiaute contém os tipos da NFe 4.00 gerados pelo nfe-xsdgen a partir do pacote
+// de schemas PL_009_V4 embutido em xsd/schemas. O arquivo leiaute.go é versionado e
+// regerado com go generate ./leiaute/... depois de copiar os XSDs oficiais
+package leiaute
+
+//go:generate go run ../cmd/nfe-xsdgen -pl PL_009_V4 -o leiaute.go
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/xml"
 	"fmt"
 	"os"
 
@@ -13,7 +12,7 @@ import (
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		fmt.Errorf("Erro ao carregar arquivo .env: %v", err)
+		fmt.Printf("Erro ao carregar arquivo .env: %v\n", err)
 		return
 	}
 	// Inicializar configurações e ferramentas SEFAZ
@@ -25,65 +24,39 @@ func main() {
 	}
 	tools, err := sefaz.NewSefazTools(config)
 	if err != nil {
-		fmt.Errorf("Erro ao inicializar ferramentas SEFAZ: %v", err)
+		fmt.Printf("Erro ao inicializar ferramentas SEFAZ: %v\n", err)
 		return
 	}
 
-	// Gerar chave de acesso
-	chave, err := services.GerarChaveAcesso(ide, emit, nNF, tpEmis) // Dados da NFe
+	// Gerar XML (chave de acesso, cNF, cDV, Id, tpAmb e totais são preenchidos pelo builder)
+	nfe, err := tools.NFeBuilder(services.Ide{ /* Dados aqui */ }, services.Emit{ /* Dados aqui */ }).
+		Dest(services.Dest{ /* Dados aqui */ }).
+		AutXML(services.AutXML{ /* Dados aqui */ }).
+		Det(services.Det{ /* Dados aqui */ }).
+		Transp(services.Transp{ /* Dados aqui */ }).
+		Cobr(services.Cobr{ /* Dados aqui */ }).
+		Pag(services.Pag{ /* Dados aqui */ }).
+		InfAdic(services.InfAdic{ /* Dados aqui */ }).
+		InfRespTec(services.InfRespTec{ /* Dados aqui */ }).
+		Build()
 	if err != nil {
-		fmt.Println("Erro ao gerar chave de acesso:", err)
+		fmt.Printf("Erro ao gerar XML: %v\n", err)
 		return
 	}
-
-	fmt.Println("Chave de Acesso Gerada:", chave)
-
-	// Gerar XML
-	infNFe := services.DynamicElement{
-		XMLName: xml.Name{Local: "infNFe"},
-		Attrs: []xml.Attr{
-			{Name: xml.Name{Local: "Id"}, Value: "NFe" + chaveAcesso},
-			{Name: xml.Name{Local: "versao"}, Value: "4.00"},
-		},
-		Children: []services.DynamicElement{
-			services.MakeTagIde(services.Ide{ /* Dados aqui */ }),
-			services.MakeTagEmit(services.Emit{ /* Dados aqui */ }),
-			services.MakeTagDest(services.Dest{ /* Dados aqui */ }),
-			services.MakeTagAutXML(services.AutXML{ /* Dados aqui */ }),
-			services.MakeTagDet(services.Det{ /* Dados aqui */ }),
-			services.MakeTagTotal(services.Total{ /* Dados aqui */ }),
-			services.MakeTagTransp(services.Transp{ /* Dados aqui */ }),
-			services.MakeTagCobr(services.Cobr{ /* Dados aqui */ }),
-			services.MakeTagPag(services.Pag{ /* Dados aqui */ }),
-			services.MakeTagInfAdic(services.InfAdic{ /* Dados aqui */ }),
-			services.MakeTagInfRespTec(services.InfRespTec{ /* Dados aqui */ }),
-		},
-	}
-	root := services.DynamicElement{
-		XMLName: xml.Name{Local: "NFe"},
-		Attrs: []xml.Attr{
-			{Name: xml.Name{Local: "xmlns"}, Value: "http://www.portalfiscal.inf.br/nfe"},
-		},
-		Children: []services.DynamicElement{infNFe},
-	}
-	xmlString, err := services.GenerateDynamicXML(root)
-	if err != nil {
-		fmt.Errorf("Erro ao gerar XML: %v", err)
-		return
-	}
-	fmt.Println("XML gerado com sucesso! \n", xmlString)
+	fmt.Println("Chave de Acesso Gerada:", nfe.ChaveAcesso)
+	fmt.Println("XML gerado com sucesso! \n", nfe.XML)
 
 	// Assinar XML
-	xmlAssinado, err := tools.AssinarXML(xmlString)
+	xmlAssinado, err := tools.AssinarXML(nfe.XML)
 	if err != nil {
-		fmt.Errorf("Erro ao assinar XML: %v", err)
+		fmt.Printf("Erro ao assinar XML: %v\n", err)
 		return
 	}
 	fmt.Println("XML assinado com sucesso! \n", xmlAssinado)
 	// Enviar Lote
-	response, err := tools.EnviarLote([]sefaz.NotaFiscal{{XML: xmlAssinado}}, "123456", 0)
+	response, err := tools.EnviarLote([]sefaz.NotaFiscal{{XML: xmlAssinado, ChaveAcesso: nfe.ChaveAcesso}}, "123456", 0)
 	if err != nil {
-		fmt.Errorf("Erro ao enviar lote: %v", err)
+		fmt.Printf("Erro ao enviar lote: %v\n", err)
 		return
 	}
 	fmt.Println("Lote enviado com sucesso!")
@@ -0,0 +1,440 @@
+package sefaz
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Prazos padrão do cancelamento, contados da autorização de uso: 24 horas na NF-e e 30
+// minutos na NFC-e, que as UFs podem ampliar. O do cancelamento por substituição é o
+// limite da NT 2018.002; as UFs podem adotar prazo menor
+const (
+	prazoCancelamentoPadrao     = 24 * time.Hour
+	prazoCancelamentoNFCePadrao = 30 * time.Minute
+	prazoCancSubstPadrao        = 168 * time.Hour
+)
+
+const verAplicPadrao = "nfe-go"
+
+// Situações do retorno que registram o evento e geram o procEventoNFe
+var cStatEventoRegistrado = map[string]bool{
+	"135": true, // Evento registrado e vinculado a NF-e
+	"136": true, // Evento registrado, mas não vinculado a NF-e
+	"155": true, // Cancelamento homologado fora de prazo
+}
+
+// Resultado do envio de um evento
+type RetornoEvento struct {
+	RetEvento     services.InfEventoRet
+	ProcEventoNFe []byte // XML de distribuição, somente quando o evento é registrado
+	XMLRetorno    string
+	Avisos        []string // Alertas da conferência local, que não impedem o envio
+}
+
+// Registrado indica se a SEFAZ registrou o evento
+func (r *RetornoEvento) Registrado() bool {
+	return cStatEventoRegistrado[r.RetEvento.CStat]
+}
+
+// Data e hora da autorização de uso (dhRecbto do protNFe) de cada chave, usadas
+// nos prazos dos eventos. Preenchido por EnviarLote e por RegistrarAutorizacao
+type RegistroAutorizacoes struct {
+	mu           sync.Mutex
+	autorizacoes map[string]time.Time
+}
+
+func NovoRegistroAutorizacoes() *RegistroAutorizacoes {
+	return &RegistroAutorizacoes{autorizacoes: map[string]time.Time{}}
+}
+
+func (r *RegistroAutorizacoes) Registrar(chave string, dhRecbto time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.autorizacoes[strings.TrimPrefix(chave, "NFe")] = dhRecbto
+}
+
+// Autorizacao retorna a data da autorização da chave, se conhecida
+func (r *RegistroAutorizacoes) Autorizacao(chave string) (time.Time, bool) {
+	if r == nil {
+		return time.Time{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dh, ok := r.autorizacoes[strings.TrimPrefix(chave, "NFe")]
+	return dh, ok
+}
+
+// Último nSeqEvento registrado de cada tipo de evento por chave, para numerar as CC-e.
+// Preenchido pelos eventos registrados nesta instância e por RegistrarEvento. Para que a
+// numeração sobreviva ao reinício do processo, use AbrirSequenciaEventos
+type SequenciaEventos struct {
+	mu        sync.Mutex
+	sequencia map[string]int
+	arquivo   *os.File // quando informado, cada evento registrado é gravado em uma linha
+}
+
+func NovaSequenciaEventos() *SequenciaEventos {
+	return &SequenciaEventos{sequencia: map[string]int{}}
+}
+
+// AbrirSequenciaEventos carrega os eventos já gravados no arquivo, uma linha
+// "tpEvento chave nSeqEvento" por evento, e grava nele os novos registros
+func AbrirSequenciaEventos(caminho string) (*SequenciaEventos, error) {
+	arquivo, err := os.OpenFile(caminho, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir a sequência de eventos: %v", err)
+	}
+	s := NovaSequenciaEventos()
+	scanner := bufio.NewScanner(arquivo)
+	for scanner.Scan() {
+		campos := strings.Fields(scanner.Text())
+		if len(campos) != 3 {
+			continue
+		}
+		if nSeqEvento, err := strconv.Atoi(campos[2]); err == nil && nSeqEvento > s.sequencia[campos[0]+campos[1]] {
+			s.sequencia[campos[0]+campos[1]] = nSeqEvento
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		arquivo.Close()
+		return nil, fmt.Errorf("erro ao ler a sequência de eventos: %v", err)
+	}
+	s.arquivo = arquivo
+	return s, nil
+}
+
+// Registrar guarda o nSeqEvento, mantendo o maior já registrado
+func (s *SequenciaEventos) Registrar(chave, tpEvento string, nSeqEvento int) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chave = strings.TrimPrefix(chave, "NFe")
+	k := tpEvento + chave
+	if nSeqEvento <= s.sequencia[k] {
+		return nil
+	}
+	if s.arquivo != nil {
+		if _, err := fmt.Fprintf(s.arquivo, "%s %s %d\n", tpEvento, chave, nSeqEvento); err != nil {
+			return fmt.Errorf("erro ao gravar a sequência de eventos: %v", err)
+		}
+	}
+	s.sequencia[k] = nSeqEvento
+	return nil
+}
+
+// Fechar encerra o arquivo da sequência, quando houver
+func (s *SequenciaEventos) Fechar() error {
+	if s == nil || s.arquivo == nil {
+		return nil
+	}
+	return s.arquivo.Close()
+}
+
+// Proximo retorna o nSeqEvento seguinte ao último registrado (1 para o primeiro evento)
+func (s *SequenciaEventos) Proximo(chave, tpEvento string) int {
+	if s == nil {
+		return 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sequencia[tpEvento+strings.TrimPrefix(chave, "NFe")] + 1
+}
+
+// RegistrarEvento guarda o nSeqEvento de um procEventoNFe registrado fora desta instância,
+// para que a próxima CC-e da chave receba a sequência correta
+func (t *SefazTools) RegistrarEvento(procEventoNFe []byte) error {
+	proc, err := services.ParseProcEventoNFe(procEventoNFe)
+	if err != nil {
+		return err
+	}
+	ret := proc.RetEvento.InfEvento
+	if !cStatEventoRegistrado[ret.CStat] {
+		return fmt.Errorf("evento não registrado: %s - %s", ret.CStat, ret.XMotivo)
+	}
+	inf := proc.Evento.InfEvento
+	nSeqEvento, err := strconv.Atoi(inf.NSeqEvento)
+	if err != nil {
+		return fmt.Errorf("nSeqEvento inválido: %q", inf.NSeqEvento)
+	}
+	if t.Eventos == nil {
+		t.Eventos = NovaSequenciaEventos()
+	}
+	return t.Eventos.Registrar(inf.ChNFe, inf.TpEvento, nSeqEvento)
+}
+
+// RegistrarAutorizacao guarda a data da autorização do nfeProc, para os prazos dos
+// eventos de notas autorizadas fora desta instância
+func (t *SefazTools) RegistrarAutorizacao(nfeProc []byte) error {
+	proc, err := services.ParseNFeProc(nfeProc)
+	if err != nil {
+		return err
+	}
+	return t.registrarProtocolo(proc.ProtNFe.InfProt)
+}
+
+func (t *SefazTools) registrarProtocolo(prot services.InfProt) error {
+	if prot.CStat != "100" && prot.CStat != "150" {
+		return fmt.Errorf("NFe não autorizada: %s - %s", prot.CStat, prot.XMotivo)
+	}
+	dh, err := services.ParseDataHora(prot.DhRecbto)
+	if err != nil {
+		return fmt.Errorf("dhRecbto do protocolo inválido: %v", err)
+	}
+	if t.Autorizacoes == nil {
+		t.Autorizacoes = NovoRegistroAutorizacoes()
+	}
+	t.Autorizacoes.Registrar(prot.ChNFe, dh.Time)
+	return nil
+}
+
+// Cancelar registra o evento de cancelamento (110111) da NF-e ou NFC-e autorizada. A
+// justificativa e o prazo contado da autorização (PrazoCancelamento na NF-e, 24 horas por
+// padrão; PrazosCancelamentoNFCe da UF na NFC-e, 30 minutos por padrão) são conferidos
+// antes do envio; com CancelamentoForaPrazo o pedido fora do prazo é enviado para as UFs
+// que o admitem
+func (t *SefazTools) Cancelar(chave, nProt, xJust string) (*RetornoEvento, error) {
+	c, err := services.ParseChaveAcesso(chave)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.ValidarProtocolo(nProt); err != nil {
+		return nil, err
+	}
+	if err := services.ValidarJustificativa(xJust); err != nil {
+		return nil, err
+	}
+	if err := t.conferirPrazoCancelamento(c); err != nil {
+		return nil, err
+	}
+	return t.enviarEvento(c, services.TpEventoCancelamento, 1, services.DetEvento{
+		DescEvento: "Cancelamento",
+		NProt:      nProt,
+		XJust:      strings.TrimSpace(xJust),
+	})
+}
+
+// CartaCorrecao registra a Carta de Correção Eletrônica (110110) da NF-e autorizada, com o
+// nSeqEvento seguinte ao da última CC-e registrada da chave e o texto obrigatório das
+// condições de uso. Os dados que a CC-e não pode alterar mencionados na correção voltam
+// em Avisos, sem impedir o envio
+func (t *SefazTools) CartaCorrecao(chave, xCorrecao string) (*RetornoEvento, error) {
+	c, err := services.ParseChaveAcesso(chave)
+	if err != nil {
+		return nil, err
+	}
+	if c.Mod == services.ModeloNFCe {
+		return nil, errors.New("a NFC-e (modelo 65) não admite carta de correção")
+	}
+	if err := services.ValidarCorrecao(xCorrecao); err != nil {
+		return nil, err
+	}
+	nSeqEvento := t.Eventos.Proximo(c.String(), services.TpEventoCCe)
+	if nSeqEvento > services.MaxSeqCCe {
+		return nil, fmt.Errorf("limite de %d cartas de correção da chave %s atingido", services.MaxSeqCCe, c.String())
+	}
+	retorno, err := t.enviarEvento(c, services.TpEventoCCe, nSeqEvento, services.DetEvento{
+		DescEvento: "Carta de Correcao",
+		XCorrecao:  strings.TrimSpace(xCorrecao),
+		XCondUso:   services.XCondUsoCCe,
+	})
+	if err != nil {
+		return nil, err
+	}
+	retorno.Avisos = services.AvisosCorrecao(xCorrecao)
+	return retorno, nil
+}
+
+func (t *SefazTools) conferirPrazoCancelamento(c services.ChaveAcesso) error {
+	return t.conferirPrazo(c, "cancelamento", t.prazoCancelamento(c), t.Configuracoes.CancelamentoForaPrazo)
+}
+
+// Prazo do cancelamento pelo modelo da chave e, na NFC-e, pela UF do emitente
+func (t *SefazTools) prazoCancelamento(c services.ChaveAcesso) time.Duration {
+	if c.Mod == services.ModeloNFCe {
+		if prazo, ok := t.Configuracoes.PrazosCancelamentoNFCe[c.SiglaUF()]; ok {
+			return prazo
+		}
+		return prazoCancelamentoNFCePadrao
+	}
+	if t.Configuracoes.PrazoCancelamento != 0 {
+		return t.Configuracoes.PrazoCancelamento
+	}
+	return prazoCancelamentoPadrao
+}
+
+// Confere o tempo decorrido desde a autorização da chave, pelo relógio da SEFAZ
+func (t *SefazTools) conferirPrazo(c services.ChaveAcesso, evento string, prazo time.Duration, foraPrazo bool) error {
+	autorizacao, ok := t.Autorizacoes.Autorizacao(c.String())
+	if !ok {
+		return fmt.Errorf("data da autorização da chave %s desconhecida: registre o nfeProc com RegistrarAutorizacao", c.String())
+	}
+	decorrido := t.relogioSefaz().Now().Sub(autorizacao)
+	if decorrido > prazo && !foraPrazo {
+		return fmt.Errorf("prazo de %s de %v excedido: nota autorizada há %v", evento, prazo, decorrido.Truncate(time.Minute))
+	}
+	return nil
+}
+
+// CancelarSubstituicao registra o cancelamento por substituição (110112) da NFC-e, usado
+// quando a venda é emitida novamente: chNFeRef é a chave da NFC-e substituta. As duas notas
+// devem ser NFC-e do mesmo emitente, e o prazo (PrazosCancSubst da UF, 168 horas por padrão)
+// é contado da autorização da nota cancelada
+func (t *SefazTools) CancelarSubstituicao(chave, nProt, xJust, chNFeRef string) (*RetornoEvento, error) {
+	c, err := services.ParseChaveAcesso(chave)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := services.ParseChaveAcesso(chNFeRef)
+	if err != nil {
+		return nil, fmt.Errorf("chave da NFC-e substituta: %v", err)
+	}
+	if c.Mod != services.ModeloNFCe || ref.Mod != services.ModeloNFCe {
+		return nil, errors.New("o cancelamento por substituição é exclusivo da NFC-e (modelo 65): as duas chaves devem ser do modelo 65")
+	}
+	if c.String() == ref.String() {
+		return nil, errors.New("a NFC-e substituta deve ser diferente da nota cancelada")
+	}
+	if c.CUF != ref.CUF || c.CNPJCPF != ref.CNPJCPF {
+		return nil, errors.New("a NFC-e substituta deve ser do mesmo emitente da nota cancelada")
+	}
+	if err := services.ValidarProtocolo(nProt); err != nil {
+		return nil, err
+	}
+	if err := services.ValidarJustificativa(xJust); err != nil {
+		return nil, err
+	}
+	prazo, ok := t.Configuracoes.PrazosCancSubst[c.SiglaUF()]
+	if !ok {
+		prazo = prazoCancSubstPadrao
+	}
+	if err := t.conferirPrazo(c, "cancelamento por substituição", prazo, false); err != nil {
+		return nil, err
+	}
+	verAplic := t.Configuracoes.VerAplic
+	if verAplic == "" {
+		verAplic = verAplicPadrao
+	}
+	return t.enviarEvento(c, services.TpEventoCancSubst, 1, services.DetEvento{
+		DescEvento:  "Cancelamento por substituicao",
+		COrgaoAutor: c.CUF,
+		TpAutor:     "1", // empresa emitente
+		VerAplic:    verAplic,
+		NProt:       nProt,
+		XJust:       strings.TrimSpace(xJust),
+		ChNFeRef:    ref.String(),
+	})
+}
+
+// Monta, assina e envia o evento do emitente da chave à RecepcaoEvento4 da UF
+// autorizadora, retornando o procEventoNFe quando o evento é registrado
+func (t *SefazTools) enviarEvento(c services.ChaveAcesso, tpEvento string, nSeqEvento int, det services.DetEvento) (*RetornoEvento, error) {
+	if t.Certificado == nil || t.PrivateKey == nil {
+		return nil, errors.New("certificado ou chave privada não carregados")
+	}
+	uf := c.SiglaUF()
+	agora := t.relogioEmissao().Now()
+	dhEvento, err := services.NovaDataHora(agora, uf)
+	if err != nil {
+		return nil, err
+	}
+	tpAmb := "2"
+	if t.Configuracoes.Ambiente == "producao" {
+		tpAmb = "1"
+	}
+	infEvento := services.NovoInfEvento(c, tpAmb, tpEvento, nSeqEvento, dhEvento, det)
+
+	evento := &bytes.Buffer{}
+	if err := services.EscreverEvento(evento, infEvento); err != nil {
+		return nil, err
+	}
+	eventoAssinado, err := services.AssinarXML(evento.String(), t.PrivateKey, t.Certificado)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao assinar o evento: %v", err)
+	}
+	eventoAssinado = strings.TrimSpace(eventoAssinado)
+	if strings.HasPrefix(eventoAssinado, "<?xml") {
+		if fim := strings.Index(eventoAssinado, "?>"); fim >= 0 {
+			eventoAssinado = eventoAssinado[fim+2:]
+		}
+	}
+
+	urlPortal := t.URLPortal
+	if c.Mod == services.ModeloNFCe {
+		if t.URLPortalNFCe == "" {
+			return nil, errors.New("endereço dos serviços da NFC-e não configurado")
+		}
+		urlPortal = t.URLPortalNFCe
+	}
+	envelope := fmt.Sprintf(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body>`+
+		`<nfeDadosMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeRecepcaoEvento4">`+
+		`<envEvento xmlns="http://www.portalfiscal.inf.br/nfe" versao="%s"><idLote>%015d</idLote>%s</envEvento>`+
+		`</nfeDadosMsg></soap12:Body></soap12:Envelope>`, services.VersaoEvento, agora.UnixMilli(), eventoAssinado)
+
+	urlServico := fmt.Sprintf("%s/ws/RecepcaoEvento/RecepcaoEvento4.asmx", urlPortal)
+	responseXML, err := EnviarSOAP(urlServico, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao enviar o evento para a SEFAZ: %v", err)
+	}
+	retorno, err := montarRetornoEvento(infEvento, eventoAssinado, responseXML)
+	if err != nil {
+		return nil, err
+	}
+	if retorno.Registrado() {
+		if t.Eventos == nil {
+			t.Eventos = NovaSequenciaEventos()
+		}
+		// O evento já foi registrado na SEFAZ: o retorno acompanha o erro da gravação
+		if err := t.Eventos.Registrar(c.String(), tpEvento, nSeqEvento); err != nil {
+			return retorno, err
+		}
+	}
+	return retorno, nil
+}
+
+// Lê o retEnvEvento e, quando o evento foi registrado, monta o procEventoNFe com o evento
+// assinado e o retEvento copiados sem reserialização
+func montarRetornoEvento(infEvento services.InfEvento, eventoAssinado string, responseXML string) (*RetornoEvento, error) {
+	ret, err := services.ParseRetEnvEvento([]byte(responseXML))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao processar resposta da SEFAZ: %v", err)
+	}
+	if ret.CStat != "128" {
+		return nil, fmt.Errorf("lote de eventos rejeitado: %s - %s", ret.CStat, ret.XMotivo)
+	}
+	brutos, err := extrairElementos([]byte(responseXML), "retEvento")
+	if err != nil {
+		return nil, err
+	}
+	for i, retEvento := range ret.RetEvento {
+		inf := retEvento.InfEvento
+		if inf.ChNFe != "" && inf.ChNFe != infEvento.ChNFe {
+			continue
+		}
+		retorno := &RetornoEvento{RetEvento: inf, XMLRetorno: responseXML}
+		if retorno.Registrado() && i < len(brutos) {
+			proc := &bytes.Buffer{}
+			proc.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+			proc.WriteString(`<procEventoNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="` + services.VersaoEvento + `">`)
+			proc.WriteString(eventoAssinado)
+			proc.Write(brutos[i])
+			proc.WriteString(`</procEventoNFe>`)
+			retorno.ProcEventoNFe = proc.Bytes()
+		}
+		return retorno, nil
+	}
+	return nil, fmt.Errorf("retEvento da chave %s não encontrado no retorno", infEvento.ChNFe)
+}
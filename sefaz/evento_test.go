@@ -0,0 +1,427 @@
+package sefaz
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
+)
+
+// Autorização das notas dos testes de eventos: 10:00 de Brasília
+var autorizacaoTeste = time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+
+// Chave de acesso do emitente do certificado de teste, no modelo e na UF informados
+func chaveEventoTeste(t *testing.T, mod, cUF, nNF string) services.ChaveAcesso {
+	t.Helper()
+	ide := services.Ide{CUF: cUF, DhEmi: "2026-10-19T10:00:00-03:00", Mod: mod, Serie: "1", CNF: "52839174"}
+	chave, err := services.GerarChaveAcesso(ide, services.Emit{CNPJ: "12345678000195"}, nNF, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := services.ParseChaveAcesso(chave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Ferramenta com o certificado de teste, o relógio decorrido após a autorização e as
+// chaves informadas registradas como autorizadas às 10:00
+func toolsEventoTeste(t *testing.T, decorrido time.Duration, chaves ...services.ChaveAcesso) *SefazTools {
+	t.Helper()
+	tools := toolsTeste(t)
+	tools.Relogio = clockwork.NewFakeClockAt(autorizacaoTeste.Add(decorrido))
+	tools.Autorizacoes = NovoRegistroAutorizacoes()
+	for _, c := range chaves {
+		tools.Autorizacoes.Registrar(c.String(), autorizacaoTeste)
+	}
+	return tools
+}
+
+// Retorno simulado da RecepcaoEvento4 com um retEvento para a chave
+func retornoEventoTeste(cStatLote, chave, tpEvento, nSeqEvento, cStat string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>` +
+		`<nfeResultMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeRecepcaoEvento4"><retEnvEvento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00">` +
+		`<idLote>1</idLote><tpAmb>2</tpAmb><verAplic>SP_EVENTOS_PL_100</verAplic><cOrgao>35</cOrgao><cStat>` + cStatLote + `</cStat><xMotivo>Lote de evento processado</xMotivo>` +
+		`<retEvento versao="1.00"><infEvento Id="ID135260000000002"><tpAmb>2</tpAmb><verAplic>SP_EVENTOS_PL_100</verAplic><cOrgao>35</cOrgao>` +
+		`<cStat>` + cStat + `</cStat><xMotivo>Evento registrado e vinculado a NF-e</xMotivo><chNFe>` + chave + `</chNFe><tpEvento>` + tpEvento + `</tpEvento>` +
+		`<xEvento>Cancelamento registrado</xEvento><nSeqEvento>` + nSeqEvento + `</nSeqEvento><dhRegEvento>2026-10-19T10:10:00-03:00</dhRegEvento>` +
+		`<nProt>135260000000002</nProt></infEvento></retEvento></retEnvEvento></nfeResultMsg></soap:Body></soap:Envelope>`
+}
+
+// Servidor da SEFAZ simulado: confere o SOAP 1.2 e guarda o último envelope recebido
+func servidorEventoTeste(t *testing.T, retorno func(envelope string) string) (*httptest.Server, *string) {
+	t.Helper()
+	recebido := new(string)
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws/RecepcaoEvento/RecepcaoEvento4.asmx" {
+			t.Errorf("caminho do serviço = %s", r.URL.Path)
+		}
+		if tipo := r.Header.Get("Content-Type"); tipo != "application/soap+xml; charset=utf-8" {
+			t.Errorf("Content-Type do SOAP 1.2 = %q", tipo)
+		}
+		corpo, _ := io.ReadAll(r.Body)
+		*recebido = string(corpo)
+		io.WriteString(w, retorno(*recebido))
+	}))
+	t.Cleanup(servidor.Close)
+	return servidor, recebido
+}
+
+func TestCancelar(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	servidor, recebido := servidorEventoTeste(t, func(string) string {
+		return retornoEventoTeste("128", c.String(), services.TpEventoCancelamento, "1", "135")
+	})
+	tools := toolsEventoTeste(t, 10*time.Minute, c)
+	tools.URLPortal = servidor.URL
+
+	retorno, err := tools.Cancelar(c.String(), "135260000000001", "Venda cancelada pelo cliente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trecho := range []string{
+		`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope">`,
+		`<tpEvento>110111</tpEvento>`, `<nSeqEvento>1</nSeqEvento>`,
+		`<nProt>135260000000001</nProt><xJust>Venda cancelada pelo cliente</xJust>`,
+		`<chNFe>` + c.String() + `</chNFe>`, `<Signature xmlns="http://www.w3.org/2000/09/xmldsig#">`,
+	} {
+		if !strings.Contains(*recebido, trecho) {
+			t.Errorf("envelope sem %s:\n%s", trecho, *recebido)
+		}
+	}
+	if !retorno.Registrado() || retorno.RetEvento.NProt != "135260000000002" {
+		t.Fatalf("cancelamento não registrado: %+v", retorno.RetEvento)
+	}
+	proc, err := services.ParseProcEventoNFe(retorno.ProcEventoNFe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc.Evento.InfEvento.ChNFe != c.String() || proc.RetEvento.InfEvento.CStat != "135" {
+		t.Fatalf("procEventoNFe: %+v", proc)
+	}
+
+	// A NFC-e usa o endereço próprio e o prazo de 30 minutos
+	nfce := chaveEventoTeste(t, services.ModeloNFCe, "35", "124")
+	tools = toolsEventoTeste(t, 31*time.Minute, nfce)
+	tools.URLPortal = "http://nfe.invalido"
+	if _, err := tools.Cancelar(nfce.String(), "135260000000001", "Venda cancelada pelo cliente"); err == nil || !strings.Contains(err.Error(), "prazo de cancelamento") {
+		t.Fatalf("esperado erro de prazo da NFC-e, obtido %v", err)
+	}
+	if _, err := tools.Cancelar(nfce.String(), "1352600000", "Venda cancelada pelo cliente"); err == nil {
+		t.Fatal("esperado erro com nProt incompleto")
+	}
+	if _, err := tools.Cancelar(nfce.String(), "135260000000001", "curta"); err == nil {
+		t.Fatal("esperado erro com justificativa curta")
+	}
+}
+
+func TestCancelarNFCe(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFCe, "35", "123")
+	servidor, _ := servidorEventoTeste(t, func(string) string {
+		return retornoEventoTeste("128", c.String(), services.TpEventoCancelamento, "1", "135")
+	})
+	tools := toolsEventoTeste(t, 20*time.Minute, c)
+	tools.URLPortal = "http://nfe.invalido"
+	tools.URLPortalNFCe = servidor.URL
+	retorno, err := tools.Cancelar(c.String(), "135260000000001", "Venda cancelada pelo cliente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retorno.Registrado() {
+		t.Fatalf("cancelamento da NFC-e não registrado: %+v", retorno.RetEvento)
+	}
+}
+
+func TestConferirPrazoCancelamento(t *testing.T) {
+	nfe := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	nfce := chaveEventoTeste(t, services.ModeloNFCe, "35", "124")
+	nfcePR := chaveEventoTeste(t, services.ModeloNFCe, "41", "125")
+	casos := []struct {
+		nome      string
+		chave     services.ChaveAcesso
+		decorrido time.Duration
+		config    Configuracoes
+		aceito    bool
+	}{
+		{"NF-e dentro das 24 horas", nfe, 23*time.Hour + 59*time.Minute, Configuracoes{}, true},
+		{"NF-e após 24 horas", nfe, 24*time.Hour + time.Minute, Configuracoes{}, false},
+		{"NF-e com prazo configurado", nfe, 47 * time.Hour, Configuracoes{PrazoCancelamento: 48 * time.Hour}, true},
+		{"NF-e fora do prazo, enviada assim mesmo", nfe, 72 * time.Hour, Configuracoes{CancelamentoForaPrazo: true}, true},
+		{"NFC-e dentro dos 30 minutos", nfce, 29 * time.Minute, Configuracoes{}, true},
+		{"NFC-e após 30 minutos", nfce, 31 * time.Minute, Configuracoes{}, false},
+		{"NFC-e não usa o prazo da NF-e", nfce, time.Hour, Configuracoes{PrazoCancelamento: 48 * time.Hour}, false},
+		{"NFC-e com prazo da UF", nfce, 23 * time.Hour, Configuracoes{PrazosCancelamentoNFCe: map[string]time.Duration{"SP": 24 * time.Hour}}, true},
+		{"NFC-e de UF sem prazo configurado", nfcePR, time.Hour, Configuracoes{PrazosCancelamentoNFCe: map[string]time.Duration{"SP": 24 * time.Hour}}, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			tools := toolsEventoTeste(t, c.decorrido, c.chave)
+			tools.Configuracoes = c.config
+			err := tools.conferirPrazoCancelamento(c.chave)
+			if c.aceito != (err == nil) {
+				t.Fatalf("erro = %v, aceito esperado %v", err, c.aceito)
+			}
+		})
+	}
+
+	// Sem a data da autorização não há como conferir o prazo
+	tools := toolsEventoTeste(t, time.Minute)
+	if err := tools.conferirPrazoCancelamento(nfe); err == nil || !strings.Contains(err.Error(), "RegistrarAutorizacao") {
+		t.Fatalf("esperado erro sem a autorização registrada, obtido %v", err)
+	}
+}
+
+func TestMontarRetornoEvento(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	outra := chaveEventoTeste(t, services.ModeloNFe, "35", "124")
+	infEvento := services.InfEvento{ChNFe: c.String(), TpEvento: services.TpEventoCancelamento}
+	eventoAssinado := `<evento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><infEvento Id="ID110111` + c.String() + `01"></infEvento></evento>`
+
+	retorno, err := montarRetornoEvento(infEvento, eventoAssinado, retornoEventoTeste("128", c.String(), "110111", "1", "135"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := string(retorno.ProcEventoNFe)
+	if !retorno.Registrado() || !strings.HasPrefix(proc, `<?xml version="1.0" encoding="UTF-8"?><procEventoNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00">`+eventoAssinado+`<retEvento versao="1.00">`) ||
+		!strings.HasSuffix(proc, `</retEvento></procEventoNFe>`) {
+		t.Fatalf("procEventoNFe montado incorretamente:\n%s", proc)
+	}
+
+	// Evento rejeitado: sem procEventoNFe
+	retorno, err = montarRetornoEvento(infEvento, eventoAssinado, retornoEventoTeste("128", c.String(), "110111", "1", "573"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retorno.Registrado() || retorno.ProcEventoNFe != nil || retorno.RetEvento.CStat != "573" {
+		t.Fatalf("evento rejeitado tratado como registrado: %+v", retorno)
+	}
+
+	// Cancelamento homologado fora de prazo também gera o procEventoNFe
+	retorno, err = montarRetornoEvento(infEvento, eventoAssinado, retornoEventoTeste("128", c.String(), "110111", "1", "155"))
+	if err != nil || retorno.ProcEventoNFe == nil {
+		t.Fatalf("cancelamento fora de prazo sem procEventoNFe: %v", err)
+	}
+
+	if _, err := montarRetornoEvento(infEvento, eventoAssinado, retornoEventoTeste("215", c.String(), "110111", "1", "135")); err == nil || !strings.Contains(err.Error(), "215") {
+		t.Fatalf("esperado erro de lote rejeitado, obtido %v", err)
+	}
+	if _, err := montarRetornoEvento(infEvento, eventoAssinado, retornoEventoTeste("128", outra.String(), "110111", "1", "135")); err == nil {
+		t.Fatal("esperado erro com o retEvento de outra chave")
+	}
+	if _, err := montarRetornoEvento(infEvento, eventoAssinado, "<html>erro</html>"); err == nil {
+		t.Fatal("esperado erro com resposta sem retEnvEvento")
+	}
+}
+
+func TestSequenciaEventos(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	s := NovaSequenciaEventos()
+	if n := s.Proximo(c.String(), services.TpEventoCCe); n != 1 {
+		t.Fatalf("primeira CC-e com nSeqEvento %d", n)
+	}
+	for _, n := range []int{1, 3, 2} {
+		if err := s.Registrar("NFe"+c.String(), services.TpEventoCCe, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Proximo(c.String(), services.TpEventoCCe); n != 4 {
+		t.Fatalf("nSeqEvento após a terceira CC-e = %d, esperado 4", n)
+	}
+	if n := s.Proximo(c.String(), services.TpEventoCancelamento); n != 1 {
+		t.Fatalf("a sequência é própria de cada tipo de evento: %d", n)
+	}
+	var nula *SequenciaEventos
+	if nula.Proximo(c.String(), services.TpEventoCCe) != 1 || nula.Registrar(c.String(), services.TpEventoCCe, 1) != nil {
+		t.Fatal("sequência nula deve começar em 1 sem erro")
+	}
+}
+
+func TestAbrirSequenciaEventos(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	outra := chaveEventoTeste(t, services.ModeloNFe, "35", "124")
+	caminho := filepath.Join(t.TempDir(), "eventos.txt")
+	s, err := AbrirSequenciaEventos(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, 2, 1} {
+		if err := s.Registrar(c.String(), services.TpEventoCCe, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Registrar(outra.String(), services.TpEventoCCe, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Fechar(); err != nil {
+		t.Fatal(err)
+	}
+	gravado, err := os.ReadFile(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := "110110 " + c.String() + " 1\n110110 " + c.String() + " 2\n110110 " + outra.String() + " 1\n"
+	if string(gravado) != esperado {
+		t.Fatalf("arquivo gravado:\n%s\nesperado:\n%s", gravado, esperado)
+	}
+
+	// Linhas incompletas são ignoradas na leitura
+	if err := os.WriteFile(caminho, append(gravado, "110110 incompleta\n\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = AbrirSequenciaEventos(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Fechar()
+	if n := s.Proximo(c.String(), services.TpEventoCCe); n != 3 {
+		t.Fatalf("nSeqEvento após reabrir = %d, esperado 3", n)
+	}
+	if n := s.Proximo(outra.String(), services.TpEventoCCe); n != 2 {
+		t.Fatalf("nSeqEvento da outra chave após reabrir = %d, esperado 2", n)
+	}
+}
+
+var nSeqEventoEnvelope = regexp.MustCompile(`<nSeqEvento>(\d+)</nSeqEvento>`)
+
+// CC-e numeradas pela sequência gravada em arquivo, inclusive após reabrir o arquivo
+func TestCartaCorrecaoSequencia(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	servidor, recebido := servidorEventoTeste(t, func(envelope string) string {
+		n := nSeqEventoEnvelope.FindStringSubmatch(envelope)[1]
+		return retornoEventoTeste("128", c.String(), services.TpEventoCCe, n, "135")
+	})
+	caminho := filepath.Join(t.TempDir(), "eventos.txt")
+	const correcao = "Onde se le Rua das Flores, 100, leia-se Rua das Flores, 1000"
+
+	var ultimo *RetornoEvento
+	for _, esperado := range []string{"1", "2", "3"} {
+		eventos, err := AbrirSequenciaEventos(caminho)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tools := toolsEventoTeste(t, time.Hour, c)
+		tools.URLPortal = servidor.URL
+		tools.Eventos = eventos
+		ultimo, err = tools.CartaCorrecao(c.String(), correcao)
+		eventos.Fechar()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := nSeqEventoEnvelope.FindStringSubmatch(*recebido)[1]; n != esperado {
+			t.Fatalf("nSeqEvento enviado = %s, esperado %s", n, esperado)
+		}
+		if len(ultimo.Avisos) != 0 {
+			t.Fatalf("avisos inesperados: %q", ultimo.Avisos)
+		}
+	}
+
+	// O procEventoNFe registrado em outra instância também avança a sequência
+	tools := toolsEventoTeste(t, time.Hour, c)
+	if err := tools.RegistrarEvento(ultimo.ProcEventoNFe); err != nil {
+		t.Fatal(err)
+	}
+	if n := tools.Eventos.Proximo(c.String(), services.TpEventoCCe); n != 4 {
+		t.Fatalf("nSeqEvento após RegistrarEvento = %d, esperado 4", n)
+	}
+
+	// Correção que menciona dado vedado segue com aviso
+	tools.URLPortal = servidor.URL
+	retorno, err := tools.CartaCorrecao(c.String(), "Corrigir o valor do frete informado")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retorno.Avisos) != 1 || !strings.Contains(retorno.Avisos[0], "valores da operação") {
+		t.Fatalf("avisos = %q", retorno.Avisos)
+	}
+
+	nfce := chaveEventoTeste(t, services.ModeloNFCe, "35", "124")
+	if _, err := tools.CartaCorrecao(nfce.String(), correcao); err == nil {
+		t.Fatal("a NFC-e não admite CC-e")
+	}
+}
+
+func TestCancelarSubstituicao(t *testing.T) {
+	cancelada := chaveEventoTeste(t, services.ModeloNFCe, "35", "123")
+	substituta := chaveEventoTeste(t, services.ModeloNFCe, "35", "124")
+	servidor, recebido := servidorEventoTeste(t, func(string) string {
+		return retornoEventoTeste("128", cancelada.String(), services.TpEventoCancSubst, "1", "135")
+	})
+	tools := toolsEventoTeste(t, 167*time.Hour, cancelada)
+	tools.URLPortalNFCe = servidor.URL
+
+	retorno, err := tools.CancelarSubstituicao(cancelada.String(), "135260000000001", "Venda emitida novamente em outra NFC-e", substituta.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trecho := range []string{
+		`<tpEvento>110112</tpEvento>`, `<descEvento>Cancelamento por substituicao</descEvento>`,
+		`<cOrgaoAutor>35</cOrgaoAutor><tpAutor>1</tpAutor>`,
+		`<chNFeRef>` + substituta.String() + `</chNFeRef>`,
+	} {
+		if !strings.Contains(*recebido, trecho) {
+			t.Errorf("envelope sem %s:\n%s", trecho, *recebido)
+		}
+	}
+	if !retorno.Registrado() {
+		t.Fatalf("cancelamento por substituição não registrado: %+v", retorno.RetEvento)
+	}
+}
+
+func TestCancelarSubstituicaoInvalido(t *testing.T) {
+	cancelada := chaveEventoTeste(t, services.ModeloNFCe, "35", "123")
+	substituta := chaveEventoTeste(t, services.ModeloNFCe, "35", "124")
+	nfe := chaveEventoTeste(t, services.ModeloNFe, "35", "125")
+	outraUF := chaveEventoTeste(t, services.ModeloNFCe, "41", "126")
+	outroEmitente := "35261011222333000181650010000001271528391743"
+	dvErrado := substituta.String()[:43] + string((substituta.CDV[0]-'0'+1)%10+'0')
+	semana := 168 * time.Hour
+
+	casos := []struct {
+		nome            string
+		chave, chNFeRef string
+		decorrido       time.Duration
+		prazos          map[string]time.Duration
+		erro            string
+	}{
+		{"nota cancelada NF-e", nfe.String(), substituta.String(), time.Hour, nil, "modelo 65"},
+		{"substituta NF-e", cancelada.String(), nfe.String(), time.Hour, nil, "modelo 65"},
+		{"substituta de outro emitente", cancelada.String(), outroEmitente, time.Hour, nil, "mesmo emitente"},
+		{"substituta de outra UF", cancelada.String(), outraUF.String(), time.Hour, nil, "mesmo emitente"},
+		{"substituta igual à cancelada", cancelada.String(), cancelada.String(), time.Hour, nil, "diferente"},
+		{"chNFeRef com DV errado", cancelada.String(), dvErrado, time.Hour, nil, "NFC-e substituta"},
+		{"chNFeRef incompleta", cancelada.String(), substituta.String()[:40], time.Hour, nil, "NFC-e substituta"},
+		{"após 168 horas", cancelada.String(), substituta.String(), semana + time.Minute, nil, "prazo de cancelamento por substituição"},
+		{"após o prazo da UF", cancelada.String(), substituta.String(), 2 * time.Hour, map[string]time.Duration{"SP": time.Hour}, "prazo de cancelamento por substituição"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			tools := toolsEventoTeste(t, c.decorrido, cancelada, nfe)
+			tools.URLPortalNFCe = "http://nfce.invalido"
+			tools.Configuracoes.PrazosCancSubst = c.prazos
+			_, err := tools.CancelarSubstituicao(c.chave, "135260000000001", "Venda emitida novamente em outra NFC-e", c.chNFeRef)
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, c.erro)
+			}
+		})
+	}
+
+	// O prazo da UF substitui as 168 horas
+	servidor, _ := servidorEventoTeste(t, func(string) string {
+		return retornoEventoTeste("128", cancelada.String(), services.TpEventoCancSubst, "1", "135")
+	})
+	tools := toolsEventoTeste(t, semana+time.Hour, cancelada)
+	tools.URLPortalNFCe = servidor.URL
+	tools.Configuracoes.PrazosCancSubst = map[string]time.Duration{"SP": 2 * semana}
+	if _, err := tools.CancelarSubstituicao(cancelada.String(), "135260000000001", "Venda emitida novamente em outra NFC-e", substituta.String()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package sefaz
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// AdicionarInfNFeSupl gera o QR Code da NFC-e já assinada e insere o infNFeSupl logo após
+// o infNFe, antes da assinatura, na ordem exigida pelo schema. A assinatura cobre apenas
+// o infNFe e continua válida
+func (t *SefazTools) AdicionarInfNFeSupl(xmlAssinado []byte) ([]byte, error) {
+	nfe, err := services.ParseNFe(xmlAssinado)
+	if err != nil {
+		return nil, err
+	}
+	if nfe.InfNFe.Ide.Mod != services.ModeloNFCe {
+		return nil, fmt.Errorf("o infNFeSupl é exclusivo da NFC-e (modelo %s)", nfe.InfNFe.Ide.Mod)
+	}
+	if nfe.InfNFeSupl != nil {
+		return nil, errors.New("a NFC-e já possui o grupo infNFeSupl")
+	}
+	digestValue, err := digestValueInfNFe(nfe)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := services.URLConsultaNFCe(nfe.InfNFe.Ide.CUF, nfe.InfNFe.Ide.TpAmb)
+	if t.Configuracoes.URLQRCode != "" && t.Configuracoes.URLChave != "" {
+		urls, err = services.URLsNFCe{QRCode: t.Configuracoes.URLQRCode, Chave: t.Configuracoes.URLChave}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var qrCode string
+	switch t.Configuracoes.VersaoQRCode {
+	case 0, 2:
+		qrCode, err = services.GerarQRCodeV2(urls.QRCode, nfe.InfNFe, digestValue, t.Configuracoes.CSC)
+	case 3:
+		qrCode, err = services.GerarQRCodeV3(urls.QRCode, nfe.InfNFe, t.assinarQRCode)
+	default:
+		return nil, fmt.Errorf("versão do QR Code não suportada: %d", t.Configuracoes.VersaoQRCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	supl := services.EscreverInfNFeSupl(services.InfNFeSupl{QrCode: qrCode, UrlChave: urls.Chave})
+	fim := bytes.Index(xmlAssinado, []byte("</infNFe>"))
+	if fim < 0 {
+		return nil, errors.New("elemento infNFe não encontrado")
+	}
+	fim += len("</infNFe>")
+	resultado := make([]byte, 0, len(xmlAssinado)+len(supl))
+	resultado = append(resultado, xmlAssinado[:fim]...)
+	resultado = append(resultado, supl...)
+	return append(resultado, xmlAssinado[fim:]...), nil
+}
+
+// DigestValue registrado no Signature da NFC-e, que é o valor conferido pela SEFAZ no
+// QR Code de contingência
+func digestValueInfNFe(nfe *services.NFe) (string, error) {
+	if nfe.Signature == nil || nfe.Signature.SignedInfo.Reference.DigestValue == "" {
+		return "", errors.New("a NFC-e não está assinada: DigestValue da assinatura não encontrado")
+	}
+	return nfe.Signature.SignedInfo.Reference.DigestValue, nil
+}
+
+// Assina os parâmetros do QR Code versão 3 com a chave do certificado (RSA-SHA1)
+func (t *SefazTools) assinarQRCode(conteudo []byte) (string, error) {
+	if t.PrivateKey == nil {
+		return "", errors.New("certificado ou chave privada não carregados")
+	}
+	hash := sha1.Sum(conteudo)
+	assinatura, err := rsa.SignPKCS1v15(nil, t.PrivateKey, crypto.SHA1, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(assinatura), nil
+}
@@ -0,0 +1,47 @@
+package sefaz
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+func TestAdicionarInfNFeSuplContingencia(t *testing.T) {
+	tools := toolsTeste(t)
+	tools.Configuracoes.CSC = services.CSC{ID: "000001", Token: "CSC-TESTE"}
+	_, assinada := nfeAssinadaTeste(t, tools, services.ModeloNFCe, "9")
+	nfe, err := services.ParseNFe(assinada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digestValue := nfe.Signature.SignedInfo.Reference.DigestValue
+
+	comSupl, err := tools.AdicionarInfNFeSupl(assinada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lida, err := services.ParseNFe(comSupl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O QR Code de contingência leva o DigestValue do Signature em hexadecimal
+	if lida.InfNFeSupl == nil || !strings.Contains(lida.InfNFeSupl.QrCode, "|"+strings.ToUpper(hex.EncodeToString([]byte(digestValue)))+"|") {
+		t.Fatalf("QR Code sem o DigestValue da assinatura (%s):\n%s", digestValue, comSupl)
+	}
+	xmlNFCe := string(comSupl)
+	if !strings.Contains(xmlNFCe, "</infNFe><infNFeSupl>") || !strings.Contains(xmlNFCe, "</infNFeSupl><Signature") {
+		t.Fatalf("infNFeSupl deve ficar entre o infNFe e o Signature:\n%s", xmlNFCe)
+	}
+}
+
+func TestAdicionarInfNFeSuplSemAssinatura(t *testing.T) {
+	tools := toolsTeste(t)
+	tools.Configuracoes.CSC = services.CSC{ID: "000001", Token: "CSC-TESTE"}
+	montada, _ := nfeAssinadaTeste(t, tools, services.ModeloNFCe, "9")
+	_, err := tools.AdicionarInfNFeSupl([]byte(montada.XML))
+	if err == nil || !strings.Contains(err.Error(), "DigestValue") {
+		t.Fatalf("esperado erro de NFC-e sem assinatura, obtido %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package sefaz
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eugustavokeller/nfe-go/services"
+)
+
+// Situações do protocolo que geram o documento de distribuição (autorizada ou denegada)
+var cStatProtocoloDistribuicao = map[string]bool{
+	"100": true, // Autorizado o uso da NF-e
+	"150": true, // Autorizado o uso da NF-e, autorização fora de prazo
+	"110": true, // Uso denegado
+	"301": true, // Uso denegado: irregularidade fiscal do emitente
+	"302": true, // Uso denegado: irregularidade fiscal do destinatário
+	"303": true, // Uso denegado: destinatário não habilitado a operar na UF
+}
+
+// MontarNFeProc gera o XML de distribuição (nfeProc) a partir dos bytes exatos da NFe
+// assinada e do retorno da SEFAZ (retEnviNFe síncrono ou retConsReciNFe, com ou sem
+// envelope SOAP). A NFe e o protNFe são copiados sem reserialização, preservando a assinatura
+func MontarNFeProc(nfeAssinada []byte, retorno []byte) ([]byte, error) {
+	nfe, err := services.ParseNFe(nfeAssinada)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler a NFe assinada: %v", err)
+	}
+	if nfe.Signature == nil {
+		return nil, errors.New("a NFe não está assinada")
+	}
+	chave := strings.TrimPrefix(nfe.InfNFe.Id, "NFe")
+	if err := services.ConferirChaveAcesso(chave, nfe.InfNFe.Ide, nfe.InfNFe.Emit); err != nil {
+		return nil, err
+	}
+
+	nfeBruta, err := extrairElementos(nfeAssinada, "NFe")
+	if err != nil {
+		return nil, err
+	}
+
+	protocolos, err := extrairElementos(retorno, "protNFe")
+	if err != nil {
+		return nil, err
+	}
+	var protBruto []byte
+	var prot services.ProtNFe
+	for _, bruto := range protocolos {
+		var candidato services.ProtNFe
+		if err := xml.Unmarshal(bruto, &candidato); err != nil {
+			return nil, fmt.Errorf("erro ao ler protNFe: %v", err)
+		}
+		if candidato.InfProt.ChNFe == chave {
+			protBruto, prot = bruto, candidato
+			break
+		}
+	}
+	if protBruto == nil {
+		return nil, fmt.Errorf("protNFe da chave %s não encontrado no retorno", chave)
+	}
+	if !cStatProtocoloDistribuicao[prot.InfProt.CStat] {
+		return nil, fmt.Errorf("NFe não autorizada: %s - %s", prot.InfProt.CStat, prot.InfProt.XMotivo)
+	}
+	digestValue := nfe.Signature.SignedInfo.Reference.DigestValue
+	if prot.InfProt.DigVal != digestValue {
+		return nil, fmt.Errorf("digVal do protocolo (%s) difere do DigestValue da assinatura (%s)", prot.InfProt.DigVal, digestValue)
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	buffer.WriteString(`<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00">`)
+	buffer.Write(nfeBruta[0])
+	buffer.Write(protBruto)
+	buffer.WriteString(`</nfeProc>`)
+	return buffer.Bytes(), nil
+}
+
+// Retorna os bytes originais de cada elemento com o nome informado, sem reserializar
+func extrairElementos(data []byte, nome string) ([][]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var elementos [][]byte
+	for {
+		inicio := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler o XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != nome {
+			continue
+		}
+		if err := decoder.Skip(); err != nil {
+			return nil, fmt.Errorf("erro ao ler o elemento %s: %v", nome, err)
+		}
+		elementos = append(elementos, data[inicio:decoder.InputOffset()])
+	}
+	if len(elementos) == 0 {
+		return nil, fmt.Errorf("elemento %s não encontrado no XML", nome)
+	}
+	return elementos, nil
+}
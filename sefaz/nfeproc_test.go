@@ -0,0 +1,97 @@
+package sefaz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
+)
+
+// Monta uma NFe (ou NFC-e) pelo builder e a assina com o certificado de teste
+func nfeAssinadaTeste(t *testing.T, tools *SefazTools, mod, tpEmis string) (*services.NFeMontada, []byte) {
+	t.Helper()
+	ide := services.Ide{
+		CUF: "35", NatOp: "VENDA", Mod: mod, Serie: "1", NNF: "123", TpNF: "1", IdDest: "1", TpEmis: tpEmis,
+		CMunFG: "3550308", TpImp: "1", FinNFe: "1", IndFinal: "1", IndPres: "1", ProcEmi: "0", VerProc: "1.0",
+	}
+	emit := services.Emit{
+		CNPJ: "12345678000195", XNome: "EMPRESA TESTE",
+		EnderEmit: services.EnderEmit{XLgr: "RUA A", Nro: "1", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP", CEP: "01001000"},
+		IE:        "123456789", CRT: "3",
+	}
+	montada, err := services.NewNFeBuilder(ide, emit).
+		Relogio(clockwork.NewFakeClockAt(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC))).
+		Dest(services.Dest{CNPJ: "11222333000181", XNome: "CLIENTE", IndIEDest: "9",
+			EnderDest: services.EnderDest{XLgr: "RUA B", Nro: "2", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP"}}).
+		Det(services.Det{Prod: services.Prod{
+			CProd: "001", CEAN: "SEM GTIN", XProd: "PRODUTO", NCM: "61091000", CFOP: "5102", UCom: "UN",
+			QCom: 1, VUnCom: 10, VProd: 10, CEANTrib: "SEM GTIN", UTrib: "UN", QTrib: 1, VUnTrib: 10, IndTot: "1",
+		}}).
+		Pag(services.Pag{DetPag: []services.DetPag{{TPag: "01", VPag: "10.00"}}}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assinada, err := tools.AssinarXMLBytes([]byte(montada.XML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return montada, assinada
+}
+
+// Retorno síncrono simulado da SEFAZ, dentro do envelope SOAP, com o digVal informado
+func retornoAutorizacaoTeste(chave, digVal, cStat string) []byte {
+	return []byte(`<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>` +
+		`<nfeResultMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeAutorizacao4"><retEnviNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00">` +
+		`<tpAmb>2</tpAmb><verAplic>SP_NFE_PL009_V4</verAplic><cStat>104</cStat><xMotivo>Lote processado</xMotivo><cUF>35</cUF>` +
+		`<dhRecbto>2026-10-19T10:00:05-03:00</dhRecbto><protNFe versao="4.00"><infProt><tpAmb>2</tpAmb><verAplic>SP_NFE_PL009_V4</verAplic>` +
+		`<chNFe>` + chave + `</chNFe><dhRecbto>2026-10-19T10:00:05-03:00</dhRecbto><nProt>135260000000001</nProt>` +
+		`<digVal>` + digVal + `</digVal><cStat>` + cStat + `</cStat><xMotivo>Autorizado o uso da NF-e</xMotivo></infProt></protNFe>` +
+		`</retEnviNFe></nfeResultMsg></soap:Body></soap:Envelope>`)
+}
+
+func TestMontarNFeProcAssinadaPeloBuilder(t *testing.T) {
+	tools := toolsTeste(t)
+	montada, assinada := nfeAssinadaTeste(t, tools, services.ModeloNFe, "1")
+	nfe, err := services.ParseNFe(assinada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nfe.Signature == nil || nfe.Signature.SignedInfo.Reference.DigestValue == "" {
+		t.Fatal("a NFe assinada deve trazer o DigestValue da assinatura")
+	}
+
+	retorno := retornoAutorizacaoTeste(montada.ChaveAcesso, nfe.Signature.SignedInfo.Reference.DigestValue, "100")
+	proc, err := MontarNFeProc(assinada, retorno)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A NFe assinada é copiada byte a byte, sem a declaração XML
+	nfeBruta := assinada[bytes.Index(assinada, []byte("<NFe")):]
+	if !bytes.Contains(proc, nfeBruta) {
+		t.Fatalf("nfeProc sem a NFe assinada original:\n%s", proc)
+	}
+	lido, err := services.ParseNFeProc(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lido.ProtNFe.InfProt.NProt != "135260000000001" || strings.TrimPrefix(lido.NFe.InfNFe.Id, "NFe") != montada.ChaveAcesso {
+		t.Fatalf("nfeProc lido incorretamente: %+v", lido.ProtNFe.InfProt)
+	}
+	// A assinatura continua válida na NFe extraída do nfeProc
+	nfeProc, err := extrairElementos(proc, "NFe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	validarAssinaturaNFe(t, string(nfeProc[0]), tools.Certificado)
+
+	if _, err := MontarNFeProc(assinada, retornoAutorizacaoTeste(montada.ChaveAcesso, "outro", "100")); err == nil {
+		t.Fatal("esperado erro com digVal diferente do DigestValue")
+	}
+	if _, err := MontarNFeProc(assinada, retornoAutorizacaoTeste(montada.ChaveAcesso, nfe.Signature.SignedInfo.Reference.DigestValue, "539")); err == nil {
+		t.Fatal("esperado erro para protocolo rejeitado")
+	}
+}
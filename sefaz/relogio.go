@@ -0,0 +1,131 @@
+package sefaz
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
+)
+
+// Amostras mantidas na estimativa do desvio do relógio local
+const amostrasDesvio = 15
+
+// Desvio acima do qual AlertaDesvio é chamado quando Configuracoes.LimiteDesvio não é informado
+const limiteDesvioPadrao = time.Minute
+
+// EstimativaDesvio acompanha a diferença entre o horário da SEFAZ (dhRecbto) e o relógio
+// local. A estimativa é a mediana das últimas amostras, o que descarta respostas lentas
+type EstimativaDesvio struct {
+	mutex    sync.Mutex
+	amostras []time.Duration
+	proxima  int
+}
+
+func NovaEstimativaDesvio() *EstimativaDesvio {
+	return &EstimativaDesvio{amostras: make([]time.Duration, 0, amostrasDesvio)}
+}
+
+// Registrar compara o dhRecbto com o instante local do meio da requisição (entre o envio
+// e a resposta) e retorna a nova estimativa
+func (e *EstimativaDesvio) Registrar(enviado, recebido time.Time, dhRecbto string) (time.Duration, error) {
+	servidor, err := services.ParseDataHora(dhRecbto)
+	if err != nil {
+		return 0, err
+	}
+	// O dhRecbto é truncado no segundo: o meio do segundo é a melhor aproximação
+	local := enviado.Add(recebido.Sub(enviado) / 2)
+	amostra := servidor.Add(500 * time.Millisecond).Sub(local)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if len(e.amostras) < amostrasDesvio {
+		e.amostras = append(e.amostras, amostra)
+	} else {
+		e.amostras[e.proxima] = amostra
+		e.proxima = (e.proxima + 1) % amostrasDesvio
+	}
+	return e.mediana(), nil
+}
+
+// Desvio retorna quanto o relógio da SEFAZ está adiantado (positivo) ou atrasado em
+// relação ao local, e false enquanto não houver amostras
+func (e *EstimativaDesvio) Desvio() (time.Duration, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if len(e.amostras) == 0 {
+		return 0, false
+	}
+	return e.mediana(), true
+}
+
+func (e *EstimativaDesvio) mediana() time.Duration {
+	ordenadas := append([]time.Duration(nil), e.amostras...)
+	sort.Slice(ordenadas, func(i, j int) bool { return ordenadas[i] < ordenadas[j] })
+	meio := len(ordenadas) / 2
+	if len(ordenadas)%2 == 0 {
+		return (ordenadas[meio-1] + ordenadas[meio]) / 2
+	}
+	return ordenadas[meio]
+}
+
+// Relógio local deslocado pelo desvio estimado, aproximando o horário da SEFAZ
+type relogioCorrigido struct {
+	clockwork.Clock
+	desvio time.Duration
+}
+
+func (r relogioCorrigido) Now() time.Time {
+	return r.Clock.Now().Add(r.desvio)
+}
+
+func (r relogioCorrigido) Since(t time.Time) time.Duration {
+	return r.Now().Sub(t)
+}
+
+// Relógio configurado ou, quando a ferramenta foi montada sem NewSefazTools, o do sistema
+func (t *SefazTools) relogio() clockwork.Clock {
+	if t.Relogio == nil {
+		return clockwork.NewRealClock()
+	}
+	return t.Relogio
+}
+
+// Relógio ajustado ao horário da SEFAZ, quando já houver estimativa do desvio
+func (t *SefazTools) relogioSefaz() clockwork.Clock {
+	if desvio, ok := t.Desvio.Desvio(); ok {
+		return relogioCorrigido{Clock: t.relogio(), desvio: desvio}
+	}
+	return t.relogio()
+}
+
+// Relógio usado no dhEmi: o da SEFAZ quando Configuracoes.CorrigirDhEmi estiver ativo
+func (t *SefazTools) relogioEmissao() clockwork.Clock {
+	if t.Configuracoes.CorrigirDhEmi {
+		return t.relogioSefaz()
+	}
+	return t.relogio()
+}
+
+// Registra o dhRecbto de uma resposta e chama AlertaDesvio, quando houver, se o desvio
+// passar do limite. Um dhRecbto ausente ou inválido não interrompe o processamento da resposta
+func (t *SefazTools) registrarDhRecbto(enviado, recebido time.Time, dhRecbto string) {
+	if t.Desvio == nil || dhRecbto == "" {
+		return
+	}
+	desvio, err := t.Desvio.Registrar(enviado, recebido, dhRecbto)
+	if err != nil {
+		return
+	}
+	limite := t.Configuracoes.LimiteDesvio
+	if limite <= 0 {
+		limite = limiteDesvioPadrao
+	}
+	if t.AlertaDesvio != nil && (desvio > limite || desvio < -limite) {
+		t.AlertaDesvio(desvio)
+	}
+}
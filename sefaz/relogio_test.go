@@ -0,0 +1,187 @@
+package sefaz
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
+)
+
+// dhRecbto da SEFAZ adiantado em desvio, com 1 segundo entre o envio e a resposta: o meio
+// da requisição coincide com o meio do segundo do dhRecbto e a amostra é exatamente o desvio
+func registrarAmostra(t *testing.T, e *EstimativaDesvio, desvio time.Duration) time.Duration {
+	t.Helper()
+	enviado := autorizacaoTeste
+	dhRecbto, err := services.NovaDataHora(enviado.Add(desvio), "SP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimativa, err := e.Registrar(enviado, enviado.Add(time.Second), dhRecbto.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return estimativa
+}
+
+func TestEstimativaDesvio(t *testing.T) {
+	e := NovaEstimativaDesvio()
+	if _, ok := e.Desvio(); ok {
+		t.Fatal("estimativa sem amostras")
+	}
+	var nula *EstimativaDesvio
+	if _, ok := nula.Desvio(); ok {
+		t.Fatal("estimativa nula sem amostras")
+	}
+
+	// A mediana descarta a resposta lenta; com um número par de amostras, a média das centrais
+	for _, c := range []struct {
+		amostra, estimativa time.Duration
+	}{
+		{10 * time.Second, 10 * time.Second},
+		{12 * time.Second, 11 * time.Second},
+		{5 * time.Minute, 12 * time.Second},
+		{11 * time.Second, 11500 * time.Millisecond},
+		{-time.Minute, 11 * time.Second},
+	} {
+		if estimativa := registrarAmostra(t, e, c.amostra); estimativa != c.estimativa {
+			t.Fatalf("estimativa após a amostra de %v = %v, esperado %v", c.amostra, estimativa, c.estimativa)
+		}
+	}
+	if desvio, ok := e.Desvio(); !ok || desvio != 11*time.Second {
+		t.Fatalf("Desvio() = %v, %v", desvio, ok)
+	}
+
+	// dhRecbto inválido não entra na estimativa
+	if _, err := e.Registrar(autorizacaoTeste, autorizacaoTeste, "2026-10-19T10:00:00Z"); err == nil {
+		t.Fatal("esperado erro com dhRecbto inválido")
+	}
+	if desvio, _ := e.Desvio(); desvio != 11*time.Second {
+		t.Fatalf("dhRecbto inválido alterou a estimativa: %v", desvio)
+	}
+
+	// Só as últimas amostras contam: o ajuste do relógio local é refletido após meia janela
+	e = NovaEstimativaDesvio()
+	for i := 0; i < amostrasDesvio; i++ {
+		registrarAmostra(t, e, 0)
+	}
+	var estimativa time.Duration
+	for i := 0; i <= amostrasDesvio/2; i++ {
+		estimativa = registrarAmostra(t, e, time.Minute)
+	}
+	if estimativa != time.Minute {
+		t.Fatalf("estimativa após renovar a janela = %v, esperado 1m", estimativa)
+	}
+}
+
+func TestRegistrarDhRecbto(t *testing.T) {
+	casos := []struct {
+		nome     string
+		dhRecbto string
+		limite   time.Duration
+		alerta   time.Duration // 0: sem alerta
+	}{
+		{"dentro do limite padrão", "2026-10-19T10:00:59-03:00", 0, 0},
+		{"SEFAZ adiantada", "2026-10-19T10:02:00-03:00", 0, 2*time.Minute + 500*time.Millisecond},
+		{"SEFAZ atrasada", "2026-10-19T09:58:00-03:00", 0, -2*time.Minute + 500*time.Millisecond},
+		{"limite configurado", "2026-10-19T10:00:30-03:00", 10 * time.Second, 30*time.Second + 500*time.Millisecond},
+		{"limite configurado não atingido", "2026-10-19T10:02:00-03:00", 5 * time.Minute, 0},
+		{"dhRecbto ausente", "", 0, 0},
+		{"dhRecbto inválido", "2026-10-19T10:05:00", 0, 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			var alertas []time.Duration
+			tools := &SefazTools{
+				Configuracoes: Configuracoes{LimiteDesvio: c.limite},
+				Desvio:        NovaEstimativaDesvio(),
+				AlertaDesvio:  func(desvio time.Duration) { alertas = append(alertas, desvio) },
+			}
+			tools.registrarDhRecbto(autorizacaoTeste, autorizacaoTeste, c.dhRecbto)
+			if c.alerta == 0 && len(alertas) != 0 || c.alerta != 0 && (len(alertas) != 1 || alertas[0] != c.alerta) {
+				t.Fatalf("alertas = %v, esperado %v", alertas, c.alerta)
+			}
+		})
+	}
+
+	// Sem AlertaDesvio ou sem estimativa, o desvio não gera alerta nem falha
+	tools := &SefazTools{Desvio: NovaEstimativaDesvio()}
+	tools.registrarDhRecbto(autorizacaoTeste, autorizacaoTeste, "2026-10-19T11:00:00-03:00")
+	if desvio, ok := tools.Desvio.Desvio(); !ok || desvio != time.Hour+500*time.Millisecond {
+		t.Fatalf("desvio sem AlertaDesvio = %v, %v", desvio, ok)
+	}
+	(&SefazTools{}).registrarDhRecbto(autorizacaoTeste, autorizacaoTeste, "2026-10-19T11:00:00-03:00")
+}
+
+// O dhRecbto da consulta de status alimenta a estimativa e o alerta
+func TestConsultarStatusServicoDesvio(t *testing.T) {
+	retorno := []byte(`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body><nfeResultMsg>` +
+		`<retConsStatServ xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><tpAmb>2</tpAmb><verAplic>SP_NFE_PL009_V4</verAplic>` +
+		`<cStat>107</cStat><xMotivo>Serviço em Operação</xMotivo><cUF>35</cUF><dhRecbto>2026-10-19T10:03:00-03:00</dhRecbto></retConsStatServ>` +
+		`</nfeResultMsg></soap:Body></soap:Envelope>`)
+	servidor := servidorSOAP12Teste(t, "/ws/NfeStatusServico/NfeStatusServico4.asmx", retorno)
+	var alerta time.Duration
+	tools := &SefazTools{
+		URLPortal:     servidor.URL,
+		Configuracoes: Configuracoes{SiglaUF: "SP"},
+		Relogio:       clockwork.NewFakeClockAt(autorizacaoTeste),
+		Desvio:        NovaEstimativaDesvio(),
+		AlertaDesvio:  func(desvio time.Duration) { alerta = desvio },
+	}
+	if _, err := tools.ConsultarStatusServico(); err != nil {
+		t.Fatal(err)
+	}
+	if esperado := 3*time.Minute + 500*time.Millisecond; alerta != esperado {
+		t.Fatalf("alerta = %v, esperado %v", alerta, esperado)
+	}
+}
+
+func TestCorrigirDhEmi(t *testing.T) {
+	c := chaveEventoTeste(t, services.ModeloNFe, "35", "123")
+	servidor, recebido := servidorEventoTeste(t, func(string) string {
+		return retornoEventoTeste("128", c.String(), services.TpEventoCancelamento, "1", "135")
+	})
+	for _, caso := range []struct {
+		corrigir bool
+		dhEvento string
+	}{
+		{false, "2026-10-19T10:10:00-03:00"},
+		{true, "2026-10-19T10:12:00-03:00"},
+	} {
+		// Relógio local às 10:10 e SEFAZ 2 minutos adiantada
+		tools := toolsEventoTeste(t, 10*time.Minute, c)
+		tools.URLPortal = servidor.URL
+		tools.Configuracoes.CorrigirDhEmi = caso.corrigir
+		tools.Desvio = NovaEstimativaDesvio()
+		registrarAmostra(t, tools.Desvio, 2*time.Minute)
+
+		if agora := tools.relogioSefaz().Now(); !agora.Equal(autorizacaoTeste.Add(12 * time.Minute)) {
+			t.Fatalf("relógio da SEFAZ = %v", agora)
+		}
+		if _, err := tools.Cancelar(c.String(), "135260000000001", "Venda cancelada pelo cliente"); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(*recebido, "<dhEvento>"+caso.dhEvento+"</dhEvento>") {
+			t.Fatalf("CorrigirDhEmi %v: esperado dhEvento %s em\n%s", caso.corrigir, caso.dhEvento, *recebido)
+		}
+	}
+
+	// O NFeBuilder da ferramenta também usa o relógio corrigido
+	tools := toolsEventoTeste(t, 10*time.Minute)
+	tools.Configuracoes.CorrigirDhEmi = true
+	tools.Desvio = NovaEstimativaDesvio()
+	registrarAmostra(t, tools.Desvio, 2*time.Minute)
+	ide := services.Ide{CUF: "35", NatOp: "VENDA", Mod: services.ModeloNFe, Serie: "1", NNF: "123", TpNF: "1", IdDest: "1",
+		CMunFG: "3550308", TpImp: "1", FinNFe: "1", IndFinal: "1", IndPres: "1", ProcEmi: "0", VerProc: "1.0"}
+	emit := services.Emit{CNPJ: "12345678000195", XNome: "EMPRESA TESTE", IE: "123456789", CRT: "3",
+		EnderEmit: services.EnderEmit{XLgr: "RUA A", Nro: "1", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP", CEP: "01000000"}}
+	montada, err := tools.NFeBuilder(ide, emit).Det(services.Det{Prod: services.Prod{CProd: "1", XProd: "PRODUTO", NCM: "61091000",
+		CFOP: "5102", UCom: "UN", QCom: 1, VUnCom: 10, VProd: 10, UTrib: "UN", QTrib: 1, VUnTrib: 10, IndTot: "1"}}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if montada.InfNFe.Ide.DhEmi != "2026-10-19T10:12:00-03:00" {
+		t.Fatalf("dhEmi corrigido = %s", montada.InfNFe.Ide.DhEmi)
+	}
+}
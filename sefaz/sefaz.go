@@ -1,6 +1,7 @@
 package sefaz
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -9,6 +10,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -17,16 +19,31 @@ import (
 
 	"github.com/beevik/etree"
 	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
 	dsig "github.com/russellhaering/goxmldsig"
 )
 
 // Configurações e certificados necessários
 type Configuracoes struct {
-	EmitenteID       int
-	CertificadoPath  string
-	CertificadoSenha string
-	Ambiente         string // "producao" ou "homologacao"
-	SiglaUF          string
+	EmitenteID             int
+	CertificadoPath        string
+	CertificadoSenha       string
+	Ambiente               string // "producao" ou "homologacao"
+	SiglaUF                string
+	CSRT                   map[string]services.CSRT // CSRT do responsável técnico por sigla da UF
+	ArquivoChaves          string                   // Registro local das chaves emitidas (opcional)
+	ArquivoEventos         string                   // Registro local do nSeqEvento de cada evento por chave (opcional)
+	CorrigirDhEmi          bool                     // Gera o dhEmi com o desvio estimado do relógio da SEFAZ
+	LimiteDesvio           time.Duration            // Desvio do relógio que dispara AlertaDesvio (padrão: 1 minuto)
+	CSC                    services.CSC             // CSC do QR Code da NFC-e (versão 2)
+	VersaoQRCode           int                      // Versão do QR Code da NFC-e: 2 (padrão) ou 3
+	URLQRCode              string                   // Substitui o endereço do QR Code da tabela por UF (opcional)
+	URLChave               string                   // Substitui o urlChave da tabela por UF (opcional)
+	PrazoCancelamento      time.Duration            // Prazo do cancelamento da NF-e contado da autorização (padrão: 24 horas)
+	PrazosCancelamentoNFCe map[string]time.Duration // Prazo do cancelamento da NFC-e por sigla da UF (padrão: 30 minutos)
+	CancelamentoForaPrazo  bool                     // Envia o cancelamento após o prazo, nas UFs que o admitem
+	PrazosCancSubst        map[string]time.Duration // Prazo do cancelamento por substituição da NFC-e por sigla da UF (padrão: 168 horas)
+	VerAplic               string                   // Versão do aplicativo informada nos eventos que a exigem (padrão: "nfe-go")
 }
 
 type NotaFiscal struct {
@@ -42,7 +59,14 @@ type SefazTools struct {
 	Configuracoes Configuracoes
 	Certificado   *x509.Certificate
 	PrivateKey    *rsa.PrivateKey
-	URLPortal     string
+	URLPortal     string // Endereço base (só o host); o caminho de cada serviço é acrescentado no envio
+	URLPortalNFCe string // Serviços da NFC-e (modelo 65), que na maioria das UFs ficam em outro endereço
+	Registro      *services.RegistroChavesMemoria
+	Relogio       clockwork.Clock // Relógio do dhEmi e da validação local (padrão: relógio do sistema)
+	Desvio        *EstimativaDesvio
+	AlertaDesvio  func(desvio time.Duration) // Chamado quando o desvio passa de LimiteDesvio (padrão: nenhum alerta; consulte Desvio)
+	Autorizacoes  *RegistroAutorizacoes      // Datas das autorizações, para os prazos dos eventos
+	Eventos       *SequenciaEventos          // Último nSeqEvento de cada tipo de evento por chave (ver Configuracoes.ArquivoEventos)
 }
 
 // Estrutura para resposta do SEFAZ
@@ -62,31 +86,117 @@ func NewSefazTools(config Configuracoes) (*SefazTools, error) {
 	}
 
 	urlSefaz := os.Getenv("SEFAZ_URL_HOMOLOGACAO")
+	urlNFCe := os.Getenv("SEFAZ_URL_NFCE_HOMOLOGACAO")
 	if config.Ambiente == "producao" {
 		urlSefaz = os.Getenv("SEFAZ_URL")
+		urlNFCe = os.Getenv("SEFAZ_URL_NFCE")
+	}
+	var registro *services.RegistroChavesMemoria
+	if config.ArquivoChaves != "" {
+		registro, err = services.AbrirRegistroChaves(config.ArquivoChaves)
+		if err != nil {
+			return nil, err
+		}
+	}
+	eventos := NovaSequenciaEventos()
+	if config.ArquivoEventos != "" {
+		eventos, err = AbrirSequenciaEventos(config.ArquivoEventos)
+		if err != nil {
+			if registro != nil {
+				registro.Fechar()
+			}
+			return nil, err
+		}
 	}
 	return &SefazTools{
 		Configuracoes: config,
 		Certificado:   cert,
 		PrivateKey:    privKey,
 		URLPortal:     urlSefaz,
+		URLPortalNFCe: urlNFCe,
+		Registro:      registro,
+		Relogio:       clockwork.NewRealClock(),
+		Desvio:        NovaEstimativaDesvio(),
+		Autorizacoes:  NovoRegistroAutorizacoes(),
+		Eventos:       eventos,
 	}, nil
 }
 
 func (t *SefazTools) AssinarXML(xmlContent string) (string, error) {
+	xmlAssinado, err := t.AssinarXMLBytes([]byte(xmlContent))
+	if err != nil {
+		return "", err
+	}
+	return string(xmlAssinado), nil
+}
+
+// AssinarXMLBytes assina o infNFe do XML gerado por services.EscreverNFe e insere o
+// Signature logo após o </infNFe>. O documento é lido uma única vez e o infNFe assinado
+// é mantido byte a byte, sem ser serializado novamente
+func (t *SefazTools) AssinarXMLBytes(xmlContent []byte) ([]byte, error) {
 	if t.Certificado == nil || t.PrivateKey == nil {
-		return "", errors.New("certificado ou chave privada não carregados")
+		return nil, errors.New("certificado ou chave privada não carregados")
 	}
 
-	// Assinar o XML com a chave privada
-	assinatura, err := AssinarConteudo(xmlContent, t.PrivateKey, "NFe41240706101244000490550010000067271091023595")
+	// Localizar o infNFe a ser assinado
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlContent); err != nil {
+		return nil, fmt.Errorf("erro ao parsear o XML: %v", err)
+	}
+	infNFe := doc.FindElement("//infNFe[@Id]")
+	if infNFe == nil {
+		return nil, errors.New("elemento infNFe com atributo Id não encontrado")
+	}
+
+	// Gerar o Signature envelopado do infNFe
+	signature, err := services.AssinarElemento(infNFe, t.PrivateKey, t.Certificado)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao assinar XML: %v", err)
+	}
+	assinatura := etree.NewDocument()
+	assinatura.SetRoot(signature)
+	assinaturaBytes, err := assinatura.WriteToBytes()
 	if err != nil {
-		return "", fmt.Errorf("erro ao assinar XML: %v", err)
+		return nil, fmt.Errorf("erro ao gerar o Signature: %v", err)
 	}
 
 	// Inserir a assinatura no XML
-	xmlAssinado := InserirAssinaturaNoXML(xmlContent, assinatura)
-	return xmlAssinado, nil
+	return InserirAssinaturaNoXMLBytes(xmlContent, string(assinaturaBytes)), nil
+}
+
+// AssinarArvore assina a NFe montada com as funções MakeTag* (services.MakeTagNFe ou os
+// grupos avulsos, como MakeTagInfRespTec). A árvore é serializada por
+// services.GenerateCompactXML, sem espaços entre as tags e sem os opcionais vazios, e
+// resulta no mesmo XML que services.EscreverNFe gera para a nota
+func (t *SefazTools) AssinarArvore(root services.DynamicElement) (string, error) {
+	xmlNFe, err := services.GenerateCompactXML(root)
+	if err != nil {
+		return "", err
+	}
+	return t.AssinarXML(xmlNFe)
+}
+
+// NFeBuilder cria o montador da NFe com o tpAmb definido pelo ambiente configurado, o
+// relógio da ferramenta, os CSRT por UF e, quando houver, o registro local de chaves emitidas
+func (t *SefazTools) NFeBuilder(ide services.Ide, emit services.Emit) *services.NFeBuilder {
+	builder := services.NewNFeBuilder(ide, emit).
+		Ambiente(t.Configuracoes.Ambiente).
+		Relogio(t.relogioEmissao()).
+		CSRT(t.Configuracoes.CSRT)
+	if t.Registro != nil {
+		builder.RegistroChaves(t.Registro)
+	}
+	return builder
+}
+
+// MakeTagInfRespTec gera a tag infRespTec, incluindo idCSRT e hashCSRT quando houver
+// CSRT configurado para a UF da nota (cUF da chave de acesso), como no NFeBuilder
+func (t *SefazTools) MakeTagInfRespTec(infRespTec services.InfRespTec, chaveAcesso string) (services.DynamicElement, error) {
+	infRespTec, err := services.AplicarCSRTUF(t.Configuracoes.CSRT, infRespTec, chaveAcesso)
+	if err != nil {
+		return services.DynamicElement{}, fmt.Errorf("erro ao gerar hashCSRT: %v", err)
+	}
+	return services.MakeTagInfRespTec(infRespTec), nil
 }
 
 func (t *SefazTools) EnviarLote(notasFiscais []NotaFiscal, idLote string, indSinc int) (*SefazResponse, error) {
@@ -94,25 +204,49 @@ func (t *SefazTools) EnviarLote(notasFiscais []NotaFiscal, idLote string, indSin
 		return nil, errors.New("nenhuma nota fiscal fornecida para envio")
 	}
 
-	// Gerar XML do lote
-	var loteXML string
-	for _, nota := range notasFiscais {
-		loteXML += nota.XML
+	// Validar as regras de negócio antes do envio, evitando rejeições conhecidas
+	if err := t.ValidarRegras(notasFiscais); err != nil {
+		return nil, err
+	}
+
+	// A NFC-e só é autorizada no modo síncrono, em lotes de um único modelo
+	modelo, err := modeloLote(notasFiscais)
+	if err != nil {
+		return nil, err
+	}
+	urlPortal := t.URLPortal
+	if modelo == services.ModeloNFCe {
+		if indSinc != 1 || len(notasFiscais) > 1 {
+			return nil, errors.New("a NFC-e só é autorizada no modo síncrono (indSinc=1), com uma nota por lote")
+		}
+		if t.URLPortalNFCe == "" {
+			return nil, errors.New("endereço dos serviços da NFC-e não configurado")
+		}
+		urlPortal = t.URLPortalNFCe
+	}
+
+	// Gerar o XML do lote dentro do envelope SOAP 1.2
+	lote := &bytes.Buffer{}
+	lote.WriteString(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body>` +
+		`<nfeDadosMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeAutorizacao4">`)
+	if err := EscreverEnviNFe(lote, idLote, indSinc, notasFiscais); err != nil {
+		return nil, fmt.Errorf("erro ao gerar o lote: %v", err)
 	}
-	requestXML := fmt.Sprintf(`
-		<enviNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00">
-			<idLote>%s</idLote>
-			<indSinc>%d</indSinc>
-			%s
-		</enviNFe>
-	`, idLote, indSinc, loteXML)
+	lote.WriteString(`</nfeDadosMsg></soap12:Body></soap12:Envelope>`)
 
 	// Enviar para o endpoint SEFAZ
-	urlServico := fmt.Sprintf("%s/ws/NfeAutorizacao/NFeAutorizacao4.asmx", t.URLPortal)
-	responseXML, err := EnviarSOAP(urlServico, requestXML)
+	urlServico := fmt.Sprintf("%s/ws/NfeAutorizacao/NFeAutorizacao4.asmx", urlPortal)
+	enviado := t.relogio().Now()
+	responseXML, err := EnviarSOAPBytes(urlServico, lote.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("erro ao enviar lote para SEFAZ: %v", err)
 	}
+	if ret, err := services.ParseRetEnviNFe([]byte(responseXML)); err == nil {
+		t.registrarDhRecbto(enviado, t.relogio().Now(), ret.DhRecbto)
+		if ret.ProtNFe != nil {
+			t.registrarProtocolo(ret.ProtNFe.InfProt)
+		}
+	}
 
 	// Processar resposta
 	response := &SefazResponse{}
@@ -120,10 +254,119 @@ func (t *SefazTools) EnviarLote(notasFiscais []NotaFiscal, idLote string, indSin
 	if err != nil {
 		return nil, fmt.Errorf("erro ao processar resposta da SEFAZ: %v", err)
 	}
+	// Retorno original, usado para montar o nfeProc com o protNFe sem reserialização
+	response.XMLRetorno = responseXML
 
 	return response, nil
 }
 
+// Modelo comum às notas do lote, lido de NotaFiscal.Modelo ou, quando ausente, da chave
+// de acesso ou do próprio XML
+func modeloLote(notasFiscais []NotaFiscal) (string, error) {
+	var modelo string
+	for i, nota := range notasFiscais {
+		mod := nota.Modelo
+		if mod == "" {
+			if chave, err := services.ParseChaveAcesso(nota.ChaveAcesso); err == nil {
+				mod = chave.Mod
+			} else if nfe, err := services.ParseNFe([]byte(nota.XML)); err == nil {
+				mod = nfe.InfNFe.Ide.Mod
+			}
+		}
+		if mod == "" {
+			mod = services.ModeloNFe
+		}
+		if i > 0 && mod != modelo {
+			return "", fmt.Errorf("o lote não pode misturar notas dos modelos %s e %s", modelo, mod)
+		}
+		modelo = mod
+	}
+	return modelo, nil
+}
+
+// EscreverEnviNFe escreve o lote enviNFe com as notas copiadas sem reserialização,
+// removendo a declaração XML de cada nota
+func EscreverEnviNFe(w io.Writer, idLote string, indSinc int, notasFiscais []NotaFiscal) error {
+	if _, err := fmt.Fprintf(w, `<enviNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><idLote>%s</idLote><indSinc>%d</indSinc>`, idLote, indSinc); err != nil {
+		return err
+	}
+	for _, nota := range notasFiscais {
+		conteudo := nota.XML
+		if strings.HasPrefix(conteudo, "<?xml") {
+			if fim := strings.Index(conteudo, "?>"); fim >= 0 {
+				conteudo = conteudo[fim+2:]
+			}
+		}
+		if _, err := io.WriteString(w, strings.TrimSpace(conteudo)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</enviNFe>")
+	return err
+}
+
+// ValidarRegras aplica as regras do MOC a cada nota do lote, considerando também
+// a duplicidade entre as notas do próprio lote
+func (t *SefazTools) ValidarRegras(notasFiscais []NotaFiscal) error {
+	ctx := services.ContextoValidacao{
+		Agora: t.relogioSefaz().Now(),
+		TpAmb: "2",
+		CUF:   services.CodigosUF[t.Configuracoes.SiglaUF],
+	}
+	if t.Configuracoes.Ambiente == "producao" {
+		ctx.TpAmb = "1"
+	}
+	if t.Registro != nil {
+		ctx.ChavesEmitidas = t.Registro.Chaves()
+	}
+	notas := make([]*services.NFe, len(notasFiscais))
+	for i, nota := range notasFiscais {
+		nfe, err := services.ParseNFe([]byte(nota.XML))
+		if err != nil {
+			return fmt.Errorf("erro ao ler a nota %d do lote: %v", i+1, err)
+		}
+		notas[i] = nfe
+		ctx.ChavesEmitidas = append(ctx.ChavesEmitidas, strings.TrimPrefix(nfe.InfNFe.Id, "NFe"))
+	}
+	for _, nfe := range notas {
+		if err := services.ValidarRegras(nfe.InfNFe, ctx); err != nil {
+			return fmt.Errorf("nota %s rejeitada na validação local: %w", nfe.InfNFe.Id, err)
+		}
+		if t.Certificado != nil {
+			if err := services.ConferirCertificadoEmitente(t.Certificado, nfe.InfNFe.Emit); err != nil {
+				return fmt.Errorf("nota %s rejeitada na validação local: %w", nfe.InfNFe.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConsultarStatusServico consulta o status do serviço de autorização da UF configurada.
+// O dhRecbto do retorno alimenta a estimativa do desvio do relógio local
+func (t *SefazTools) ConsultarStatusServico() (*services.RetConsStatServ, error) {
+	tpAmb := "2"
+	if t.Configuracoes.Ambiente == "producao" {
+		tpAmb = "1"
+	}
+	envelope := fmt.Sprintf(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body>`+
+		`<nfeDadosMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeStatusServico4">`+
+		`<consStatServ xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><tpAmb>%s</tpAmb><cUF>%s</cUF><xServ>STATUS</xServ></consStatServ>`+
+		`</nfeDadosMsg></soap12:Body></soap12:Envelope>`, tpAmb, services.CodigosUF[t.Configuracoes.SiglaUF])
+
+	urlServico := fmt.Sprintf("%s/ws/NfeStatusServico/NfeStatusServico4.asmx", t.URLPortal)
+	enviado := t.relogio().Now()
+	responseXML, err := EnviarSOAP(urlServico, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar o status do serviço: %v", err)
+	}
+	ret, err := services.ParseRetConsStatServ([]byte(responseXML))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao processar resposta da SEFAZ: %v", err)
+	}
+	t.registrarDhRecbto(enviado, t.relogio().Now(), ret.DhRecbto)
+	return ret, nil
+}
+
 func ConsultarRecibo(url string, recibo string) (string, error) {
 	soapEnvelope := fmt.Sprintf(`
 		<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:nfe="http://www.portalfiscal.inf.br/nfe/wsdl/NFeRetAutorizacao4">
@@ -180,16 +423,22 @@ func ConsultarRecibo(url string, recibo string) (string, error) {
 }
 
 func EnviarSOAP(url string, xmlContent string) (string, error) {
+	return EnviarSOAPBytes(url, []byte(xmlContent))
+}
+
+// EnviarSOAPBytes envia o envelope SOAP 1.2 sem conversão intermediária para string. O
+// SOAP 1.2 exige o tipo application/soap+xml; text/xml é o do SOAP 1.1
+func EnviarSOAPBytes(url string, xmlContent []byte) (string, error) {
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
 
-	request, err := http.NewRequest("POST", url, strings.NewReader(xmlContent))
+	request, err := http.NewRequest("POST", url, bytes.NewReader(xmlContent))
 	if err != nil {
 		return "", fmt.Errorf("erro ao criar requisição SOAP: %v", err)
 	}
 
-	request.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	request.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
 	response, err := client.Do(request)
 	if err != nil {
 		return "", fmt.Errorf("erro ao enviar requisição SOAP: %v", err)
@@ -205,6 +454,9 @@ func EnviarSOAP(url string, xmlContent string) (string, error) {
 }
 
 // AssinarConteudo realiza a assinatura do XML com base em uma chave privada
+//
+// Deprecated: retorna apenas o valor da assinatura RSA-SHA256, sem o elemento Signature
+// exigido pela SEFAZ. Use SefazTools.AssinarXML ou services.AssinarXML
 func AssinarConteudo(xmlContent string, privateKey *rsa.PrivateKey, elementID string) (string, error) {
 	// Parse do XML usando etree
 	doc := etree.NewDocument()
@@ -240,11 +492,22 @@ func AssinarConteudo(xmlContent string, privateKey *rsa.PrivateKey, elementID st
 	return signatureBase64, nil
 }
 
+// InserirAssinaturaNoXML insere o elemento Signature serializado logo após o fechamento
+// do </infNFe>, como irmão do infNFe assinado
 func InserirAssinaturaNoXML(xmlContent, assinatura string) string {
-	// Inserir a assinatura no local apropriado do XML
-	// Assumimos que a assinatura deve ser inserida imediatamente antes do fechamento da tag `</infNFe>`
-	insertPoint := "</infNFe>"
-	signedXML := strings.Replace(xmlContent, insertPoint, assinatura+insertPoint, 1)
+	return string(InserirAssinaturaNoXMLBytes([]byte(xmlContent), assinatura))
+}
 
-	return signedXML
+// InserirAssinaturaNoXMLBytes é a versão de InserirAssinaturaNoXML sobre []byte
+func InserirAssinaturaNoXMLBytes(xmlContent []byte, assinatura string) []byte {
+	insertPoint := []byte("</infNFe>")
+	i := bytes.Index(xmlContent, insertPoint)
+	if i < 0 {
+		return xmlContent
+	}
+	i += len(insertPoint)
+	signedXML := make([]byte, 0, len(xmlContent)+len(assinatura))
+	signedXML = append(signedXML, xmlContent[:i]...)
+	signedXML = append(signedXML, assinatura...)
+	return append(signedXML, xmlContent[i:]...)
 }
@@ -0,0 +1,218 @@
+package sefaz
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/eugustavokeller/nfe-go/services"
+	"github.com/jonboulle/clockwork"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+func toolsTeste(t *testing.T) *SefazTools {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelo := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "EMPRESA TESTE:12345678000199"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, modelo, modelo, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SefazTools{Certificado: cert, PrivateKey: key}
+}
+
+// Confere com o validador do goxmldsig que o Signature é irmão do infNFe e assina o infNFe
+func validarAssinaturaNFe(t *testing.T, xmlAssinado string, cert *x509.Certificate) {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlAssinado); err != nil {
+		t.Fatal(err)
+	}
+	infNFe := doc.Root().SelectElement("infNFe")
+	signature := doc.Root().SelectElement("Signature")
+	if infNFe == nil || signature == nil || signature.Index() != infNFe.Index()+1 {
+		t.Fatalf("Signature deve ser irmão do infNFe, logo após ele:\n%s", xmlAssinado)
+	}
+	for _, caminho := range []string{"SignedInfo/Reference/DigestValue", "SignatureValue", "KeyInfo/X509Data/X509Certificate"} {
+		if signature.FindElement(caminho) == nil {
+			t.Errorf("Signature sem %s", caminho)
+		}
+	}
+	envelope := infNFe.Copy()
+	envelope.CreateAttr("xmlns", doc.Root().SelectAttrValue("xmlns", ""))
+	envelope.AddChild(signature.Copy())
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+	ctx.IdAttribute = "Id"
+	if _, err := ctx.Validate(envelope); err != nil {
+		t.Fatalf("assinatura inválida: %v\n%s", err, xmlAssinado)
+	}
+}
+
+func TestAssinarXMLBytes(t *testing.T) {
+	tools := toolsTeste(t)
+	original := `<?xml version="1.0" encoding="UTF-8"?><NFe xmlns="http://www.portalfiscal.inf.br/nfe">` +
+		`<infNFe Id="NFe35261012345678000199550010000001231000000011" versao="4.00"><ide><cUF>35</cUF>` +
+		`<natOp>VENDA &amp; REMESSA</natOp></ide><total><ICMSTot><vNF>10.00</vNF></ICMSTot></total></infNFe></NFe>`
+	assinado, err := tools.AssinarXMLBytes([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O infNFe é mantido byte a byte, com o Signature logo após o </infNFe>
+	fim := strings.Index(original, "</infNFe>") + len("</infNFe>")
+	if !strings.HasPrefix(string(assinado), original[:fim]+`<Signature xmlns="http://www.w3.org/2000/09/xmldsig#">`) ||
+		!strings.HasSuffix(string(assinado), "</Signature></NFe>") {
+		t.Fatalf("Signature fora do lugar:\n%s", assinado)
+	}
+	validarAssinaturaNFe(t, string(assinado), tools.Certificado)
+
+	texto, err := tools.AssinarXML(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validarAssinaturaNFe(t, texto, tools.Certificado)
+}
+
+func TestAssinarXMLBytesSemInfNFe(t *testing.T) {
+	tools := toolsTeste(t)
+	if _, err := tools.AssinarXMLBytes([]byte(`<NFe><infNFe versao="4.00"></infNFe></NFe>`)); err == nil {
+		t.Fatal("esperado erro para infNFe sem Id")
+	}
+	if _, err := (&SefazTools{}).AssinarXMLBytes([]byte(`<NFe/>`)); err == nil {
+		t.Fatal("esperado erro sem certificado carregado")
+	}
+}
+
+// O CSRT é o da UF da nota, mesmo quando a ferramenta está configurada para outra UF
+func TestMakeTagInfRespTecUFDaNota(t *testing.T) {
+	tools := &SefazTools{Configuracoes: Configuracoes{
+		SiglaUF: "SP",
+		CSRT: map[string]services.CSRT{
+			"SP": {ID: "01", Token: "TOKEN-SP"},
+			"PR": {ID: "02", Token: "TOKEN-PR"},
+		},
+	}}
+	chave := "41261012345678000199550010000001231000000019"
+	tag, err := tools.MakeTagInfRespTec(services.InfRespTec{CNPJ: "33333333000191"}, chave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlTag, err := services.GenerateCompactXML(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := "<idCSRT>02</idCSRT><hashCSRT>" + services.GerarHashCSRT("TOKEN-PR", chave) + "</hashCSRT>"
+	if !strings.Contains(xmlTag, esperado) {
+		t.Fatalf("infRespTec sem o CSRT da UF da nota:\n%s", xmlTag)
+	}
+}
+
+// A árvore das funções MakeTag* gera e assina o mesmo XML que o builder
+func TestAssinarArvore(t *testing.T) {
+	tools := toolsTeste(t)
+	montada, assinada := nfeAssinadaTeste(t, tools, services.ModeloNFe, "1")
+	arvore, err := services.MakeTagNFe(montada.InfNFe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlArvore, err := tools.AssinarArvore(arvore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmlArvore != string(assinada) {
+		t.Fatalf("árvore assinada diverge do builder:\n%s\n%s", xmlArvore, assinada)
+	}
+
+	// Grupo avulso acrescentado ao fim do infNFe, como o infRespTec com CSRT
+	infRespTec, err := tools.MakeTagInfRespTec(services.InfRespTec{CNPJ: "33333333000191", XContato: "SUPORTE", Email: "suporte@example.com", Fone: "11999999999"}, montada.ChaveAcesso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arvore.Children[0].Children = append(arvore.Children[0].Children, infRespTec)
+	xmlArvore, err = tools.AssinarArvore(arvore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(xmlArvore, "<fone>11999999999</fone></infRespTec></infNFe><Signature") {
+		t.Fatalf("infRespTec fora do lugar:\n%s", xmlArvore)
+	}
+	validarAssinaturaNFe(t, xmlArvore, tools.Certificado)
+}
+
+// Servidor que confere o SOAP 1.2 da requisição e responde com o retorno informado
+func servidorSOAP12Teste(t *testing.T, caminho string, retorno []byte) *httptest.Server {
+	t.Helper()
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != caminho {
+			t.Errorf("caminho do serviço = %s, esperado %s", r.URL.Path, caminho)
+		}
+		if tipo := r.Header.Get("Content-Type"); tipo != "application/soap+xml; charset=utf-8" {
+			t.Errorf("Content-Type do SOAP 1.2 = %q", tipo)
+		}
+		corpo, _ := io.ReadAll(r.Body)
+		if !bytes.HasPrefix(corpo, []byte(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body><nfeDadosMsg `)) ||
+			!bytes.HasSuffix(corpo, []byte(`</nfeDadosMsg></soap12:Body></soap12:Envelope>`)) {
+			t.Errorf("requisição fora do envelope SOAP 1.2:\n%s", corpo)
+		}
+		w.Write(retorno)
+	}))
+	t.Cleanup(servidor.Close)
+	return servidor
+}
+
+func TestEnviarLoteSOAP12(t *testing.T) {
+	tools := toolsTeste(t)
+	tools.Configuracoes.SiglaUF = "SP"
+	tools.Relogio = clockwork.NewFakeClockAt(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC))
+	montada, assinada := nfeAssinadaTeste(t, tools, services.ModeloNFe, "1")
+	servidor := servidorSOAP12Teste(t, "/ws/NfeAutorizacao/NFeAutorizacao4.asmx", retornoAutorizacaoTeste(montada.ChaveAcesso, "digest", "100"))
+	tools.URLPortal = servidor.URL
+
+	resposta, err := tools.EnviarLote([]NotaFiscal{{XML: string(assinada), ChaveAcesso: montada.ChaveAcesso}}, "1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resposta.XMLRetorno, "<chNFe>"+montada.ChaveAcesso+"</chNFe>") {
+		t.Fatalf("retorno da autorização não preservado:\n%s", resposta.XMLRetorno)
+	}
+	if _, ok := tools.Autorizacoes.Autorizacao(montada.ChaveAcesso); !ok {
+		t.Fatal("autorização do protNFe não registrada")
+	}
+}
+
+func TestConsultarStatusServicoSOAP12(t *testing.T) {
+	retorno := []byte(`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body><nfeResultMsg>` +
+		`<retConsStatServ xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><tpAmb>2</tpAmb><verAplic>SP_NFE_PL009_V4</verAplic>` +
+		`<cStat>107</cStat><xMotivo>Serviço em Operação</xMotivo><cUF>35</cUF><dhRecbto>2026-10-19T10:00:00-03:00</dhRecbto></retConsStatServ>` +
+		`</nfeResultMsg></soap:Body></soap:Envelope>`)
+	servidor := servidorSOAP12Teste(t, "/ws/NfeStatusServico/NfeStatusServico4.asmx", retorno)
+	tools := &SefazTools{URLPortal: servidor.URL, Configuracoes: Configuracoes{SiglaUF: "SP"}}
+	ret, err := tools.ConsultarStatusServico()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.CStat != "107" {
+		t.Fatalf("cStat = %s", ret.CStat)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+)
+
+// Finalidades da NFe (finNFe). Nota de crédito e nota de débito foram incluídas pela reforma tributária
+const (
+	FinNFeNormal       = "1"
+	FinNFeComplementar = "2"
+	FinNFeAjuste       = "3"
+	FinNFeDevolucao    = "4"
+	FinNFeCredito      = "5"
+	FinNFeDebito       = "6"
+)
+
+// Tipos de nota de débito (tpNFDebito)
+var TiposNFDebito = map[string]string{
+	"01": "Transferência de créditos para cooperativas",
+	"02": "Anulação de crédito por saídas imunes/isentas",
+	"03": "Débitos de notas fiscais não processadas na apuração",
+	"04": "Multa e juros",
+	"05": "Transferência de crédito na sucessão",
+	"06": "Pagamento antecipado",
+	"07": "Perda em estoque",
+}
+
+// Tipos de nota de crédito (tpNFCredito)
+var TiposNFCredito = map[string]string{
+	"01": "Multa e juros",
+	"02": "Apropriação de crédito presumido de IBS sobre o saldo devedor na ZFM",
+	"03": "Retorno",
+	"04": "Redução de valores",
+	"05": "Transferência de crédito na sucessão",
+}
+
+// ValidarFinalidade verifica as combinações de finNFe, tpNFDebito e tpNFCredito permitidas
+func ValidarFinalidade(ide Ide) error {
+	switch ide.FinNFe {
+	case FinNFeNormal, FinNFeComplementar, FinNFeAjuste, FinNFeDevolucao:
+		if ide.TpNFDebito != "" || ide.TpNFCredito != "" {
+			return fmt.Errorf("tpNFDebito e tpNFCredito só podem ser informados em notas de débito ou crédito (finNFe %s)", ide.FinNFe)
+		}
+		return nil
+	case FinNFeDebito:
+		if ide.TpNFCredito != "" {
+			return fmt.Errorf("nota de débito não pode informar tpNFCredito")
+		}
+		if _, ok := TiposNFDebito[ide.TpNFDebito]; !ok {
+			return fmt.Errorf("tpNFDebito inválido: %q", ide.TpNFDebito)
+		}
+	case FinNFeCredito:
+		if ide.TpNFDebito != "" {
+			return fmt.Errorf("nota de crédito não pode informar tpNFDebito")
+		}
+		if _, ok := TiposNFCredito[ide.TpNFCredito]; !ok {
+			return fmt.Errorf("tpNFCredito inválido: %q", ide.TpNFCredito)
+		}
+	default:
+		return fmt.Errorf("finNFe inválido: %q", ide.FinNFe)
+	}
+	// Notas de débito e crédito são exclusivas do modelo 55 e referenciam a nota original
+	if ide.Mod != "55" {
+		return fmt.Errorf("nota de débito/crédito deve ser modelo 55")
+	}
+	if len(ide.NFref) == 0 {
+		return fmt.Errorf("nota de débito/crédito deve referenciar a NFe original")
+	}
+	for _, ref := range ide.NFref {
+		if _, err := ParseChaveAcesso(ref.RefNFe); err != nil {
+			return fmt.Errorf("chave de acesso referenciada inválida: %v", err)
+		}
+	}
+	return nil
+}
+
+// As combinações de finNFe com tpNFDebito e tpNFCredito (ValidarFinalidade)
+func regraFinalidade(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	if err := ValidarFinalidade(infNFe.Ide); err != nil {
+		return []Violacao{{CStat: 225, Motivo: "Rejeição: Falha no Schema XML da NFe", Detalhe: err.Error()}}
+	}
+	return nil
+}
+
+// NovaNotaDebito cria a nota de débito que ajusta o IBS/CBS da NFe original autorizada
+func NovaNotaDebito(original NFeProc, tpNFDebito string, det []Det) (InfNFe, error) {
+	infNFe, err := novaNotaAjuste(original, det)
+	if err != nil {
+		return InfNFe{}, err
+	}
+	infNFe.Ide.FinNFe = FinNFeDebito
+	infNFe.Ide.TpNFDebito = tpNFDebito
+	infNFe.Ide.NatOp = "Nota de débito"
+	if err := ValidarFinalidade(infNFe.Ide); err != nil {
+		return InfNFe{}, err
+	}
+	return infNFe, nil
+}
+
+// NovaNotaCredito cria a nota de crédito que ajusta o IBS/CBS da NFe original autorizada
+func NovaNotaCredito(original NFeProc, tpNFCredito string, det []Det) (InfNFe, error) {
+	infNFe, err := novaNotaAjuste(original, det)
+	if err != nil {
+		return InfNFe{}, err
+	}
+	infNFe.Ide.FinNFe = FinNFeCredito
+	infNFe.Ide.TpNFCredito = tpNFCredito
+	infNFe.Ide.NatOp = "Nota de crédito"
+	if err := ValidarFinalidade(infNFe.Ide); err != nil {
+		return InfNFe{}, err
+	}
+	return infNFe, nil
+}
+
+// Só a NFe autorizada (cStat 100 ou 150) pode ser ajustada por nota de débito ou crédito
+func conferirNotaOriginal(original NFeProc) error {
+	if cStat := original.ProtNFe.InfProt.CStat; cStat != "100" && cStat != "150" {
+		return fmt.Errorf("a NFe original não está autorizada (cStat %s)", cStat)
+	}
+	return nil
+}
+
+// Copia emitente, destinatário e identificação da nota original, limpando os campos
+// que identificam o novo documento (cNF, nNF, dhEmi, cDV). Para montar a nota com chave
+// e totais, use NFeBuilder.NotaDebito ou NFeBuilder.NotaCredito
+func novaNotaAjuste(original NFeProc, det []Det) (InfNFe, error) {
+	prot := original.ProtNFe.InfProt
+	if err := conferirNotaOriginal(original); err != nil {
+		return InfNFe{}, err
+	}
+	if len(det) == 0 {
+		return InfNFe{}, fmt.Errorf("nota de débito/crédito deve ter ao menos um item")
+	}
+	ide := original.NFe.InfNFe.Ide
+	ide.CNF = ""
+	ide.NNF = ""
+	ide.DhEmi = ""
+	ide.CDV = ""
+	ide.TpNFDebito = ""
+	ide.TpNFCredito = ""
+	ide.NFref = []NFref{{RefNFe: prot.ChNFe}}
+	return InfNFe{
+		Versao: "4.00",
+		Ide:    ide,
+		Emit:   original.NFe.InfNFe.Emit,
+		Dest:   original.NFe.InfNFe.Dest,
+		Det:    det,
+	}, nil
+}
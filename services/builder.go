@@ -0,0 +1,382 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// NFeBuilder monta o XML da NFe a partir das estruturas tipadas, preenchendo
+// os campos derivados (cNF, chave de acesso, cDV, Id, tpAmb, nItem e totais)
+type NFeBuilder struct {
+	ide        Ide
+	emit       Emit
+	dest       *Dest
+	retirada   *Local
+	entrega    *Local
+	autXML     []AutXML
+	det        []Det
+	transp     *Transp
+	cobr       *Cobr
+	pag        *Pag
+	intermed   *InfIntermed
+	infAdic    *InfAdic
+	exporta    *Exporta
+	compra     *Compra
+	infRespTec *InfRespTec
+	ambiente   string
+	registro   RegistroChaves
+	csrt       map[string]CSRT
+	relogio    clockwork.Clock
+	original   *NFeProc // NFe ajustada pela nota de débito ou crédito
+}
+
+// Resultado da montagem da NFe, pronto para assinatura
+type NFeMontada struct {
+	ChaveAcesso string
+	InfNFe      InfNFe
+	XML         string
+}
+
+func NewNFeBuilder(ide Ide, emit Emit) *NFeBuilder {
+	return &NFeBuilder{ide: ide, emit: emit, relogio: clockwork.NewRealClock()}
+}
+
+// Dest define o destinatário, obrigatório na NF-e e opcional na NFC-e (ver DestConsumidor)
+func (b *NFeBuilder) Dest(dest Dest) *NFeBuilder {
+	b.dest = &dest
+	return b
+}
+
+// Retirada define o local de retirada, quando diferente do endereço do emitente
+func (b *NFeBuilder) Retirada(retirada Local) *NFeBuilder {
+	b.retirada = &retirada
+	return b
+}
+
+// Entrega define o local de entrega, quando diferente do endereço do destinatário
+func (b *NFeBuilder) Entrega(entrega Local) *NFeBuilder {
+	b.entrega = &entrega
+	return b
+}
+
+func (b *NFeBuilder) AutXML(autXML ...AutXML) *NFeBuilder {
+	b.autXML = append(b.autXML, autXML...)
+	return b
+}
+
+func (b *NFeBuilder) Det(det ...Det) *NFeBuilder {
+	b.det = append(b.det, det...)
+	return b
+}
+
+func (b *NFeBuilder) Transp(transp Transp) *NFeBuilder {
+	b.transp = &transp
+	return b
+}
+
+func (b *NFeBuilder) Cobr(cobr Cobr) *NFeBuilder {
+	b.cobr = &cobr
+	return b
+}
+
+func (b *NFeBuilder) Pag(pag Pag) *NFeBuilder {
+	b.pag = &pag
+	return b
+}
+
+func (b *NFeBuilder) InfIntermed(infIntermed InfIntermed) *NFeBuilder {
+	b.intermed = &infIntermed
+	return b
+}
+
+func (b *NFeBuilder) InfAdic(infAdic InfAdic) *NFeBuilder {
+	b.infAdic = &infAdic
+	return b
+}
+
+func (b *NFeBuilder) Exporta(exporta Exporta) *NFeBuilder {
+	b.exporta = &exporta
+	return b
+}
+
+func (b *NFeBuilder) Compra(compra Compra) *NFeBuilder {
+	b.compra = &compra
+	return b
+}
+
+func (b *NFeBuilder) InfRespTec(infRespTec InfRespTec) *NFeBuilder {
+	b.infRespTec = &infRespTec
+	return b
+}
+
+// Ambiente define o tpAmb da nota: "producao" ou "homologacao"
+func (b *NFeBuilder) Ambiente(ambiente string) *NFeBuilder {
+	b.ambiente = ambiente
+	return b
+}
+
+// RegistroChaves define o registro local consultado antes de devolver a chave, para
+// não reutilizar a numeração de uma nota já emitida. Para montar a mesma nota de novo,
+// informe o cNF da montagem anterior (NFeMontada.InfNFe.Ide.CNF), que gera a mesma chave
+func (b *NFeBuilder) RegistroChaves(registro RegistroChaves) *NFeBuilder {
+	b.registro = registro
+	return b
+}
+
+// CSRT define os CSRT do responsável técnico por sigla da UF. O da UF da nota preenche
+// idCSRT e hashCSRT do infRespTec, calculado com a chave de acesso final
+func (b *NFeBuilder) CSRT(csrt map[string]CSRT) *NFeBuilder {
+	b.csrt = csrt
+	return b
+}
+
+// NotaDebito transforma a nota em nota de débito (finNFe 6) da NFe original autorizada:
+// referencia a chave do protocolo e, sem Dest informado, usa o destinatário da original
+func (b *NFeBuilder) NotaDebito(original NFeProc, tpNFDebito string) *NFeBuilder {
+	b.ajustar(original)
+	b.ide.FinNFe = FinNFeDebito
+	b.ide.TpNFDebito = tpNFDebito
+	b.ide.TpNFCredito = ""
+	return b
+}
+
+// NotaCredito transforma a nota em nota de crédito (finNFe 5) da NFe original autorizada
+func (b *NFeBuilder) NotaCredito(original NFeProc, tpNFCredito string) *NFeBuilder {
+	b.ajustar(original)
+	b.ide.FinNFe = FinNFeCredito
+	b.ide.TpNFCredito = tpNFCredito
+	b.ide.TpNFDebito = ""
+	return b
+}
+
+func (b *NFeBuilder) ajustar(original NFeProc) {
+	b.original = &original
+	b.ide.NFref = []NFref{{RefNFe: original.ProtNFe.InfProt.ChNFe}}
+	if b.dest == nil {
+		dest := original.NFe.InfNFe.Dest
+		b.dest = &dest
+	}
+}
+
+// Build calcula os campos derivados e gera o XML da NFe pronto para assinatura
+func (b *NFeBuilder) Build() (*NFeMontada, error) {
+	if len(b.det) == 0 {
+		return nil, fmt.Errorf("a NFe deve ter ao menos um item")
+	}
+	if len(b.det) > 990 {
+		return nil, fmt.Errorf("a NFe pode ter no máximo 990 itens")
+	}
+	ide := b.ide
+	switch b.ambiente {
+	case "producao":
+		ide.TpAmb = "1"
+	case "homologacao", "":
+		ide.TpAmb = "2"
+	default:
+		return nil, fmt.Errorf("ambiente inválido: %q", b.ambiente)
+	}
+	if ide.TpEmis == "" {
+		ide.TpEmis = "1"
+	}
+	if ide.FinNFe == "" {
+		ide.FinNFe = FinNFeNormal
+	}
+	if b.original != nil {
+		if err := conferirNotaOriginal(*b.original); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidarFinalidade(ide); err != nil {
+		return nil, err
+	}
+	dest := b.dest
+	if ide.Mod == ModeloNFCe {
+		if dest != nil {
+			copia := *dest
+			dest = &copia
+		}
+		aplicarPadroesNFCe(&ide, dest)
+	}
+	if ide.DhEmi == "" {
+		// Horário local da UF do emitente: Manaus, Cuiabá e Rio Branco diferem de Brasília
+		uf := b.emit.EnderEmit.UF
+		if uf == "" {
+			uf = ide.CUF
+		}
+		dhEmi, err := NovaDataHora(b.relogio.Now(), uf)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao gerar dhEmi: %v", err)
+		}
+		ide.DhEmi = dhEmi.String()
+	}
+	if ide.CNF == "" {
+		cNF, err := GerarCNF(ide.NNF)
+		if err != nil {
+			return nil, err
+		}
+		ide.CNF = cNF
+	} else if err := ValidarCNF(ide.CNF, ide.NNF); err != nil {
+		return nil, err
+	}
+
+	chave, err := GerarChaveAcesso(ide, b.emit, ide.NNF, ide.TpEmis)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar chave de acesso: %v", err)
+	}
+	ide.CDV = chave[43:]
+	if b.registro != nil {
+		if err := b.registro.Reservar(chave); err != nil {
+			return nil, err
+		}
+	}
+
+	infRespTec := b.infRespTec
+	if infRespTec != nil {
+		comCSRT, err := AplicarCSRTUF(b.csrt, *infRespTec, chave)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao gerar hashCSRT: %v", err)
+		}
+		infRespTec = &comCSRT
+	}
+
+	det := make([]Det, len(b.det))
+	for i, item := range b.det {
+		if item.NItem == "" {
+			item.NItem = strconv.Itoa(i + 1)
+		}
+		det[i] = item
+	}
+
+	infNFe := InfNFe{
+		Id:          "NFe" + chave,
+		Versao:      "4.00",
+		Ide:         ide,
+		Emit:        b.emit,
+		Retirada:    b.retirada,
+		Entrega:     b.entrega,
+		AutXML:      b.autXML,
+		Det:         det,
+		Total:       totalizar(det),
+		Transp:      b.transp,
+		Cobr:        b.cobr,
+		Pag:         b.pag,
+		InfIntermed: b.intermed,
+		InfAdic:     b.infAdic,
+		Exporta:     b.exporta,
+		Compra:      b.compra,
+		InfRespTec:  infRespTec,
+	}
+	if dest != nil {
+		infNFe.Dest = *dest
+	}
+	if infNFe.Total.ISSQNtot != nil {
+		// Competência da prestação dos serviços: a data de emissão
+		infNFe.Total.ISSQNtot.DCompet = ide.DhEmi[:10]
+	}
+	if infNFe.Transp == nil {
+		// Sem transporte informado: modFrete 9 (sem ocorrência de transporte)
+		infNFe.Transp = &Transp{ModFrete: "9"}
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := EscreverNFe(buffer, infNFe); err != nil {
+		return nil, err
+	}
+	return &NFeMontada{ChaveAcesso: chave, InfNFe: infNFe, XML: buffer.String()}, nil
+}
+
+// Soma os valores dos itens nos totais da nota. Os itens de serviço (com ISSQN) são
+// somados no ISSQNtot, e os demais no ICMSTot. vProd considera apenas os itens que
+// compõem o total (indTot = 1) e vNF segue a fórmula do leiaute:
+// vProd - vDesc - vICMSDeson + vST + vFCPST + vFrete + vSeg + vOutro + vII + vIPI + vIPIDevol + vServ
+func totalizar(det []Det) Total {
+	var total Total
+	t := &total.ICMSTot
+	var servicos ISSQNtot
+	for _, item := range det {
+		prod := item.Prod
+		imposto := item.Imposto
+		if imposto == nil {
+			imposto = &Imposto{}
+		}
+		if issqn := imposto.ISSQN; issqn != nil {
+			if prod.IndTot == "1" {
+				servicos.VServ += prod.VProd
+			}
+			servicos.VBC += issqn.VBC
+			servicos.VISS += issqn.VISSQN
+			servicos.VDeducao += issqn.VDeducao
+			servicos.VOutro += issqn.VOutro
+			servicos.VDescIncond += issqn.VDescIncond
+			servicos.VDescCond += issqn.VDescCond
+			servicos.VISSRet += issqn.VISSRet
+			if imposto.PIS != nil {
+				servicos.VPIS += imposto.PIS.Grupo.VPIS
+			}
+			if imposto.COFINS != nil {
+				servicos.VCOFINS += imposto.COFINS.Grupo.VCOFINS
+			}
+			total.ISSQNtot = &servicos
+		} else {
+			if prod.IndTot == "1" {
+				t.VProd += prod.VProd
+			}
+			if imposto.PIS != nil {
+				t.VPIS += imposto.PIS.Grupo.VPIS
+			}
+			if imposto.COFINS != nil {
+				t.VCOFINS += imposto.COFINS.Grupo.VCOFINS
+			}
+		}
+		t.VFrete += prod.VFrete
+		t.VSeg += prod.VSeg
+		t.VDesc += prod.VDesc
+		t.VOutro += prod.VOutro
+		t.VTotTrib += imposto.VTotTrib
+		if imposto.ICMS != nil {
+			g := imposto.ICMS.Grupo
+			t.VBC += g.VBC
+			t.VICMS += g.VICMS
+			t.VICMSDeson += g.VICMSDeson
+			t.VFCP += g.VFCP
+			t.VBSCST += g.VBCST
+			t.VST += g.VICMSST
+			t.VFCPST += g.VFCPST
+			t.VFCPSTRet += g.VFCPSTRet
+		}
+		if imposto.ICMSUFDest != nil {
+			t.VFCPUFDest += imposto.ICMSUFDest.VFCPUFDest
+			t.VICMSUFDest += imposto.ICMSUFDest.VICMSUFDest
+			t.VICMSUFRemet += imposto.ICMSUFDest.VICMSUFRemet
+		}
+		if imposto.II != nil {
+			t.VII += imposto.II.VII
+		}
+		if imposto.IPI != nil && imposto.IPI.IPITrib != nil {
+			t.VIPI += imposto.IPI.IPITrib.VIPI
+		}
+	}
+	for _, valor := range []*float64{
+		&t.VBC, &t.VICMS, &t.VICMSDeson, &t.VFCPUFDest, &t.VICMSUFDest, &t.VICMSUFRemet, &t.VFCP, &t.VBSCST,
+		&t.VST, &t.VFCPST, &t.VFCPSTRet, &t.VProd, &t.VFrete, &t.VSeg, &t.VDesc, &t.VII, &t.VIPI, &t.VIPIDevol,
+		&t.VPIS, &t.VCOFINS, &t.VOutro, &t.VTotTrib,
+		&servicos.VServ, &servicos.VBC, &servicos.VISS, &servicos.VPIS, &servicos.VCOFINS, &servicos.VDeducao,
+		&servicos.VOutro, &servicos.VDescIncond, &servicos.VDescCond, &servicos.VISSRet,
+	} {
+		*valor = arredondar(*valor)
+	}
+	t.VNF = arredondar(t.VProd - t.VDesc - t.VICMSDeson + t.VST + t.VFCPST + t.VFrete + t.VSeg + t.VOutro +
+		t.VII + t.VIPI + t.VIPIDevol + servicos.VServ)
+	total.ISTot, total.IBSCBSTot = TotalizarIBSCBS(det)
+	return total
+}
+
+// Relogio substitui o relógio usado no dhEmi, permitindo testes determinísticos com
+// clockwork.NewFakeClockAt
+func (b *NFeBuilder) Relogio(relogio clockwork.Clock) *NFeBuilder {
+	b.relogio = relogio
+	return b
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func itemTeste(vProd float64, imposto *Imposto) Det {
+	return Det{
+		Prod: Prod{
+			CProd: "001", CEAN: "SEM GTIN", XProd: "PRODUTO", NCM: "61091000", CFOP: "5102", UCom: "UN",
+			QCom: 1, VUnCom: vProd, VProd: vProd, CEANTrib: "SEM GTIN", UTrib: "UN", QTrib: 1, VUnTrib: vProd, IndTot: "1",
+		},
+		Imposto: imposto,
+	}
+}
+
+func icmsTeste(grupo ICMSGrupo) *ICMS {
+	return &ICMS{Grupo: grupo}
+}
+
+func TestTotalizar(t *testing.T) {
+	comDespesas := itemTeste(100, nil)
+	comDespesas.Prod.VFrete, comDespesas.Prod.VSeg, comDespesas.Prod.VDesc, comDespesas.Prod.VOutro = 10, 2.5, 7.25, 1
+	foraDoTotal := itemTeste(30, nil)
+	foraDoTotal.Prod.IndTot = "0"
+	servico := itemTeste(300, &Imposto{
+		ISSQN:  &ISSQN{VBC: 300, VAliq: 5, VISSQN: 15, CMunFG: "4106902", CListServ: "14.01", IndISS: "1", IndIncentivo: "2"},
+		PIS:    &PIS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "PISAliq"}, CST: "01", VBC: 300, PPIS: 1.65, VPIS: 4.95}},
+		COFINS: &COFINS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "COFINSAliq"}, CST: "01", VBC: 300, PCOFINS: 7.6, VCOFINS: 22.8}},
+	})
+
+	casos := []struct {
+		nome     string
+		det      []Det
+		esperado ICMSTot
+		servicos *ISSQNtot
+	}{
+		{
+			nome:     "somente produtos",
+			det:      []Det{itemTeste(10, nil), itemTeste(20.1, nil)},
+			esperado: ICMSTot{VProd: 30.1, VNF: 30.1},
+		},
+		{
+			nome:     "frete, seguro, desconto e outras despesas",
+			det:      []Det{comDespesas},
+			esperado: ICMSTot{VProd: 100, VFrete: 10, VSeg: 2.5, VDesc: 7.25, VOutro: 1, VNF: 106.25},
+		},
+		{
+			nome:     "item fora do total",
+			det:      []Det{itemTeste(50, nil), foraDoTotal},
+			esperado: ICMSTot{VProd: 50, VNF: 50},
+		},
+		{
+			nome: "ICMS próprio, ST, IPI, PIS e COFINS",
+			det: []Det{itemTeste(100, &Imposto{
+				VTotTrib: 31.4,
+				ICMS: icmsTeste(ICMSGrupo{
+					XMLName: xml.Name{Local: "ICMS10"}, Orig: "0", CST: "10", VBC: 100, PICMS: 18, VICMS: 18, VFCP: 2,
+					VBCST: 140, PICMSST: 18, VICMSST: 7.2,
+				}),
+				IPI:    &IPI{CEnq: "999", IPITrib: &IPITrib{CST: "50", VBC: 100, PIPI: 10, VIPI: 10}},
+				PIS:    &PIS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "PISAliq"}, CST: "01", VBC: 100, PPIS: 1.65, VPIS: 1.65}},
+				COFINS: &COFINS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "COFINSAliq"}, CST: "01", VBC: 100, PCOFINS: 7.6, VCOFINS: 7.6}},
+			})},
+			esperado: ICMSTot{
+				VBC: 100, VICMS: 18, VFCP: 2, VBSCST: 140, VST: 7.2, VProd: 100, VIPI: 10, VPIS: 1.65, VCOFINS: 7.6,
+				VNF: 117.2, VTotTrib: 31.4,
+			},
+		},
+		{
+			nome: "ICMS desonerado",
+			det: []Det{itemTeste(200, &Imposto{ICMS: icmsTeste(ICMSGrupo{
+				XMLName: xml.Name{Local: "ICMS40"}, Orig: "0", CST: "40", VICMSDeson: 24, MotDesICMS: "7",
+			})})},
+			esperado: ICMSTot{VICMSDeson: 24, VProd: 200, VNF: 176},
+		},
+		{
+			nome: "FCP retido por ST e ST retido anteriormente",
+			det: []Det{
+				itemTeste(100, &Imposto{ICMS: icmsTeste(ICMSGrupo{
+					XMLName: xml.Name{Local: "ICMS10"}, Orig: "0", CST: "10", VBC: 100, PICMS: 18, VICMS: 18,
+					VBCST: 140, PICMSST: 18, VICMSST: 7.2, VBCFCPST: 140, PFCPST: 2, VFCPST: 2.8,
+				})}),
+				itemTeste(50, &Imposto{ICMS: icmsTeste(ICMSGrupo{
+					XMLName: xml.Name{Local: "ICMS60"}, Orig: "0", CST: "60", VBCSTRet: 50, PST: 18, VICMSSTRet: 9, VFCPSTRet: 1,
+				})}),
+			},
+			esperado: ICMSTot{VBC: 100, VICMS: 18, VBSCST: 140, VST: 7.2, VFCPST: 2.8, VFCPSTRet: 1, VProd: 150, VNF: 160},
+		},
+		{
+			nome: "imposto de importação e partilha do ICMS interestadual",
+			det: []Det{itemTeste(1000, &Imposto{
+				II:         &II{VBC: 1000, VDespAdu: 50, VII: 140, VIOF: 3},
+				ICMSUFDest: &ICMSUFDest{VBCUFDest: 1000, PICMSUFDest: 18, PICMSInter: 12, PICMSInterPart: 100, VFCPUFDest: 20, VICMSUFDest: 60},
+			})},
+			esperado: ICMSTot{VFCPUFDest: 20, VICMSUFDest: 60, VProd: 1000, VII: 140, VNF: 1140},
+		},
+		{
+			nome:     "serviço com ISSQN somado no vServ",
+			det:      []Det{itemTeste(100, nil), servico},
+			esperado: ICMSTot{VProd: 100, VNF: 400},
+			servicos: &ISSQNtot{VServ: 300, VBC: 300, VISS: 15, VPIS: 4.95, VCOFINS: 22.8},
+		},
+		{
+			nome:     "arredondamento da soma",
+			det:      []Det{itemTeste(0.1, nil), itemTeste(0.2, nil)},
+			esperado: ICMSTot{VProd: 0.3, VNF: 0.3},
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			total := totalizar(c.det)
+			if total.ICMSTot != c.esperado {
+				t.Fatalf("totais:\n%+v\nesperado:\n%+v", total.ICMSTot, c.esperado)
+			}
+			if (total.ISSQNtot == nil) != (c.servicos == nil) || c.servicos != nil && *total.ISSQNtot != *c.servicos {
+				t.Fatalf("ISSQNtot: %+v, esperado: %+v", total.ISSQNtot, c.servicos)
+			}
+		})
+	}
+}
+
+func builderTeste() *NFeBuilder {
+	ide := Ide{
+		CUF: "41", NatOp: "VENDA", Mod: ModeloNFe, Serie: "1", NNF: "123", TpNF: "1", IdDest: "1",
+		CMunFG: "4106902", TpImp: "1", FinNFe: "1", IndFinal: "1", IndPres: "1", ProcEmi: "0", VerProc: "1.0",
+	}
+	emit := Emit{
+		CNPJ: "12345678000195", XNome: "EMPRESA TESTE",
+		EnderEmit: EnderEmit{XLgr: "RUA A", Nro: "1", XBairro: "CENTRO", CMun: "4106902", XMun: "CURITIBA", UF: "PR", CEP: "80000000"},
+		IE:        "123456789", CRT: "3",
+	}
+	return NewNFeBuilder(ide, emit).
+		Relogio(clockwork.NewFakeClockAt(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC))).
+		Det(itemTeste(10, nil))
+}
+
+func TestBuildCSRT(t *testing.T) {
+	csrts := map[string]CSRT{
+		"PR": {ID: "01", Token: "TOKEN-PR"},
+		"SP": {ID: "02", Token: "TOKEN-SP"},
+	}
+	montada, err := builderTeste().
+		InfRespTec(InfRespTec{CNPJ: "33333333000191", XContato: "SUPORTE", Email: "suporte@example.com", Fone: "11999999999"}).
+		CSRT(csrts).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	respTec := montada.InfNFe.InfRespTec
+	if respTec.IdCSRT != "01" || respTec.HashCSRT != GerarHashCSRT("TOKEN-PR", montada.ChaveAcesso) {
+		t.Fatalf("CSRT da UF da nota não aplicado: %+v", respTec)
+	}
+	if !strings.Contains(montada.XML, "<idCSRT>01</idCSRT><hashCSRT>"+respTec.HashCSRT+"</hashCSRT></infRespTec>") {
+		t.Fatalf("XML sem idCSRT/hashCSRT:\n%s", montada.XML)
+	}
+
+	// Sem CSRT para a UF da nota, o infRespTec fica sem idCSRT e hashCSRT
+	montada, err = builderTeste().
+		InfRespTec(InfRespTec{CNPJ: "33333333000191"}).
+		CSRT(map[string]CSRT{"SP": csrts["SP"]}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if montada.InfNFe.InfRespTec.IdCSRT != "" || strings.Contains(montada.XML, "idCSRT") {
+		t.Fatalf("CSRT de outra UF aplicado:\n%s", montada.XML)
+	}
+}
+
+// Na nota conjugada, a competência do ISSQNtot é a data de emissão
+func TestBuildISSQNtot(t *testing.T) {
+	montada, err := builderTeste().
+		Det(itemTeste(50, &Imposto{ISSQN: &ISSQN{VBC: 50, VAliq: 2, VISSQN: 1, CMunFG: "4106902", CListServ: "14.01", IndISS: "1", IndIncentivo: "2"}})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := montada.InfNFe.Total
+	if total.ISSQNtot == nil || total.ISSQNtot.DCompet != "2026-10-19" || total.ICMSTot.VNF != 60 {
+		t.Fatalf("totais da nota conjugada: %+v %+v", total.ICMSTot, total.ISSQNtot)
+	}
+	if !strings.Contains(montada.XML, "<dCompet>2026-10-19</dCompet></ISSQNtot>") {
+		t.Fatalf("XML sem o ISSQNtot:\n%s", montada.XML)
+	}
+}
+
+// NFe autorizada usada como original das notas de débito e crédito
+func originalTeste(t *testing.T, cStat string) NFeProc {
+	t.Helper()
+	montada, err := builderTeste().Dest(Dest{CNPJ: "11222333000181", XNome: "CLIENTE", IndIEDest: "9"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NFeProc{
+		Versao:  "4.00",
+		NFe:     NFe{InfNFe: montada.InfNFe},
+		ProtNFe: ProtNFe{InfProt: InfProt{ChNFe: montada.ChaveAcesso, CStat: cStat}},
+	}
+}
+
+func TestBuildNotaDebitoCredito(t *testing.T) {
+	original := originalTeste(t, "100")
+	chaveOriginal := original.ProtNFe.InfProt.ChNFe
+
+	montada, err := builderTeste().NotaDebito(original, "04").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ide := montada.InfNFe.Ide
+	if ide.FinNFe != FinNFeDebito || ide.TpNFDebito != "04" || ide.TpNFCredito != "" {
+		t.Fatalf("finalidade da nota de débito: %+v", ide)
+	}
+	if len(ide.NFref) != 1 || ide.NFref[0].RefNFe != chaveOriginal {
+		t.Fatalf("NFref = %+v, esperada a chave %s", ide.NFref, chaveOriginal)
+	}
+	if montada.InfNFe.Dest.CNPJ != "11222333000181" {
+		t.Fatalf("destinatário da original não copiado: %+v", montada.InfNFe.Dest)
+	}
+	if !strings.Contains(montada.XML, "<refNFe>"+chaveOriginal+"</refNFe></NFref>") ||
+		!strings.Contains(montada.XML, "<finNFe>6</finNFe>") || !strings.Contains(montada.XML, "<tpNFDebito>04</tpNFDebito>") {
+		t.Fatalf("XML da nota de débito:\n%s", montada.XML)
+	}
+	if err := ValidarRegras(montada.InfNFe, ContextoValidacao{Agora: time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// O destinatário informado prevalece sobre o da original
+	montada, err = builderTeste().Dest(Dest{CPF: "52998224725"}).NotaCredito(original, "03").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ide = montada.InfNFe.Ide
+	if ide.FinNFe != FinNFeCredito || ide.TpNFCredito != "03" || ide.TpNFDebito != "" || montada.InfNFe.Dest.CPF != "52998224725" {
+		t.Fatalf("nota de crédito: %+v, dest %+v", ide, montada.InfNFe.Dest)
+	}
+
+	// Débito seguido de crédito: vale a última finalidade
+	montada, err = builderTeste().NotaDebito(original, "04").NotaCredito(original, "01").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if montada.InfNFe.Ide.TpNFDebito != "" || montada.InfNFe.Ide.FinNFe != FinNFeCredito {
+		t.Fatalf("tpNFDebito mantido na nota de crédito: %+v", montada.InfNFe.Ide)
+	}
+}
+
+func TestBuildFinalidadeInvalida(t *testing.T) {
+	original := originalTeste(t, "100")
+	nfce := func() *NFeBuilder {
+		b := builderTeste()
+		b.ide.Mod = ModeloNFCe
+		return b
+	}
+	casos := []struct {
+		nome    string
+		builder *NFeBuilder
+		erro    string
+	}{
+		{"original não autorizada", builderTeste().NotaDebito(originalTeste(t, "110"), "04"), "não está autorizada"},
+		{"tpNFDebito inexistente", builderTeste().NotaDebito(original, "99"), "tpNFDebito inválido"},
+		{"tpNFCredito inexistente", builderTeste().NotaCredito(original, "06"), "tpNFCredito inválido"},
+		{"nota de débito da NFC-e", nfce().NotaDebito(original, "04"), "modelo 55"},
+		{"nota normal com tpNFDebito", func() *NFeBuilder {
+			b := builderTeste()
+			b.ide.TpNFDebito = "04"
+			return b
+		}(), "só podem ser informados"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			_, err := c.builder.Build()
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, c.erro)
+			}
+		})
+	}
+}
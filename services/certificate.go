@@ -1,70 +1,66 @@
 package services
 
 import (
-	"crypto"
 	"crypto/rsa"
-	"crypto/sha1"
 	"crypto/x509"
-	"encoding/base64"
+	"encoding/asn1"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/beevik/etree"
 	dsig "github.com/russellhaering/goxmldsig"
 	"software.sslmate.com/src/go-pkcs12"
 )
 
-// AssinarXML assina o XML da NFe usando RSA-SHA1
+// AssinarXML assina o primeiro elemento com atributo Id do XML (infNFe, infEvento...) e
+// insere o Signature logo após o elemento assinado
 func AssinarXML(xmlContent string, privateKey *rsa.PrivateKey, certificate *x509.Certificate) (string, error) {
-	// Parse do XML
-	fmt.Println("XML recebido:", xmlContent)
 	doc := etree.NewDocument()
-	err := doc.ReadFromString(xmlContent)
-	if err != nil {
+	if err := doc.ReadFromString(xmlContent); err != nil {
 		return "", fmt.Errorf("erro ao parsear o XML: %v", err)
 	}
-
-	// Encontrar o elemento `infNFe` com o atributo Id
 	element := doc.FindElement("//*[@Id]")
 	if element == nil {
 		return "", fmt.Errorf("elemento com atributo `Id` não encontrado no XML")
 	}
-
-	// Canonicalizar o elemento `infNFe`
-	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
-	canonicalized, err := canonicalizer.Canonicalize(element)
-	if err != nil {
-		return "", fmt.Errorf("erro ao canonicalizar o elemento: %v", err)
-	}
-
-	// Calcular o hash SHA-1 do conteúdo canonicalizado
-	hash := sha1.Sum(canonicalized)
-
-	// Gerar a assinatura digital usando RSA-SHA1
-	signature, err := rsa.SignPKCS1v15(nil, privateKey, crypto.SHA1, hash[:])
+	signature, err := AssinarElemento(element, privateKey, certificate)
 	if err != nil {
-		return "", fmt.Errorf("erro ao gerar assinatura digital: %v", err)
+		return "", err
 	}
+	element.Parent().InsertChildAt(element.Index()+1, signature)
 
-	// Codificar a assinatura em Base64
-	signatureValue := base64.StdEncoding.EncodeToString(signature)
-
-	// Gerar o elemento <Signature>
-	signatureElement := gerarElementoSignature(signatureValue, certificate, element.SelectAttrValue("Id", ""))
-
-	// Adicionar o elemento <Signature> ao documento
-	root := doc.Root()
-	root.AddChild(signatureElement)
-
-	// Gerar o XML final assinado
 	finalXML, err := doc.WriteToString()
 	if err != nil {
 		return "", fmt.Errorf("erro ao gerar o XML final: %v", err)
 	}
-	fmt.Println("XML assinado:", finalXML)
 	return finalXML, nil
 }
 
+// AssinarElemento gera o Signature envelopado do leiaute da NF-e para o elemento, que deve
+// estar no documento para herdar os namespaces: referência ao Id, C14N inclusivo, digest
+// SHA-1 do elemento canonicalizado e RSA-SHA1 sobre o SignedInfo canonicalizado
+func AssinarElemento(element *etree.Element, privateKey *rsa.PrivateKey, certificate *x509.Certificate) (*etree.Element, error) {
+	if element.SelectAttrValue("Id", "") == "" {
+		return nil, fmt.Errorf("elemento %s sem o atributo Id", element.Tag)
+	}
+	ctx, err := dsig.NewSigningContext(privateKey, [][]byte{certificate.Raw})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao preparar a assinatura: %v", err)
+	}
+	ctx.IdAttribute = "Id"
+	ctx.Prefix = ""
+	ctx.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	if err := ctx.SetSignatureMethod(dsig.RSASHA1SignatureMethod); err != nil {
+		return nil, err
+	}
+	signature, err := ctx.ConstructSignature(element, true)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar assinatura digital: %v", err)
+	}
+	return signature, nil
+}
+
 func CarregarCertificado(caminhoCert string, senha string) (*rsa.PrivateKey, *x509.Certificate, error) {
 	// Carregar certificado
 	pfxData, err := os.ReadFile(caminhoCert)
@@ -82,68 +78,82 @@ func CarregarCertificado(caminhoCert string, senha string) (*rsa.PrivateKey, *x5
 	return rsaKey, cert, nil
 }
 
-func gerarElementoSignature(signatureValue string, certificate *x509.Certificate, referenceID string) *etree.Element {
-	// Criar elemento <Signature>
-	signature := etree.NewElement("Signature")
-	signature.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
-
-	// Criar <SignedInfo>
-	signedInfo := etree.NewElement("SignedInfo")
-
-	// Adicionar <CanonicalizationMethod>
-	canonicalizationMethod := etree.NewElement("CanonicalizationMethod")
-	canonicalizationMethod.CreateAttr("Algorithm", "http://www.w3.org/TR/2001/REC-xml-c14n-20010315")
-	signedInfo.AddChild(canonicalizationMethod)
-
-	// Adicionar <SignatureMethod>
-	signatureMethod := etree.NewElement("SignatureMethod")
-	signatureMethod.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#rsa-sha1")
-	signedInfo.AddChild(signatureMethod)
-
-	// Adicionar <Reference>
-	reference := etree.NewElement("Reference")
-	reference.CreateAttr("URI", "#"+referenceID)
-
-	// Adicionar <Transforms>
-	transforms := etree.NewElement("Transforms")
-	transform1 := etree.NewElement("Transform")
-	transform1.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#enveloped-signature")
-	transforms.AddChild(transform1)
-
-	transform2 := etree.NewElement("Transform")
-	transform2.CreateAttr("Algorithm", "http://www.w3.org/TR/2001/REC-xml-c14n-20010315")
-	transforms.AddChild(transform2)
-
-	reference.AddChild(transforms)
-
-	// Adicionar <DigestMethod>
-	digestMethod := etree.NewElement("DigestMethod")
-	digestMethod.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#sha1")
-	reference.AddChild(digestMethod)
-
-	// Adicionar <DigestValue>
-	digestValue := etree.NewElement("DigestValue")
-	digestValue.SetText(signatureValue) // DigestValue real deve ser calculado
-	reference.AddChild(digestValue)
-
-	signedInfo.AddChild(reference)
-
-	// Adicionar <SignedInfo> ao <Signature>
-	signature.AddChild(signedInfo)
-
-	// Adicionar <SignatureValue>
-	signatureValueElement := etree.NewElement("SignatureValue")
-	signatureValueElement.SetText(signatureValue)
-	signature.AddChild(signatureValueElement)
+// OIDs ICP-Brasil do subjectAltName (otherName) com os dados do titular do e-CPF e o
+// CNPJ do e-CNPJ
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidICPBrasilCPF   = asn1.ObjectIdentifier{2, 16, 76, 1, 3, 1}
+	oidICPBrasilCNPJ  = asn1.ObjectIdentifier{2, 16, 76, 1, 3, 3}
+)
 
-	// Adicionar <KeyInfo>
-	keyInfo := etree.NewElement("KeyInfo")
-	x509Data := etree.NewElement("X509Data")
-	x509Certificate := etree.NewElement("X509Certificate")
-	x509Certificate.SetText(base64.StdEncoding.EncodeToString(certificate.Raw))
-	x509Data.AddChild(x509Certificate)
-	keyInfo.AddChild(x509Data)
-	signature.AddChild(keyInfo)
+// DocumentoCertificado retorna o CNPJ (numérico ou alfanumérico) do e-CNPJ ou o CPF do
+// e-CPF. Sem o otherName ICP-Brasil, usa o sufixo do CN ("RAZAO SOCIAL:CNPJ")
+func DocumentoCertificado(cert *x509.Certificate) (cnpj string, cpf string) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var nomes []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &nomes); err != nil {
+			break
+		}
+		for _, nome := range nomes {
+			// otherName: [0] IMPLICIT SEQUENCE { type-id OID, value [0] EXPLICIT ANY }
+			if nome.Class != asn1.ClassContextSpecific || nome.Tag != 0 {
+				continue
+			}
+			var outro struct {
+				ID    asn1.ObjectIdentifier
+				Valor asn1.RawValue `asn1:"tag:0,explicit"`
+			}
+			if _, err := asn1.UnmarshalWithParams(nome.FullBytes, &outro, "tag:0"); err != nil {
+				continue
+			}
+			var conteudo asn1.RawValue
+			if _, err := asn1.Unmarshal(outro.Valor.Bytes, &conteudo); err != nil {
+				continue
+			}
+			valor := strings.TrimSpace(string(conteudo.Bytes))
+			switch {
+			case outro.ID.Equal(oidICPBrasilCNPJ) && len(valor) >= 14:
+				cnpj = strings.ToUpper(valor[:14])
+			case outro.ID.Equal(oidICPBrasilCPF) && len(valor) >= 19:
+				// Data de nascimento (8) seguida do CPF (11)
+				cpf = valor[8:19]
+			}
+		}
+	}
+	if cnpj != "" {
+		return cnpj, ""
+	}
+	if cpf != "" {
+		return "", cpf
+	}
+	if i := strings.LastIndex(cert.Subject.CommonName, ":"); i >= 0 {
+		switch sufixo := strings.ToUpper(cert.Subject.CommonName[i+1:]); len(sufixo) {
+		case 14:
+			return sufixo, ""
+		case 11:
+			return "", sufixo
+		}
+	}
+	return "", ""
+}
 
-	return signature
+// ConferirCertificadoEmitente verifica se o certificado pertence ao emitente: mesmo
+// CNPJ base (8 primeiras posições, também no CNPJ alfanumérico) ou mesmo CPF
+func ConferirCertificadoEmitente(cert *x509.Certificate, emit Emit) error {
+	cnpj, cpf := DocumentoCertificado(cert)
+	if emit.CNPJ != "" {
+		if len(cnpj) != 14 || len(emit.CNPJ) != 14 || cnpj[:8] != emit.CNPJ[:8] {
+			return Violacao{CStat: 213, Motivo: "Rejeição: CNPJ-Base do Emitente difere do CNPJ-Base do Certificado Digital",
+				Detalhe: fmt.Sprintf("emitente %s, certificado %s", emit.CNPJ, cnpj+cpf)}
+		}
+		return nil
+	}
+	if cpf == "" || cpf != emit.CPF {
+		return Violacao{CStat: 213, Motivo: "Rejeição: CPF do Emitente difere do CPF do Certificado Digital",
+			Detalhe: fmt.Sprintf("emitente %s, certificado %s", emit.CPF, cnpj+cpf)}
+	}
+	return nil
 }
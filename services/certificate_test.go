@@ -0,0 +1,233 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+func certificadoTeste(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelo := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "EMPRESA TESTE:12345678000199"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, modelo, modelo, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// Confere a assinatura com o validador do goxmldsig. O validador procura o Signature dentro
+// do elemento referenciado, então uma cópia do Signature é colocada na cópia do elemento
+// assinado, que recebe explicitamente o namespace herdado do elemento raiz
+func validarAssinatura(t *testing.T, xmlAssinado, tag string, cert *x509.Certificate) {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xmlAssinado); err != nil {
+		t.Fatal(err)
+	}
+	assinado := doc.Root().SelectElement(tag)
+	signature := doc.Root().SelectElement("Signature")
+	if assinado == nil || signature == nil {
+		t.Fatalf("%s e Signature devem ser filhos do elemento raiz:\n%s", tag, xmlAssinado)
+	}
+	if assinado.Index()+1 != signature.Index() {
+		t.Fatalf("Signature deve vir logo após %s", tag)
+	}
+	if signature.Space != "" || signature.SelectAttrValue("xmlns", "") != dsig.Namespace {
+		t.Fatalf("Signature deve usar o namespace padrão do xmldsig, sem prefixo")
+	}
+
+	envelope := assinado.Copy()
+	envelope.CreateAttr("xmlns", doc.Root().SelectAttrValue("xmlns", ""))
+	envelope.AddChild(signature.Copy())
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+	ctx.IdAttribute = "Id"
+	if _, err := ctx.Validate(envelope); err != nil {
+		t.Fatalf("assinatura inválida: %v\n%s", err, xmlAssinado)
+	}
+}
+
+func TestAssinarXML(t *testing.T) {
+	key, cert := certificadoTeste(t)
+	casos := []struct {
+		nome, xml, tag string
+	}{
+		{
+			"NFe",
+			`<?xml version="1.0" encoding="UTF-8"?><NFe xmlns="http://www.portalfiscal.inf.br/nfe"><infNFe versao="4.00" Id="NFe35261012345678000199550010000001231000000011">` +
+				`<ide><cUF>35</cUF><natOp>VENDA &amp; REMESSA</natOp></ide><emit><xNome>EMPRESA "TESTE"</xNome></emit></infNFe></NFe>`,
+			"infNFe",
+		},
+		{
+			"evento",
+			`<evento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><infEvento Id="ID1101113526101234567800019955001000000123100000001101">` +
+				`<cOrgao>35</cOrgao><tpAmb>2</tpAmb><detEvento versao="1.00"><descEvento>Cancelamento</descEvento><xJust>Justificativa com acentuação</xJust></detEvento></infEvento></evento>`,
+			"infEvento",
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			assinado, err := AssinarXML(c.xml, key, cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validarAssinatura(t, assinado, c.tag, cert)
+			for _, algoritmo := range []string{
+				`<CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315"/>`,
+				`<SignatureMethod Algorithm="http://www.w3.org/2000/09/xmldsig#rsa-sha1"/>`,
+				`<DigestMethod Algorithm="http://www.w3.org/2000/09/xmldsig#sha1"/>`,
+				`<Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>`,
+			} {
+				if !strings.Contains(assinado, algoritmo) {
+					t.Errorf("assinatura sem %s", algoritmo)
+				}
+			}
+		})
+	}
+}
+
+func TestAssinarXMLAlterado(t *testing.T) {
+	key, cert := certificadoTeste(t)
+	assinado, err := AssinarXML(`<NFe xmlns="http://www.portalfiscal.inf.br/nfe"><infNFe versao="4.00" Id="NFe1"><vNF>10.00</vNF></infNFe></NFe>`, key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alterado := strings.Replace(assinado, "<vNF>10.00</vNF>", "<vNF>1.00</vNF>", 1)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(alterado); err != nil {
+		t.Fatal(err)
+	}
+	envelope := doc.Root().SelectElement("infNFe").Copy()
+	envelope.CreateAttr("xmlns", "http://www.portalfiscal.inf.br/nfe")
+	envelope.AddChild(doc.Root().SelectElement("Signature").Copy())
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+	ctx.IdAttribute = "Id"
+	if _, err := ctx.Validate(envelope); err == nil {
+		t.Fatal("a alteração do infNFe assinado deveria invalidar a assinatura")
+	}
+}
+
+// Certificado com o subject e, opcionalmente, os otherName ICP-Brasil (OID → conteúdo)
+// no subjectAltName, como nos e-CNPJ e e-CPF
+func certificadoDocumento(t *testing.T, cn string, outros map[string]string) *x509.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelo := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"ICP-Brasil"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if len(outros) > 0 {
+		var nomes []asn1.RawValue
+		for oid, valor := range outros {
+			id := oidICPBrasilCPF
+			if oid == "cnpj" {
+				id = oidICPBrasilCNPJ
+			}
+			idDER, _ := asn1.Marshal(id)
+			conteudo, _ := asn1.Marshal([]byte(valor))
+			explicito, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: conteudo})
+			nomes = append(nomes, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(idDER, explicito...)})
+		}
+		san, err := asn1.Marshal(nomes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modelo.ExtraExtensions = []pkix.Extension{{Id: oidSubjectAltName, Value: san}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, modelo, modelo, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestDocumentoCertificado(t *testing.T) {
+	casos := []struct {
+		nome, cn  string
+		outros    map[string]string
+		cnpj, cpf string
+	}{
+		{"e-CNPJ alfanumérico pelo CN", "EMPRESA TESTE LTDA:12ABC34501DE35", nil, "12ABC34501DE35", ""},
+		{"e-CNPJ numérico pelo CN", "EMPRESA TESTE LTDA:11222333000181", nil, "11222333000181", ""},
+		{"e-CPF pelo CN", "FULANO DE TAL:52998224725", nil, "", "52998224725"},
+		{"otherName do e-CNPJ", "EMPRESA TESTE LTDA", map[string]string{"cnpj": "12abc34501de35"}, "12ABC34501DE35", ""},
+		{"otherName prevalece sobre o CN", "EMPRESA TESTE LTDA:11222333000181", map[string]string{"cnpj": "12ABC34501DE35"}, "12ABC34501DE35", ""},
+		{"otherName do e-CPF", "FULANO DE TAL", map[string]string{"cpf": "01011980529982247250000000000000000000000000"}, "", "52998224725"},
+		{"sem documento", "EMPRESA TESTE LTDA", nil, "", ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			cnpj, cpf := DocumentoCertificado(certificadoDocumento(t, c.cn, c.outros))
+			if cnpj != c.cnpj || cpf != c.cpf {
+				t.Fatalf("DocumentoCertificado = (%q, %q), esperado (%q, %q)", cnpj, cpf, c.cnpj, c.cpf)
+			}
+		})
+	}
+}
+
+func TestConferirCertificadoEmitente(t *testing.T) {
+	eCNPJ := certificadoDocumento(t, "EMPRESA TESTE LTDA:12ABC34501DE35", nil)
+	eCPF := certificadoDocumento(t, "FULANO DE TAL:52998224725", nil)
+	casos := []struct {
+		nome   string
+		cert   *x509.Certificate
+		emit   Emit
+		aceito bool
+	}{
+		{"mesmo CNPJ", eCNPJ, Emit{CNPJ: "12ABC34501DE35"}, true},
+		{"matriz com o certificado da filial", eCNPJ, Emit{CNPJ: "12ABC345000188"}, true},
+		{"outro CNPJ base", eCNPJ, Emit{CNPJ: "11222333000181"}, false},
+		{"CNPJ base em minúsculas", eCNPJ, Emit{CNPJ: "12abc34501de35"}, false},
+		{"mesmo CPF", eCPF, Emit{CPF: "52998224725"}, true},
+		{"outro CPF", eCPF, Emit{CPF: "11144477735"}, false},
+		{"emitente CNPJ com e-CPF", eCPF, Emit{CNPJ: "12ABC34501DE35"}, false},
+		{"emitente CPF com e-CNPJ", eCNPJ, Emit{CPF: "52998224725"}, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			err := ConferirCertificadoEmitente(c.cert, c.emit)
+			if c.aceito {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var violacao Violacao
+			if !errors.As(err, &violacao) || violacao.CStat != 213 {
+				t.Fatalf("esperada a rejeição 213, obtido %v", err)
+			}
+		})
+	}
+}
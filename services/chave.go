@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Campos da chave de acesso de 44 dígitos da NFe
+type ChaveAcesso struct {
+	CUF     string // Código IBGE da UF do emitente
+	AAMM    string // Ano e mês da emissão
+	CNPJCPF string // CNPJ do emitente (numérico ou alfanumérico), ou CPF completado com zeros à esquerda
+	Mod     string
+	Serie   string
+	NNF     string
+	TpEmis  string
+	CNF     string
+	CDV     string
+}
+
+// ParseChaveAcesso separa os campos da chave (com ou sem o prefixo "NFe") e confere o
+// dígito verificador. O CNPJ do emitente pode ser alfanumérico
+func ParseChaveAcesso(chave string) (ChaveAcesso, error) {
+	c, err := separarChave(chave)
+	if err != nil {
+		return ChaveAcesso{}, err
+	}
+	dv, err := calcularDV(c.String()[:43])
+	if err != nil {
+		return ChaveAcesso{}, err
+	}
+	if strconv.Itoa(dv) != c.CDV {
+		return ChaveAcesso{}, fmt.Errorf("dígito verificador da chave de acesso inválido: esperado %d, informado %s", dv, c.CDV)
+	}
+	return c, nil
+}
+
+// Separa os campos da chave sem conferir o dígito verificador
+func separarChave(chave string) (ChaveAcesso, error) {
+	chave = strings.TrimPrefix(strings.TrimSpace(chave), "NFe")
+	if len(chave) != 44 {
+		return ChaveAcesso{}, fmt.Errorf("a chave de acesso deve ter 44 caracteres: %q", chave)
+	}
+	for i, r := range chave {
+		// Letras maiúsculas só nas 12 primeiras posições do CNPJ alfanumérico
+		if r >= 'A' && r <= 'Z' && i >= 6 && i < 18 {
+			continue
+		}
+		if r < '0' || r > '9' {
+			return ChaveAcesso{}, fmt.Errorf("caractere inválido na posição %d da chave de acesso: %q", i+1, chave)
+		}
+	}
+	c := ChaveAcesso{
+		CUF:     chave[0:2],
+		AAMM:    chave[2:6],
+		CNPJCPF: chave[6:20],
+		Mod:     chave[20:22],
+		Serie:   chave[22:25],
+		NNF:     chave[25:34],
+		TpEmis:  chave[34:35],
+		CNF:     chave[35:43],
+		CDV:     chave[43:44],
+	}
+	if c.SiglaUF() == "" {
+		return ChaveAcesso{}, fmt.Errorf("código da UF inválido na chave de acesso: %s", c.CUF)
+	}
+	if mes, _ := strconv.Atoi(c.AAMM[2:]); mes < 1 || mes > 12 {
+		return ChaveAcesso{}, fmt.Errorf("mês de emissão inválido na chave de acesso: %s", c.AAMM)
+	}
+	return c, nil
+}
+
+// String remonta a chave de 44 dígitos
+func (c ChaveAcesso) String() string {
+	return c.CUF + c.AAMM + c.CNPJCPF + c.Mod + c.Serie + c.NNF + c.TpEmis + c.CNF + c.CDV
+}
+
+// SiglaUF retorna a sigla da UF do emitente, ou "" se o código não existir
+func (c ChaveAcesso) SiglaUF() string {
+	return SiglaUF(c.CUF)
+}
+
+// CPF retorna o CPF do emitente pessoa física, ou "" quando a chave é de um CNPJ
+func (c ChaveAcesso) CPF() string {
+	cpf := strings.TrimPrefix(c.CNPJCPF, "000")
+	if len(cpf) == 11 && ValidarCPF(cpf) && !ValidarCNPJ(c.CNPJCPF) {
+		return cpf
+	}
+	return ""
+}
+
+// CNPJ retorna o CNPJ do emitente, ou "" quando a chave é de um CPF
+func (c ChaveAcesso) CNPJ() string {
+	if c.CPF() != "" {
+		return ""
+	}
+	return c.CNPJCPF
+}
+
+// ConferirChaveAcesso verifica se a chave corresponde aos dados da identificação e
+// do emitente da nota, listando os campos divergentes
+func ConferirChaveAcesso(chave string, ide Ide, emit Emit) error {
+	c, err := ParseChaveAcesso(chave)
+	if err != nil {
+		return err
+	}
+	if divergencias := divergenciasChave(c, ide, emit); len(divergencias) > 0 {
+		return fmt.Errorf("chave de acesso não corresponde à nota: %s", strings.Join(divergencias, ", "))
+	}
+	return nil
+}
+
+// Campos da nota que divergem dos campos da chave. O cDV só é conferido quando informado
+func divergenciasChave(c ChaveAcesso, ide Ide, emit Emit) []string {
+	var divergencias []string
+	conferir := func(campo, naChave, naNota string) {
+		if naChave != naNota {
+			divergencias = append(divergencias, fmt.Sprintf("%s (chave %s, nota %s)", campo, naChave, naNota))
+		}
+	}
+	conferir("cUF", c.CUF, fmt.Sprintf("%02s", ide.CUF))
+	if dhEmi, err := ParseDataHora(ide.DhEmi); err != nil {
+		divergencias = append(divergencias, fmt.Sprintf("dhEmi inválido (%q)", ide.DhEmi))
+	} else {
+		conferir("AAMM", c.AAMM, dhEmi.AAMM())
+	}
+	conferir("CNPJ/CPF", c.CNPJCPF, documentoChave(emit))
+	conferir("mod", c.Mod, fmt.Sprintf("%02s", ide.Mod))
+	conferir("serie", c.Serie, fmt.Sprintf("%03s", ide.Serie))
+	conferir("nNF", c.NNF, fmt.Sprintf("%09s", ide.NNF))
+	conferir("tpEmis", c.TpEmis, ide.TpEmis)
+	conferir("cNF", c.CNF, fmt.Sprintf("%08s", ide.CNF))
+	if ide.CDV != "" {
+		conferir("cDV", c.CDV, ide.CDV)
+	}
+	return divergencias
+}
+
+// CNPJ do emitente ou, para o emitente pessoa física, o CPF com zeros à esquerda
+func documentoChave(emit Emit) string {
+	if emit.CNPJ == "" && emit.CPF != "" {
+		return fmt.Sprintf("%014s", emit.CPF)
+	}
+	return emit.CNPJ
+}
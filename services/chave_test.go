@@ -0,0 +1,115 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChaveAcesso(t *testing.T) {
+	casos := []struct {
+		nome, chave string
+		esperado    ChaveAcesso
+	}{
+		{"NFe do Paraná", "41240706101244000490550010000067271091023595",
+			ChaveAcesso{CUF: "41", AAMM: "2407", CNPJCPF: "06101244000490", Mod: "55", Serie: "001", NNF: "000006727", TpEmis: "1", CNF: "09102359", CDV: "5"}},
+		{"exemplo do MOC", "52060433009911002506550120000007800267301615",
+			ChaveAcesso{CUF: "52", AAMM: "0604", CNPJCPF: "33009911002506", Mod: "55", Serie: "012", NNF: "000000780", TpEmis: "0", CNF: "26730161", CDV: "5"}},
+		{"prefixo NFe", "NFe41240706101244000490550010000067271091023595",
+			ChaveAcesso{CUF: "41", AAMM: "2407", CNPJCPF: "06101244000490", Mod: "55", Serie: "001", NNF: "000006727", TpEmis: "1", CNF: "09102359", CDV: "5"}},
+		{"CNPJ alfanumérico", "41261012ABC34501DE35550010000001231000000011",
+			ChaveAcesso{CUF: "41", AAMM: "2610", CNPJCPF: "12ABC34501DE35", Mod: "55", Serie: "001", NNF: "000000123", TpEmis: "1", CNF: "00000001", CDV: "1"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			chave, err := ParseChaveAcesso(c.chave)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chave != c.esperado {
+				t.Fatalf("campos = %+v, esperado %+v", chave, c.esperado)
+			}
+			if chave.String() != strings.TrimPrefix(c.chave, "NFe") {
+				t.Fatalf("String() = %s", chave.String())
+			}
+		})
+	}
+}
+
+func TestParseChaveAcessoInvalida(t *testing.T) {
+	casos := []struct {
+		nome, chave, erro string
+	}{
+		{"dígito verificador", "41240706101244000490550010000067271091023594", "dígito verificador"},
+		{"DV do MOC alterado", "52060433009911002506550120000007800267301610", "dígito verificador"},
+		{"tamanho", "4124070610124400049055001000006727109102359", "44 caracteres"},
+		{"letra fora do CNPJ", "41240706101244000490550010000067271091023A95", "caractere inválido"},
+		{"UF inexistente", "00240706101244000490550010000067271091023595", "UF inválido"},
+		{"mês inexistente", "41241306101244000490550010000067271091023595", "mês de emissão"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			_, err := ParseChaveAcesso(c.chave)
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, c.erro)
+			}
+		})
+	}
+}
+
+func TestConferirChaveAcesso(t *testing.T) {
+	const chave = "41240706101244000490550010000067271091023595"
+	ide := Ide{CUF: "41", DhEmi: "2024-07-18T10:15:00-03:00", Mod: "55", Serie: "1", NNF: "6727", TpEmis: "1", CNF: "09102359", CDV: "5"}
+	emit := Emit{CNPJ: "06101244000490"}
+	if err := ConferirChaveAcesso(chave, ide, emit); err != nil {
+		t.Fatal(err)
+	}
+	gerada, err := GerarChaveAcesso(ide, emit, "6727", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gerada != chave {
+		t.Fatalf("GerarChaveAcesso = %s, esperado %s", gerada, chave)
+	}
+
+	casos := []struct {
+		nome  string
+		chave string
+		ide   func(*Ide)
+		emit  Emit
+		erro  string
+	}{
+		{"nNF divergente", chave, func(i *Ide) { i.NNF = "6728" }, emit, "nNF"},
+		{"mês divergente", chave, func(i *Ide) { i.DhEmi = "2024-08-01T10:15:00-03:00" }, emit, "AAMM"},
+		{"cDV divergente", chave, func(i *Ide) { i.CDV = "4" }, emit, "cDV"},
+		{"outro emitente", chave, func(*Ide) {}, Emit{CNPJ: "33009911002506"}, "CNPJ/CPF"},
+		{"DV da chave", "41240706101244000490550010000067271091023591", func(*Ide) {}, emit, "dígito verificador"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			i := ide
+			c.ide(&i)
+			err := ConferirChaveAcesso(c.chave, i, c.emit)
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, c.erro)
+			}
+		})
+	}
+}
+
+func TestGerarChaveAcessoCNPJAlfanumerico(t *testing.T) {
+	ide := Ide{CUF: "41", DhEmi: "2026-10-19T09:00:00-03:00", Mod: "55", Serie: "1", CNF: "00000001"}
+	chave, err := GerarChaveAcesso(ide, Emit{CNPJ: "12ABC34501DE35"}, "123", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chave != "41261012ABC34501DE35550010000001231000000011" {
+		t.Fatalf("chave = %s", chave)
+	}
+	c, err := ParseChaveAcesso(chave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CNPJ() != "12ABC34501DE35" || c.CPF() != "" {
+		t.Fatalf("emitente da chave = CNPJ %q, CPF %q", c.CNPJ(), c.CPF())
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tentativas de sorteio antes de desistir de um cNF aceitável
+const tentativasCNF = 100
+
+// GerarCNF sorteia o código numérico da chave de acesso com crypto/rand, descartando
+// os valores recusados pela SEFAZ (ver ValidarCNF)
+func GerarCNF(nNF string) (string, error) {
+	for i := 0; i < tentativasCNF; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(100000000))
+		if err != nil {
+			return "", fmt.Errorf("erro ao gerar cNF: %v", err)
+		}
+		cNF := fmt.Sprintf("%08d", n.Int64())
+		if ValidarCNF(cNF, nNF) == nil {
+			return cNF, nil
+		}
+	}
+	return "", errors.New("não foi possível gerar um cNF válido")
+}
+
+// ValidarCNF verifica se o cNF tem 8 dígitos e não é igual ao nNF, composto por um
+// único dígito repetido (11111111) ou por dígitos sequenciais (12345678, 87654321)
+func ValidarCNF(cNF string, nNF string) error {
+	if len(cNF) != 8 {
+		return fmt.Errorf("o campo cNF deve ter 8 dígitos: %q", cNF)
+	}
+	for _, r := range cNF {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("o campo cNF deve conter apenas dígitos: %q", cNF)
+		}
+	}
+	if numero, err := strconv.Atoi(nNF); err == nil {
+		if codigo, _ := strconv.Atoi(cNF); codigo == numero {
+			return fmt.Errorf("o cNF não pode ser igual ao número da nota (%s)", nNF)
+		}
+	}
+	if strings.Count(cNF, cNF[:1]) == len(cNF) {
+		return fmt.Errorf("o cNF não pode ser formado por um único dígito repetido: %s", cNF)
+	}
+	crescente, decrescente := true, true
+	for i := 1; i < len(cNF); i++ {
+		diferenca := int(cNF[i]) - int(cNF[i-1])
+		crescente = crescente && diferenca == 1
+		decrescente = decrescente && diferenca == -1
+	}
+	if crescente || decrescente {
+		return fmt.Errorf("o cNF não pode ser formado por dígitos sequenciais: %s", cNF)
+	}
+	return nil
+}
+
+// ErrChaveDuplicada indica que a numeração da nota já foi usada em outra chave emitida
+var ErrChaveDuplicada = errors.New("numeração da nota já utilizada em chave de acesso emitida")
+
+// RegistroChaves guarda as chaves de acesso já geradas. Reservar registra a chave e
+// falha com ErrChaveDuplicada quando já existe outra chave com a mesma UF, emitente,
+// modelo, série e número, evitando a rejeição 539 (duplicidade com diferença na chave).
+// Reservar de novo a mesma chave não é erro: a nota pode ser montada mais de uma vez
+// (mesmo cNF) antes do envio
+type RegistroChaves interface {
+	Reservar(chave string) error
+}
+
+// Registro de chaves em memória, para um único processo
+type RegistroChavesMemoria struct {
+	mutex   sync.Mutex
+	chaves  map[string]string // numeração (cUF, CNPJ, mod, série, nNF) -> chave
+	arquivo *os.File          // quando informado, cada chave reservada é gravada em uma linha
+}
+
+func NovoRegistroChavesMemoria() *RegistroChavesMemoria {
+	return &RegistroChavesMemoria{chaves: map[string]string{}}
+}
+
+// AbrirRegistroChaves carrega as chaves já gravadas no arquivo (uma por linha) e
+// grava nele as novas reservas
+func AbrirRegistroChaves(caminho string) (*RegistroChavesMemoria, error) {
+	arquivo, err := os.OpenFile(caminho, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o registro de chaves: %v", err)
+	}
+	registro := NovoRegistroChavesMemoria()
+	scanner := bufio.NewScanner(arquivo)
+	for scanner.Scan() {
+		if chave := strings.TrimSpace(scanner.Text()); len(chave) == 44 {
+			registro.chaves[numeracaoChave(chave)] = chave
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		arquivo.Close()
+		return nil, fmt.Errorf("erro ao ler o registro de chaves: %v", err)
+	}
+	registro.arquivo = arquivo
+	return registro, nil
+}
+
+func (r *RegistroChavesMemoria) Reservar(chave string) error {
+	if len(chave) != 44 {
+		return fmt.Errorf("chave de acesso inválida: %q", chave)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	numeracao := numeracaoChave(chave)
+	if existente, ok := r.chaves[numeracao]; ok {
+		if existente == chave {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrChaveDuplicada, existente)
+	}
+	if r.arquivo != nil {
+		if _, err := r.arquivo.WriteString(chave + "\n"); err != nil {
+			return fmt.Errorf("erro ao gravar o registro de chaves: %v", err)
+		}
+	}
+	r.chaves[numeracao] = chave
+	return nil
+}
+
+// Chaves retorna as chaves reservadas, para uso em ContextoValidacao.ChavesEmitidas
+func (r *RegistroChavesMemoria) Chaves() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	chaves := make([]string, 0, len(r.chaves))
+	for _, chave := range r.chaves {
+		chaves = append(chaves, chave)
+	}
+	return chaves
+}
+
+// Fechar encerra o arquivo do registro, quando houver
+func (r *RegistroChavesMemoria) Fechar() error {
+	if r.arquivo == nil {
+		return nil
+	}
+	return r.arquivo.Close()
+}
+
+// cUF (0:2), CNPJ, modelo, série e número (6:34): AAMM, tpEmis e cNF não distinguem notas
+func numeracaoChave(chave string) string {
+	return chave[0:2] + chave[6:34]
+}
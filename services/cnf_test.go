@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidarCNF(t *testing.T) {
+	casos := []struct {
+		nome, cNF, nNF, erro string
+	}{
+		{"válido", "52839174", "123", ""},
+		{"sequência parcial", "12345679", "123", ""},
+		{"nNF não numérico", "52839174", "", ""},
+		{"igual ao nNF", "00000123", "123", "igual ao número"},
+		{"igual ao nNF com zeros", "00000123", "000000123", "igual ao número"},
+		{"zeros", "00000000", "1", "único dígito"},
+		{"dígito repetido", "77777777", "123", "único dígito"},
+		{"crescente", "12345678", "123", "sequenciais"},
+		{"crescente a partir do zero", "01234567", "123", "sequenciais"},
+		{"decrescente", "87654321", "123", "sequenciais"},
+		{"decrescente até o zero", "76543210", "123", "sequenciais"},
+		{"curto", "5283917", "123", "8 dígitos"},
+		{"longo", "528391740", "123", "8 dígitos"},
+		{"letra", "5283917A", "123", "apenas dígitos"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			err := ValidarCNF(c.cNF, c.nNF)
+			if c.erro == "" && err != nil || c.erro != "" && (err == nil || !strings.Contains(err.Error(), c.erro)) {
+				t.Fatalf("ValidarCNF(%q, %q) = %v, esperado %q", c.cNF, c.nNF, err, c.erro)
+			}
+		})
+	}
+}
+
+func TestGerarCNF(t *testing.T) {
+	gerados := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		cNF, err := GerarCNF("123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidarCNF(cNF, "123"); err != nil {
+			t.Fatal(err)
+		}
+		gerados[cNF] = true
+	}
+	if len(gerados) < 990 {
+		t.Fatalf("só %d cNF distintos em 1000", len(gerados))
+	}
+}
+
+func TestRegistroChavesReservar(t *testing.T) {
+	chave := "35261012345678000199550010000001231000000011"
+	// Mesma numeração (cUF, CNPJ, modelo, série e nNF) com outro cNF
+	outraChave := "35261012345678000199550010000001231000000020"
+	proxima := "35261012345678000199550010000001241000000017"
+
+	arquivo := filepath.Join(t.TempDir(), "chaves.txt")
+	registro, err := AbrirRegistroChaves(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registro.Reservar(chave); err != nil {
+		t.Fatal(err)
+	}
+	if err := registro.Reservar(chave); err != nil {
+		t.Fatalf("reservar de novo a mesma chave não deve falhar: %v", err)
+	}
+	if err := registro.Reservar(outraChave); !errors.Is(err, ErrChaveDuplicada) {
+		t.Fatalf("esperado ErrChaveDuplicada para outra chave com a mesma numeração, obtido %v", err)
+	}
+	if err := registro.Fechar(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A chave é gravada uma única vez e continua reservada após reabrir o registro
+	conteudo, err := os.ReadFile(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(conteudo), chave) != 1 {
+		t.Fatalf("chave gravada mais de uma vez:\n%s", conteudo)
+	}
+	registro, err = AbrirRegistroChaves(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registro.Reservar(chave); err != nil {
+		t.Fatal(err)
+	}
+	if err := registro.Reservar(outraChave); !errors.Is(err, ErrChaveDuplicada) {
+		t.Fatalf("esperado ErrChaveDuplicada após reabrir o registro, obtido %v", err)
+	}
+	if err := registro.Reservar(proxima); err != nil {
+		t.Fatal(err)
+	}
+	if err := registro.Fechar(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reservar de novo após reabrir não regrava a chave; linhas estranhas são ignoradas
+	conteudo, err = os.ReadFile(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(conteudo) != chave+"\n"+proxima+"\n" {
+		t.Fatalf("registro após reabrir:\n%s", conteudo)
+	}
+	if err := os.WriteFile(arquivo, append(conteudo, "\nchave truncada\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registro, err = AbrirRegistroChaves(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registro.Fechar()
+	chaves := registro.Chaves()
+	sort.Strings(chaves)
+	if !reflect.DeepEqual(chaves, []string{chave, proxima}) {
+		t.Fatalf("chaves reservadas = %v", chaves)
+	}
+	for _, c := range []string{chave, proxima} {
+		if err := registro.Reservar(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildRegistroChaves(t *testing.T) {
+	registro := NovoRegistroChavesMemoria()
+	montada, err := builderTeste().RegistroChaves(registro).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A mesma nota montada de novo, com o mesmo cNF, gera a mesma chave
+	ide := builderTeste().ide
+	ide.CNF = montada.InfNFe.Ide.CNF
+	novamente, err := NewNFeBuilder(ide, montada.InfNFe.Emit).
+		Relogio(builderTeste().relogio).
+		Det(itemTeste(10, nil)).
+		RegistroChaves(registro).
+		Build()
+	if err != nil {
+		t.Fatalf("remontar a mesma nota não deve falhar: %v", err)
+	}
+	if novamente.ChaveAcesso != montada.ChaveAcesso {
+		t.Fatalf("chave diferente na remontagem: %s != %s", novamente.ChaveAcesso, montada.ChaveAcesso)
+	}
+
+	// Outro cNF para a mesma numeração é recusado
+	ide.CNF = "10203041"
+	if ide.CNF == montada.InfNFe.Ide.CNF {
+		ide.CNF = "10203042"
+	}
+	_, err = NewNFeBuilder(ide, montada.InfNFe.Emit).
+		Relogio(builderTeste().relogio).
+		Det(itemTeste(10, nil)).
+		RegistroChaves(registro).
+		Build()
+	if !errors.Is(err, ErrChaveDuplicada) {
+		t.Fatalf("esperado ErrChaveDuplicada, obtido %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// Formato AAAA-MM-DDThh:mm:ssTZD dos campos dhEmi, dhSaiEnt, dhEvento e dhRecbto
+const FormatoDataHora = "2006-01-02T15:04:05-07:00"
+
+// Fusos horários das capitais de cada UF. Desde 2019 não há horário de verão, mas o
+// banco IANA é consultado primeiro para acompanhar eventuais mudanças
+var fusosUF = map[string]string{
+	"AC": "America/Rio_Branco", "AM": "America/Manaus", "RO": "America/Porto_Velho",
+	"RR": "America/Boa_Vista", "MT": "America/Cuiaba", "MS": "America/Campo_Grande",
+	"PA": "America/Belem", "AP": "America/Belem", "TO": "America/Araguaina",
+	"MA": "America/Fortaleza", "PI": "America/Fortaleza", "CE": "America/Fortaleza",
+	"RN": "America/Fortaleza", "PB": "America/Fortaleza", "PE": "America/Recife",
+	"AL": "America/Maceio", "SE": "America/Maceio", "BA": "America/Bahia",
+	"MG": "America/Sao_Paulo", "ES": "America/Sao_Paulo", "RJ": "America/Sao_Paulo",
+	"SP": "America/Sao_Paulo", "PR": "America/Sao_Paulo", "SC": "America/Sao_Paulo",
+	"RS": "America/Sao_Paulo", "GO": "America/Sao_Paulo", "DF": "America/Sao_Paulo",
+}
+
+// Deslocamento em horas em relação ao UTC, usado quando o sistema não tem o banco IANA.
+// As UFs ausentes seguem o horário de Brasília (-03:00)
+var deslocamentosUF = map[string]int{
+	"AC": -5,
+	"AM": -4, "RO": -4, "RR": -4, "MT": -4, "MS": -4,
+}
+
+// FusoUF retorna o fuso horário da capital da UF (sigla ou código IBGE)
+func FusoUF(uf string) (*time.Location, error) {
+	sigla := uf
+	if _, ok := fusosUF[sigla]; !ok {
+		sigla = SiglaUF(uf)
+	}
+	nome, ok := fusosUF[sigla]
+	if !ok {
+		return nil, fmt.Errorf("UF desconhecida: %q", uf)
+	}
+	if fuso, err := time.LoadLocation(nome); err == nil {
+		return fuso, nil
+	}
+	deslocamento, ok := deslocamentosUF[sigla]
+	if !ok {
+		deslocamento = -3
+	}
+	return time.FixedZone(nome, deslocamento*60*60), nil
+}
+
+// SiglaUF retorna a sigla da UF a partir do código IBGE, ou "" se o código não existir
+func SiglaUF(codigo string) string {
+	for sigla, c := range CodigosUF {
+		if c == codigo {
+			return sigla
+		}
+	}
+	return ""
+}
+
+// DataHora é um instante já convertido para o fuso da UF, formatado como AAAA-MM-DDThh:mm:ssTZD
+type DataHora struct {
+	time.Time
+}
+
+// NovaDataHora converte o instante para o fuso da UF do emitente (sigla ou código IBGE),
+// descartando as frações de segundo, que o leiaute não aceita
+func NovaDataHora(t time.Time, uf string) (DataHora, error) {
+	fuso, err := FusoUF(uf)
+	if err != nil {
+		return DataHora{}, err
+	}
+	return DataHora{t.In(fuso).Truncate(time.Second)}, nil
+}
+
+// ParseDataHora lê uma data e hora no formato AAAA-MM-DDThh:mm:ssTZD, recusando o
+// sufixo "Z" e as frações de segundo
+func ParseDataHora(valor string) (DataHora, error) {
+	t, err := time.Parse(FormatoDataHora, valor)
+	if err != nil || t.Format(FormatoDataHora) != valor {
+		return DataHora{}, fmt.Errorf("data e hora fora do formato AAAA-MM-DDThh:mm:ssTZD: %q", valor)
+	}
+	return DataHora{t}, nil
+}
+
+func (d DataHora) String() string {
+	return d.Format(FormatoDataHora)
+}
+
+// AAMM retorna o ano e mês da data local, como usados na chave de acesso
+func (d DataHora) AAMM() string {
+	return d.Format("0601")
+}
+
+func (d DataHora) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *DataHora) UnmarshalText(texto []byte) error {
+	valor, err := ParseDataHora(string(texto))
+	if err != nil {
+		return err
+	}
+	*d = valor
+	return nil
+}
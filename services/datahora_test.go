@@ -0,0 +1,142 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestFusoUF(t *testing.T) {
+	// Em 19/10/2026 não há horário de verão: o deslocamento do IANA deve coincidir com o
+	// usado quando o sistema não tem o banco de fusos
+	instante := time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+	for uf := range fusosUF {
+		fuso, err := FusoUF(uf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		esperado, ok := deslocamentosUF[uf]
+		if !ok {
+			esperado = -3
+		}
+		if _, deslocamento := instante.In(fuso).Zone(); deslocamento != esperado*60*60 {
+			t.Errorf("%s: deslocamento %ds, esperado %dh", uf, deslocamento, esperado)
+		}
+	}
+	porCodigo, err := FusoUF("13")
+	if err != nil || porCodigo.String() != fusosUF["AM"] {
+		t.Fatalf("FusoUF pelo código do AM = %v, %v", porCodigo, err)
+	}
+	if _, err := FusoUF("XX"); err == nil {
+		t.Fatal("esperado erro com UF desconhecida")
+	}
+}
+
+func TestNovaDataHora(t *testing.T) {
+	casos := []struct {
+		nome  string
+		agora time.Time
+		uf    string
+		dhEmi string
+		aamm  string
+	}{
+		{"DF", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), "DF", "2026-10-19T10:00:00-03:00", "2610"},
+		{"AM", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), "AM", "2026-10-19T09:00:00-04:00", "2610"},
+		{"MT", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), "MT", "2026-10-19T09:00:00-04:00", "2610"},
+		{"AC", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), "AC", "2026-10-19T08:00:00-05:00", "2610"},
+		{"AC pelo código IBGE", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC), "12", "2026-10-19T08:00:00-05:00", "2610"},
+		{"frações de segundo descartadas", time.Date(2026, 10, 19, 13, 0, 0, 999999999, time.UTC), "DF", "2026-10-19T10:00:00-03:00", "2610"},
+		// Meia hora após a virada do mês em Brasília ainda é outubro no AM e no AC
+		{"virada do mês no DF", time.Date(2026, 11, 1, 3, 30, 0, 0, time.UTC), "DF", "2026-11-01T00:30:00-03:00", "2611"},
+		{"virada do mês no MT", time.Date(2026, 11, 1, 3, 30, 0, 0, time.UTC), "MT", "2026-10-31T23:30:00-04:00", "2610"},
+		{"virada do mês no AC", time.Date(2026, 11, 1, 3, 30, 0, 0, time.UTC), "AC", "2026-10-31T22:30:00-05:00", "2610"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			relogio := clockwork.NewFakeClockAt(c.agora)
+			dh, err := NovaDataHora(relogio.Now(), c.uf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dh.String() != c.dhEmi || dh.AAMM() != c.aamm {
+				t.Fatalf("dhEmi = %s (AAMM %s), esperado %s (AAMM %s)", dh, dh.AAMM(), c.dhEmi, c.aamm)
+			}
+			lida, err := ParseDataHora(dh.String())
+			if err != nil || !lida.Equal(c.agora.Truncate(time.Second)) {
+				t.Fatalf("ParseDataHora(%s) = %v, %v", dh, lida, err)
+			}
+		})
+	}
+	if _, err := NovaDataHora(time.Now(), "XX"); err == nil {
+		t.Fatal("esperado erro com UF desconhecida")
+	}
+}
+
+// O dhEmi gerado pelo NFeBuilder usa o fuso da UF do emitente, e o mês da chave segue a data local
+func TestBuildDhEmiFusoUF(t *testing.T) {
+	casos := []struct {
+		uf, cUF, dhEmi string
+	}{
+		{"DF", "53", "2026-10-31T23:30:00-03:00"},
+		{"AM", "13", "2026-10-31T22:30:00-04:00"},
+		{"MT", "51", "2026-10-31T22:30:00-04:00"},
+		{"AC", "12", "2026-10-31T21:30:00-05:00"},
+	}
+	for _, c := range casos {
+		t.Run(c.uf, func(t *testing.T) {
+			b := builderTeste().Relogio(clockwork.NewFakeClockAt(time.Date(2026, 11, 1, 2, 30, 0, 0, time.UTC)))
+			b.ide.CUF = c.cUF
+			b.emit.EnderEmit.UF = c.uf
+			montada, err := b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if montada.InfNFe.Ide.DhEmi != c.dhEmi {
+				t.Fatalf("dhEmi = %s, esperado %s", montada.InfNFe.Ide.DhEmi, c.dhEmi)
+			}
+			if aamm := montada.ChaveAcesso[2:6]; aamm != "2610" {
+				t.Fatalf("AAMM da chave = %s, esperado 2610", aamm)
+			}
+		})
+	}
+}
+
+func TestParseDataHoraInvalida(t *testing.T) {
+	for _, valor := range []string{
+		"",
+		"2026-10-19",
+		"2026-10-19T10:00:00",
+		"2026-10-19T10:00:00Z",
+		"2026-10-19T10:00:00.123-03:00",
+		"2026-10-19T10:00:00-0300",
+		"2026-10-19 10:00:00-03:00",
+		"19/10/2026 10:00:00",
+		"2026-13-19T10:00:00-03:00",
+		"2026-10-19T25:00:00-03:00",
+		"2026-1",
+	} {
+		if _, err := ParseDataHora(valor); err == nil || !strings.Contains(err.Error(), "AAAA-MM-DDThh:mm:ssTZD") {
+			t.Errorf("ParseDataHora(%q): erro = %v", valor, err)
+		}
+	}
+
+	// Um dhEmi malformado informado no ide é recusado sem pânico
+	for _, dhEmi := range []string{"2026-1", "2026-10-19T10:00:00Z"} {
+		ide := Ide{CUF: "41", DhEmi: dhEmi, Mod: ModeloNFe, Serie: "1", CNF: "52839174"}
+		if _, err := GerarChaveAcesso(ide, Emit{CNPJ: "12345678000195"}, "123", "1"); err == nil {
+			t.Errorf("GerarChaveAcesso com dhEmi %q: esperado erro", dhEmi)
+		}
+		b := builderTeste()
+		b.ide.DhEmi = dhEmi
+		if _, err := b.Build(); err == nil {
+			t.Errorf("Build com dhEmi %q: esperado erro", dhEmi)
+		}
+		infNFe, ctx := notaRegrasTeste(t)
+		infNFe.Ide.DhEmi = dhEmi
+		if len(regraDataEmissao(infNFe, ctx)) == 0 {
+			t.Errorf("regraDataEmissao aceitou dhEmi %q", dhEmi)
+		}
+	}
+}
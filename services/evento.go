@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tipos de evento do emitente
+const (
+	TpEventoCCe          = "110110" // Carta de Correção
+	TpEventoCancelamento = "110111"
+	TpEventoCancSubst    = "110112" // Cancelamento por substituição da NFC-e
+	VersaoEvento         = "1.00"
+)
+
+// Texto das condições de uso da CC-e, obrigatório no xCondUso e reproduzido sem acentos
+// como exige o leiaute
+const XCondUsoCCe = "A Carta de Correcao e disciplinada pelo paragrafo 1o-A do art. 7o do Convenio S/N, " +
+	"de 15 de dezembro de 1970 e pode ser utilizada para regularizacao de erro ocorrido na emissao de " +
+	"documento fiscal, desde que o erro nao esteja relacionado com: I - as variaveis que determinam o " +
+	"valor do imposto tais como: base de calculo, aliquota, diferenca de preco, quantidade, valor da " +
+	"operacao ou da prestacao; II - a correcao de dados cadastrais que implique mudanca do remetente " +
+	"ou do destinatario; III - a data de emissao ou de saida."
+
+// Limite de CC-e por chave: cada nova carta substitui a anterior e recebe o nSeqEvento seguinte
+const MaxSeqCCe = 20
+
+// Dados que a CC-e não pode alterar (§ 1º-A do art. 7º do Convênio S/N de 1970), com os
+// termos que os identificam no texto da correção, já sem acentos
+var CamposVedadosCCe = []struct {
+	Descricao string
+	Termos    []string
+}{
+	{"valores da operação ou da prestação", []string{"valor", "valores", "preco", "precos", "desconto", "frete", "seguro"}},
+	{"base de cálculo e alíquota do imposto", []string{"base de calculo", "aliquota", "icms", "ipi", "pis", "cofins", "imposto"}},
+	{"quantidade das mercadorias", []string{"quantidade", "qtde", "qtd"}},
+	{"remetente ou destinatário", []string{"remetente", "destinatario", "emitente", "cnpj", "cpf", "razao social"}},
+	{"data de emissão ou de saída", []string{"data de emissao", "data de saida", "data da emissao", "data da saida", "dhemi", "dhsaient"}},
+}
+
+// Estruturas dos eventos da NFe (cancelamento, carta de correção etc.)
+type Evento struct {
+	XMLName   xml.Name   `xml:"evento"`
+	Versao    string     `xml:"versao,attr"`
+	InfEvento InfEvento  `xml:"infEvento"`
+	Signature *Signature `xml:"Signature,omitempty"`
+}
+
+type InfEvento struct {
+	XMLName    xml.Name  `xml:"infEvento"`
+	Id         string    `xml:"Id,attr"`
+	COrgao     string    `xml:"cOrgao"`
+	TpAmb      string    `xml:"tpAmb"`
+	CNPJ       string    `xml:"CNPJ,omitempty"`
+	CPF        string    `xml:"CPF,omitempty"`
+	ChNFe      string    `xml:"chNFe"`
+	DhEvento   string    `xml:"dhEvento"`
+	TpEvento   string    `xml:"tpEvento"`
+	NSeqEvento string    `xml:"nSeqEvento"`
+	VerEvento  string    `xml:"verEvento"`
+	DetEvento  DetEvento `xml:"detEvento"`
+}
+
+// Detalhe do evento. Os campos variam conforme o tpEvento
+type DetEvento struct {
+	XMLName     xml.Name `xml:"detEvento"`
+	Versao      string   `xml:"versao,attr"`
+	DescEvento  string   `xml:"descEvento"`
+	COrgaoAutor string   `xml:"cOrgaoAutor,omitempty"`
+	TpAutor     string   `xml:"tpAutor,omitempty"`
+	VerAplic    string   `xml:"verAplic,omitempty"`
+	NProt       string   `xml:"nProt,omitempty"`
+	XJust       string   `xml:"xJust,omitempty"`
+	ChNFeRef    string   `xml:"chNFeRef,omitempty"`
+	XCorrecao   string   `xml:"xCorrecao,omitempty"`
+	XCondUso    string   `xml:"xCondUso,omitempty"`
+}
+
+type RetEvento struct {
+	XMLName   xml.Name     `xml:"retEvento"`
+	Versao    string       `xml:"versao,attr"`
+	InfEvento InfEventoRet `xml:"infEvento"`
+}
+
+type InfEventoRet struct {
+	XMLName     xml.Name `xml:"infEvento"`
+	Id          string   `xml:"Id,attr,omitempty"`
+	TpAmb       string   `xml:"tpAmb"`
+	VerAplic    string   `xml:"verAplic"`
+	COrgao      string   `xml:"cOrgao"`
+	CStat       string   `xml:"cStat"`
+	XMotivo     string   `xml:"xMotivo"`
+	ChNFe       string   `xml:"chNFe,omitempty"`
+	TpEvento    string   `xml:"tpEvento,omitempty"`
+	XEvento     string   `xml:"xEvento,omitempty"`
+	NSeqEvento  string   `xml:"nSeqEvento,omitempty"`
+	CNPJDest    string   `xml:"CNPJDest,omitempty"`
+	CPFDest     string   `xml:"CPFDest,omitempty"`
+	EmailDest   string   `xml:"emailDest,omitempty"`
+	DhRegEvento string   `xml:"dhRegEvento,omitempty"`
+	NProt       string   `xml:"nProt,omitempty"`
+}
+
+// Evento com o registro da SEFAZ (documento de distribuição do evento)
+type ProcEventoNFe struct {
+	XMLName   xml.Name  `xml:"procEventoNFe"`
+	Versao    string    `xml:"versao,attr"`
+	Evento    Evento    `xml:"evento"`
+	RetEvento RetEvento `xml:"retEvento"`
+}
+
+// Retorno do envio do lote de eventos (envEvento)
+type RetEnvEvento struct {
+	XMLName   xml.Name    `xml:"retEnvEvento"`
+	Versao    string      `xml:"versao,attr"`
+	IdLote    string      `xml:"idLote"`
+	TpAmb     string      `xml:"tpAmb"`
+	VerAplic  string      `xml:"verAplic"`
+	COrgao    string      `xml:"cOrgao"`
+	CStat     string      `xml:"cStat"`
+	XMotivo   string      `xml:"xMotivo"`
+	RetEvento []RetEvento `xml:"retEvento"`
+}
+
+// NovoInfEvento monta o infEvento do emitente da chave, com o Id
+// "ID" + tpEvento + chave + nSeqEvento (2 dígitos)
+func NovoInfEvento(chave ChaveAcesso, tpAmb, tpEvento string, nSeqEvento int, dhEvento DataHora, det DetEvento) InfEvento {
+	det.Versao = VersaoEvento
+	return InfEvento{
+		Id:         fmt.Sprintf("ID%s%s%02d", tpEvento, chave.String(), nSeqEvento),
+		COrgao:     chave.CUF,
+		TpAmb:      tpAmb,
+		CNPJ:       chave.CNPJ(),
+		CPF:        chave.CPF(),
+		ChNFe:      chave.String(),
+		DhEvento:   dhEvento.String(),
+		TpEvento:   tpEvento,
+		NSeqEvento: strconv.Itoa(nSeqEvento),
+		VerEvento:  VersaoEvento,
+		DetEvento:  det,
+	}
+}
+
+// ValidarJustificativa confere o xJust dos cancelamentos: de 15 a 255 caracteres,
+// desconsiderando os espaços das extremidades
+func ValidarJustificativa(xJust string) error {
+	n := utf8.RuneCountInString(strings.TrimSpace(xJust))
+	if n < 15 || n > 255 {
+		return fmt.Errorf("a justificativa deve ter de 15 a 255 caracteres, informados %d", n)
+	}
+	return nil
+}
+
+// ValidarCorrecao confere o xCorrecao da CC-e: de 15 a 1000 caracteres, desconsiderando
+// os espaços das extremidades
+func ValidarCorrecao(xCorrecao string) error {
+	n := utf8.RuneCountInString(strings.TrimSpace(xCorrecao))
+	if n < 15 || n > 1000 {
+		return fmt.Errorf("a correção deve ter de 15 a 1000 caracteres, informados %d", n)
+	}
+	return nil
+}
+
+// AvisosCorrecao aponta os dados vedados à CC-e que o texto da correção parece alterar.
+// A conferência é apenas indicativa: a carta é enviada mesmo com avisos
+func AvisosCorrecao(xCorrecao string) []string {
+	// Palavras separadas por um espaço, para comparar termos inteiros
+	palavras := strings.FieldsFunc(semAcentos(strings.ToLower(xCorrecao)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	texto := " " + strings.Join(palavras, " ") + " "
+	var avisos []string
+	for _, vedado := range CamposVedadosCCe {
+		for _, termo := range vedado.Termos {
+			if strings.Contains(texto, " "+termo+" ") {
+				avisos = append(avisos, fmt.Sprintf("a CC-e não pode alterar %s (termo %q na correção)", vedado.Descricao, termo))
+				break
+			}
+		}
+	}
+	return avisos
+}
+
+var removerAcentos = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ü", "u", "ç", "c",
+)
+
+func semAcentos(texto string) string {
+	return removerAcentos.Replace(texto)
+}
+
+// ValidarProtocolo confere o nProt de 15 dígitos da autorização
+func ValidarProtocolo(nProt string) error {
+	if len(nProt) != 15 || strings.Trim(nProt, "0123456789") != "" {
+		return errors.New("o número do protocolo de autorização (nProt) deve ter 15 dígitos")
+	}
+	return nil
+}
+
+// EscreverEvento serializa o evento, ainda sem assinatura, no leiaute da versão 1.00
+func EscreverEvento(w io.Writer, infEvento InfEvento) error {
+	e := novoEscritorXML(w)
+	e.texto(`<evento xmlns="http://www.portalfiscal.inf.br/nfe" versao="` + VersaoEvento + `"><infEvento Id="`)
+	e.escapar(infEvento.Id, true)
+	e.texto(`">`)
+	e.campo("cOrgao", infEvento.COrgao)
+	e.campo("tpAmb", infEvento.TpAmb)
+	e.campoOpcional("CNPJ", infEvento.CNPJ)
+	e.campoOpcional("CPF", infEvento.CPF)
+	e.campo("chNFe", infEvento.ChNFe)
+	e.campo("dhEvento", infEvento.DhEvento)
+	e.campo("tpEvento", infEvento.TpEvento)
+	e.campo("nSeqEvento", infEvento.NSeqEvento)
+	e.campo("verEvento", infEvento.VerEvento)
+
+	det := infEvento.DetEvento
+	e.texto(`<detEvento versao="`)
+	e.escapar(det.Versao, true)
+	e.texto(`">`)
+	e.campo("descEvento", det.DescEvento)
+	e.campoOpcional("cOrgaoAutor", det.COrgaoAutor)
+	e.campoOpcional("tpAutor", det.TpAutor)
+	e.campoOpcional("verAplic", det.VerAplic)
+	e.campoOpcional("nProt", det.NProt)
+	e.campoOpcional("xJust", det.XJust)
+	e.campoOpcional("chNFeRef", det.ChNFeRef)
+	e.campoOpcional("xCorrecao", det.XCorrecao)
+	e.campoOpcional("xCondUso", det.XCondUso)
+	e.texto("</detEvento></infEvento></evento>")
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("erro ao gerar XML: %w", err)
+	}
+	return nil
+}
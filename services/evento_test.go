@@ -0,0 +1,35 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAvisosCorrecao(t *testing.T) {
+	casos := []struct {
+		nome, xCorrecao string
+		avisos          []string // trechos esperados, na ordem de CamposVedadosCCe
+	}{
+		{"endereço de entrega", "Onde se le Rua das Flores, 100, leia-se Rua das Flores, 1000 - Bloco B", nil},
+		{"valor", "Corrigir o valor unitário do item 2", []string{`"valor"`}},
+		{"alíquota com acento e maiúsculas", "ALÍQUOTA do ICMS informada errada", []string{`"aliquota"`}},
+		{"termo composto", "A base de cálculo correta é 100,00", []string{`"base de calculo"`}},
+		{"termo dentro de outra palavra", "Corrigir a descrição: VALORIZADOR DE CABELOS", nil},
+		{"quantidade e destinatário", "Quantidade de volumes e razão social do destinatário",
+			[]string{"quantidade das mercadorias", "remetente ou destinatário"}},
+		{"data de emissão", "Data de emissão correta: 15/10/2026", []string{"data de emissão ou de saída"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			avisos := AvisosCorrecao(c.xCorrecao)
+			if len(avisos) != len(c.avisos) {
+				t.Fatalf("avisos = %q, esperados %d", avisos, len(c.avisos))
+			}
+			for i, trecho := range c.avisos {
+				if !strings.Contains(avisos[i], trecho) {
+					t.Errorf("aviso %d = %q, esperado contendo %s", i, avisos[i], trecho)
+				}
+			}
+		})
+	}
+}
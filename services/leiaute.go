@@ -0,0 +1,502 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Campo de um grupo de tributo, na ordem do leiaute 4.00. Campos opcionais só são
+// escritos quando preenchidos; os campos de um mesmo bloco opcional (grupo > 0) são
+// escritos juntos, inclusive os obrigatórios com valor zero, quando algum deles está
+// preenchido
+type campoLeiaute struct {
+	tag      string
+	opcional bool
+	grupo    int
+}
+
+// Converte a descrição "orig CST [modBC vBC pRedBC? pICMS vICMS] pFCP?" na sequência de
+// campos: "?" marca o campo opcional e os colchetes delimitam um bloco opcional
+func sequenciaLeiaute(descricao string) []campoLeiaute {
+	var campos []campoLeiaute
+	grupo, bloco := 0, 0
+	for _, tag := range strings.Fields(descricao) {
+		if strings.HasPrefix(tag, "[") {
+			grupo++
+			bloco = grupo
+			tag = tag[1:]
+		}
+		fim := strings.HasSuffix(tag, "]")
+		tag = strings.TrimSuffix(tag, "]")
+		campo := campoLeiaute{tag: strings.TrimSuffix(tag, "?"), opcional: strings.HasSuffix(tag, "?"), grupo: bloco}
+		campos = append(campos, campo)
+		if fim {
+			bloco = 0
+		}
+	}
+	return campos
+}
+
+// Blocos do ICMS comuns a vários grupos: FCP retido por ST, ICMS-ST retido anteriormente
+// e ICMS efetivo
+const (
+	leiauteFCPST     = "[vBCFCPST pFCPST vFCPST]"
+	leiauteSTRetido  = "[vBCSTRet pST vICMSSubstituto? vICMSSTRet] [vBCFCPSTRet pFCPSTRet vFCPSTRet] [pRedBCEfet vBCEfet pICMSEfet vICMSEfet]"
+	leiauteICMSST    = "modBCST pMVAST? pRedBCST? vBCST pICMSST vICMSST " + leiauteFCPST
+	leiauteICMSDeson = "[vICMSDeson motDesICMS]"
+)
+
+// Grupos do ICMS. ICMS40 também é usado para os CST 41 e 50
+var leiauteICMS = map[string][]campoLeiaute{
+	"ICMS00":    sequenciaLeiaute("orig CST modBC vBC pICMS vICMS [pFCP vFCP]"),
+	"ICMS10":    sequenciaLeiaute("orig CST modBC vBC pICMS vICMS [vBCFCP pFCP vFCP] " + leiauteICMSST),
+	"ICMS20":    sequenciaLeiaute("orig CST modBC pRedBC vBC pICMS vICMS [vBCFCP pFCP vFCP] " + leiauteICMSDeson),
+	"ICMS30":    sequenciaLeiaute("orig CST " + leiauteICMSST + " " + leiauteICMSDeson),
+	"ICMS40":    sequenciaLeiaute("orig CST " + leiauteICMSDeson),
+	"ICMS51":    sequenciaLeiaute("orig CST modBC? pRedBC? vBC? pICMS? vICMSOp? pDif? vICMSDif? vICMS? [vBCFCP? pFCP? vFCP?]"),
+	"ICMS60":    sequenciaLeiaute("orig CST " + leiauteSTRetido),
+	"ICMS70":    sequenciaLeiaute("orig CST modBC pRedBC vBC pICMS vICMS [vBCFCP pFCP vFCP] " + leiauteICMSST + " " + leiauteICMSDeson),
+	"ICMS90":    sequenciaLeiaute("orig CST [modBC vBC pRedBC? pICMS vICMS] [vBCFCP pFCP vFCP] [modBCST pMVAST? pRedBCST? vBCST pICMSST vICMSST] " + leiauteFCPST + " " + leiauteICMSDeson),
+	"ICMSSN101": sequenciaLeiaute("orig CSOSN pCredSN vCredICMSSN"),
+	"ICMSSN102": sequenciaLeiaute("orig CSOSN"),
+	"ICMSSN201": sequenciaLeiaute("orig CSOSN " + leiauteICMSST + " [pCredSN vCredICMSSN]"),
+	"ICMSSN202": sequenciaLeiaute("orig CSOSN " + leiauteICMSST),
+	"ICMSSN500": sequenciaLeiaute("orig CSOSN " + leiauteSTRetido),
+	"ICMSSN900": sequenciaLeiaute("orig CSOSN [modBC vBC pRedBC? pICMS vICMS] [modBCST pMVAST? pRedBCST? vBCST pICMSST vICMSST] " + leiauteFCPST + " [pCredSN vCredICMSSN]"),
+}
+
+// Grupos do PIS e da COFINS. No grupo Outr a base é em valor ou em quantidade
+var leiautePISCOFINS = map[string][]campoLeiaute{
+	"PISAliq":    sequenciaLeiaute("CST vBC pPIS vPIS"),
+	"PISQtde":    sequenciaLeiaute("CST qBCProd vAliqProd vPIS"),
+	"PISNT":      sequenciaLeiaute("CST"),
+	"PISOutr":    sequenciaLeiaute("CST [vBC pPIS] [qBCProd vAliqProd] vPIS"),
+	"COFINSAliq": sequenciaLeiaute("CST vBC pCOFINS vCOFINS"),
+	"COFINSQtde": sequenciaLeiaute("CST qBCProd vAliqProd vCOFINS"),
+	"COFINSNT":   sequenciaLeiaute("CST"),
+	"COFINSOutr": sequenciaLeiaute("CST [vBC pCOFINS] [qBCProd vAliqProd] vCOFINS"),
+}
+
+// Demais grupos escritos pela sequência do leiaute
+var (
+	leiauteII         = sequenciaLeiaute("vBC vDespAdu vII vIOF")
+	leiauteISSQN      = sequenciaLeiaute("vBC vAliq vISSQN cMunFG cListServ vDeducao? vOutro? vDescIncond? vDescCond? vISSRet? indISS cServico? cMun? cPais? nProcesso? indIncentivo")
+	leiauteICMSUFDest = sequenciaLeiaute("vBCUFDest vBCFCPUFDest? pFCPUFDest? pICMSUFDest pICMSInter pICMSInterPart vFCPUFDest? vICMSUFDest vICMSUFRemet")
+	leiauteLocal      = sequenciaLeiaute("CNPJ? CPF? xNome? xLgr nro xCpl? xBairro cMun xMun UF CEP? cPais? xPais? fone? email? IE?")
+	leiauteRefNF      = sequenciaLeiaute("cUF AAMM CNPJ mod serie nNF")
+	leiauteRefNFP     = sequenciaLeiaute("cUF AAMM CNPJ? CPF? IE mod serie nNF")
+	leiauteRefECF     = sequenciaLeiaute("mod nECF nCOO")
+	leiauteRastro     = sequenciaLeiaute("nLote qLote dFab dVal cAgreg?")
+	leiauteMed        = sequenciaLeiaute("cProdANVISA xMotivoIsencao? vPMC")
+	leiauteExporta    = sequenciaLeiaute("UFSaidaPais xLocExporta xLocDespacho?")
+	leiauteCompra     = sequenciaLeiaute("xNEmp? xPed? xCont?")
+)
+
+// Campos com 4 casas decimais: alíquotas, percentuais e valores por unidade
+var quatroCasas = map[string]bool{
+	"pRedBC": true, "pICMS": true, "pFCP": true, "pMVAST": true, "pRedBCST": true, "pICMSST": true,
+	"pFCPST": true, "pST": true, "pFCPSTRet": true, "pRedBCEfet": true, "pICMSEfet": true, "pDif": true,
+	"pCredSN": true, "pPIS": true, "pCOFINS": true, "qBCProd": true, "vAliqProd": true,
+	"pIPI": true, "qUnid": true, "vUnid": true, "vAliq": true, "pFCPUFDest": true, "pICMSUFDest": true,
+}
+
+func casasDecimais(tag string) int {
+	switch {
+	case quatroCasas[tag]:
+		return 4
+	case tag == "qLote":
+		return 3
+	}
+	return 2
+}
+
+// Valor de um campo do grupo: texto para os códigos e número para os valores
+type valorLeiaute struct {
+	texto   string
+	numero  float64
+	decimal bool
+}
+
+func (v valorLeiaute) vazio() bool {
+	if v.decimal {
+		return v.numero == 0
+	}
+	return v.texto == ""
+}
+
+func (g ICMSGrupo) valor(tag string) valorLeiaute {
+	switch tag {
+	case "orig":
+		return valorLeiaute{texto: g.Orig}
+	case "CST":
+		return valorLeiaute{texto: g.CST}
+	case "CSOSN":
+		return valorLeiaute{texto: g.CSOSN}
+	case "modBC":
+		return valorLeiaute{texto: g.ModBC}
+	case "modBCST":
+		return valorLeiaute{texto: g.ModBCST}
+	case "motDesICMS":
+		return valorLeiaute{texto: g.MotDesICMS}
+	}
+	var numero float64
+	switch tag {
+	case "pRedBC":
+		numero = g.PRedBC
+	case "vBC":
+		numero = g.VBC
+	case "pICMS":
+		numero = g.PICMS
+	case "vICMSOp":
+		numero = g.VICMSOp
+	case "pDif":
+		numero = g.PDif
+	case "vICMSDif":
+		numero = g.VICMSDif
+	case "vICMS":
+		numero = g.VICMS
+	case "vBCFCP":
+		numero = g.VBCFCP
+	case "pFCP":
+		numero = g.PFCP
+	case "vFCP":
+		numero = g.VFCP
+	case "pMVAST":
+		numero = g.PMVAST
+	case "pRedBCST":
+		numero = g.PRedBCST
+	case "vBCST":
+		numero = g.VBCST
+	case "pICMSST":
+		numero = g.PICMSST
+	case "vICMSST":
+		numero = g.VICMSST
+	case "vBCFCPST":
+		numero = g.VBCFCPST
+	case "pFCPST":
+		numero = g.PFCPST
+	case "vFCPST":
+		numero = g.VFCPST
+	case "vBCSTRet":
+		numero = g.VBCSTRet
+	case "pST":
+		numero = g.PST
+	case "vICMSSubstituto":
+		numero = g.VICMSSubstituto
+	case "vICMSSTRet":
+		numero = g.VICMSSTRet
+	case "vBCFCPSTRet":
+		numero = g.VBCFCPSTRet
+	case "pFCPSTRet":
+		numero = g.PFCPSTRet
+	case "vFCPSTRet":
+		numero = g.VFCPSTRet
+	case "pRedBCEfet":
+		numero = g.PRedBCEfet
+	case "vBCEfet":
+		numero = g.VBCEfet
+	case "pICMSEfet":
+		numero = g.PICMSEfet
+	case "vICMSEfet":
+		numero = g.VICMSEfet
+	case "vICMSDeson":
+		numero = g.VICMSDeson
+	case "pCredSN":
+		numero = g.PCredSN
+	case "vCredICMSSN":
+		numero = g.VCredICMSSN
+	}
+	return valorLeiaute{numero: numero, decimal: true}
+}
+
+func (g PISCOFINSGrupo) valor(tag string) valorLeiaute {
+	switch tag {
+	case "CST":
+		return valorLeiaute{texto: g.CST}
+	case "vBC":
+		return valorLeiaute{numero: g.VBC, decimal: true}
+	case "pPIS":
+		return valorLeiaute{numero: g.PPIS, decimal: true}
+	case "vPIS":
+		return valorLeiaute{numero: g.VPIS, decimal: true}
+	case "pCOFINS":
+		return valorLeiaute{numero: g.PCOFINS, decimal: true}
+	case "vCOFINS":
+		return valorLeiaute{numero: g.VCOFINS, decimal: true}
+	case "qBCProd":
+		return valorLeiaute{numero: g.QBCProd, decimal: true}
+	case "vAliqProd":
+		return valorLeiaute{numero: g.VAliqProd, decimal: true}
+	}
+	return valorLeiaute{}
+}
+
+func (ii II) valor(tag string) valorLeiaute {
+	switch tag {
+	case "vBC":
+		return valorLeiaute{numero: ii.VBC, decimal: true}
+	case "vDespAdu":
+		return valorLeiaute{numero: ii.VDespAdu, decimal: true}
+	case "vII":
+		return valorLeiaute{numero: ii.VII, decimal: true}
+	case "vIOF":
+		return valorLeiaute{numero: ii.VIOF, decimal: true}
+	}
+	return valorLeiaute{}
+}
+
+func (i ISSQN) valor(tag string) valorLeiaute {
+	switch tag {
+	case "cMunFG":
+		return valorLeiaute{texto: i.CMunFG}
+	case "cListServ":
+		return valorLeiaute{texto: i.CListServ}
+	case "indISS":
+		return valorLeiaute{texto: i.IndISS}
+	case "cServico":
+		return valorLeiaute{texto: i.CServico}
+	case "cMun":
+		return valorLeiaute{texto: i.CMun}
+	case "cPais":
+		return valorLeiaute{texto: i.CPais}
+	case "nProcesso":
+		return valorLeiaute{texto: i.NProcesso}
+	case "indIncentivo":
+		return valorLeiaute{texto: i.IndIncentivo}
+	}
+	var numero float64
+	switch tag {
+	case "vBC":
+		numero = i.VBC
+	case "vAliq":
+		numero = i.VAliq
+	case "vISSQN":
+		numero = i.VISSQN
+	case "vDeducao":
+		numero = i.VDeducao
+	case "vOutro":
+		numero = i.VOutro
+	case "vDescIncond":
+		numero = i.VDescIncond
+	case "vDescCond":
+		numero = i.VDescCond
+	case "vISSRet":
+		numero = i.VISSRet
+	}
+	return valorLeiaute{numero: numero, decimal: true}
+}
+
+func (i ICMSUFDest) valor(tag string) valorLeiaute {
+	var numero float64
+	switch tag {
+	case "vBCUFDest":
+		numero = i.VBCUFDest
+	case "vBCFCPUFDest":
+		numero = i.VBCFCPUFDest
+	case "pFCPUFDest":
+		numero = i.PFCPUFDest
+	case "pICMSUFDest":
+		numero = i.PICMSUFDest
+	case "pICMSInter":
+		numero = i.PICMSInter
+	case "pICMSInterPart":
+		numero = i.PICMSInterPart
+	case "vFCPUFDest":
+		numero = i.VFCPUFDest
+	case "vICMSUFDest":
+		numero = i.VICMSUFDest
+	case "vICMSUFRemet":
+		numero = i.VICMSUFRemet
+	}
+	return valorLeiaute{numero: numero, decimal: true}
+}
+
+func (l Local) valor(tag string) valorLeiaute {
+	var texto string
+	switch tag {
+	case "CNPJ":
+		texto = l.CNPJ
+	case "CPF":
+		texto = l.CPF
+	case "xNome":
+		texto = l.XNome
+	case "xLgr":
+		texto = l.XLgr
+	case "nro":
+		texto = l.Nro
+	case "xCpl":
+		texto = l.XCpl
+	case "xBairro":
+		texto = l.XBairro
+	case "cMun":
+		texto = l.CMun
+	case "xMun":
+		texto = l.XMun
+	case "UF":
+		texto = l.UF
+	case "CEP":
+		texto = l.CEP
+	case "cPais":
+		texto = l.CPais
+	case "xPais":
+		texto = l.XPais
+	case "fone":
+		texto = l.Fone
+	case "email":
+		texto = l.Email
+	case "IE":
+		texto = l.IE
+	}
+	return valorLeiaute{texto: texto}
+}
+
+func (r RefNF) valor(tag string) valorLeiaute {
+	var texto string
+	switch tag {
+	case "cUF":
+		texto = r.CUF
+	case "AAMM":
+		texto = r.AAMM
+	case "CNPJ":
+		texto = r.CNPJ
+	case "mod":
+		texto = r.Mod
+	case "serie":
+		texto = r.Serie
+	case "nNF":
+		texto = r.NNF
+	}
+	return valorLeiaute{texto: texto}
+}
+
+func (r RefNFP) valor(tag string) valorLeiaute {
+	var texto string
+	switch tag {
+	case "cUF":
+		texto = r.CUF
+	case "AAMM":
+		texto = r.AAMM
+	case "CNPJ":
+		texto = r.CNPJ
+	case "CPF":
+		texto = r.CPF
+	case "IE":
+		texto = r.IE
+	case "mod":
+		texto = r.Mod
+	case "serie":
+		texto = r.Serie
+	case "nNF":
+		texto = r.NNF
+	}
+	return valorLeiaute{texto: texto}
+}
+
+func (r RefECF) valor(tag string) valorLeiaute {
+	var texto string
+	switch tag {
+	case "mod":
+		texto = r.Mod
+	case "nECF":
+		texto = r.NECF
+	case "nCOO":
+		texto = r.NCOO
+	}
+	return valorLeiaute{texto: texto}
+}
+
+func (r Rastro) valor(tag string) valorLeiaute {
+	switch tag {
+	case "nLote":
+		return valorLeiaute{texto: r.NLote}
+	case "qLote":
+		return valorLeiaute{numero: r.QLote, decimal: true}
+	case "dFab":
+		return valorLeiaute{texto: r.DFab}
+	case "dVal":
+		return valorLeiaute{texto: r.DVal}
+	case "cAgreg":
+		return valorLeiaute{texto: r.CAgreg}
+	}
+	return valorLeiaute{}
+}
+
+func (m Med) valor(tag string) valorLeiaute {
+	switch tag {
+	case "cProdANVISA":
+		return valorLeiaute{texto: m.CProdANVISA}
+	case "xMotivoIsencao":
+		return valorLeiaute{texto: m.XMotivoIsencao}
+	case "vPMC":
+		return valorLeiaute{numero: m.VPMC, decimal: true}
+	}
+	return valorLeiaute{}
+}
+
+func (e Exporta) valor(tag string) valorLeiaute {
+	switch tag {
+	case "UFSaidaPais":
+		return valorLeiaute{texto: e.UFSaidaPais}
+	case "xLocExporta":
+		return valorLeiaute{texto: e.XLocExporta}
+	case "xLocDespacho":
+		return valorLeiaute{texto: e.XLocDespacho}
+	}
+	return valorLeiaute{}
+}
+
+func (c Compra) valor(tag string) valorLeiaute {
+	switch tag {
+	case "xNEmp":
+		return valorLeiaute{texto: c.XNEmp}
+	case "xPed":
+		return valorLeiaute{texto: c.XPed}
+	case "xCont":
+		return valorLeiaute{texto: c.XCont}
+	}
+	return valorLeiaute{}
+}
+
+// Percorre os campos do grupo na ordem do leiaute, chamando escrever apenas para os que
+// devem constar no XML
+func percorrerLeiaute(campos []campoLeiaute, valor func(tag string) valorLeiaute, escrever func(tag string, v valorLeiaute)) {
+	for i := 0; i < len(campos); {
+		campo := campos[i]
+		if campo.grupo == 0 {
+			if v := valor(campo.tag); !campo.opcional || !v.vazio() {
+				escrever(campo.tag, v)
+			}
+			i++
+			continue
+		}
+		fim := i
+		preenchido := false
+		for ; fim < len(campos) && campos[fim].grupo == campo.grupo; fim++ {
+			preenchido = preenchido || !valor(campos[fim].tag).vazio()
+		}
+		for _, c := range campos[i:fim] {
+			if v := valor(c.tag); preenchido && (!c.opcional || !v.vazio()) {
+				escrever(c.tag, v)
+			}
+		}
+		i = fim
+	}
+}
+
+// Leiaute do grupo de ICMS informado em XMLName
+func leiauteGrupoICMS(g ICMSGrupo) ([]campoLeiaute, error) {
+	campos, ok := leiauteICMS[g.XMLName.Local]
+	if !ok {
+		return nil, fmt.Errorf("grupo de ICMS inválido: %q", g.XMLName.Local)
+	}
+	return campos, nil
+}
+
+// Leiaute do grupo de PIS ou COFINS informado em XMLName, que deve começar pelo tributo
+func leiauteGrupoPISCOFINS(tributo string, g PISCOFINSGrupo) ([]campoLeiaute, error) {
+	campos, ok := leiautePISCOFINS[g.XMLName.Local]
+	if !ok || !strings.HasPrefix(g.XMLName.Local, tributo) {
+		return nil, fmt.Errorf("grupo de %s inválido: %q", tributo, g.XMLName.Local)
+	}
+	return campos, nil
+}
@@ -11,6 +11,7 @@ type DynamicElement struct {
 	Content  string
 	Attrs    []xml.Attr
 	Children []DynamicElement
+	Opcional bool // Elemento opcional no schema: omitido na serialização compacta quando vazio
 }
 
 // Função genérica para gerar XML a partir de dados dinâmicos
@@ -30,6 +31,57 @@ func GenerateDynamicXML(root DynamicElement) (string, error) {
 	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + buffer.String(), nil
 }
 
+// GenerateCompactXML gera o XML no formato exigido pela SEFAZ: sem indentação ou
+// espaços entre as tags e sem os elementos opcionais vazios
+func GenerateCompactXML(root DynamicElement) (string, error) {
+	buffer := &bytes.Buffer{}
+	encoder := xml.NewEncoder(buffer)
+
+	root, _ = removerOpcionaisVazios(root)
+	if err := encodeDynamicElement(encoder, root); err != nil {
+		return "", fmt.Errorf("erro ao gerar XML: %w", err)
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return "", fmt.Errorf("erro ao finalizar XML: %w", err)
+	}
+
+	return `<?xml version="1.0" encoding="UTF-8"?>` + buffer.String(), nil
+}
+
+// Remove recursivamente os elementos opcionais cuja subárvore não tem nenhum conteúdo
+// ou atributo preenchido. Retorna false quando o próprio elemento deve ser omitido
+func removerOpcionaisVazios(element DynamicElement) (DynamicElement, bool) {
+	if element.Opcional && elementoVazio(element) {
+		return element, false
+	}
+	var children []DynamicElement
+	for _, child := range element.Children {
+		if child, ok := removerOpcionaisVazios(child); ok {
+			children = append(children, child)
+		}
+	}
+	element.Children = children
+	return element, true
+}
+
+func elementoVazio(element DynamicElement) bool {
+	if element.Content != "" {
+		return false
+	}
+	for _, attr := range element.Attrs {
+		if attr.Value != "" {
+			return false
+		}
+	}
+	for _, child := range element.Children {
+		if !elementoVazio(child) {
+			return false
+		}
+	}
+	return true
+}
+
 func encodeDynamicElement(encoder *xml.Encoder, element DynamicElement) error {
 	startElement := xml.StartElement{Name: element.XMLName, Attr: element.Attrs}
 
@@ -56,30 +108,148 @@ func encodeDynamicElement(encoder *xml.Encoder, element DynamicElement) error {
 	return nil
 }
 
-func MakeTagIde(ide Ide) DynamicElement {
+// MakeTagNFe monta a árvore completa da NFe (NFe > infNFe) a partir das estruturas
+// tipadas, com os grupos na ordem do leiaute. Retorna erro quando infIntermed ou infAdic
+// não atendem ao leiaute
+func MakeTagNFe(infNFe InfNFe) (DynamicElement, error) {
+	children := []DynamicElement{MakeTagIde(infNFe.Ide), MakeTagEmit(infNFe.Emit)}
+	if infNFe.Dest != (Dest{}) {
+		children = append(children, MakeTagDest(infNFe.Dest))
+	}
+	if infNFe.Retirada != nil {
+		children = append(children, MakeTagLocal("retirada", *infNFe.Retirada))
+	}
+	if infNFe.Entrega != nil {
+		children = append(children, MakeTagLocal("entrega", *infNFe.Entrega))
+	}
+	for _, autXML := range infNFe.AutXML {
+		children = append(children, MakeTagAutXML(autXML))
+	}
+	for _, det := range infNFe.Det {
+		children = append(children, MakeTagDet(det))
+	}
+	children = append(children, MakeTagTotal(infNFe.Total))
+	if infNFe.Transp != nil {
+		children = append(children, MakeTagTransp(*infNFe.Transp))
+	}
+	if infNFe.Cobr != nil {
+		children = append(children, MakeTagCobr(*infNFe.Cobr))
+	}
+	if infNFe.Pag != nil {
+		children = append(children, MakeTagPag(*infNFe.Pag))
+	}
+	if infNFe.InfIntermed != nil {
+		infIntermed, err := MakeTagInfIntermed(infNFe.Ide, *infNFe.InfIntermed)
+		if err != nil {
+			return DynamicElement{}, err
+		}
+		children = append(children, infIntermed)
+	}
+	if infNFe.InfAdic != nil {
+		infAdic, err := MakeTagInfAdic(*infNFe.InfAdic)
+		if err != nil {
+			return DynamicElement{}, err
+		}
+		children = append(children, infAdic)
+	}
+	if infNFe.Exporta != nil {
+		children = append(children, makeTagGrupo("exporta", leiauteExporta, infNFe.Exporta.valor))
+	}
+	if infNFe.Compra != nil {
+		children = append(children, makeTagGrupo("compra", leiauteCompra, infNFe.Compra.valor))
+	}
+	if infNFe.InfRespTec != nil {
+		children = append(children, MakeTagInfRespTec(*infNFe.InfRespTec))
+	}
 	return DynamicElement{
-		XMLName: xml.Name{Local: "ide"},
+		XMLName: xml.Name{Local: "NFe"},
+		Attrs: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: "http://www.portalfiscal.inf.br/nfe"},
+		},
 		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "cUF"}, Content: ide.CUF},
-			{XMLName: xml.Name{Local: "cNF"}, Content: ide.CNF},
-			{XMLName: xml.Name{Local: "natOp"}, Content: ide.NatOp},
-			{XMLName: xml.Name{Local: "mod"}, Content: ide.Mod},
-			{XMLName: xml.Name{Local: "serie"}, Content: ide.Serie},
-			{XMLName: xml.Name{Local: "nNF"}, Content: ide.NNF},
-			{XMLName: xml.Name{Local: "dhEmi"}, Content: ide.DhEmi},
-			{XMLName: xml.Name{Local: "tpNF"}, Content: ide.TpNF},
-			{XMLName: xml.Name{Local: "idDest"}, Content: ide.IdDest},
-			{XMLName: xml.Name{Local: "cMunFG"}, Content: ide.CMunFG},
-			{XMLName: xml.Name{Local: "tpImp"}, Content: ide.TpImp},
-			{XMLName: xml.Name{Local: "tpEmis"}, Content: ide.TpEmis},
-			{XMLName: xml.Name{Local: "cDV"}, Content: ide.CDV},
-			{XMLName: xml.Name{Local: "tpAmb"}, Content: ide.TpAmb},
-			{XMLName: xml.Name{Local: "finNFe"}, Content: ide.FinNFe},
-			{XMLName: xml.Name{Local: "indFinal"}, Content: ide.IndFinal},
-			{XMLName: xml.Name{Local: "indPres"}, Content: ide.IndPres},
-			{XMLName: xml.Name{Local: "procEmi"}, Content: ide.ProcEmi},
-			{XMLName: xml.Name{Local: "verProc"}, Content: ide.VerProc},
+			{
+				XMLName: xml.Name{Local: "infNFe"},
+				Attrs: []xml.Attr{
+					{Name: xml.Name{Local: "Id"}, Value: infNFe.Id},
+					{Name: xml.Name{Local: "versao"}, Value: infNFe.Versao},
+				},
+				Children: children,
+			},
 		},
+	}, nil
+}
+
+func MakeTagIde(ide Ide) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "cUF"}, Content: ide.CUF},
+		{XMLName: xml.Name{Local: "cNF"}, Content: ide.CNF},
+		{XMLName: xml.Name{Local: "natOp"}, Content: ide.NatOp},
+		{XMLName: xml.Name{Local: "mod"}, Content: ide.Mod},
+		{XMLName: xml.Name{Local: "serie"}, Content: ide.Serie},
+		{XMLName: xml.Name{Local: "nNF"}, Content: ide.NNF},
+		{XMLName: xml.Name{Local: "dhEmi"}, Content: ide.DhEmi},
+		{XMLName: xml.Name{Local: "dhSaiEnt"}, Content: ide.DhSaiEnt, Opcional: true},
+		{XMLName: xml.Name{Local: "tpNF"}, Content: ide.TpNF},
+		{XMLName: xml.Name{Local: "idDest"}, Content: ide.IdDest},
+		{XMLName: xml.Name{Local: "cMunFG"}, Content: ide.CMunFG},
+		{XMLName: xml.Name{Local: "tpImp"}, Content: ide.TpImp},
+		{XMLName: xml.Name{Local: "tpEmis"}, Content: ide.TpEmis},
+		{XMLName: xml.Name{Local: "cDV"}, Content: ide.CDV},
+		{XMLName: xml.Name{Local: "tpAmb"}, Content: ide.TpAmb},
+		{XMLName: xml.Name{Local: "finNFe"}, Content: ide.FinNFe},
+	}
+	// Tipo da nota de débito/crédito (finNFe 6 e 5)
+	if ide.TpNFDebito != "" {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "tpNFDebito"}, Content: ide.TpNFDebito})
+	}
+	if ide.TpNFCredito != "" {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "tpNFCredito"}, Content: ide.TpNFCredito})
+	}
+	children = append(children,
+		DynamicElement{XMLName: xml.Name{Local: "indFinal"}, Content: ide.IndFinal},
+		DynamicElement{XMLName: xml.Name{Local: "indPres"}, Content: ide.IndPres},
+	)
+	// indIntermed só é informado nas operações com indPres 1, 2, 3, 4 ou 9
+	if ide.IndIntermed != "" {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "indIntermed"}, Content: ide.IndIntermed})
+	}
+	children = append(children,
+		DynamicElement{XMLName: xml.Name{Local: "procEmi"}, Content: ide.ProcEmi},
+		DynamicElement{XMLName: xml.Name{Local: "verProc"}, Content: ide.VerProc},
+	)
+	// Entrada em contingência: data e justificativa são informadas juntas
+	if ide.DhCont != "" || ide.XJust != "" {
+		children = append(children,
+			DynamicElement{XMLName: xml.Name{Local: "dhCont"}, Content: ide.DhCont},
+			DynamicElement{XMLName: xml.Name{Local: "xJust"}, Content: ide.XJust},
+		)
+	}
+	for _, ref := range ide.NFref {
+		children = append(children, MakeTagNFref(ref))
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "ide"},
+		Children: children,
+	}
+}
+
+// MakeTagNFref gera o documento referenciado: NF-e, nota modelo 1/1A, nota de produtor,
+// CT-e ou cupom fiscal
+func MakeTagNFref(ref NFref) DynamicElement {
+	children := []DynamicElement{{XMLName: xml.Name{Local: "refNFe"}, Content: ref.RefNFe, Opcional: true}}
+	if ref.RefNF != nil {
+		children = append(children, makeTagGrupo("refNF", leiauteRefNF, ref.RefNF.valor))
+	}
+	if ref.RefNFP != nil {
+		children = append(children, makeTagGrupo("refNFP", leiauteRefNFP, ref.RefNFP.valor))
+	}
+	children = append(children, DynamicElement{XMLName: xml.Name{Local: "refCTe"}, Content: ref.RefCTe, Opcional: true})
+	if ref.RefECF != nil {
+		children = append(children, makeTagGrupo("refECF", leiauteRefECF, ref.RefECF.valor))
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "NFref"},
+		Children: children,
 	}
 }
 
@@ -87,26 +257,28 @@ func MakeTagEmit(emit Emit) DynamicElement {
 	return DynamicElement{
 		XMLName: xml.Name{Local: "emit"},
 		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "CNPJ"}, Content: emit.CNPJ},
+			{XMLName: xml.Name{Local: "CNPJ"}, Content: emit.CNPJ, Opcional: true},
+			{XMLName: xml.Name{Local: "CPF"}, Content: emit.CPF, Opcional: true},
 			{XMLName: xml.Name{Local: "xNome"}, Content: emit.XNome},
-			{XMLName: xml.Name{Local: "xFant"}, Content: emit.XFant},
+			{XMLName: xml.Name{Local: "xFant"}, Content: emit.XFant, Opcional: true},
 			{
 				XMLName: xml.Name{Local: "enderEmit"},
 				Children: []DynamicElement{
 					{XMLName: xml.Name{Local: "xLgr"}, Content: emit.EnderEmit.XLgr},
 					{XMLName: xml.Name{Local: "nro"}, Content: emit.EnderEmit.Nro},
-					{XMLName: xml.Name{Local: "xCpl"}, Content: emit.EnderEmit.XCpl},
+					{XMLName: xml.Name{Local: "xCpl"}, Content: emit.EnderEmit.XCpl, Opcional: true},
 					{XMLName: xml.Name{Local: "xBairro"}, Content: emit.EnderEmit.XBairro},
 					{XMLName: xml.Name{Local: "cMun"}, Content: emit.EnderEmit.CMun},
 					{XMLName: xml.Name{Local: "xMun"}, Content: emit.EnderEmit.XMun},
 					{XMLName: xml.Name{Local: "UF"}, Content: emit.EnderEmit.UF},
 					{XMLName: xml.Name{Local: "CEP"}, Content: emit.EnderEmit.CEP},
-					{XMLName: xml.Name{Local: "cPais"}, Content: emit.EnderEmit.CPais},
-					{XMLName: xml.Name{Local: "xPais"}, Content: emit.EnderEmit.XPais},
-					{XMLName: xml.Name{Local: "fone"}, Content: emit.EnderEmit.Fone},
+					{XMLName: xml.Name{Local: "cPais"}, Content: emit.EnderEmit.CPais, Opcional: true},
+					{XMLName: xml.Name{Local: "xPais"}, Content: emit.EnderEmit.XPais, Opcional: true},
+					{XMLName: xml.Name{Local: "fone"}, Content: emit.EnderEmit.Fone, Opcional: true},
 				},
 			},
 			{XMLName: xml.Name{Local: "IE"}, Content: emit.IE},
+			{XMLName: xml.Name{Local: "IEST"}, Content: emit.IEST, Opcional: true},
 			{XMLName: xml.Name{Local: "CRT"}, Content: emit.CRT},
 		},
 	}
@@ -116,58 +288,337 @@ func MakeTagDest(dest Dest) DynamicElement {
 	return DynamicElement{
 		XMLName: xml.Name{Local: "dest"},
 		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "CNPJ"}, Content: dest.CNPJ},
-			{XMLName: xml.Name{Local: "xNome"}, Content: dest.XNome},
+			{XMLName: xml.Name{Local: "CNPJ"}, Content: dest.CNPJ, Opcional: true},
+			{XMLName: xml.Name{Local: "CPF"}, Content: dest.CPF, Opcional: true},
+			{XMLName: xml.Name{Local: "idEstrangeiro"}, Content: dest.IdEstrangeiro, Opcional: true},
+			{XMLName: xml.Name{Local: "xNome"}, Content: dest.XNome, Opcional: true},
 			{
-				XMLName: xml.Name{Local: "enderDest"},
+				XMLName:  xml.Name{Local: "enderDest"},
+				Opcional: true,
 				Children: []DynamicElement{
 					{XMLName: xml.Name{Local: "xLgr"}, Content: dest.EnderDest.XLgr},
 					{XMLName: xml.Name{Local: "nro"}, Content: dest.EnderDest.Nro},
+					{XMLName: xml.Name{Local: "xCpl"}, Content: dest.EnderDest.XCpl, Opcional: true},
 					{XMLName: xml.Name{Local: "xBairro"}, Content: dest.EnderDest.XBairro},
 					{XMLName: xml.Name{Local: "cMun"}, Content: dest.EnderDest.CMun},
 					{XMLName: xml.Name{Local: "xMun"}, Content: dest.EnderDest.XMun},
 					{XMLName: xml.Name{Local: "UF"}, Content: dest.EnderDest.UF},
-					{XMLName: xml.Name{Local: "CEP"}, Content: dest.EnderDest.CEP},
-					{XMLName: xml.Name{Local: "cPais"}, Content: dest.EnderDest.CPais},
-					{XMLName: xml.Name{Local: "xPais"}, Content: dest.EnderDest.XPais},
-					{XMLName: xml.Name{Local: "fone"}, Content: dest.EnderDest.Fone},
+					{XMLName: xml.Name{Local: "CEP"}, Content: dest.EnderDest.CEP, Opcional: true},
+					{XMLName: xml.Name{Local: "cPais"}, Content: dest.EnderDest.CPais, Opcional: true},
+					{XMLName: xml.Name{Local: "xPais"}, Content: dest.EnderDest.XPais, Opcional: true},
+					{XMLName: xml.Name{Local: "fone"}, Content: dest.EnderDest.Fone, Opcional: true},
 				},
 			},
 			{XMLName: xml.Name{Local: "indIEDest"}, Content: dest.IndIEDest},
-			{XMLName: xml.Name{Local: "IE"}, Content: dest.IE},
-			{XMLName: xml.Name{Local: "email"}, Content: dest.Email},
+			{XMLName: xml.Name{Local: "IE"}, Content: dest.IE, Opcional: true},
+			{XMLName: xml.Name{Local: "ISUF"}, Content: dest.ISUF, Opcional: true},
+			{XMLName: xml.Name{Local: "IM"}, Content: dest.IM, Opcional: true},
+			{XMLName: xml.Name{Local: "email"}, Content: dest.Email, Opcional: true},
 		},
 	}
 }
 
+// MakeTagLocal gera o local de retirada ou de entrega (tag "retirada" ou "entrega")
+func MakeTagLocal(tag string, local Local) DynamicElement {
+	return makeTagGrupo(tag, leiauteLocal, local.valor)
+}
+
 func MakeTagDet(det Det) DynamicElement {
-	return DynamicElement{
+	element := DynamicElement{
 		XMLName: xml.Name{Local: "det"},
 		Attrs: []xml.Attr{
 			{Name: xml.Name{Local: "nItem"}, Value: det.NItem},
 		},
-		Children: []DynamicElement{
-			{
-				XMLName: xml.Name{Local: "prod"},
-				Children: []DynamicElement{
-					{XMLName: xml.Name{Local: "cProd"}, Content: det.Prod.CProd},
-					{XMLName: xml.Name{Local: "xProd"}, Content: det.Prod.XProd},
-					{XMLName: xml.Name{Local: "cEAN"}, Content: det.Prod.CEAN},
-					{XMLName: xml.Name{Local: "cEANTrib"}, Content: det.Prod.CEANTrib},
-					{XMLName: xml.Name{Local: "NCM"}, Content: det.Prod.NCM},
-					{XMLName: xml.Name{Local: "CFOP"}, Content: det.Prod.CFOP},
-					{XMLName: xml.Name{Local: "uCom"}, Content: det.Prod.UCom},
-					{XMLName: xml.Name{Local: "qCom"}, Content: fmt.Sprintf("%.4f", det.Prod.QCom)},
-					{XMLName: xml.Name{Local: "vUnCom"}, Content: fmt.Sprintf("%.10f", det.Prod.VUnCom)},
-					{XMLName: xml.Name{Local: "vProd"}, Content: fmt.Sprintf("%.2f", det.Prod.VProd)},
-					{XMLName: xml.Name{Local: "uTrib"}, Content: det.Prod.UTrib},
-					{XMLName: xml.Name{Local: "qTrib"}, Content: fmt.Sprintf("%.4f", det.Prod.QTrib)},
-					{XMLName: xml.Name{Local: "vUnTrib"}, Content: fmt.Sprintf("%.10f", det.Prod.VUnTrib)},
-					{XMLName: xml.Name{Local: "indTot"}, Content: det.Prod.IndTot},
+		Children: []DynamicElement{MakeTagProd(det.Prod)},
+	}
+	if det.Imposto != nil {
+		element.Children = append(element.Children, MakeTagImposto(*det.Imposto))
+	}
+	if det.InfAdProd != "" {
+		element.Children = append(element.Children, DynamicElement{XMLName: xml.Name{Local: "infAdProd"}, Content: det.InfAdProd})
+	}
+	return element
+}
+
+func MakeTagProd(prod Prod) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "cProd"}, Content: prod.CProd},
+		{XMLName: xml.Name{Local: "cEAN"}, Content: prod.CEAN},
+		{XMLName: xml.Name{Local: "xProd"}, Content: prod.XProd},
+		{XMLName: xml.Name{Local: "NCM"}, Content: prod.NCM},
+		{XMLName: xml.Name{Local: "CEST"}, Content: prod.CEST, Opcional: true},
+		{XMLName: xml.Name{Local: "indEscala"}, Content: prod.IndEscala, Opcional: true},
+		{XMLName: xml.Name{Local: "CNPJFab"}, Content: prod.CNPJFab, Opcional: true},
+		{XMLName: xml.Name{Local: "cBenef"}, Content: prod.CBenef, Opcional: true},
+		{XMLName: xml.Name{Local: "CFOP"}, Content: prod.CFOP},
+		{XMLName: xml.Name{Local: "uCom"}, Content: prod.UCom},
+		{XMLName: xml.Name{Local: "qCom"}, Content: fmt.Sprintf("%.4f", prod.QCom)},
+		{XMLName: xml.Name{Local: "vUnCom"}, Content: fmt.Sprintf("%.10f", prod.VUnCom)},
+		{XMLName: xml.Name{Local: "vProd"}, Content: fmt.Sprintf("%.2f", prod.VProd)},
+		{XMLName: xml.Name{Local: "cEANTrib"}, Content: prod.CEANTrib},
+		{XMLName: xml.Name{Local: "uTrib"}, Content: prod.UTrib},
+		{XMLName: xml.Name{Local: "qTrib"}, Content: fmt.Sprintf("%.4f", prod.QTrib)},
+		{XMLName: xml.Name{Local: "vUnTrib"}, Content: fmt.Sprintf("%.10f", prod.VUnTrib)},
+	}
+	// Frete, seguro, desconto e outras despesas só são informados quando houver valor
+	for _, valor := range []struct {
+		tag   string
+		valor float64
+	}{{"vFrete", prod.VFrete}, {"vSeg", prod.VSeg}, {"vDesc", prod.VDesc}, {"vOutro", prod.VOutro}} {
+		if valor.valor != 0 {
+			children = append(children, DynamicElement{XMLName: xml.Name{Local: valor.tag}, Content: fmt.Sprintf("%.2f", valor.valor)})
+		}
+	}
+	children = append(children, DynamicElement{XMLName: xml.Name{Local: "indTot"}, Content: prod.IndTot})
+	for _, di := range prod.DI {
+		children = append(children, MakeTagDI(di))
+	}
+	children = append(children,
+		DynamicElement{XMLName: xml.Name{Local: "xPed"}, Content: prod.XPed, Opcional: true},
+		DynamicElement{XMLName: xml.Name{Local: "nItemPed"}, Content: prod.NItemPed, Opcional: true},
+	)
+	for _, rastro := range prod.Rastro {
+		children = append(children, makeTagGrupo("rastro", leiauteRastro, rastro.valor))
+	}
+	if prod.Med != nil {
+		children = append(children, makeTagGrupo("med", leiauteMed, prod.Med.valor))
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "prod"},
+		Children: children,
+	}
+}
+
+// MakeTagDI gera a declaração de importação com as suas adições
+func MakeTagDI(di DI) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "nDI"}, Content: di.NDI},
+		{XMLName: xml.Name{Local: "dDI"}, Content: di.DDI},
+		{XMLName: xml.Name{Local: "xLocDesemb"}, Content: di.XLocDesemb},
+		{XMLName: xml.Name{Local: "UFDesemb"}, Content: di.UFDesemb},
+		{XMLName: xml.Name{Local: "dDesemb"}, Content: di.DDesemb},
+		{XMLName: xml.Name{Local: "tpViaTransp"}, Content: di.TpViaTransp},
+	}
+	// Adicional ao frete para renovação da marinha mercante, só na via marítima
+	if di.VAFRMM != 0 {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "vAFRMM"}, Content: fmt.Sprintf("%.2f", di.VAFRMM)})
+	}
+	children = append(children,
+		DynamicElement{XMLName: xml.Name{Local: "tpIntermedio"}, Content: di.TpIntermedio},
+		DynamicElement{XMLName: xml.Name{Local: "CNPJ"}, Content: di.CNPJ, Opcional: true},
+		DynamicElement{XMLName: xml.Name{Local: "UFTerceiro"}, Content: di.UFTerceiro, Opcional: true},
+		DynamicElement{XMLName: xml.Name{Local: "cExportador"}, Content: di.CExportador},
+	)
+	for _, adi := range di.Adi {
+		adiChildren := []DynamicElement{
+			{XMLName: xml.Name{Local: "nAdicao"}, Content: adi.NAdicao, Opcional: true},
+			{XMLName: xml.Name{Local: "nSeqAdic"}, Content: adi.NSeqAdic},
+			{XMLName: xml.Name{Local: "cFabricante"}, Content: adi.CFabricante},
+		}
+		if adi.VDescDI != 0 {
+			adiChildren = append(adiChildren, DynamicElement{XMLName: xml.Name{Local: "vDescDI"}, Content: fmt.Sprintf("%.2f", adi.VDescDI)})
+		}
+		adiChildren = append(adiChildren, DynamicElement{XMLName: xml.Name{Local: "nDraw"}, Content: adi.NDraw, Opcional: true})
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "adi"}, Children: adiChildren})
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "DI"},
+		Children: children,
+	}
+}
+
+func MakeTagImposto(imposto Imposto) DynamicElement {
+	var children []DynamicElement
+	if imposto.VTotTrib > 0 {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "vTotTrib"}, Content: fmt.Sprintf("%.2f", imposto.VTotTrib)})
+	}
+	if imposto.ICMS != nil {
+		children = append(children, MakeTagICMS(*imposto.ICMS))
+	}
+	if imposto.IPI != nil {
+		children = append(children, MakeTagIPI(*imposto.IPI))
+	}
+	if imposto.II != nil {
+		children = append(children, makeTagGrupo("II", leiauteII, imposto.II.valor))
+	}
+	if imposto.ISSQN != nil {
+		children = append(children, makeTagGrupo("ISSQN", leiauteISSQN, imposto.ISSQN.valor))
+	}
+	if imposto.PIS != nil {
+		children = append(children, MakeTagPIS(*imposto.PIS))
+	}
+	if imposto.COFINS != nil {
+		children = append(children, MakeTagCOFINS(*imposto.COFINS))
+	}
+	if imposto.ICMSUFDest != nil {
+		children = append(children, makeTagGrupo("ICMSUFDest", leiauteICMSUFDest, imposto.ICMSUFDest.valor))
+	}
+	if imposto.IS != nil {
+		children = append(children, MakeTagIS(*imposto.IS))
+	}
+	if imposto.IBSCBS != nil {
+		children = append(children, MakeTagIBSCBS(*imposto.IBSCBS))
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "imposto"},
+		Children: children,
+	}
+}
+
+// MakeTagICMS gera o ICMS com o grupo de Grupo.XMLName (ICMS00, ICMSSN102...) na sequência
+// do leiaute. Um grupo desconhecido gera o elemento vazio, rejeitado na validação do XSD
+func MakeTagICMS(icms ICMS) DynamicElement {
+	campos, _ := leiauteGrupoICMS(icms.Grupo)
+	return makeTagGrupoLeiaute("ICMS", icms.Grupo.XMLName.Local, campos, icms.Grupo.valor)
+}
+
+func MakeTagPIS(pis PIS) DynamicElement {
+	campos, _ := leiauteGrupoPISCOFINS("PIS", pis.Grupo)
+	return makeTagGrupoLeiaute("PIS", pis.Grupo.XMLName.Local, campos, pis.Grupo.valor)
+}
+
+func MakeTagCOFINS(cofins COFINS) DynamicElement {
+	campos, _ := leiauteGrupoPISCOFINS("COFINS", cofins.Grupo)
+	return makeTagGrupoLeiaute("COFINS", cofins.Grupo.XMLName.Local, campos, cofins.Grupo.valor)
+}
+
+func makeTagGrupoLeiaute(tributo, grupo string, campos []campoLeiaute, valor func(string) valorLeiaute) DynamicElement {
+	return DynamicElement{
+		XMLName:  xml.Name{Local: tributo},
+		Children: []DynamicElement{makeTagGrupo(grupo, campos, valor)},
+	}
+}
+
+// Monta o grupo com os campos na sequência do leiaute
+func makeTagGrupo(tag string, campos []campoLeiaute, valor func(string) valorLeiaute) DynamicElement {
+	var children []DynamicElement
+	percorrerLeiaute(campos, valor, func(tag string, v valorLeiaute) {
+		content := v.texto
+		if v.decimal {
+			content = fmt.Sprintf("%.*f", casasDecimais(tag), v.numero)
+		}
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: tag}, Content: content})
+	})
+	return DynamicElement{
+		XMLName:  xml.Name{Local: tag},
+		Children: children,
+	}
+}
+
+func MakeTagIPI(ipi IPI) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "CNPJProd"}, Content: ipi.CNPJProd, Opcional: true},
+		{XMLName: xml.Name{Local: "cEnq"}, Content: ipi.CEnq},
+	}
+	if t := ipi.IPITrib; t != nil {
+		trib := []DynamicElement{{XMLName: xml.Name{Local: "CST"}, Content: t.CST}}
+		// Cálculo por alíquota ou por unidade de medida
+		if t.QUnid != 0 || t.VUnid != 0 {
+			trib = append(trib,
+				DynamicElement{XMLName: xml.Name{Local: "qUnid"}, Content: fmt.Sprintf("%.4f", t.QUnid)},
+				DynamicElement{XMLName: xml.Name{Local: "vUnid"}, Content: fmt.Sprintf("%.4f", t.VUnid)},
+			)
+		} else {
+			trib = append(trib,
+				DynamicElement{XMLName: xml.Name{Local: "vBC"}, Content: fmt.Sprintf("%.2f", t.VBC)},
+				DynamicElement{XMLName: xml.Name{Local: "pIPI"}, Content: fmt.Sprintf("%.4f", t.PIPI)},
+			)
+		}
+		trib = append(trib, DynamicElement{XMLName: xml.Name{Local: "vIPI"}, Content: fmt.Sprintf("%.2f", t.VIPI)})
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "IPITrib"}, Children: trib})
+	} else if ipi.IPINT != nil {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "IPINT"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "CST"}, Content: ipi.IPINT.CST},
+			},
+		})
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "IPI"},
+		Children: children,
+	}
+}
+
+func MakeTagIS(is IS) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "CSTIS"}, Content: is.CSTIS},
+		{XMLName: xml.Name{Local: "cClassTribIS"}, Content: is.CClassTribIS},
+		{XMLName: xml.Name{Local: "vBCIS"}, Content: fmt.Sprintf("%.2f", is.VBCIS)},
+		{XMLName: xml.Name{Local: "pIS"}, Content: fmt.Sprintf("%.4f", is.PIS)},
+	}
+	// Alíquota específica por unidade de medida
+	if is.PISEspec > 0 {
+		children = append(children,
+			DynamicElement{XMLName: xml.Name{Local: "pISEspec"}, Content: fmt.Sprintf("%.4f", is.PISEspec)},
+			DynamicElement{XMLName: xml.Name{Local: "uTrib"}, Content: is.UTrib},
+			DynamicElement{XMLName: xml.Name{Local: "qTrib"}, Content: fmt.Sprintf("%.4f", is.QTrib)},
+		)
+	}
+	children = append(children, DynamicElement{XMLName: xml.Name{Local: "vIS"}, Content: fmt.Sprintf("%.2f", is.VIS)})
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "IS"},
+		Children: children,
+	}
+}
+
+func MakeTagIBSCBS(ibscbs IBSCBS) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "CST"}, Content: ibscbs.CST},
+		{XMLName: xml.Name{Local: "cClassTrib"}, Content: ibscbs.CClassTrib},
+	}
+	if g := ibscbs.GIBSCBS; g != nil {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "gIBSCBS"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "vBC"}, Content: fmt.Sprintf("%.2f", g.VBC)},
+				{
+					XMLName: xml.Name{Local: "gIBSUF"},
+					Children: makeTagAliquotaIBSCBS(
+						DynamicElement{XMLName: xml.Name{Local: "pIBSUF"}, Content: fmt.Sprintf("%.4f", g.GIBSUF.PIBSUF)},
+						g.GIBSUF.GRed,
+						DynamicElement{XMLName: xml.Name{Local: "vIBSUF"}, Content: fmt.Sprintf("%.2f", g.GIBSUF.VIBSUF)},
+					),
+				},
+				{
+					XMLName: xml.Name{Local: "gIBSMun"},
+					Children: makeTagAliquotaIBSCBS(
+						DynamicElement{XMLName: xml.Name{Local: "pIBSMun"}, Content: fmt.Sprintf("%.4f", g.GIBSMun.PIBSMun)},
+						g.GIBSMun.GRed,
+						DynamicElement{XMLName: xml.Name{Local: "vIBSMun"}, Content: fmt.Sprintf("%.2f", g.GIBSMun.VIBSMun)},
+					),
+				},
+				{XMLName: xml.Name{Local: "vIBS"}, Content: fmt.Sprintf("%.2f", g.VIBS)},
+				{
+					XMLName: xml.Name{Local: "gCBS"},
+					Children: makeTagAliquotaIBSCBS(
+						DynamicElement{XMLName: xml.Name{Local: "pCBS"}, Content: fmt.Sprintf("%.4f", g.GCBS.PCBS)},
+						g.GCBS.GRed,
+						DynamicElement{XMLName: xml.Name{Local: "vCBS"}, Content: fmt.Sprintf("%.2f", g.GCBS.VCBS)},
+					),
 				},
 			},
-		},
+		})
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "IBSCBS"},
+		Children: children,
+	}
+}
+
+// Monta a sequência alíquota, redução (opcional) e valor dos grupos gIBSUF, gIBSMun e gCBS
+func makeTagAliquotaIBSCBS(aliquota DynamicElement, gRed *GRed, valor DynamicElement) []DynamicElement {
+	children := []DynamicElement{aliquota}
+	if gRed != nil {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "gRed"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "pRedAliq"}, Content: fmt.Sprintf("%.4f", gRed.PRedAliq)},
+				{XMLName: xml.Name{Local: "pAliqEfet"}, Content: fmt.Sprintf("%.4f", gRed.PAliqEfet)},
+			},
+		})
 	}
+	return append(children, valor)
 }
 
 func MakeTagAutXML(autXML AutXML) DynamicElement {
@@ -180,7 +631,7 @@ func MakeTagAutXML(autXML AutXML) DynamicElement {
 }
 
 func MakeTagTotal(total Total) DynamicElement {
-	return DynamicElement{
+	element := DynamicElement{
 		XMLName: xml.Name{Local: "total"},
 		Children: []DynamicElement{
 			{
@@ -189,8 +640,11 @@ func MakeTagTotal(total Total) DynamicElement {
 					{XMLName: xml.Name{Local: "vBC"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VBC)},
 					{XMLName: xml.Name{Local: "vICMS"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VICMS)},
 					{XMLName: xml.Name{Local: "vICMSDeson"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VICMSDeson)},
+					makeTagValorOpcional("vFCPUFDest", total.ICMSTot.VFCPUFDest),
+					makeTagValorOpcional("vICMSUFDest", total.ICMSTot.VICMSUFDest),
+					makeTagValorOpcional("vICMSUFRemet", total.ICMSTot.VICMSUFRemet),
 					{XMLName: xml.Name{Local: "vFCP"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VFCP)},
-					{XMLName: xml.Name{Local: "vBCST"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VBCST)},
+					{XMLName: xml.Name{Local: "vBCST"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VBSCST)},
 					{XMLName: xml.Name{Local: "vST"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VST)},
 					{XMLName: xml.Name{Local: "vFCPST"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VFCPST)},
 					{XMLName: xml.Name{Local: "vFCPSTRet"}, Content: fmt.Sprintf("%.2f", total.ICMSTot.VFCPSTRet)},
@@ -210,70 +664,299 @@ func MakeTagTotal(total Total) DynamicElement {
 			},
 		},
 	}
+	if t := total.ISSQNtot; t != nil {
+		element.Children = append(element.Children, DynamicElement{
+			XMLName: xml.Name{Local: "ISSQNtot"},
+			Children: []DynamicElement{
+				makeTagValorOpcional("vServ", t.VServ),
+				makeTagValorOpcional("vBC", t.VBC),
+				makeTagValorOpcional("vISS", t.VISS),
+				makeTagValorOpcional("vPIS", t.VPIS),
+				makeTagValorOpcional("vCOFINS", t.VCOFINS),
+				{XMLName: xml.Name{Local: "dCompet"}, Content: t.DCompet},
+				makeTagValorOpcional("vDeducao", t.VDeducao),
+				makeTagValorOpcional("vOutro", t.VOutro),
+				makeTagValorOpcional("vDescIncond", t.VDescIncond),
+				makeTagValorOpcional("vDescCond", t.VDescCond),
+				makeTagValorOpcional("vISSRet", t.VISSRet),
+				{XMLName: xml.Name{Local: "cRegTrib"}, Content: t.CRegTrib, Opcional: true},
+			},
+		})
+	}
+	if total.ISTot != nil {
+		element.Children = append(element.Children, DynamicElement{
+			XMLName: xml.Name{Local: "ISTot"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "vIS"}, Content: fmt.Sprintf("%.2f", total.ISTot.VIS)},
+			},
+		})
+	}
+	if t := total.IBSCBSTot; t != nil {
+		element.Children = append(element.Children, DynamicElement{
+			XMLName: xml.Name{Local: "IBSCBSTot"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "vBCIBSCBS"}, Content: fmt.Sprintf("%.2f", t.VBCIBSCBS)},
+				{
+					XMLName: xml.Name{Local: "gIBS"},
+					Children: []DynamicElement{
+						{
+							XMLName: xml.Name{Local: "gIBSUF"},
+							Children: []DynamicElement{
+								{XMLName: xml.Name{Local: "vDif"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSUF.VDif)},
+								{XMLName: xml.Name{Local: "vDevTrib"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSUF.VDevTrib)},
+								{XMLName: xml.Name{Local: "vIBSUF"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSUF.VIBSUF)},
+							},
+						},
+						{
+							XMLName: xml.Name{Local: "gIBSMun"},
+							Children: []DynamicElement{
+								{XMLName: xml.Name{Local: "vDif"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSMun.VDif)},
+								{XMLName: xml.Name{Local: "vDevTrib"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSMun.VDevTrib)},
+								{XMLName: xml.Name{Local: "vIBSMun"}, Content: fmt.Sprintf("%.2f", t.GIBS.GIBSMun.VIBSMun)},
+							},
+						},
+						{XMLName: xml.Name{Local: "vIBS"}, Content: fmt.Sprintf("%.2f", t.GIBS.VIBS)},
+						{XMLName: xml.Name{Local: "vCredPres"}, Content: fmt.Sprintf("%.2f", t.GIBS.VCredPres)},
+						{XMLName: xml.Name{Local: "vCredPresCondSus"}, Content: fmt.Sprintf("%.2f", t.GIBS.VCredPresCondSus)},
+					},
+				},
+				{
+					XMLName: xml.Name{Local: "gCBS"},
+					Children: []DynamicElement{
+						{XMLName: xml.Name{Local: "vDif"}, Content: fmt.Sprintf("%.2f", t.GCBS.VDif)},
+						{XMLName: xml.Name{Local: "vDevTrib"}, Content: fmt.Sprintf("%.2f", t.GCBS.VDevTrib)},
+						{XMLName: xml.Name{Local: "vCBS"}, Content: fmt.Sprintf("%.2f", t.GCBS.VCBS)},
+						{XMLName: xml.Name{Local: "vCredPres"}, Content: fmt.Sprintf("%.2f", t.GCBS.VCredPres)},
+						{XMLName: xml.Name{Local: "vCredPresCondSus"}, Content: fmt.Sprintf("%.2f", t.GCBS.VCredPresCondSus)},
+					},
+				},
+			},
+		})
+	}
+	if total.VNFTot > 0 {
+		element.Children = append(element.Children, DynamicElement{XMLName: xml.Name{Local: "vNFTot"}, Content: fmt.Sprintf("%.2f", total.VNFTot)})
+	}
+	return element
+}
+
+// Valor com 2 casas decimais, omitido na serialização compacta quando zero
+func makeTagValorOpcional(tag string, valor float64) DynamicElement {
+	element := DynamicElement{XMLName: xml.Name{Local: tag}, Opcional: true}
+	if valor != 0 {
+		element.Content = fmt.Sprintf("%.2f", valor)
+	}
+	return element
 }
 
 func MakeTagTransp(transp Transp) DynamicElement {
-	return DynamicElement{
+	element := DynamicElement{
 		XMLName: xml.Name{Local: "transp"},
 		Children: []DynamicElement{
 			{XMLName: xml.Name{Local: "modFrete"}, Content: transp.ModFrete},
 			{XMLName: xml.Name{Local: "transporta"},
+				Opcional: true,
 				Children: []DynamicElement{
-					{XMLName: xml.Name{Local: "CNPJ"}, Content: transp.Transporta.CNPJ},
-					{XMLName: xml.Name{Local: "xNome"}, Content: transp.Transporta.XNome},
-					{XMLName: xml.Name{Local: "xEnder"}, Content: transp.Transporta.XEnder},
-					{XMLName: xml.Name{Local: "xMun"}, Content: transp.Transporta.XMun},
-					{XMLName: xml.Name{Local: "UF"}, Content: transp.Transporta.UF},
-				},
-			},
-			{XMLName: xml.Name{Local: "vol"},
-				Children: []DynamicElement{
-					{XMLName: xml.Name{Local: "qVol"}, Content: transp.Vol.QVol},
-					{XMLName: xml.Name{Local: "esp"}, Content: transp.Vol.Esp},
-					{XMLName: xml.Name{Local: "pesoL"}, Content: transp.Vol.PesoL},
-					{XMLName: xml.Name{Local: "pesoB"}, Content: transp.Vol.PesoB},
+					{XMLName: xml.Name{Local: "CNPJ"}, Content: transp.Transporta.CNPJ, Opcional: true},
+					{XMLName: xml.Name{Local: "CPF"}, Content: transp.Transporta.CPF, Opcional: true},
+					{XMLName: xml.Name{Local: "xNome"}, Content: transp.Transporta.XNome, Opcional: true},
+					{XMLName: xml.Name{Local: "IE"}, Content: transp.Transporta.IE, Opcional: true},
+					{XMLName: xml.Name{Local: "xEnder"}, Content: transp.Transporta.XEnder, Opcional: true},
+					{XMLName: xml.Name{Local: "xMun"}, Content: transp.Transporta.XMun, Opcional: true},
+					{XMLName: xml.Name{Local: "UF"}, Content: transp.Transporta.UF, Opcional: true},
 				},
 			},
 		},
 	}
+	for _, vol := range transp.Vol {
+		element.Children = append(element.Children, DynamicElement{
+			XMLName:  xml.Name{Local: "vol"},
+			Opcional: true,
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "qVol"}, Content: vol.QVol, Opcional: true},
+				{XMLName: xml.Name{Local: "esp"}, Content: vol.Esp, Opcional: true},
+				{XMLName: xml.Name{Local: "pesoL"}, Content: vol.PesoL, Opcional: true},
+				{XMLName: xml.Name{Local: "pesoB"}, Content: vol.PesoB, Opcional: true},
+			},
+		})
+	}
+	return element
 }
 
 func MakeTagCobr(cobr Cobr) DynamicElement {
-	return DynamicElement{
-		XMLName: xml.Name{Local: "cobr"},
-		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "fat"}, Content: cobr.Fat},
-			{XMLName: xml.Name{Local: "dup"}, Content: cobr.Dup},
+	children := []DynamicElement{
+		{
+			XMLName:  xml.Name{Local: "fat"},
+			Opcional: true,
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "nFat"}, Content: cobr.Fat.NFat, Opcional: true},
+				{XMLName: xml.Name{Local: "vOrig"}, Content: cobr.Fat.VOrig, Opcional: true},
+				{XMLName: xml.Name{Local: "vDesc"}, Content: cobr.Fat.VDesc, Opcional: true},
+				{XMLName: xml.Name{Local: "vLiq"}, Content: cobr.Fat.VLiq, Opcional: true},
+			},
 		},
 	}
+	for _, dup := range cobr.Dup {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "dup"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "nDup"}, Content: dup.NDup, Opcional: true},
+				{XMLName: xml.Name{Local: "dVenc"}, Content: dup.DVenc, Opcional: true},
+				{XMLName: xml.Name{Local: "vDup"}, Content: dup.VDup},
+			},
+		})
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "cobr"},
+		Children: children,
+	}
 }
 
 func MakeTagPag(pag Pag) DynamicElement {
+	var children []DynamicElement
+	for _, detPag := range pag.DetPag {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "detPag"},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "indPag"}, Content: detPag.IndPag, Opcional: true},
+				{XMLName: xml.Name{Local: "tPag"}, Content: detPag.TPag},
+				{XMLName: xml.Name{Local: "vPag"}, Content: detPag.VPag},
+			},
+		})
+	}
+	if pag.VTroco != "" {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "vTroco"}, Content: pag.VTroco})
+	}
 	return DynamicElement{
-		XMLName: xml.Name{Local: "pag"},
-		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "detPag"}, Content: pag.DetPag},
-		},
+		XMLName:  xml.Name{Local: "pag"},
+		Children: children,
 	}
 }
 
-func MakeTagInfAdic(infAdic InfAdic) DynamicElement {
+// Ocorrências máximas dos grupos de infAdic
+const (
+	maxObsCont  = 10
+	maxObsFisco = 10
+	maxProcRef  = 100
+)
+
+// ValidarInfIntermed verifica se o grupo infIntermed pode ser informado: apenas nas
+// operações com intermediador (indIntermed 1)
+func ValidarInfIntermed(ide Ide) error {
+	if ide.IndIntermed != "1" {
+		return fmt.Errorf("infIntermed só pode ser informado com indIntermed 1 (operação com intermediador), informado %q", ide.IndIntermed)
+	}
+	return nil
+}
+
+// ValidarInfAdic verifica as ocorrências máximas de obsCont (10), obsFisco (10) e procRef (100)
+func ValidarInfAdic(infAdic InfAdic) error {
+	if len(infAdic.ObsCont) > maxObsCont {
+		return fmt.Errorf("infAdic pode ter no máximo %d obsCont, informados %d", maxObsCont, len(infAdic.ObsCont))
+	}
+	if len(infAdic.ObsFisco) > maxObsFisco {
+		return fmt.Errorf("infAdic pode ter no máximo %d obsFisco, informados %d", maxObsFisco, len(infAdic.ObsFisco))
+	}
+	if len(infAdic.ProcRef) > maxProcRef {
+		return fmt.Errorf("infAdic pode ter no máximo %d procRef, informados %d", maxProcRef, len(infAdic.ProcRef))
+	}
+	return nil
+}
+
+// MakeTagInfIntermed monta o grupo do intermediador, recusado quando o ide não indica
+// operação com intermediador
+func MakeTagInfIntermed(ide Ide, infIntermed InfIntermed) (DynamicElement, error) {
+	if err := ValidarInfIntermed(ide); err != nil {
+		return DynamicElement{}, err
+	}
 	return DynamicElement{
-		XMLName: xml.Name{Local: "infAdic"},
+		XMLName: xml.Name{Local: "infIntermed"},
 		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "infCpl"}, Content: infAdic.InfCpl},
+			{XMLName: xml.Name{Local: "CNPJ"}, Content: infIntermed.CNPJ},
+			{XMLName: xml.Name{Local: "idCadIntTran"}, Content: infIntermed.IdCadIntTran},
 		},
+	}, nil
+}
+
+// MakeTagInfAdic monta as informações adicionais, recusando obsCont, obsFisco ou procRef
+// além das ocorrências do leiaute
+func MakeTagInfAdic(infAdic InfAdic) (DynamicElement, error) {
+	if err := ValidarInfAdic(infAdic); err != nil {
+		return DynamicElement{}, err
+	}
+	var children []DynamicElement
+	if infAdic.InfAdFisco != "" {
+		children = append(children, DynamicElement{XMLName: xml.Name{Local: "infAdFisco"}, Content: infAdic.InfAdFisco})
+	}
+	children = append(children, DynamicElement{XMLName: xml.Name{Local: "infCpl"}, Content: infAdic.InfCpl, Opcional: true})
+	for _, obs := range infAdic.ObsCont {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "obsCont"},
+			Attrs: []xml.Attr{
+				{Name: xml.Name{Local: "xCampo"}, Value: obs.XCampo},
+			},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "xTexto"}, Content: obs.XTexto},
+			},
+		})
 	}
+	for _, obs := range infAdic.ObsFisco {
+		children = append(children, DynamicElement{
+			XMLName: xml.Name{Local: "obsFisco"},
+			Attrs: []xml.Attr{
+				{Name: xml.Name{Local: "xCampo"}, Value: obs.XCampo},
+			},
+			Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "xTexto"}, Content: obs.XTexto},
+			},
+		})
+	}
+	for _, proc := range infAdic.ProcRef {
+		procChildren := []DynamicElement{
+			{XMLName: xml.Name{Local: "nProc"}, Content: proc.NProc},
+			{XMLName: xml.Name{Local: "indProc"}, Content: proc.IndProc},
+		}
+		if proc.TpAto != "" {
+			procChildren = append(procChildren, DynamicElement{XMLName: xml.Name{Local: "tpAto"}, Content: proc.TpAto})
+		}
+		children = append(children, DynamicElement{
+			XMLName:  xml.Name{Local: "procRef"},
+			Children: procChildren,
+		})
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "infAdic"},
+		Children: children,
+	}, nil
 }
 
 func MakeTagInfRespTec(infRespTec InfRespTec) DynamicElement {
+	children := []DynamicElement{
+		{XMLName: xml.Name{Local: "CNPJ"}, Content: infRespTec.CNPJ},
+		{XMLName: xml.Name{Local: "xContato"}, Content: infRespTec.XContato},
+		{XMLName: xml.Name{Local: "email"}, Content: infRespTec.Email},
+		{XMLName: xml.Name{Local: "fone"}, Content: infRespTec.Fone},
+	}
+	// idCSRT e hashCSRT são informados juntos, apenas nas UFs que exigem o CSRT
+	if infRespTec.IdCSRT != "" && infRespTec.HashCSRT != "" {
+		children = append(children,
+			DynamicElement{XMLName: xml.Name{Local: "idCSRT"}, Content: infRespTec.IdCSRT},
+			DynamicElement{XMLName: xml.Name{Local: "hashCSRT"}, Content: infRespTec.HashCSRT},
+		)
+	}
+	return DynamicElement{
+		XMLName:  xml.Name{Local: "infRespTec"},
+		Children: children,
+	}
+}
+
+// MakeTagInfNFeSupl gera o grupo da NFC-e com o QR Code e o endereço de consulta pela
+// chave, que fica entre o infNFe e a assinatura
+func MakeTagInfNFeSupl(supl InfNFeSupl) DynamicElement {
 	return DynamicElement{
-		XMLName: xml.Name{Local: "infRespTec"},
+		XMLName: xml.Name{Local: "infNFeSupl"},
 		Children: []DynamicElement{
-			{XMLName: xml.Name{Local: "CNPJ"}, Content: infRespTec.CNPJ},
-			{XMLName: xml.Name{Local: "xContato"}, Content: infRespTec.XContato},
-			{XMLName: xml.Name{Local: "email"}, Content: infRespTec.Email},
-			{XMLName: xml.Name{Local: "fone"}, Content: infRespTec.Fone},
+			{XMLName: xml.Name{Local: "qrCode"}, Content: supl.QrCode},
+			{XMLName: xml.Name{Local: "urlChave"}, Content: supl.UrlChave},
 		},
 	}
 }
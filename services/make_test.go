@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Sequência dos elementos filhos no leiaute 4.00 (MOC e NT 2025.002), incluindo os que o
+// pacote não gera. Os grupos de escolha (NFref, ICMSxx, PISxx) não entram na conferência
+var ordemLeiaute = map[string]string{
+	"NFe":         "infNFe infNFeSupl Signature",
+	"infNFe":      "ide emit avulsa dest retirada entrega autXML det total transp cobr pag infIntermed infAdic exporta compra cana infRespTec infSolicNFF",
+	"ide":         "cUF cNF natOp mod serie nNF dhEmi dhSaiEnt tpNF idDest cMunFG cMunFGIBS tpImp tpEmis cDV tpAmb finNFe tpNFDebito tpNFCredito indFinal indPres indIntermed procEmi verProc dhCont xJust NFref gCompraGov",
+	"emit":        "CNPJ CPF xNome xFant enderEmit IE IEST IM CNAE CRT",
+	"enderEmit":   "xLgr nro xCpl xBairro cMun xMun UF CEP cPais xPais fone",
+	"dest":        "CNPJ CPF idEstrangeiro xNome enderDest indIEDest IE ISUF IM email",
+	"enderDest":   "xLgr nro xCpl xBairro cMun xMun UF CEP cPais xPais fone",
+	"retirada":    "CNPJ CPF xNome xLgr nro xCpl xBairro cMun xMun UF CEP cPais xPais fone email IE",
+	"entrega":     "CNPJ CPF xNome xLgr nro xCpl xBairro cMun xMun UF CEP cPais xPais fone email IE",
+	"autXML":      "CNPJ CPF",
+	"det":         "prod imposto impostoDevol infAdProd obsItem",
+	"prod":        "cProd cEAN cBarra xProd NCM NVE CEST indEscala CNPJFab cBenef EXTIPI CFOP uCom qCom vUnCom vProd cEANTrib cBarraTrib uTrib qTrib vUnTrib vFrete vSeg vDesc vOutro indTot DI detExport xPed nItemPed nFCI rastro infProdNFF infProdEmb veicProd med arma comb nRECOPI",
+	"DI":          "nDI dDI xLocDesemb UFDesemb dDesemb tpViaTransp vAFRMM tpIntermedio CNPJ CPF UFTerceiro cExportador adi",
+	"adi":         "nAdicao nSeqAdic cFabricante vDescDI nDraw",
+	"rastro":      "nLote qLote dFab dVal cAgreg",
+	"med":         "cProdANVISA xMotivoIsencao vPMC",
+	"imposto":     "vTotTrib ICMS IPI II ISSQN PIS PISST COFINS COFINSST ICMSUFDest IS IBSCBS",
+	"IPI":         "CNPJProd cSelo qSelo cEnq IPITrib IPINT",
+	"IPITrib":     "CST vBC pIPI qUnid vUnid vIPI",
+	"II":          "vBC vDespAdu vII vIOF",
+	"ISSQN":       "vBC vAliq vISSQN cMunFG cListServ vDeducao vOutro vDescIncond vDescCond vISSRet indISS cServico cMun cPais nProcesso indIncentivo",
+	"ICMSUFDest":  "vBCUFDest vBCFCPUFDest pFCPUFDest pICMSUFDest pICMSInter pICMSInterPart vFCPUFDest vICMSUFDest vICMSUFRemet",
+	"IS":          "CSTIS cClassTribIS vBCIS pIS pISEspec uTrib qTrib vIS",
+	"total":       "ICMSTot ISSQNtot retTrib ISTot IBSCBSTot vNFTot",
+	"ICMSTot":     "vBC vICMS vICMSDeson vFCPUFDest vICMSUFDest vICMSUFRemet vFCP vBCST vST vFCPST vFCPSTRet qBCMono vICMSMono qBCMonoReten vICMSMonoReten qBCMonoRet vICMSMonoRet vProd vFrete vSeg vDesc vII vIPI vIPIDevol vPIS vCOFINS vOutro vNF vTotTrib",
+	"ISSQNtot":    "vServ vBC vISS vPIS vCOFINS dCompet vDeducao vOutro vDescIncond vDescCond vISSRet cRegTrib",
+	"transp":      "modFrete transporta retTransp veicTransp reboque vagao balsa vol",
+	"transporta":  "CNPJ CPF xNome IE xEnder xMun UF",
+	"vol":         "qVol esp marca nVol pesoL pesoB lacres",
+	"cobr":        "fat dup",
+	"fat":         "nFat vOrig vDesc vLiq",
+	"dup":         "nDup dVenc vDup",
+	"pag":         "detPag vTroco",
+	"detPag":      "indPag tPag xPag vPag dPag CNPJPag UFPag card",
+	"infIntermed": "CNPJ idCadIntTran",
+	"infAdic":     "infAdFisco infCpl obsCont obsFisco procRef",
+	"exporta":     "UFSaidaPais xLocExporta xLocDespacho",
+	"compra":      "xNEmp xPed xCont",
+	"infRespTec":  "CNPJ xContato email fone idCSRT hashCSRT",
+}
+
+// Árvore de MakeTagNFe de uma nota válida
+func arvoreNFeTeste(t testing.TB, infNFe InfNFe) DynamicElement {
+	t.Helper()
+	arvore, err := MakeTagNFe(infNFe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return arvore
+}
+
+// Confere que os filhos de cada grupo aparecem na sequência do leiaute, qualquer que seja
+// a combinação de grupos opcionais presentes
+func conferirOrdemLeiaute(t *testing.T, origem string, xmlNFe string) {
+	t.Helper()
+	type nivel struct {
+		nome   string
+		ordem  []string
+		ultimo int
+	}
+	var pilha []*nivel
+	decoder := xml.NewDecoder(strings.NewReader(xmlNFe))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", origem, err)
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			nome := el.Name.Local
+			if len(pilha) > 0 && pilha[len(pilha)-1].ordem != nil {
+				pai := pilha[len(pilha)-1]
+				posicao := -1
+				for i, filho := range pai.ordem {
+					if filho == nome {
+						posicao = i
+						break
+					}
+				}
+				switch {
+				case posicao < 0:
+					t.Errorf("%s: %s não pertence a %s no leiaute", origem, nome, pai.nome)
+				case posicao < pai.ultimo:
+					t.Errorf("%s: %s fora da sequência em %s (depois de %s)", origem, nome, pai.nome, pai.ordem[pai.ultimo])
+				default:
+					pai.ultimo = posicao
+				}
+			}
+			atual := &nivel{nome: nome}
+			if ordem, ok := ordemLeiaute[nome]; ok {
+				atual.ordem = strings.Fields(ordem)
+			}
+			pilha = append(pilha, atual)
+		case xml.EndElement:
+			pilha = pilha[:len(pilha)-1]
+		}
+	}
+}
+
+func TestMakeTagNFeOrdemLeiaute(t *testing.T) {
+	notas := map[string]InfNFe{"completa": nfeCompletaTeste()}
+
+	// Grupos opcionais ausentes entre grupos presentes
+	parcial := nfeCompletaTeste()
+	parcial.Dest = Dest{}
+	parcial.Entrega = nil
+	parcial.Cobr = nil
+	parcial.InfIntermed = nil
+	parcial.Det[0].Imposto.IPI = nil
+	parcial.Det[0].Imposto.II = nil
+	parcial.Det[0].Prod.CEST = ""
+	parcial.Det[0].Prod.XPed = ""
+	parcial.Total.ISSQNtot = nil
+	notas["parcial"] = parcial
+
+	for _, arquivo := range []string{"nfe_compra_proc.xml", "nfe_importacao.xml", "nfe_conjugada.xml", "nfe_exportacao.xml"} {
+		data, err := os.ReadFile(filepath.Join("testdata", arquivo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfe, err := ParseNFe(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notas[arquivo] = nfe.InfNFe
+	}
+
+	for nome, infNFe := range notas {
+		compacto, err := GenerateCompactXML(arvoreNFeTeste(t, infNFe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conferirOrdemLeiaute(t, nome+" (GenerateCompactXML)", compacto)
+		conferirOrdemLeiaute(t, nome+" (EscreverNFe)", escreverNFeTeste(t, infNFe))
+
+		// Mesmo com os opcionais vazios, a árvore completa mantém a sequência
+		indentado, err := GenerateDynamicXML(arvoreNFeTeste(t, infNFe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conferirOrdemLeiaute(t, nome+" (GenerateDynamicXML)", indentado)
+	}
+}
+
+// Os elementos opcionais vazios saem da serialização compacta; os obrigatórios ficam,
+// mesmo vazios, e a ordem dos demais não muda
+func TestGenerateCompactXMLOpcionais(t *testing.T) {
+	root := DynamicElement{
+		XMLName: xml.Name{Local: "grupo"},
+		Children: []DynamicElement{
+			{XMLName: xml.Name{Local: "a"}, Content: "1"},
+			{XMLName: xml.Name{Local: "b"}, Opcional: true},
+			{XMLName: xml.Name{Local: "c"}},
+			{XMLName: xml.Name{Local: "d"}, Opcional: true, Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "e"}, Opcional: true},
+			}},
+			{XMLName: xml.Name{Local: "f"}, Opcional: true, Children: []DynamicElement{
+				{XMLName: xml.Name{Local: "g"}},
+				{XMLName: xml.Name{Local: "h"}, Content: "2"},
+			}},
+			{XMLName: xml.Name{Local: "i"}, Opcional: true, Attrs: []xml.Attr{{Name: xml.Name{Local: "x"}, Value: "3"}}},
+		},
+	}
+	compacto, err := GenerateCompactXML(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := `<?xml version="1.0" encoding="UTF-8"?><grupo><a>1</a><c></c><f><g></g><h>2</h></f><i x="3"></i></grupo>`
+	if compacto != esperado {
+		t.Fatalf("\n%s\n%s", compacto, esperado)
+	}
+	if indentado, err := GenerateDynamicXML(root); err != nil || !bytes.Contains([]byte(indentado), []byte("<b></b>")) {
+		t.Fatalf("GenerateDynamicXML deve manter os opcionais vazios: %v\n%s", err, indentado)
+	}
+}
+
+func TestInfAdicInfIntermedLeiaute(t *testing.T) {
+	obsCont := func(n int) []ObsCont { return make([]ObsCont, n) }
+	obsFisco := func(n int) []ObsFisco { return make([]ObsFisco, n) }
+	procRef := func(n int) []ProcRef { return make([]ProcRef, n) }
+	casos := []struct {
+		nome    string
+		alterar func(*InfNFe)
+		erro    string
+	}{
+		{"limites do leiaute", func(i *InfNFe) {
+			i.InfAdic = &InfAdic{ObsCont: obsCont(10), ObsFisco: obsFisco(10), ProcRef: procRef(100)}
+		}, ""},
+		{"11 obsCont", func(i *InfNFe) { i.InfAdic = &InfAdic{ObsCont: obsCont(11)} }, "no máximo 10 obsCont"},
+		{"11 obsFisco", func(i *InfNFe) { i.InfAdic = &InfAdic{ObsFisco: obsFisco(11)} }, "no máximo 10 obsFisco"},
+		{"101 procRef", func(i *InfNFe) { i.InfAdic = &InfAdic{ProcRef: procRef(101)} }, "no máximo 100 procRef"},
+		{"sem intermediador e sem infIntermed", func(i *InfNFe) { i.Ide.IndIntermed = "0"; i.InfIntermed = nil }, ""},
+		{"infIntermed sem intermediador", func(i *InfNFe) { i.Ide.IndIntermed = "0" }, "indIntermed 1"},
+		{"infIntermed sem indIntermed", func(i *InfNFe) { i.Ide.IndIntermed = "" }, "indIntermed 1"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			infNFe := nfeCompletaTeste()
+			c.alterar(&infNFe)
+			_, errArvore := MakeTagNFe(infNFe)
+			errEscrita := EscreverNFe(&bytes.Buffer{}, infNFe)
+			for origem, err := range map[string]error{"MakeTagNFe": errArvore, "EscreverNFe": errEscrita} {
+				if c.erro == "" && err != nil || c.erro != "" && (err == nil || !strings.Contains(err.Error(), c.erro)) {
+					t.Errorf("%s: erro = %v, esperado %q", origem, err, c.erro)
+				}
+			}
+		})
+	}
+
+	if _, err := MakeTagInfIntermed(Ide{IndIntermed: "1"}, InfIntermed{CNPJ: "22222222000191", IdCadIntTran: "LOJA"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MakeTagInfAdic(InfAdic{ObsCont: obsCont(11)}); err == nil {
+		t.Fatal("MakeTagInfAdic aceitou 11 obsCont")
+	}
+
+	// O builder recusa a nota antes de devolvê-la
+	_, err := builderTeste().InfIntermed(InfIntermed{CNPJ: "22222222000191", IdCadIntTran: "LOJA"}).Build()
+	if err == nil || !strings.Contains(err.Error(), "indIntermed 1") {
+		t.Fatalf("Build com infIntermed sem indIntermed: %v", err)
+	}
+	_, err = builderTeste().InfAdic(InfAdic{ProcRef: procRef(101)}).Build()
+	if err == nil || !strings.Contains(err.Error(), "procRef") {
+		t.Fatalf("Build com 101 procRef: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import "fmt"
+
+// Modelos do documento fiscal (campo mod)
+const (
+	ModeloNFe  = "55"
+	ModeloNFCe = "65"
+)
+
+// Formatos do DANFE (campo tpImp)
+const (
+	TpImpRetrato      = "1"
+	TpImpPaisagem     = "2"
+	TpImpSimplificado = "3"
+	TpImpNFCe         = "4" // DANFE NFC-e
+	TpImpNFCeMensagem = "5" // DANFE NFC-e em mensagem eletrônica
+)
+
+// DestConsumidor identifica o consumidor da NFC-e apenas pelo CPF. Na NFC-e o
+// destinatário é opcional e, quando informado, não é contribuinte do ICMS
+func DestConsumidor(cpf string) Dest {
+	return Dest{CPF: cpf, IndIEDest: "9"}
+}
+
+// Preenche os campos da NFC-e que só admitem um valor ou têm padrão no varejo: DANFE
+// NFC-e, operação interna, consumidor final e venda presencial
+func aplicarPadroesNFCe(ide *Ide, dest *Dest) {
+	if ide.TpImp == "" {
+		ide.TpImp = TpImpNFCe
+	}
+	if ide.IdDest == "" {
+		ide.IdDest = "1"
+	}
+	if ide.IndFinal == "" {
+		ide.IndFinal = "1"
+	}
+	if ide.IndPres == "" {
+		ide.IndPres = "1"
+	}
+	if dest != nil && dest.IndIEDest == "" {
+		dest.IndIEDest = "9"
+	}
+}
+
+// Regras específicas de cada modelo: a NF-e exige destinatário e a NFC-e só admite
+// consumidor final em operação presencial (ou entrega em domicílio) com DANFE NFC-e
+func regraModelo(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	ide := infNFe.Ide
+	if ide.Mod != ModeloNFCe {
+		var violacoes []Violacao
+		if infNFe.Dest == (Dest{}) {
+			violacoes = append(violacoes, Violacao{CStat: 719, Motivo: "Rejeição: NF-e sem a identificação do destinatário"})
+		}
+		if ide.TpImp == TpImpNFCe || ide.TpImp == TpImpNFCeMensagem {
+			violacoes = append(violacoes, Violacao{CStat: 225, Motivo: "Rejeição: Falha no Schema XML da NFe",
+				Detalhe: fmt.Sprintf("tpImp %s exclusivo da NFC-e", ide.TpImp)})
+		}
+		return violacoes
+	}
+	var violacoes []Violacao
+	if ide.TpImp != TpImpNFCe && ide.TpImp != TpImpNFCeMensagem {
+		violacoes = append(violacoes, Violacao{CStat: 709, Motivo: "Rejeição: NFC-e com formato de DANFE inválido",
+			Detalhe: fmt.Sprintf("tpImp %s", ide.TpImp)})
+	}
+	// NFC-e: emissão normal ou contingência off-line
+	if ide.TpEmis != "1" && ide.TpEmis != "9" {
+		violacoes = append(violacoes, Violacao{CStat: 714, Motivo: "Rejeição: NFC-e com opção de contingência inválida",
+			Detalhe: fmt.Sprintf("tpEmis %s", ide.TpEmis)})
+	}
+	if ide.FinNFe != "1" {
+		violacoes = append(violacoes, Violacao{CStat: 715, Motivo: "Rejeição: NFC-e com finalidade inválida",
+			Detalhe: fmt.Sprintf("finNFe %s", ide.FinNFe)})
+	}
+	if ide.IndFinal != "1" {
+		violacoes = append(violacoes, Violacao{CStat: 716, Motivo: "Rejeição: NFC-e em operação não destinada a consumidor final"})
+	}
+	if ide.IndPres != "1" && ide.IndPres != "4" && ide.IndPres != "5" {
+		violacoes = append(violacoes, Violacao{CStat: 717, Motivo: "Rejeição: NFC-e em operação não presencial",
+			Detalhe: fmt.Sprintf("indPres %s", ide.IndPres)})
+	}
+	if infNFe.Emit.IEST != "" {
+		violacoes = append(violacoes, Violacao{CStat: 718, Motivo: "Rejeição: NFC-e não deve informar IE de Substituto Tributário"})
+	}
+	return violacoes
+}
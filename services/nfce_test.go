@@ -0,0 +1,80 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAplicarPadroesNFCe(t *testing.T) {
+	ide := Ide{}
+	dest := Dest{CPF: "52998224725"}
+	aplicarPadroesNFCe(&ide, &dest)
+	if ide.TpImp != TpImpNFCe || ide.IdDest != "1" || ide.IndFinal != "1" || ide.IndPres != "1" {
+		t.Fatalf("padrões não aplicados: %+v", ide)
+	}
+	if dest.IndIEDest != "9" {
+		t.Fatalf("indIEDest = %q, esperado 9", dest.IndIEDest)
+	}
+
+	// Valores informados são mantidos, inclusive os que regraModelo rejeita
+	ide = Ide{TpImp: TpImpNFCeMensagem, IdDest: "2", IndFinal: "0", IndPres: "4"}
+	dest = Dest{CNPJ: "11222333000181", IndIEDest: "1"}
+	aplicarPadroesNFCe(&ide, &dest)
+	if !reflect.DeepEqual(ide, Ide{TpImp: TpImpNFCeMensagem, IdDest: "2", IndFinal: "0", IndPres: "4"}) {
+		t.Fatalf("campos informados alterados: %+v", ide)
+	}
+	if dest.IndIEDest != "1" {
+		t.Fatalf("indIEDest informado alterado: %q", dest.IndIEDest)
+	}
+
+	// A NFC-e sem destinatário não recebe um
+	ide = Ide{}
+	aplicarPadroesNFCe(&ide, nil)
+	if ide.TpImp != TpImpNFCe {
+		t.Fatalf("padrões não aplicados sem destinatário: %+v", ide)
+	}
+}
+
+func TestRegraModelo(t *testing.T) {
+	nfce := func(alterar func(*InfNFe)) InfNFe {
+		infNFe := InfNFe{Ide: Ide{Mod: ModeloNFCe, TpImp: TpImpNFCe, TpEmis: "1", FinNFe: "1", IndFinal: "1", IndPres: "1"}}
+		alterar(&infNFe)
+		return infNFe
+	}
+	nfe := func(alterar func(*InfNFe)) InfNFe {
+		infNFe := InfNFe{Ide: Ide{Mod: ModeloNFe, TpImp: TpImpRetrato, TpEmis: "1", FinNFe: "1"}, Dest: Dest{CNPJ: "11222333000181"}}
+		alterar(&infNFe)
+		return infNFe
+	}
+	casos := []struct {
+		nome   string
+		infNFe InfNFe
+		cStats []int
+	}{
+		{"NFC-e válida", nfce(func(*InfNFe) {}), nil},
+		{"NFC-e sem destinatário e com entrega em domicílio", nfce(func(i *InfNFe) { i.Ide.IndPres = "4" }), nil},
+		{"NFC-e em contingência off-line", nfce(func(i *InfNFe) { i.Ide.TpEmis = "9"; i.Ide.TpImp = TpImpNFCeMensagem }), nil},
+		{"NFC-e com DANFE retrato", nfce(func(i *InfNFe) { i.Ide.TpImp = TpImpRetrato }), []int{709}},
+		{"NFC-e em SVC", nfce(func(i *InfNFe) { i.Ide.TpEmis = "6" }), []int{714}},
+		{"NFC-e de devolução", nfce(func(i *InfNFe) { i.Ide.FinNFe = "4" }), []int{715}},
+		{"NFC-e sem consumidor final", nfce(func(i *InfNFe) { i.Ide.IndFinal = "0" }), []int{716}},
+		{"NFC-e pela internet", nfce(func(i *InfNFe) { i.Ide.IndPres = "2" }), []int{717}},
+		{"NFC-e com IE ST", nfce(func(i *InfNFe) { i.Emit.IEST = "123456789" }), []int{718}},
+		{"NFC-e com várias falhas", nfce(func(i *InfNFe) { i.Ide.TpImp = ""; i.Ide.IndFinal = "0" }), []int{709, 716}},
+		{"NF-e válida", nfe(func(*InfNFe) {}), nil},
+		{"NF-e sem destinatário", nfe(func(i *InfNFe) { i.Dest = Dest{} }), []int{719}},
+		{"NF-e com DANFE NFC-e", nfe(func(i *InfNFe) { i.Ide.TpImp = TpImpNFCe }), []int{225}},
+		{"NF-e com DANFE NFC-e sem destinatário", nfe(func(i *InfNFe) { i.Dest = Dest{}; i.Ide.TpImp = TpImpNFCeMensagem }), []int{719, 225}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			var cStats []int
+			for _, v := range regraModelo(c.infNFe, ContextoValidacao{}) {
+				cStats = append(cStats, v.CStat)
+			}
+			if !reflect.DeepEqual(cStats, c.cStats) {
+				t.Fatalf("rejeições = %v, esperado %v", cStats, c.cStats)
+			}
+		})
+	}
+}
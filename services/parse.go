@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// ParseNFe lê o XML de uma NFe, assinada ou não. Também aceita um nfeProc,
+// retornando a NFe contida nele
+func ParseNFe(data []byte) (*NFe, error) {
+	nfe := &NFe{}
+	if err := decodificarElemento(data, "NFe", nfe); err != nil {
+		return nil, err
+	}
+	return nfe, nil
+}
+
+// ParseNFeProc lê o XML de distribuição da NFe autorizada (nfeProc)
+func ParseNFeProc(data []byte) (*NFeProc, error) {
+	nfeProc := &NFeProc{}
+	if err := decodificarElemento(data, "nfeProc", nfeProc); err != nil {
+		return nil, err
+	}
+	return nfeProc, nil
+}
+
+// ParseProcEventoNFe lê o XML de distribuição de um evento (procEventoNFe)
+func ParseProcEventoNFe(data []byte) (*ProcEventoNFe, error) {
+	procEvento := &ProcEventoNFe{}
+	if err := decodificarElemento(data, "procEventoNFe", procEvento); err != nil {
+		return nil, err
+	}
+	return procEvento, nil
+}
+
+// ParseRetEnviNFe lê o retorno da autorização, com ou sem o envelope SOAP
+func ParseRetEnviNFe(data []byte) (*RetEnviNFe, error) {
+	ret := &RetEnviNFe{}
+	if err := decodificarElemento(data, "retEnviNFe", ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseRetConsReciNFe lê o retorno da consulta do recibo, com ou sem o envelope SOAP
+func ParseRetConsReciNFe(data []byte) (*RetConsReciNFe, error) {
+	ret := &RetConsReciNFe{}
+	if err := decodificarElemento(data, "retConsReciNFe", ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseRetConsStatServ lê o retorno da consulta do status do serviço, com ou sem o envelope SOAP
+func ParseRetConsStatServ(data []byte) (*RetConsStatServ, error) {
+	ret := &RetConsStatServ{}
+	if err := decodificarElemento(data, "retConsStatServ", ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseRetEnvEvento lê o retorno do envio de eventos, com ou sem o envelope SOAP
+func ParseRetEnvEvento(data []byte) (*RetEnvEvento, error) {
+	ret := &RetEnvEvento{}
+	if err := decodificarElemento(data, "retEnvEvento", ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Localiza o primeiro elemento com o nome informado, em qualquer nível do
+// documento, e decodifica-o em v
+func decodificarElemento(data []byte, nome string, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fmt.Errorf("elemento %s não encontrado no XML", nome)
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao ler o XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != nome {
+			continue
+		}
+		if err := decoder.DecodeElement(v, &start); err != nil {
+			return fmt.Errorf("erro ao decodificar %s: %v", nome, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Trecho do infNFe, com as tags de abertura e fechamento
+func trechoInfNFe(t *testing.T, xmlNFe []byte) []byte {
+	t.Helper()
+	inicio := bytes.Index(xmlNFe, []byte("<infNFe "))
+	fim := bytes.Index(xmlNFe, []byte("</infNFe>"))
+	if inicio < 0 || fim < 0 {
+		t.Fatalf("XML sem infNFe:\n%s", xmlNFe)
+	}
+	return xmlNFe[inicio : fim+len("</infNFe>")]
+}
+
+// Documentos do leiaute 4.00 de outros emissores: a leitura e a escrita pelas estruturas
+// tipadas devem reproduzir o infNFe original byte a byte
+func TestParseNFeLeiaute400(t *testing.T) {
+	for _, arquivo := range []string{"nfe_compra_proc.xml", "nfe_importacao.xml", "nfe_conjugada.xml", "nfe_exportacao.xml"} {
+		t.Run(arquivo, func(t *testing.T) {
+			original, err := os.ReadFile(filepath.Join("testdata", arquivo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nfe, err := ParseNFe(original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			escrito := []byte(escreverNFeTeste(t, nfe.InfNFe))
+			if esperado, obtido := trechoInfNFe(t, original), trechoInfNFe(t, escrito); !bytes.Equal(esperado, obtido) {
+				t.Fatalf("infNFe reescrito diverge do original:\n%s\n%s", esperado, obtido)
+			}
+			relido, err := ParseNFe(escrito)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(relido.InfNFe, nfe.InfNFe) {
+				t.Fatalf("infNFe relido diverge:\n%+v\n%+v", relido.InfNFe, nfe.InfNFe)
+			}
+
+			// Os totais do documento conferem com a soma dos itens
+			total := totalizar(nfe.InfNFe.Det)
+			lido := nfe.InfNFe.Total
+			total.ICMSTot.XMLName = lido.ICMSTot.XMLName
+			if total.ICMSTot != lido.ICMSTot {
+				t.Errorf("ICMSTot:\n%+v\nsoma dos itens:\n%+v", lido.ICMSTot, total.ICMSTot)
+			}
+			if (total.ISSQNtot == nil) != (lido.ISSQNtot == nil) {
+				t.Fatalf("ISSQNtot: %+v, soma dos itens: %+v", lido.ISSQNtot, total.ISSQNtot)
+			}
+			if total.ISSQNtot != nil {
+				total.ISSQNtot.DCompet = lido.ISSQNtot.DCompet
+				if *total.ISSQNtot != *lido.ISSQNtot {
+					t.Errorf("ISSQNtot:\n%+v\nsoma dos itens:\n%+v", *lido.ISSQNtot, *total.ISSQNtot)
+				}
+			}
+		})
+	}
+}
+
+func TestParseNFeGrupos(t *testing.T) {
+	ler := func(arquivo string) InfNFe {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join("testdata", arquivo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfe, err := ParseNFe(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nfe.InfNFe
+	}
+
+	compra := ler("nfe_compra_proc.xml")
+	if compra.Ide.DhSaiEnt != "2026-10-15T14:00:00-03:00" || len(compra.Ide.NFref) != 5 {
+		t.Fatalf("ide: %+v", compra.Ide)
+	}
+	refs := compra.Ide.NFref
+	if refs[0].RefNFe == "" || refs[1].RefNF == nil || refs[1].RefNF.Mod != "01" || refs[2].RefNFP == nil || refs[2].RefNFP.CPF != "12345678909" ||
+		refs[3].RefCTe == "" || refs[4].RefECF == nil || refs[4].RefECF.NCOO != "004512" {
+		t.Errorf("NFref: %+v", refs)
+	}
+	if compra.Retirada == nil || compra.Retirada.XNome != "DEPOSITO FORNECEDOR" || compra.Entrega == nil || compra.Entrega.IE != "9087654321" {
+		t.Errorf("retirada/entrega: %+v %+v", compra.Retirada, compra.Entrega)
+	}
+	med := compra.Det[0]
+	if med.Prod.CEST != "1300100" || med.Prod.CNPJFab != "60318797000100" || len(med.Prod.Rastro) != 2 || med.Prod.Rastro[1].QLote != 4 ||
+		med.Prod.Med == nil || med.Prod.Med.VPMC != 12.35 {
+		t.Errorf("prod do medicamento: %+v", med.Prod)
+	}
+	if g := med.Imposto.ICMS.Grupo; g.VICMSSTRet != 6.38 || g.VFCPSTRet != 1.7 || g.VICMSEfet != 14.92 {
+		t.Errorf("ICMS60: %+v", g)
+	}
+	if g := compra.Det[1].Imposto.ICMS.Grupo; g.VBCFCPST != 49 || g.PFCPST != 2 || g.VFCPST != 0.28 {
+		t.Errorf("FCP-ST do ICMS10: %+v", g)
+	}
+	if g := compra.Det[2].Imposto.ICMS.Grupo; compra.Det[2].Prod.CBenef != "PR830001" || g.VICMSOp != 294.5 || g.PDif != 33.33 || g.VICMSDif != 98.16 {
+		t.Errorf("diferimento do ICMS51: %+v", g)
+	}
+	if compra.Compra == nil || compra.Compra.XPed != "PC-778" {
+		t.Errorf("compra: %+v", compra.Compra)
+	}
+
+	importacao := ler("nfe_importacao.xml")
+	if importacao.Ide.DhCont == "" || importacao.Ide.XJust == "" {
+		t.Errorf("contingência: %+v", importacao.Ide)
+	}
+	prod := importacao.Det[0].Prod
+	if len(prod.DI) != 1 || prod.DI[0].VAFRMM != 150 || len(prod.DI[0].Adi) != 2 || prod.DI[0].Adi[1].VDescDI != 25 {
+		t.Errorf("DI: %+v", prod.DI)
+	}
+	if ii := importacao.Det[0].Imposto.II; ii == nil || ii.VII != 847 || ii.VDespAdu != 320 {
+		t.Errorf("II: %+v", ii)
+	}
+
+	conjugada := ler("nfe_conjugada.xml")
+	if difal := conjugada.Det[0].Imposto.ICMSUFDest; difal == nil || difal.VICMSUFDest != 150 || difal.PICMSInter != 12 {
+		t.Errorf("ICMSUFDest: %+v", difal)
+	}
+	if issqn := conjugada.Det[1].Imposto.ISSQN; issqn == nil || issqn.CListServ != "14.06" || issqn.VISSQN != 17.5 || conjugada.Det[1].Imposto.ICMS != nil {
+		t.Errorf("ISSQN: %+v", issqn)
+	}
+	if tot := conjugada.Total.ISSQNtot; tot == nil || tot.VServ != 350 || tot.DCompet != "2026-10-17" {
+		t.Errorf("ISSQNtot: %+v", tot)
+	}
+
+	exportacao := ler("nfe_exportacao.xml")
+	if exporta := exportacao.Exporta; exporta == nil || exporta.UFSaidaPais != "PR" || exporta.XLocDespacho != "EADI CURITIBA" {
+		t.Errorf("exporta: %+v", exporta)
+	}
+}
+
+// A árvore de MakeTagNFe também reproduz os documentos de outros emissores
+func TestMakeTagNFeLeiaute400(t *testing.T) {
+	for _, arquivo := range []string{"nfe_compra_proc.xml", "nfe_importacao.xml", "nfe_conjugada.xml", "nfe_exportacao.xml"} {
+		original, err := os.ReadFile(filepath.Join("testdata", arquivo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfe, err := ParseNFe(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arvore, err := GenerateCompactXML(arvoreNFeTeste(t, nfe.InfNFe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if esperado, obtido := trechoInfNFe(t, original), trechoInfNFe(t, []byte(arvore)); !bytes.Equal(esperado, obtido) {
+			t.Errorf("%s: MakeTagNFe diverge do original:\n%s\n%s", arquivo, esperado, obtido)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Código de Segurança do Contribuinte, gerado pelo emitente no portal da UF para o QR Code da NFC-e
+type CSC struct {
+	ID    string // Identificador do CSC (idCSC)
+	Token string // Código CSC
+}
+
+// Grupo de informações suplementares da NFC-e, entre o infNFe e a assinatura
+type InfNFeSupl struct {
+	XMLName  xml.Name `xml:"infNFeSupl"`
+	QrCode   string   `xml:"qrCode"`
+	UrlChave string   `xml:"urlChave"`
+}
+
+// Endereços de consulta da NFC-e de uma UF: o do QR Code e o da consulta pela chave (urlChave)
+type URLsNFCe struct {
+	QRCode string
+	Chave  string
+}
+
+// Endereços de consulta publicados pelas UFs no Portal da NFC-e, por ambiente. Quando
+// uma UF alterar o endereço, use Configuracoes.URLQRCode e URLChave até a atualização
+var URLsConsultaNFCe = map[string]struct{ Producao, Homologacao URLsNFCe }{
+	"AC": {
+		URLsNFCe{"http://www.sefaznet.ac.gov.br/nfce/qrcode", "www.sefaznet.ac.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.hml.sefaznet.ac.gov.br/nfce/qrcode", "www.sefaznet.ac.gov.br/nfce/consulta"},
+	},
+	"AL": {
+		URLsNFCe{"http://nfce.sefaz.al.gov.br/QRCode/consultarNFCe.jsp", "www.sefaz.al.gov.br/nfce/consulta"},
+		URLsNFCe{"http://nfce.sefaz.al.gov.br/QRCode/consultarNFCe.jsp", "www.sefaz.al.gov.br/nfce/consulta"},
+	},
+	"AM": {
+		URLsNFCe{"https://sistemas.sefaz.am.gov.br/nfceweb/consultarNFCe.jsp", "www.sefaz.am.gov.br/nfce/consulta"},
+		URLsNFCe{"https://sistemas.sefaz.am.gov.br/nfceweb-hom/consultarNFCe.jsp", "www.sefaz.am.gov.br/nfce/consulta"},
+	},
+	"AP": {
+		URLsNFCe{"https://www.sefaz.ap.gov.br/nfce/nfcep.php", "www.sefaz.ap.gov.br/nfce/consulta"},
+		URLsNFCe{"https://www.sefaz.ap.gov.br/nfcehml/nfce.php", "www.sefaz.ap.gov.br/nfce/consulta"},
+	},
+	"BA": {
+		URLsNFCe{"http://nfe.sefaz.ba.gov.br/servicos/nfce/modulos/geral/NFCEC_consulta_chave_acesso.aspx", "http://www.sefaz.ba.gov.br/nfce/consulta"},
+		URLsNFCe{"http://hnfe.sefaz.ba.gov.br/servicos/nfce/modulos/geral/NFCEC_consulta_chave_acesso.aspx", "http://hinternet.sefaz.ba.gov.br/nfce/consulta"},
+	},
+	"CE": {
+		URLsNFCe{"http://nfce.sefaz.ce.gov.br/pages/ShowNFCe.html", "www.sefaz.ce.gov.br/nfce/consulta"},
+		URLsNFCe{"http://nfceh.sefaz.ce.gov.br/pages/ShowNFCe.html", "www.sefaz.ce.gov.br/nfce/consulta"},
+	},
+	"DF": {
+		URLsNFCe{"http://www.fazenda.df.gov.br/nfce/qrcode", "www.fazenda.df.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.fazenda.df.gov.br/nfce/qrcode", "www.fazenda.df.gov.br/nfce/consulta"},
+	},
+	"ES": {
+		URLsNFCe{"http://app.sefaz.es.gov.br/ConsultaNFCe/qrcode.aspx", "www.sefaz.es.gov.br/nfce/consulta"},
+		URLsNFCe{"http://homologacao.sefaz.es.gov.br/ConsultaNFCe/qrcode.aspx", "www.sefaz.es.gov.br/nfce/consulta"},
+	},
+	"GO": {
+		URLsNFCe{"http://nfe.sefaz.go.gov.br/nfeweb/sites/nfce/danfeNFCe", "www.sefaz.go.gov.br/nfce/consulta"},
+		URLsNFCe{"http://homolog.sefaz.go.gov.br/nfeweb/sites/nfce/danfeNFCe", "www.sefaz.go.gov.br/nfce/consulta"},
+	},
+	"MA": {
+		URLsNFCe{"http://nfce.sefaz.ma.gov.br/portal/consultarNFCe.jsp", "www.sefaz.ma.gov.br/nfce/consulta"},
+		URLsNFCe{"http://homologacao.sefaz.ma.gov.br/portal/consultarNFCe.jsp", "www.sefaz.ma.gov.br/nfce/consulta"},
+	},
+	"MG": {
+		URLsNFCe{"https://portalsped.fazenda.mg.gov.br/portalnfce/sistema/qrcode.xhtml", "https://portalsped.fazenda.mg.gov.br/portalnfce"},
+		URLsNFCe{"https://portalsped.fazenda.mg.gov.br/portalnfce/sistema/qrcode.xhtml", "https://hportalsped.fazenda.mg.gov.br/portalnfce"},
+	},
+	"MS": {
+		URLsNFCe{"http://www.dfe.ms.gov.br/nfce/qrcode", "http://www.dfe.ms.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.dfe.ms.gov.br/nfce/qrcode", "http://www.dfe.ms.gov.br/nfce/consulta"},
+	},
+	"MT": {
+		URLsNFCe{"http://www.sefaz.mt.gov.br/nfce/consultanfce", "http://www.sefaz.mt.gov.br/nfce/consultanfce"},
+		URLsNFCe{"http://homologacao.sefaz.mt.gov.br/nfce/consultanfce", "http://homologacao.sefaz.mt.gov.br/nfce/consultanfce"},
+	},
+	"PA": {
+		URLsNFCe{"https://appnfc.sefa.pa.gov.br/portal/view/consultas/nfce/nfceForm.seam", "www.sefa.pa.gov.br/nfce/consulta"},
+		URLsNFCe{"https://appnfc.sefa.pa.gov.br/portal-homologacao/view/consultas/nfce/nfceForm.seam", "www.sefa.pa.gov.br/nfce/consulta"},
+	},
+	"PB": {
+		URLsNFCe{"http://www.sefaz.pb.gov.br/nfce", "www.sefaz.pb.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.sefaz.pb.gov.br/nfcehom", "www.sefaz.pb.gov.br/nfce/consulta"},
+	},
+	"PE": {
+		URLsNFCe{"http://nfce.sefaz.pe.gov.br/nfce/consulta", "nfce.sefaz.pe.gov.br/nfce/consulta"},
+		URLsNFCe{"http://nfcehomolog.sefaz.pe.gov.br/nfce/consulta", "nfce.sefaz.pe.gov.br/nfce/consulta"},
+	},
+	"PI": {
+		URLsNFCe{"http://www.sefaz.pi.gov.br/nfce/qrcode", "www.sefaz.pi.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.sefaz.pi.gov.br/nfce/qrcode", "www.sefaz.pi.gov.br/nfce/consulta"},
+	},
+	"PR": {
+		URLsNFCe{"http://www.fazenda.pr.gov.br/nfce/qrcode", "http://www.fazenda.pr.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.fazenda.pr.gov.br/nfce/qrcode", "http://www.fazenda.pr.gov.br/nfce/consulta"},
+	},
+	"RJ": {
+		URLsNFCe{"https://consultadfe.fazenda.rj.gov.br/consultaNFCe/QRCode", "www.fazenda.rj.gov.br/nfce/consulta"},
+		URLsNFCe{"https://consultadfe.fazenda.rj.gov.br/consultaNFCe/QRCode", "www.fazenda.rj.gov.br/nfce/consulta"},
+	},
+	"RN": {
+		URLsNFCe{"http://nfce.set.rn.gov.br/consultarNFCe.aspx", "www.set.rn.gov.br/nfce/consulta"},
+		URLsNFCe{"http://hom.nfce.set.rn.gov.br/consultarNFCe.aspx", "www.set.rn.gov.br/nfce/consulta"},
+	},
+	"RO": {
+		URLsNFCe{"http://www.nfce.sefin.ro.gov.br/consultanfce/consulta.jsp", "www.sefin.ro.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.nfce.sefin.ro.gov.br/consultanfce/consulta.jsp", "www.sefin.ro.gov.br/nfce/consulta"},
+	},
+	"RR": {
+		URLsNFCe{"https://www.sefaz.rr.gov.br/nfce/servlet/qrcode", "www.sefaz.rr.gov.br/nfce/consulta"},
+		URLsNFCe{"http://200.174.88.103:8080/nfce/servlet/qrcode", "www.sefaz.rr.gov.br/nfce/consulta"},
+	},
+	"RS": {
+		URLsNFCe{"https://www.sefaz.rs.gov.br/NFCE/NFCE-COM.aspx", "www.sefaz.rs.gov.br/nfce/consulta"},
+		URLsNFCe{"https://www.sefaz.rs.gov.br/NFCE/NFCE-COM.aspx", "www.sefaz.rs.gov.br/nfce/consulta"},
+	},
+	"SC": {
+		URLsNFCe{"https://sat.sef.sc.gov.br/nfce/consulta", "https://sat.sef.sc.gov.br/nfce/consulta"},
+		URLsNFCe{"https://hom.sat.sef.sc.gov.br/nfce/consulta", "https://hom.sat.sef.sc.gov.br/nfce/consulta"},
+	},
+	"SE": {
+		URLsNFCe{"http://www.nfce.se.gov.br/nfce/qrcode", "http://www.nfce.se.gov.br/nfce/consulta"},
+		URLsNFCe{"http://www.hom.nfe.se.gov.br/nfce/qrcode", "http://www.hom.nfe.se.gov.br/nfce/consulta"},
+	},
+	"SP": {
+		URLsNFCe{"https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx", "https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica"},
+		URLsNFCe{"https://www.homologacao.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx", "https://www.homologacao.nfce.fazenda.sp.gov.br/NFCeConsultaPublica"},
+	},
+	"TO": {
+		URLsNFCe{"http://www.sefaz.to.gov.br/nfce/qrcode", "www.sefaz.to.gov.br/nfce/consulta"},
+		URLsNFCe{"http://homologacao.sefaz.to.gov.br/nfce/qrcode", "www.sefaz.to.gov.br/nfce/consulta"},
+	},
+}
+
+// URLConsultaNFCe retorna os endereços de consulta da UF (sigla ou código IBGE) no ambiente (tpAmb)
+func URLConsultaNFCe(uf string, tpAmb string) (URLsNFCe, error) {
+	sigla := uf
+	if _, ok := URLsConsultaNFCe[sigla]; !ok {
+		sigla = SiglaUF(uf)
+	}
+	urls, ok := URLsConsultaNFCe[sigla]
+	if !ok {
+		return URLsNFCe{}, fmt.Errorf("endereço de consulta da NFC-e não cadastrado para a UF %q", uf)
+	}
+	if tpAmb == "1" {
+		return urls.Producao, nil
+	}
+	return urls.Homologacao, nil
+}
+
+// GerarQRCodeV2 monta o QR Code versão 2 (NT 2015.002). Na emissão normal os parâmetros
+// são chave, versão, tpAmb e idCSC; em contingência off-line (tpEmis 9) entram também o
+// dia da emissão, o vNF e o DigestValue da assinatura em hexadecimal. O hash é o SHA-1
+// dos parâmetros concatenados com o CSC
+func GerarQRCodeV2(urlQRCode string, infNFe InfNFe, digestValue string, csc CSC) (string, error) {
+	if csc.ID == "" || csc.Token == "" {
+		return "", fmt.Errorf("CSC não configurado")
+	}
+	// idCSC sem os zeros não significativos
+	idCSC, err := strconv.Atoi(csc.ID)
+	if err != nil {
+		return "", fmt.Errorf("idCSC inválido: %q", csc.ID)
+	}
+	chave := strings.TrimPrefix(infNFe.Id, "NFe")
+	parametros := []string{chave, "2", infNFe.Ide.TpAmb}
+	if infNFe.Ide.TpEmis == "9" {
+		dia, err := diaEmissao(infNFe.Ide)
+		if err != nil {
+			return "", err
+		}
+		if digestValue == "" {
+			return "", fmt.Errorf("o DigestValue da assinatura é obrigatório no QR Code de contingência")
+		}
+		parametros = append(parametros, dia, fmt.Sprintf("%.2f", infNFe.Total.ICMSTot.VNF),
+			strings.ToUpper(hex.EncodeToString([]byte(digestValue))))
+	}
+	parametros = append(parametros, strconv.Itoa(idCSC))
+	conteudo := strings.Join(parametros, "|")
+	hash := sha1.Sum([]byte(conteudo + csc.Token))
+	return fmt.Sprintf("%s?p=%s|%s", urlQRCode, conteudo, strings.ToUpper(hex.EncodeToString(hash[:]))), nil
+}
+
+// GerarQRCodeV3 monta o QR Code versão 3, que dispensa o CSC. Na emissão normal leva só
+// chave, versão e tpAmb; em contingência off-line acrescenta o dia da emissão, o vNF, a
+// identificação do destinatário e a assinatura dos parâmetros com o certificado do
+// emitente, feita por assinar (RSA-SHA1, retornada em Base64)
+func GerarQRCodeV3(urlQRCode string, infNFe InfNFe, assinar func(conteudo []byte) (string, error)) (string, error) {
+	chave := strings.TrimPrefix(infNFe.Id, "NFe")
+	conteudo := strings.Join([]string{chave, "3", infNFe.Ide.TpAmb}, "|")
+	if infNFe.Ide.TpEmis != "9" {
+		return fmt.Sprintf("%s?p=%s", urlQRCode, conteudo), nil
+	}
+	dia, err := diaEmissao(infNFe.Ide)
+	if err != nil {
+		return "", err
+	}
+	// Tipo do documento do destinatário: 1 CNPJ, 2 CPF, 3 identificação do estrangeiro
+	var tpIdDest, idDest string
+	switch dest := infNFe.Dest; {
+	case dest.CNPJ != "":
+		tpIdDest, idDest = "1", dest.CNPJ
+	case dest.CPF != "":
+		tpIdDest, idDest = "2", dest.CPF
+	case dest.IdEstrangeiro != "":
+		tpIdDest, idDest = "3", dest.IdEstrangeiro
+	}
+	conteudo = strings.Join([]string{conteudo, dia, fmt.Sprintf("%.2f", infNFe.Total.ICMSTot.VNF), tpIdDest, idDest}, "|")
+	assinatura, err := assinar([]byte(conteudo))
+	if err != nil {
+		return "", fmt.Errorf("erro ao assinar o QR Code: %v", err)
+	}
+	return fmt.Sprintf("%s?p=%s|%s", urlQRCode, conteudo, assinatura), nil
+}
+
+// Dia (DD) da data de emissão, usado no QR Code de contingência
+func diaEmissao(ide Ide) (string, error) {
+	dhEmi, err := ParseDataHora(ide.DhEmi)
+	if err != nil {
+		return "", fmt.Errorf("data de emissão inválida: %v", err)
+	}
+	return dhEmi.Format("02"), nil
+}
+
+// EscreverInfNFeSupl gera o grupo infNFeSupl, com o QR Code em CDATA como nos exemplos da SEFAZ
+func EscreverInfNFeSupl(supl InfNFeSupl) []byte {
+	e := &bytes.Buffer{}
+	e.WriteString("<infNFeSupl><qrCode><![CDATA[")
+	e.WriteString(supl.QrCode)
+	e.WriteString("]]></qrCode><urlChave>")
+	xml.EscapeText(e, []byte(supl.UrlChave))
+	e.WriteString("</urlChave></infNFeSupl>")
+	return e.Bytes()
+}
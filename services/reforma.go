@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// Alíquotas de IBS e CBS (em percentual) usadas no cálculo do grupo gIBSCBS
+type AliquotasIBSCBS struct {
+	PIBSUF  float64
+	PIBSMun float64
+	PCBS    float64
+}
+
+// Alíquotas de teste do ano de 2026 (LC 214/2025, art. 343): CBS 0,9% e IBS estadual 0,1%
+var AliquotasTeste2026 = AliquotasIBSCBS{
+	PIBSUF:  0.10,
+	PIBSMun: 0.00,
+	PCBS:    0.90,
+}
+
+// CalcularIBSCBS gera o grupo IBSCBS do item aplicando as alíquotas sobre a base de cálculo
+func CalcularIBSCBS(cst string, cClassTrib string, vBC float64, aliquotas AliquotasIBSCBS) (IBSCBS, error) {
+	if len(cst) != 3 {
+		return IBSCBS{}, fmt.Errorf("CST do IBS/CBS deve ter 3 dígitos")
+	}
+	if len(cClassTrib) != 6 {
+		return IBSCBS{}, fmt.Errorf("cClassTrib deve ter 6 dígitos")
+	}
+	if vBC < 0 {
+		return IBSCBS{}, fmt.Errorf("base de cálculo do IBS/CBS não pode ser negativa")
+	}
+	vIBSUF := arredondar(vBC * aliquotas.PIBSUF / 100)
+	vIBSMun := arredondar(vBC * aliquotas.PIBSMun / 100)
+	return IBSCBS{
+		CST:        cst,
+		CClassTrib: cClassTrib,
+		GIBSCBS: &GIBSCBS{
+			VBC:     arredondar(vBC),
+			GIBSUF:  GIBSUF{PIBSUF: aliquotas.PIBSUF, VIBSUF: vIBSUF},
+			GIBSMun: GIBSMun{PIBSMun: aliquotas.PIBSMun, VIBSMun: vIBSMun},
+			VIBS:    arredondar(vIBSUF + vIBSMun),
+			GCBS:    GCBS{PCBS: aliquotas.PCBS, VCBS: arredondar(vBC * aliquotas.PCBS / 100)},
+		},
+	}, nil
+}
+
+// CalcularIBSCBSTeste2026 calcula o IBS/CBS do item com as alíquotas de teste de 2026
+func CalcularIBSCBSTeste2026(cst string, cClassTrib string, vBC float64) (IBSCBS, error) {
+	return CalcularIBSCBS(cst, cClassTrib, vBC, AliquotasTeste2026)
+}
+
+// TotalizarIBSCBS soma os grupos IS e IBSCBS dos itens para os totais ISTot e IBSCBSTot
+func TotalizarIBSCBS(dets []Det) (*ISTot, *IBSCBSTot) {
+	var isTot *ISTot
+	var ibscbsTot *IBSCBSTot
+	for _, det := range dets {
+		if det.Imposto == nil {
+			continue
+		}
+		if det.Imposto.IS != nil {
+			if isTot == nil {
+				isTot = &ISTot{}
+			}
+			isTot.VIS += det.Imposto.IS.VIS
+		}
+		if det.Imposto.IBSCBS != nil && det.Imposto.IBSCBS.GIBSCBS != nil {
+			if ibscbsTot == nil {
+				ibscbsTot = &IBSCBSTot{}
+			}
+			g := det.Imposto.IBSCBS.GIBSCBS
+			ibscbsTot.VBCIBSCBS += g.VBC
+			ibscbsTot.GIBS.GIBSUF.VIBSUF += g.GIBSUF.VIBSUF
+			ibscbsTot.GIBS.GIBSMun.VIBSMun += g.GIBSMun.VIBSMun
+			ibscbsTot.GIBS.VIBS += g.VIBS
+			ibscbsTot.GCBS.VCBS += g.GCBS.VCBS
+		}
+	}
+	if isTot != nil {
+		isTot.VIS = arredondar(isTot.VIS)
+	}
+	if ibscbsTot != nil {
+		ibscbsTot.VBCIBSCBS = arredondar(ibscbsTot.VBCIBSCBS)
+		ibscbsTot.GIBS.GIBSUF.VIBSUF = arredondar(ibscbsTot.GIBS.GIBSUF.VIBSUF)
+		ibscbsTot.GIBS.GIBSMun.VIBSMun = arredondar(ibscbsTot.GIBS.GIBSMun.VIBSMun)
+		ibscbsTot.GIBS.VIBS = arredondar(ibscbsTot.GIBS.VIBS)
+		ibscbsTot.GCBS.VCBS = arredondar(ibscbsTot.GCBS.VCBS)
+	}
+	return isTot, ibscbsTot
+}
+
+// Arredonda valores monetários para 2 casas decimais
+func arredondar(valor float64) float64 {
+	return math.Round(valor*100) / 100
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalcularIBSCBSTeste2026(t *testing.T) {
+	casos := []struct {
+		nome                   string
+		vBC                    float64
+		vBCGrupo, vIBSUF, vCBS float64
+	}{
+		{"alíquotas de 2026", 1000, 1000, 1, 9},
+		{"base com centavos", 1234.56, 1234.56, 1.23, 11.11},
+		{"arredondamento para cima", 33.35, 33.35, 0.03, 0.30},
+		{"valores abaixo do centavo", 0.55, 0.55, 0, 0},
+		{"base com mais de 2 casas", 99.999, 100, 0.10, 0.90},
+		{"base zero", 0, 0, 0, 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			ibscbs, err := CalcularIBSCBSTeste2026("000", "000001", c.vBC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := ibscbs.GIBSCBS
+			if ibscbs.CST != "000" || ibscbs.CClassTrib != "000001" || g == nil {
+				t.Fatalf("grupo IBSCBS: %+v", ibscbs)
+			}
+			if g.GIBSUF.PIBSUF != 0.1 || g.GIBSMun.PIBSMun != 0 || g.GCBS.PCBS != 0.9 {
+				t.Fatalf("alíquotas pIBSUF %v, pIBSMun %v, pCBS %v", g.GIBSUF.PIBSUF, g.GIBSMun.PIBSMun, g.GCBS.PCBS)
+			}
+			if g.VBC != c.vBCGrupo || g.GIBSUF.VIBSUF != c.vIBSUF || g.GIBSMun.VIBSMun != 0 || g.VIBS != c.vIBSUF || g.GCBS.VCBS != c.vCBS {
+				t.Fatalf("vBC %v, vIBSUF %v, vIBSMun %v, vIBS %v, vCBS %v; esperado vBC %v, vIBS %v, vCBS %v",
+					g.VBC, g.GIBSUF.VIBSUF, g.GIBSMun.VIBSMun, g.VIBS, g.GCBS.VCBS, c.vBCGrupo, c.vIBSUF, c.vCBS)
+			}
+		})
+	}
+}
+
+func TestCalcularIBSCBS(t *testing.T) {
+	// vIBS soma as parcelas já arredondadas da UF e do município
+	ibscbs, err := CalcularIBSCBS("000", "000001", 100.5, AliquotasIBSCBS{PIBSUF: 0.1, PIBSMun: 0.05, PCBS: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := ibscbs.GIBSCBS
+	if g.GIBSUF.VIBSUF != 0.10 || g.GIBSMun.VIBSMun != 0.05 || g.VIBS != 0.15 || g.GCBS.VCBS != 0.90 {
+		t.Fatalf("vIBSUF %v, vIBSMun %v, vIBS %v, vCBS %v", g.GIBSUF.VIBSUF, g.GIBSMun.VIBSMun, g.VIBS, g.GCBS.VCBS)
+	}
+
+	for _, c := range []struct {
+		cst, cClassTrib string
+		vBC             float64
+		erro            string
+	}{
+		{"00", "000001", 100, "CST"},
+		{"000", "00001", 100, "cClassTrib"},
+		{"000", "000001", -1, "negativa"},
+	} {
+		if _, err := CalcularIBSCBSTeste2026(c.cst, c.cClassTrib, c.vBC); err == nil || !strings.Contains(err.Error(), c.erro) {
+			t.Errorf("CalcularIBSCBS(%q, %q, %v): erro = %v, esperado contendo %q", c.cst, c.cClassTrib, c.vBC, err, c.erro)
+		}
+	}
+}
+
+func itemIBSCBSTeste(t *testing.T, vProd float64) Det {
+	t.Helper()
+	ibscbs, err := CalcularIBSCBSTeste2026("000", "000001", vProd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return itemTeste(vProd, &Imposto{IBSCBS: &ibscbs})
+}
+
+func TestTotalizarIBSCBS(t *testing.T) {
+	if isTot, ibscbsTot := TotalizarIBSCBS([]Det{itemTeste(10, nil), itemTeste(10, &Imposto{})}); isTot != nil || ibscbsTot != nil {
+		t.Fatalf("totais sem itens da reforma: %+v, %+v", isTot, ibscbsTot)
+	}
+
+	// O total é a soma dos valores já arredondados de cada item: três itens de 0,55 somam
+	// vCBS 0,00, e não 0,01 como o cálculo sobre a base total de 1,65
+	det := []Det{
+		itemIBSCBSTeste(t, 0.55), itemIBSCBSTeste(t, 0.55), itemIBSCBSTeste(t, 0.55),
+		itemIBSCBSTeste(t, 1234.56), itemIBSCBSTeste(t, 33.35),
+		itemTeste(50, nil),
+		itemTeste(20, &Imposto{IS: &IS{CSTIS: "000", CClassTribIS: "000001", VBCIS: 20, PIS: 10, VIS: 2}}),
+	}
+	isTot, ibscbsTot := TotalizarIBSCBS(det)
+	if isTot == nil || isTot.VIS != 2 {
+		t.Fatalf("ISTot = %+v", isTot)
+	}
+	if ibscbsTot == nil {
+		t.Fatal("IBSCBSTot não gerado")
+	}
+	if ibscbsTot.VBCIBSCBS != 1269.56 || ibscbsTot.GIBS.GIBSUF.VIBSUF != 1.26 || ibscbsTot.GIBS.GIBSMun.VIBSMun != 0 ||
+		ibscbsTot.GIBS.VIBS != 1.26 || ibscbsTot.GCBS.VCBS != 11.41 {
+		t.Fatalf("IBSCBSTot = %+v", *ibscbsTot)
+	}
+}
+
+func TestBuildIBSCBSTot(t *testing.T) {
+	b := builderTeste()
+	b.det = nil
+	montada, err := b.Det(itemIBSCBSTeste(t, 1234.56), itemIBSCBSTeste(t, 33.35)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tot := montada.InfNFe.Total.IBSCBSTot
+	if tot == nil || tot.VBCIBSCBS != 1267.91 || tot.GIBS.VIBS != 1.26 || tot.GCBS.VCBS != 11.41 {
+		t.Fatalf("Total.IBSCBSTot = %+v", tot)
+	}
+	if montada.InfNFe.Total.ISTot != nil {
+		t.Fatalf("ISTot sem itens com IS: %+v", montada.InfNFe.Total.ISTot)
+	}
+	trecho := "<IBSCBSTot><vBCIBSCBS>1267.91</vBCIBSCBS><gIBS><gIBSUF><vDif>0.00</vDif><vDevTrib>0.00</vDevTrib><vIBSUF>1.26</vIBSUF></gIBSUF>" +
+		"<gIBSMun><vDif>0.00</vDif><vDevTrib>0.00</vDevTrib><vIBSMun>0.00</vIBSMun></gIBSMun><vIBS>1.26</vIBS>" +
+		"<vCredPres>0.00</vCredPres><vCredPresCondSus>0.00</vCredPresCondSus></gIBS><gCBS><vDif>0.00</vDif><vDevTrib>0.00</vDevTrib>" +
+		"<vCBS>11.41</vCBS><vCredPres>0.00</vCredPres><vCredPresCondSus>0.00</vCredPresCondSus></gCBS></IBSCBSTot>"
+	if !strings.Contains(montada.XML, trecho) {
+		t.Fatalf("XML sem o IBSCBSTot esperado:\n%s", montada.XML)
+	}
+}
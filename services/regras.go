@@ -0,0 +1,296 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Violação de uma regra de validação do Manual de Orientação do Contribuinte,
+// com o código de rejeição (cStat) que a SEFAZ retornaria
+type Violacao struct {
+	CStat   int
+	Motivo  string
+	Detalhe string
+}
+
+func (v Violacao) Error() string {
+	if v.Detalhe == "" {
+		return fmt.Sprintf("%d - %s", v.CStat, v.Motivo)
+	}
+	return fmt.Sprintf("%d - %s (%s)", v.CStat, v.Motivo, v.Detalhe)
+}
+
+// Violacoes reúne todas as regras violadas por uma NFe
+type Violacoes []Violacao
+
+func (v Violacoes) Error() string {
+	mensagens := make([]string, len(v))
+	for i, violacao := range v {
+		mensagens[i] = violacao.Error()
+	}
+	return strings.Join(mensagens, "; ")
+}
+
+// Dados do ambiente de recebimento usados pelas regras
+type ContextoValidacao struct {
+	Agora          time.Time // Horário de recebimento considerado
+	TpAmb          string    // Ambiente do serviço (1 produção, 2 homologação)
+	CUF            string    // Código da UF autorizadora
+	ChavesEmitidas []string  // Chaves já autorizadas, para detectar duplicidade
+}
+
+// Regra de validação sobre o infNFe
+type Regra func(infNFe InfNFe, ctx ContextoValidacao) []Violacao
+
+// Regras do MOC verificadas localmente antes do envio
+var RegrasMOC = []Regra{
+	regraAmbiente,
+	regraUFAutorizadora,
+	regraChaveAcesso,
+	regraNFRef,
+	regraFinalidade,
+	regraDuplicidade,
+	regraDocumentos,
+	regraModelo,
+	regraDataEmissao,
+	regraValorItem,
+	regraTotalProdutos,
+	regraTotalNF,
+}
+
+// ValidarRegras executa as regras do MOC e retorna Violacoes quando alguma falhar
+func ValidarRegras(infNFe InfNFe, ctx ContextoValidacao) error {
+	if ctx.Agora.IsZero() {
+		ctx.Agora = time.Now()
+	}
+	var violacoes Violacoes
+	for _, regra := range RegrasMOC {
+		violacoes = append(violacoes, regra(infNFe, ctx)...)
+	}
+	if len(violacoes) > 0 {
+		return violacoes
+	}
+	return nil
+}
+
+func regraAmbiente(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	if ctx.TpAmb != "" && infNFe.Ide.TpAmb != ctx.TpAmb {
+		return []Violacao{{CStat: 252, Motivo: "Rejeição: Ambiente informado diverge do Ambiente de recebimento",
+			Detalhe: fmt.Sprintf("tpAmb %s", infNFe.Ide.TpAmb)}}
+	}
+	return nil
+}
+
+func regraUFAutorizadora(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	if ctx.CUF != "" && infNFe.Ide.CUF != ctx.CUF {
+		return []Violacao{{CStat: 226, Motivo: "Rejeição: Código da UF do Emitente diverge da UF autorizadora",
+			Detalhe: fmt.Sprintf("cUF %s", infNFe.Ide.CUF)}}
+	}
+	return nil
+}
+
+func regraChaveAcesso(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	chave := strings.TrimPrefix(infNFe.Id, "NFe")
+	if len(chave) != 44 {
+		return []Violacao{{CStat: 502, Motivo: "Rejeição: Erro na Chave de Acesso - Campo Id não corresponde à concatenação dos campos correspondentes",
+			Detalhe: "chave com tamanho diferente de 44"}}
+	}
+	c, err := separarChave(chave)
+	if err != nil {
+		return []Violacao{{CStat: 502, Motivo: "Rejeição: Erro na Chave de Acesso - Campo Id não corresponde à concatenação dos campos correspondentes",
+			Detalhe: err.Error()}}
+	}
+	var violacoes []Violacao
+	dv, err := calcularDV(chave[:43])
+	if err != nil || c.CDV != fmt.Sprint(dv) || infNFe.Ide.CDV != c.CDV {
+		violacoes = append(violacoes, Violacao{CStat: 253, Motivo: "Rejeição: Digito Verificador da chave de acesso composta inválida"})
+	}
+	// O cDV já foi conferido acima (253)
+	ide := infNFe.Ide
+	ide.CDV = ""
+	if divergencias := divergenciasChave(c, ide, infNFe.Emit); len(divergencias) > 0 {
+		violacoes = append(violacoes, Violacao{CStat: 502, Motivo: "Rejeição: Erro na Chave de Acesso - Campo Id não corresponde à concatenação dos campos correspondentes",
+			Detalhe: strings.Join(divergencias, ", ")})
+	}
+	return violacoes
+}
+
+// As chaves das NF-e referenciadas devem ser válidas
+func regraNFRef(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	var violacoes []Violacao
+	for _, ref := range infNFe.Ide.NFref {
+		if ref.RefNFe == "" {
+			continue
+		}
+		if _, err := ParseChaveAcesso(ref.RefNFe); err != nil {
+			violacoes = append(violacoes, Violacao{CStat: 547, Motivo: "Rejeição: Dígito Verificador da Chave de Acesso da NF-e Referenciada inválido",
+				Detalhe: err.Error()})
+		}
+	}
+	return violacoes
+}
+
+// Mesma UF, emitente, modelo, série e número com chave diferente (cNF ou data distintos)
+func regraDuplicidade(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	chave := strings.TrimPrefix(infNFe.Id, "NFe")
+	if len(chave) != 44 {
+		return nil
+	}
+	for _, emitida := range ctx.ChavesEmitidas {
+		if len(emitida) != 44 || emitida == chave {
+			continue
+		}
+		// cUF (0:2), CNPJ, modelo, série e número (6:34)
+		if emitida[0:2] == chave[0:2] && emitida[6:34] == chave[6:34] {
+			return []Violacao{{CStat: 539, Motivo: "Rejeição: Duplicidade de NF-e com diferença na Chave de Acesso",
+				Detalhe: fmt.Sprintf("chave emitida %s", emitida)}}
+		}
+	}
+	return nil
+}
+
+func regraDocumentos(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	var violacoes []Violacao
+	if infNFe.Emit.CNPJ != "" && !ValidarCNPJ(infNFe.Emit.CNPJ) {
+		violacoes = append(violacoes, Violacao{CStat: 207, Motivo: "Rejeição: CNPJ do emitente inválido"})
+	}
+	if infNFe.Dest.CNPJ != "" && !ValidarCNPJ(infNFe.Dest.CNPJ) {
+		violacoes = append(violacoes, Violacao{CStat: 208, Motivo: "Rejeição: CNPJ do destinatário inválido"})
+	}
+	if infNFe.Dest.CPF != "" && !ValidarCPF(infNFe.Dest.CPF) {
+		violacoes = append(violacoes, Violacao{CStat: 237, Motivo: "Rejeição: CPF do destinatário inválido"})
+	}
+	if t := infNFe.Transp; t != nil && t.Transporta.CNPJ != "" && !ValidarCNPJ(t.Transporta.CNPJ) {
+		violacoes = append(violacoes, Violacao{CStat: 542, Motivo: "Rejeição: CNPJ do Transportador inválido"})
+	}
+	for _, autXML := range infNFe.AutXML {
+		if autXML.CNPJ != "" && !ValidarCNPJ(autXML.CNPJ) {
+			violacoes = append(violacoes, Violacao{CStat: 325, Motivo: "Rejeição: CNPJ autorizado para download inválido",
+				Detalhe: autXML.CNPJ})
+		}
+	}
+	return violacoes
+}
+
+// A SEFAZ tolera 5 minutos de diferença no futuro e 30 dias de atraso na emissão
+func regraDataEmissao(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	dhEmi, err := ParseDataHora(infNFe.Ide.DhEmi)
+	if err != nil {
+		return []Violacao{{CStat: 225, Motivo: "Rejeição: Falha no Schema XML da NFe", Detalhe: "dhEmi inválido"}}
+	}
+	if dhEmi.After(ctx.Agora.Add(5 * time.Minute)) {
+		return []Violacao{{CStat: 703, Motivo: "Rejeição: Data-Hora de Emissão posterior ao horário de recebimento",
+			Detalhe: infNFe.Ide.DhEmi}}
+	}
+	if dhEmi.Before(ctx.Agora.AddDate(0, 0, -30)) {
+		return []Violacao{{CStat: 228, Motivo: "Rejeição: Data de Emissão muito atrasada", Detalhe: infNFe.Ide.DhEmi}}
+	}
+	return nil
+}
+
+func regraValorItem(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	var violacoes []Violacao
+	for _, det := range infNFe.Det {
+		esperado := det.Prod.QCom * det.Prod.VUnCom
+		if math.Abs(esperado-det.Prod.VProd) > 0.01 {
+			violacoes = append(violacoes, Violacao{CStat: 629, Motivo: "Rejeição: Valor do Produto difere do produto Valor Unitário de Comercialização e Quantidade Comercial",
+				Detalhe: fmt.Sprintf("item %s", det.NItem)})
+		}
+	}
+	return violacoes
+}
+
+func regraTotalProdutos(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	soma := 0.0
+	for _, det := range infNFe.Det {
+		// Os itens de serviço (ISSQN) são somados no vServ do ISSQNtot
+		if det.Prod.IndTot == "1" && (det.Imposto == nil || det.Imposto.ISSQN == nil) {
+			soma += det.Prod.VProd
+		}
+	}
+	if math.Abs(arredondar(soma)-infNFe.Total.ICMSTot.VProd) > 0.001 {
+		return []Violacao{{CStat: 564, Motivo: "Rejeição: Total do Produto / Serviço difere do somatório dos itens",
+			Detalhe: fmt.Sprintf("vProd %.2f, soma dos itens %.2f", infNFe.Total.ICMSTot.VProd, soma)}}
+	}
+	return nil
+}
+
+func regraTotalNF(infNFe InfNFe, ctx ContextoValidacao) []Violacao {
+	t := infNFe.Total.ICMSTot
+	esperado := t.VProd - t.VDesc - t.VICMSDeson + t.VST + t.VFCPST + t.VFrete + t.VSeg + t.VOutro + t.VII + t.VIPI + t.VIPIDevol
+	if infNFe.Total.ISSQNtot != nil {
+		esperado += infNFe.Total.ISSQNtot.VServ
+	}
+	if math.Abs(arredondar(esperado)-t.VNF) > 0.001 {
+		return []Violacao{{CStat: 610, Motivo: "Rejeição: Total da NF difere do somatório dos Valores compõe o valor Total da NF",
+			Detalhe: fmt.Sprintf("vNF %.2f, somatório %.2f", t.VNF, esperado)}}
+	}
+	return nil
+}
+
+// ValidarCNPJ verifica os dígitos verificadores do CNPJ numérico ou alfanumérico.
+// No alfanumérico, as 12 primeiras posições aceitam letras maiúsculas e cada caractere
+// vale o seu código ASCII menos 48; os dígitos verificadores continuam numéricos
+func ValidarCNPJ(cnpj string) bool {
+	if len(cnpj) != 14 || strings.Count(cnpj, cnpj[:1]) == 14 {
+		return false
+	}
+	for i, r := range cnpj {
+		if _, ok := valorCaractere(r); !ok || (i >= 12 && (r < '0' || r > '9')) {
+			return false
+		}
+	}
+	pesos := []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	for _, n := range []int{12, 13} {
+		soma := 0
+		for i := 0; i < n; i++ {
+			valor, _ := valorCaractere(rune(cnpj[i]))
+			soma += valor * pesos[len(pesos)-n+i]
+		}
+		dv := 11 - soma%11
+		if dv >= 10 {
+			dv = 0
+		}
+		if int(cnpj[n]-'0') != dv {
+			return false
+		}
+	}
+	return true
+}
+
+// Valor de um caractere no cálculo dos dígitos verificadores do CNPJ alfanumérico
+// e da chave de acesso: código ASCII menos 48, para dígitos e letras maiúsculas
+func valorCaractere(r rune) (int, bool) {
+	if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') {
+		return int(r) - 48, true
+	}
+	return 0, false
+}
+
+// ValidarCPF verifica os dígitos verificadores do CPF
+func ValidarCPF(cpf string) bool {
+	if len(cpf) != 11 || strings.Count(cpf, cpf[:1]) == 11 {
+		return false
+	}
+	for _, r := range cpf {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	for _, n := range []int{9, 10} {
+		soma := 0
+		for i := 0; i < n; i++ {
+			soma += int(cpf[i]-'0') * (n + 1 - i)
+		}
+		dv := 11 - soma%11
+		if dv >= 10 {
+			dv = 0
+		}
+		if int(cpf[n]-'0') != dv {
+			return false
+		}
+	}
+	return true
+}
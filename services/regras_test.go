@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidarCNPJ(t *testing.T) {
+	casos := []struct {
+		nome, cnpj string
+		valido     bool
+	}{
+		{"numérico", "11222333000181", true},
+		{"alfanumérico da Receita Federal", "12ABC34501DE35", true},
+		{"alfanumérico, matriz", "12ABC345000188", true},
+		{"alfanumérico com DV errado", "12ABC34501DE36", false},
+		{"letras minúsculas", "12abc34501de35", false},
+		{"letra no DV", "12ABC34501DE3A", false},
+		{"caractere especial", "12ABC345.1DE35", false},
+		{"numérico com DV errado", "11222333000182", false},
+		{"repetido", "00000000000000", false},
+		{"curto", "1222333000181", false},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if ValidarCNPJ(c.cnpj) != c.valido {
+				t.Fatalf("ValidarCNPJ(%q) = %v", c.cnpj, !c.valido)
+			}
+		})
+	}
+}
+
+func TestValidarCPF(t *testing.T) {
+	casos := map[string]bool{
+		"52998224725": true,
+		"52998224724": false,
+		"11111111111": false,
+		"5299822472A": false,
+		"5299822472":  false,
+	}
+	for cpf, valido := range casos {
+		if ValidarCPF(cpf) != valido {
+			t.Errorf("ValidarCPF(%q) = %v", cpf, !valido)
+		}
+	}
+}
+
+// NF-e válida perante todas as RegrasMOC, recebida às 10:05 de Brasília
+func notaRegrasTeste(t *testing.T) (InfNFe, ContextoValidacao) {
+	t.Helper()
+	ide := Ide{CUF: "41", DhEmi: "2026-10-19T10:00:00-03:00", Mod: ModeloNFe, Serie: "1", NNF: "123", TpEmis: "1",
+		CNF: "52839174", TpAmb: "2", FinNFe: "1", TpImp: TpImpRetrato}
+	emit := Emit{CNPJ: "11222333000181"}
+	chave, err := GerarChaveAcesso(ide, emit, ide.NNF, ide.TpEmis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ide.CDV = chave[43:]
+	infNFe := InfNFe{
+		Id:   "NFe" + chave,
+		Ide:  ide,
+		Emit: emit,
+		Dest: Dest{CNPJ: "12ABC34501DE35"},
+		Det: []Det{
+			{NItem: "1", Prod: Prod{QCom: 2, VUnCom: 10.5, VProd: 21, IndTot: "1"}},
+			{NItem: "2", Prod: Prod{QCom: 3, VUnCom: 3.3333, VProd: 10, IndTot: "1"}},
+		},
+	}
+	infNFe.Total.ICMSTot.VProd = 31
+	infNFe.Total.ICMSTot.VFrete = 5
+	infNFe.Total.ICMSTot.VDesc = 1
+	infNFe.Total.ICMSTot.VNF = 35
+	ctx := ContextoValidacao{Agora: time.Date(2026, 10, 19, 13, 5, 0, 0, time.UTC), TpAmb: "2", CUF: "41"}
+	return infNFe, ctx
+}
+
+func TestRegrasMOC(t *testing.T) {
+	const outraChave = "41240706101244000490550010000067271091023595"
+	casos := []struct {
+		nome    string
+		regra   Regra
+		alterar func(*InfNFe, *ContextoValidacao)
+		cStats  []int
+	}{
+		{"252 mesmo ambiente", regraAmbiente, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"252 produção no serviço de homologação", regraAmbiente, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.TpAmb = "1" }, []int{252}},
+
+		{"226 UF autorizadora", regraUFAutorizadora, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"226 nota de outra UF", regraUFAutorizadora, func(_ *InfNFe, c *ContextoValidacao) { c.CUF = "35" }, []int{226}},
+
+		{"502/253 chave correta", regraChaveAcesso, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"253 DV da chave", regraChaveAcesso, func(i *InfNFe, _ *ContextoValidacao) {
+			dv := (i.Id[len(i.Id)-1]-'0'+1)%10 + '0'
+			i.Id = i.Id[:len(i.Id)-1] + string(dv)
+			i.Ide.CDV = string(dv)
+		}, []int{253}},
+		{"253 cDV diferente do DV da chave", regraChaveAcesso, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.CDV = "X" }, []int{253}},
+		{"502 nNF diferente da chave", regraChaveAcesso, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.NNF = "124" }, []int{502}},
+		{"502 tamanho da chave", regraChaveAcesso, func(i *InfNFe, _ *ContextoValidacao) { i.Id = i.Id[:46] }, []int{502}},
+
+		{"547 NF-e referenciada válida", regraNFRef, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.NFref = []NFref{{RefNFe: outraChave}} }, nil},
+		{"547 DV da NF-e referenciada", regraNFRef, func(i *InfNFe, _ *ContextoValidacao) {
+			i.Ide.NFref = []NFref{{RefNFe: outraChave[:43] + "4"}}
+		}, []int{547}},
+
+		{"225 nota normal", regraFinalidade, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"225 nota de débito sem a NFe original", regraFinalidade, func(i *InfNFe, _ *ContextoValidacao) {
+			i.Ide.FinNFe, i.Ide.TpNFDebito = FinNFeDebito, "04"
+		}, []int{225}},
+		{"225 nota de débito", regraFinalidade, func(i *InfNFe, _ *ContextoValidacao) {
+			i.Ide.FinNFe, i.Ide.TpNFDebito, i.Ide.NFref = FinNFeDebito, "04", []NFref{{RefNFe: outraChave}}
+		}, nil},
+
+		{"539 outra nota da série", regraDuplicidade, func(i *InfNFe, c *ContextoValidacao) {
+			c.ChavesEmitidas = []string{strings.TrimPrefix(i.Id, "NFe"), outraChave}
+		}, nil},
+		{"539 mesmo número com outro cNF", regraDuplicidade, func(i *InfNFe, c *ContextoValidacao) {
+			chave := strings.TrimPrefix(i.Id, "NFe")
+			c.ChavesEmitidas = []string{chave[:35] + "00000001" + chave[43:]}
+		}, []int{539}},
+
+		{"629 vProd dos itens", regraValorItem, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"629 vProd diferente de qCom × vUnCom", regraValorItem, func(i *InfNFe, _ *ContextoValidacao) { i.Det[0].Prod.VProd = 21.02 }, []int{629}},
+
+		{"564 soma dos itens", regraTotalProdutos, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"564 item fora do total", regraTotalProdutos, func(i *InfNFe, _ *ContextoValidacao) { i.Det[1].Prod.IndTot = "0" }, []int{564}},
+
+		{"610 total da nota", regraTotalNF, func(*InfNFe, *ContextoValidacao) {}, nil},
+		{"610 total sem o frete", regraTotalNF, func(i *InfNFe, _ *ContextoValidacao) { i.Total.ICMSTot.VNF = 30 }, []int{610}},
+
+		{"703/228 dentro da tolerância", regraDataEmissao, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.DhEmi = "2026-10-19T10:09:59-03:00" }, nil},
+		{"703 emissão no futuro", regraDataEmissao, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.DhEmi = "2026-10-19T10:10:01-03:00" }, []int{703}},
+		{"228 emissão há 30 dias", regraDataEmissao, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.DhEmi = "2026-09-19T10:06:00-03:00" }, nil},
+		{"228 emissão muito atrasada", regraDataEmissao, func(i *InfNFe, _ *ContextoValidacao) { i.Ide.DhEmi = "2026-09-19T10:04:00-03:00" }, []int{228}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			infNFe, ctx := notaRegrasTeste(t)
+			c.alterar(&infNFe, &ctx)
+			var cStats []int
+			for _, v := range c.regra(infNFe, ctx) {
+				cStats = append(cStats, v.CStat)
+			}
+			if !reflect.DeepEqual(cStats, c.cStats) {
+				t.Fatalf("rejeições = %v, esperado %v", cStats, c.cStats)
+			}
+		})
+	}
+}
+
+func TestValidarRegras(t *testing.T) {
+	infNFe, ctx := notaRegrasTeste(t)
+	if err := ValidarRegras(infNFe, ctx); err != nil {
+		t.Fatal(err)
+	}
+	infNFe.Ide.TpAmb = "1"
+	infNFe.Total.ICMSTot.VNF = 30
+	err := ValidarRegras(infNFe, ctx)
+	var violacoes Violacoes
+	if !errors.As(err, &violacoes) || len(violacoes) != 2 || violacoes[0].CStat != 252 || violacoes[1].CStat != 610 {
+		t.Fatalf("esperadas as rejeições 252 e 610 na ordem das RegrasMOC, obtido %v", err)
+	}
+}
@@ -0,0 +1,689 @@
+package services
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// EscreverNFe serializa a NFe diretamente das estruturas tipadas para o io.Writer,
+// sem montar a árvore de DynamicElement. A saída é idêntica à de GenerateCompactXML
+// sobre MakeTagNFe, sem indentação e sem os elementos opcionais vazios
+func EscreverNFe(w io.Writer, infNFe InfNFe) error {
+	e := novoEscritorXML(w)
+	e.texto(`<?xml version="1.0" encoding="UTF-8"?><NFe xmlns="http://www.portalfiscal.inf.br/nfe"><infNFe Id="`)
+	e.escapar(infNFe.Id, true)
+	e.texto(`" versao="`)
+	e.escapar(infNFe.Versao, true)
+	e.texto(`">`)
+
+	e.ide(infNFe.Ide)
+	e.emit(infNFe.Emit)
+	if infNFe.Dest != (Dest{}) {
+		e.dest(infNFe.Dest)
+	}
+	if infNFe.Retirada != nil {
+		e.grupo("retirada", leiauteLocal, infNFe.Retirada.valor)
+	}
+	if infNFe.Entrega != nil {
+		e.grupo("entrega", leiauteLocal, infNFe.Entrega.valor)
+	}
+	for _, autXML := range infNFe.AutXML {
+		e.abrir("autXML")
+		e.campo("CNPJ", autXML.CNPJ)
+		e.fechar("autXML")
+	}
+	for _, det := range infNFe.Det {
+		e.det(det)
+	}
+	e.total(infNFe.Total)
+	if infNFe.Transp != nil {
+		e.transp(*infNFe.Transp)
+	}
+	if infNFe.Cobr != nil {
+		e.cobr(*infNFe.Cobr)
+	}
+	if infNFe.Pag != nil {
+		e.pag(*infNFe.Pag)
+	}
+	if infNFe.InfIntermed != nil {
+		if err := ValidarInfIntermed(infNFe.Ide); err != nil {
+			e.falhar(err)
+		}
+		e.abrir("infIntermed")
+		e.campo("CNPJ", infNFe.InfIntermed.CNPJ)
+		e.campo("idCadIntTran", infNFe.InfIntermed.IdCadIntTran)
+		e.fechar("infIntermed")
+	}
+	if infNFe.InfAdic != nil {
+		e.infAdic(*infNFe.InfAdic)
+	}
+	if infNFe.Exporta != nil {
+		e.grupo("exporta", leiauteExporta, infNFe.Exporta.valor)
+	}
+	if infNFe.Compra != nil {
+		e.grupo("compra", leiauteCompra, infNFe.Compra.valor)
+	}
+	if infNFe.InfRespTec != nil {
+		e.infRespTec(*infNFe.InfRespTec)
+	}
+
+	e.texto("</infNFe></NFe>")
+	if e.err != nil {
+		return fmt.Errorf("erro ao gerar XML: %w", e.err)
+	}
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("erro ao gerar XML: %w", err)
+	}
+	return nil
+}
+
+// Escritor de XML compacto. Os erros de escrita ficam retidos no bufio.Writer
+// e são retornados no Flush; os de conteúdo, em err
+type escritorXML struct {
+	w   *bufio.Writer
+	num []byte // buffer reutilizado na formatação dos valores numéricos
+	err error  // grupo de tributo inválido
+}
+
+func novoEscritorXML(w io.Writer) *escritorXML {
+	return &escritorXML{w: bufio.NewWriter(w), num: make([]byte, 0, 32)}
+}
+
+func (e *escritorXML) texto(s string) {
+	e.w.WriteString(s)
+}
+
+func (e *escritorXML) abrir(tag string) {
+	e.w.WriteByte('<')
+	e.w.WriteString(tag)
+	e.w.WriteByte('>')
+}
+
+func (e *escritorXML) fechar(tag string) {
+	e.w.WriteString("</")
+	e.w.WriteString(tag)
+	e.w.WriteByte('>')
+}
+
+// Elemento obrigatório: é escrito mesmo quando vazio
+func (e *escritorXML) campo(tag, valor string) {
+	e.abrir(tag)
+	e.escapar(valor, false)
+	e.fechar(tag)
+}
+
+// Elemento opcional: omitido quando vazio
+func (e *escritorXML) campoOpcional(tag, valor string) {
+	if valor != "" {
+		e.campo(tag, valor)
+	}
+}
+
+// Valor decimal com o número de casas definido pelo leiaute
+func (e *escritorXML) decimal(tag string, valor float64, casas int) {
+	e.abrir(tag)
+	e.num = strconv.AppendFloat(e.num[:0], valor, 'f', casas, 64)
+	e.w.Write(e.num)
+	e.fechar(tag)
+}
+
+// Valor decimal opcional: omitido quando zero
+func (e *escritorXML) decimalOpcional(tag string, valor float64, casas int) {
+	if valor != 0 {
+		e.decimal(tag, valor, casas)
+	}
+}
+
+// Guarda o primeiro erro de conteúdo, retornado ao final por EscreverNFe
+func (e *escritorXML) falhar(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Escapa o texto da mesma forma que o xml.Encoder: quebras de linha só são
+// escapadas nos atributos e caracteres inválidos viram U+FFFD
+func (e *escritorXML) escapar(s string, atributo bool) {
+	ultimo := 0
+	for i := 0; i < len(s); {
+		r, largura := utf8.DecodeRuneInString(s[i:])
+		var troca string
+		switch {
+		case r == '"':
+			troca = "&#34;"
+		case r == '\'':
+			troca = "&#39;"
+		case r == '&':
+			troca = "&amp;"
+		case r == '<':
+			troca = "&lt;"
+		case r == '>':
+			troca = "&gt;"
+		case r == '\t':
+			troca = "&#x9;"
+		case r == '\n':
+			if atributo {
+				troca = "&#xA;"
+			}
+		case r == '\r':
+			troca = "&#xD;"
+		case !caractereXMLValido(r) || (r == utf8.RuneError && largura == 1):
+			troca = "\uFFFD"
+		}
+		if troca != "" {
+			e.w.WriteString(s[ultimo:i])
+			e.w.WriteString(troca)
+			ultimo = i + largura
+		}
+		i += largura
+	}
+	e.w.WriteString(s[ultimo:])
+}
+
+// Faixas de caracteres permitidas pela especificação XML 1.0
+func caractereXMLValido(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+func (e *escritorXML) ide(ide Ide) {
+	e.abrir("ide")
+	e.campo("cUF", ide.CUF)
+	e.campo("cNF", ide.CNF)
+	e.campo("natOp", ide.NatOp)
+	e.campo("mod", ide.Mod)
+	e.campo("serie", ide.Serie)
+	e.campo("nNF", ide.NNF)
+	e.campo("dhEmi", ide.DhEmi)
+	e.campoOpcional("dhSaiEnt", ide.DhSaiEnt)
+	e.campo("tpNF", ide.TpNF)
+	e.campo("idDest", ide.IdDest)
+	e.campo("cMunFG", ide.CMunFG)
+	e.campo("tpImp", ide.TpImp)
+	e.campo("tpEmis", ide.TpEmis)
+	e.campo("cDV", ide.CDV)
+	e.campo("tpAmb", ide.TpAmb)
+	e.campo("finNFe", ide.FinNFe)
+	e.campoOpcional("tpNFDebito", ide.TpNFDebito)
+	e.campoOpcional("tpNFCredito", ide.TpNFCredito)
+	e.campo("indFinal", ide.IndFinal)
+	e.campo("indPres", ide.IndPres)
+	e.campoOpcional("indIntermed", ide.IndIntermed)
+	e.campo("procEmi", ide.ProcEmi)
+	e.campo("verProc", ide.VerProc)
+	if ide.DhCont != "" || ide.XJust != "" {
+		e.campo("dhCont", ide.DhCont)
+		e.campo("xJust", ide.XJust)
+	}
+	for _, ref := range ide.NFref {
+		e.abrir("NFref")
+		e.campoOpcional("refNFe", ref.RefNFe)
+		if ref.RefNF != nil {
+			e.grupo("refNF", leiauteRefNF, ref.RefNF.valor)
+		}
+		if ref.RefNFP != nil {
+			e.grupo("refNFP", leiauteRefNFP, ref.RefNFP.valor)
+		}
+		e.campoOpcional("refCTe", ref.RefCTe)
+		if ref.RefECF != nil {
+			e.grupo("refECF", leiauteRefECF, ref.RefECF.valor)
+		}
+		e.fechar("NFref")
+	}
+	e.fechar("ide")
+}
+
+func (e *escritorXML) emit(emit Emit) {
+	e.abrir("emit")
+	e.campoOpcional("CNPJ", emit.CNPJ)
+	e.campoOpcional("CPF", emit.CPF)
+	e.campo("xNome", emit.XNome)
+	e.campoOpcional("xFant", emit.XFant)
+	e.abrir("enderEmit")
+	e.campo("xLgr", emit.EnderEmit.XLgr)
+	e.campo("nro", emit.EnderEmit.Nro)
+	e.campoOpcional("xCpl", emit.EnderEmit.XCpl)
+	e.campo("xBairro", emit.EnderEmit.XBairro)
+	e.campo("cMun", emit.EnderEmit.CMun)
+	e.campo("xMun", emit.EnderEmit.XMun)
+	e.campo("UF", emit.EnderEmit.UF)
+	e.campo("CEP", emit.EnderEmit.CEP)
+	e.campoOpcional("cPais", emit.EnderEmit.CPais)
+	e.campoOpcional("xPais", emit.EnderEmit.XPais)
+	e.campoOpcional("fone", emit.EnderEmit.Fone)
+	e.fechar("enderEmit")
+	e.campo("IE", emit.IE)
+	e.campoOpcional("IEST", emit.IEST)
+	e.campo("CRT", emit.CRT)
+	e.fechar("emit")
+}
+
+func (e *escritorXML) dest(dest Dest) {
+	e.abrir("dest")
+	e.campoOpcional("CNPJ", dest.CNPJ)
+	e.campoOpcional("CPF", dest.CPF)
+	e.campoOpcional("idEstrangeiro", dest.IdEstrangeiro)
+	e.campoOpcional("xNome", dest.XNome)
+	if ender := dest.EnderDest; ender != (EnderDest{}) {
+		e.abrir("enderDest")
+		e.campo("xLgr", ender.XLgr)
+		e.campo("nro", ender.Nro)
+		e.campoOpcional("xCpl", ender.XCpl)
+		e.campo("xBairro", ender.XBairro)
+		e.campo("cMun", ender.CMun)
+		e.campo("xMun", ender.XMun)
+		e.campo("UF", ender.UF)
+		e.campoOpcional("CEP", ender.CEP)
+		e.campoOpcional("cPais", ender.CPais)
+		e.campoOpcional("xPais", ender.XPais)
+		e.campoOpcional("fone", ender.Fone)
+		e.fechar("enderDest")
+	}
+	e.campo("indIEDest", dest.IndIEDest)
+	e.campoOpcional("IE", dest.IE)
+	e.campoOpcional("ISUF", dest.ISUF)
+	e.campoOpcional("IM", dest.IM)
+	e.campoOpcional("email", dest.Email)
+	e.fechar("dest")
+}
+
+func (e *escritorXML) det(det Det) {
+	e.texto(`<det nItem="`)
+	e.escapar(det.NItem, true)
+	e.texto(`">`)
+	e.prod(det.Prod)
+	if det.Imposto != nil {
+		e.imposto(*det.Imposto)
+	}
+	e.campoOpcional("infAdProd", det.InfAdProd)
+	e.fechar("det")
+}
+
+func (e *escritorXML) prod(prod Prod) {
+	e.abrir("prod")
+	e.campo("cProd", prod.CProd)
+	e.campo("cEAN", prod.CEAN)
+	e.campo("xProd", prod.XProd)
+	e.campo("NCM", prod.NCM)
+	e.campoOpcional("CEST", prod.CEST)
+	e.campoOpcional("indEscala", prod.IndEscala)
+	e.campoOpcional("CNPJFab", prod.CNPJFab)
+	e.campoOpcional("cBenef", prod.CBenef)
+	e.campo("CFOP", prod.CFOP)
+	e.campo("uCom", prod.UCom)
+	e.decimal("qCom", prod.QCom, 4)
+	e.decimal("vUnCom", prod.VUnCom, 10)
+	e.decimal("vProd", prod.VProd, 2)
+	e.campo("cEANTrib", prod.CEANTrib)
+	e.campo("uTrib", prod.UTrib)
+	e.decimal("qTrib", prod.QTrib, 4)
+	e.decimal("vUnTrib", prod.VUnTrib, 10)
+	e.decimalOpcional("vFrete", prod.VFrete, 2)
+	e.decimalOpcional("vSeg", prod.VSeg, 2)
+	e.decimalOpcional("vDesc", prod.VDesc, 2)
+	e.decimalOpcional("vOutro", prod.VOutro, 2)
+	e.campo("indTot", prod.IndTot)
+	for _, di := range prod.DI {
+		e.di(di)
+	}
+	e.campoOpcional("xPed", prod.XPed)
+	e.campoOpcional("nItemPed", prod.NItemPed)
+	for _, rastro := range prod.Rastro {
+		e.grupo("rastro", leiauteRastro, rastro.valor)
+	}
+	if prod.Med != nil {
+		e.grupo("med", leiauteMed, prod.Med.valor)
+	}
+	e.fechar("prod")
+}
+
+func (e *escritorXML) di(di DI) {
+	e.abrir("DI")
+	e.campo("nDI", di.NDI)
+	e.campo("dDI", di.DDI)
+	e.campo("xLocDesemb", di.XLocDesemb)
+	e.campo("UFDesemb", di.UFDesemb)
+	e.campo("dDesemb", di.DDesemb)
+	e.campo("tpViaTransp", di.TpViaTransp)
+	e.decimalOpcional("vAFRMM", di.VAFRMM, 2)
+	e.campo("tpIntermedio", di.TpIntermedio)
+	e.campoOpcional("CNPJ", di.CNPJ)
+	e.campoOpcional("UFTerceiro", di.UFTerceiro)
+	e.campo("cExportador", di.CExportador)
+	for _, adi := range di.Adi {
+		e.abrir("adi")
+		e.campoOpcional("nAdicao", adi.NAdicao)
+		e.campo("nSeqAdic", adi.NSeqAdic)
+		e.campo("cFabricante", adi.CFabricante)
+		e.decimalOpcional("vDescDI", adi.VDescDI, 2)
+		e.campoOpcional("nDraw", adi.NDraw)
+		e.fechar("adi")
+	}
+	e.fechar("DI")
+}
+
+func (e *escritorXML) imposto(imposto Imposto) {
+	e.abrir("imposto")
+	e.decimalOpcional("vTotTrib", imposto.VTotTrib, 2)
+	if imposto.ICMS != nil {
+		campos, err := leiauteGrupoICMS(imposto.ICMS.Grupo)
+		e.grupoLeiaute("ICMS", imposto.ICMS.Grupo.XMLName.Local, campos, err, imposto.ICMS.Grupo.valor)
+	}
+	if imposto.IPI != nil {
+		e.ipi(*imposto.IPI)
+	}
+	if imposto.II != nil {
+		e.grupo("II", leiauteII, imposto.II.valor)
+	}
+	if imposto.ISSQN != nil {
+		e.grupo("ISSQN", leiauteISSQN, imposto.ISSQN.valor)
+	}
+	if imposto.PIS != nil {
+		campos, err := leiauteGrupoPISCOFINS("PIS", imposto.PIS.Grupo)
+		e.grupoLeiaute("PIS", imposto.PIS.Grupo.XMLName.Local, campos, err, imposto.PIS.Grupo.valor)
+	}
+	if imposto.COFINS != nil {
+		campos, err := leiauteGrupoPISCOFINS("COFINS", imposto.COFINS.Grupo)
+		e.grupoLeiaute("COFINS", imposto.COFINS.Grupo.XMLName.Local, campos, err, imposto.COFINS.Grupo.valor)
+	}
+	if imposto.ICMSUFDest != nil {
+		e.grupo("ICMSUFDest", leiauteICMSUFDest, imposto.ICMSUFDest.valor)
+	}
+	if is := imposto.IS; is != nil {
+		e.abrir("IS")
+		e.campo("CSTIS", is.CSTIS)
+		e.campo("cClassTribIS", is.CClassTribIS)
+		e.decimal("vBCIS", is.VBCIS, 2)
+		e.decimal("pIS", is.PIS, 4)
+		if is.PISEspec > 0 {
+			e.decimal("pISEspec", is.PISEspec, 4)
+			e.campo("uTrib", is.UTrib)
+			e.decimal("qTrib", is.QTrib, 4)
+		}
+		e.decimal("vIS", is.VIS, 2)
+		e.fechar("IS")
+	}
+	if ibscbs := imposto.IBSCBS; ibscbs != nil {
+		e.abrir("IBSCBS")
+		e.campo("CST", ibscbs.CST)
+		e.campo("cClassTrib", ibscbs.CClassTrib)
+		if g := ibscbs.GIBSCBS; g != nil {
+			e.abrir("gIBSCBS")
+			e.decimal("vBC", g.VBC, 2)
+			e.aliquotaIBSCBS("gIBSUF", "pIBSUF", g.GIBSUF.PIBSUF, g.GIBSUF.GRed, "vIBSUF", g.GIBSUF.VIBSUF)
+			e.aliquotaIBSCBS("gIBSMun", "pIBSMun", g.GIBSMun.PIBSMun, g.GIBSMun.GRed, "vIBSMun", g.GIBSMun.VIBSMun)
+			e.decimal("vIBS", g.VIBS, 2)
+			e.aliquotaIBSCBS("gCBS", "pCBS", g.GCBS.PCBS, g.GCBS.GRed, "vCBS", g.GCBS.VCBS)
+			e.fechar("gIBSCBS")
+		}
+		e.fechar("IBSCBS")
+	}
+	e.fechar("imposto")
+}
+
+// Tributo com o grupo escolhido pelo CST (<ICMS><ICMS00>...</ICMS00></ICMS>), escrito
+// na sequência do leiaute
+func (e *escritorXML) grupoLeiaute(tributo, grupo string, campos []campoLeiaute, err error, valor func(string) valorLeiaute) {
+	if err != nil {
+		e.falhar(err)
+		return
+	}
+	e.abrir(tributo)
+	e.grupo(grupo, campos, valor)
+	e.fechar(tributo)
+}
+
+// Grupo escrito na sequência do leiaute
+func (e *escritorXML) grupo(tag string, campos []campoLeiaute, valor func(string) valorLeiaute) {
+	e.abrir(tag)
+	percorrerLeiaute(campos, valor, func(tag string, v valorLeiaute) {
+		if v.decimal {
+			e.decimal(tag, v.numero, casasDecimais(tag))
+		} else {
+			e.campo(tag, v.texto)
+		}
+	})
+	e.fechar(tag)
+}
+
+func (e *escritorXML) ipi(ipi IPI) {
+	e.abrir("IPI")
+	e.campoOpcional("CNPJProd", ipi.CNPJProd)
+	e.campo("cEnq", ipi.CEnq)
+	switch {
+	case ipi.IPITrib != nil:
+		t := ipi.IPITrib
+		e.abrir("IPITrib")
+		e.campo("CST", t.CST)
+		// Cálculo por alíquota ou por unidade de medida
+		if t.QUnid != 0 || t.VUnid != 0 {
+			e.decimal("qUnid", t.QUnid, 4)
+			e.decimal("vUnid", t.VUnid, 4)
+		} else {
+			e.decimal("vBC", t.VBC, 2)
+			e.decimal("pIPI", t.PIPI, 4)
+		}
+		e.decimal("vIPI", t.VIPI, 2)
+		e.fechar("IPITrib")
+	case ipi.IPINT != nil:
+		e.abrir("IPINT")
+		e.campo("CST", ipi.IPINT.CST)
+		e.fechar("IPINT")
+	default:
+		e.falhar(fmt.Errorf("IPI sem o grupo IPITrib ou IPINT"))
+	}
+	e.fechar("IPI")
+}
+
+// Grupo com alíquota, redução (opcional) e valor: gIBSUF, gIBSMun e gCBS
+func (e *escritorXML) aliquotaIBSCBS(grupo, tagAliquota string, aliquota float64, gRed *GRed, tagValor string, valor float64) {
+	e.abrir(grupo)
+	e.decimal(tagAliquota, aliquota, 4)
+	if gRed != nil {
+		e.abrir("gRed")
+		e.decimal("pRedAliq", gRed.PRedAliq, 4)
+		e.decimal("pAliqEfet", gRed.PAliqEfet, 4)
+		e.fechar("gRed")
+	}
+	e.decimal(tagValor, valor, 2)
+	e.fechar(grupo)
+}
+
+func (e *escritorXML) total(total Total) {
+	t := total.ICMSTot
+	e.abrir("total")
+	e.abrir("ICMSTot")
+	e.decimal("vBC", t.VBC, 2)
+	e.decimal("vICMS", t.VICMS, 2)
+	e.decimal("vICMSDeson", t.VICMSDeson, 2)
+	e.decimalOpcional("vFCPUFDest", t.VFCPUFDest, 2)
+	e.decimalOpcional("vICMSUFDest", t.VICMSUFDest, 2)
+	e.decimalOpcional("vICMSUFRemet", t.VICMSUFRemet, 2)
+	e.decimal("vFCP", t.VFCP, 2)
+	e.decimal("vBCST", t.VBSCST, 2)
+	e.decimal("vST", t.VST, 2)
+	e.decimal("vFCPST", t.VFCPST, 2)
+	e.decimal("vFCPSTRet", t.VFCPSTRet, 2)
+	e.decimal("vProd", t.VProd, 2)
+	e.decimal("vFrete", t.VFrete, 2)
+	e.decimal("vSeg", t.VSeg, 2)
+	e.decimal("vDesc", t.VDesc, 2)
+	e.decimal("vII", t.VII, 2)
+	e.decimal("vIPI", t.VIPI, 2)
+	e.decimal("vIPIDevol", t.VIPIDevol, 2)
+	e.decimal("vPIS", t.VPIS, 2)
+	e.decimal("vCOFINS", t.VCOFINS, 2)
+	e.decimal("vOutro", t.VOutro, 2)
+	e.decimal("vNF", t.VNF, 2)
+	e.decimal("vTotTrib", t.VTotTrib, 2)
+	e.fechar("ICMSTot")
+	if t := total.ISSQNtot; t != nil {
+		e.abrir("ISSQNtot")
+		e.decimalOpcional("vServ", t.VServ, 2)
+		e.decimalOpcional("vBC", t.VBC, 2)
+		e.decimalOpcional("vISS", t.VISS, 2)
+		e.decimalOpcional("vPIS", t.VPIS, 2)
+		e.decimalOpcional("vCOFINS", t.VCOFINS, 2)
+		e.campo("dCompet", t.DCompet)
+		e.decimalOpcional("vDeducao", t.VDeducao, 2)
+		e.decimalOpcional("vOutro", t.VOutro, 2)
+		e.decimalOpcional("vDescIncond", t.VDescIncond, 2)
+		e.decimalOpcional("vDescCond", t.VDescCond, 2)
+		e.decimalOpcional("vISSRet", t.VISSRet, 2)
+		e.campoOpcional("cRegTrib", t.CRegTrib)
+		e.fechar("ISSQNtot")
+	}
+	if total.ISTot != nil {
+		e.abrir("ISTot")
+		e.decimal("vIS", total.ISTot.VIS, 2)
+		e.fechar("ISTot")
+	}
+	if t := total.IBSCBSTot; t != nil {
+		e.abrir("IBSCBSTot")
+		e.decimal("vBCIBSCBS", t.VBCIBSCBS, 2)
+		e.abrir("gIBS")
+		e.abrir("gIBSUF")
+		e.decimal("vDif", t.GIBS.GIBSUF.VDif, 2)
+		e.decimal("vDevTrib", t.GIBS.GIBSUF.VDevTrib, 2)
+		e.decimal("vIBSUF", t.GIBS.GIBSUF.VIBSUF, 2)
+		e.fechar("gIBSUF")
+		e.abrir("gIBSMun")
+		e.decimal("vDif", t.GIBS.GIBSMun.VDif, 2)
+		e.decimal("vDevTrib", t.GIBS.GIBSMun.VDevTrib, 2)
+		e.decimal("vIBSMun", t.GIBS.GIBSMun.VIBSMun, 2)
+		e.fechar("gIBSMun")
+		e.decimal("vIBS", t.GIBS.VIBS, 2)
+		e.decimal("vCredPres", t.GIBS.VCredPres, 2)
+		e.decimal("vCredPresCondSus", t.GIBS.VCredPresCondSus, 2)
+		e.fechar("gIBS")
+		e.abrir("gCBS")
+		e.decimal("vDif", t.GCBS.VDif, 2)
+		e.decimal("vDevTrib", t.GCBS.VDevTrib, 2)
+		e.decimal("vCBS", t.GCBS.VCBS, 2)
+		e.decimal("vCredPres", t.GCBS.VCredPres, 2)
+		e.decimal("vCredPresCondSus", t.GCBS.VCredPresCondSus, 2)
+		e.fechar("gCBS")
+		e.fechar("IBSCBSTot")
+	}
+	if total.VNFTot > 0 {
+		e.decimal("vNFTot", total.VNFTot, 2)
+	}
+	e.fechar("total")
+}
+
+func (e *escritorXML) transp(transp Transp) {
+	e.abrir("transp")
+	e.campo("modFrete", transp.ModFrete)
+	t := transp.Transporta
+	t.XMLName = xml.Name{}
+	if t != (Transporta{}) {
+		e.abrir("transporta")
+		e.campoOpcional("CNPJ", t.CNPJ)
+		e.campoOpcional("CPF", t.CPF)
+		e.campoOpcional("xNome", t.XNome)
+		e.campoOpcional("IE", t.IE)
+		e.campoOpcional("xEnder", t.XEnder)
+		e.campoOpcional("xMun", t.XMun)
+		e.campoOpcional("UF", t.UF)
+		e.fechar("transporta")
+	}
+	for _, vol := range transp.Vol {
+		if vol.XMLName = (xml.Name{}); vol == (Vol{}) {
+			continue
+		}
+		e.abrir("vol")
+		e.campoOpcional("qVol", vol.QVol)
+		e.campoOpcional("esp", vol.Esp)
+		e.campoOpcional("pesoL", vol.PesoL)
+		e.campoOpcional("pesoB", vol.PesoB)
+		e.fechar("vol")
+	}
+	e.fechar("transp")
+}
+
+func (e *escritorXML) cobr(cobr Cobr) {
+	e.abrir("cobr")
+	fat := cobr.Fat
+	fat.XMLName = xml.Name{}
+	if fat != (Fat{}) {
+		e.abrir("fat")
+		e.campoOpcional("nFat", fat.NFat)
+		e.campoOpcional("vOrig", fat.VOrig)
+		e.campoOpcional("vDesc", fat.VDesc)
+		e.campoOpcional("vLiq", fat.VLiq)
+		e.fechar("fat")
+	}
+	for _, dup := range cobr.Dup {
+		e.abrir("dup")
+		e.campoOpcional("nDup", dup.NDup)
+		e.campoOpcional("dVenc", dup.DVenc)
+		e.campo("vDup", dup.VDup)
+		e.fechar("dup")
+	}
+	e.fechar("cobr")
+}
+
+func (e *escritorXML) pag(pag Pag) {
+	e.abrir("pag")
+	for _, detPag := range pag.DetPag {
+		e.abrir("detPag")
+		e.campoOpcional("indPag", detPag.IndPag)
+		e.campo("tPag", detPag.TPag)
+		e.campo("vPag", detPag.VPag)
+		e.fechar("detPag")
+	}
+	e.campoOpcional("vTroco", pag.VTroco)
+	e.fechar("pag")
+}
+
+func (e *escritorXML) infAdic(infAdic InfAdic) {
+	if err := ValidarInfAdic(infAdic); err != nil {
+		e.falhar(err)
+	}
+	e.abrir("infAdic")
+	e.campoOpcional("infAdFisco", infAdic.InfAdFisco)
+	e.campoOpcional("infCpl", infAdic.InfCpl)
+	for _, obs := range infAdic.ObsCont {
+		e.observacao("obsCont", obs.XCampo, obs.XTexto)
+	}
+	for _, obs := range infAdic.ObsFisco {
+		e.observacao("obsFisco", obs.XCampo, obs.XTexto)
+	}
+	for _, proc := range infAdic.ProcRef {
+		e.abrir("procRef")
+		e.campo("nProc", proc.NProc)
+		e.campo("indProc", proc.IndProc)
+		e.campoOpcional("tpAto", proc.TpAto)
+		e.fechar("procRef")
+	}
+	e.fechar("infAdic")
+}
+
+func (e *escritorXML) observacao(tag, xCampo, xTexto string) {
+	e.w.WriteByte('<')
+	e.w.WriteString(tag)
+	e.texto(` xCampo="`)
+	e.escapar(xCampo, true)
+	e.texto(`">`)
+	e.campo("xTexto", xTexto)
+	e.fechar(tag)
+}
+
+func (e *escritorXML) infRespTec(infRespTec InfRespTec) {
+	e.abrir("infRespTec")
+	e.campo("CNPJ", infRespTec.CNPJ)
+	e.campo("xContato", infRespTec.XContato)
+	e.campo("email", infRespTec.Email)
+	e.campo("fone", infRespTec.Fone)
+	if infRespTec.IdCSRT != "" && infRespTec.HashCSRT != "" {
+		e.campo("idCSRT", infRespTec.IdCSRT)
+		e.campo("hashCSRT", infRespTec.HashCSRT)
+	}
+	e.fechar("infRespTec")
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// NFe com todos os grupos preenchidos, incluindo tributos com base em valor e em quantidade
+func nfeCompletaTeste() InfNFe {
+	return InfNFe{
+		Id:     "NFe35261012345678000199550010000001231000000011",
+		Versao: "4.00",
+		Ide: Ide{
+			CUF: "35", CNF: "00000001", NatOp: "VENDA & REMESSA", Mod: "55", Serie: "1", NNF: "123",
+			DhEmi: "2026-10-19T10:00:00-03:00", DhSaiEnt: "2026-10-19T11:00:00-03:00", TpNF: "1", IdDest: "1", CMunFG: "3550308", TpImp: "1",
+			TpEmis: "1", CDV: "1", TpAmb: "2", FinNFe: "1", IndFinal: "1", IndPres: "1", IndIntermed: "1",
+			ProcEmi: "0", VerProc: "1.0",
+			NFref: []NFref{
+				{RefNFe: "35261012345678000199550010000001221000000014"},
+				{RefNFP: &RefNFP{CUF: "35", AAMM: "2609", CPF: "12345678909", IE: "ISENTO", Mod: "04", Serie: "0", NNF: "10"}},
+			},
+		},
+		Emit: Emit{
+			CNPJ: "12345678000199", XNome: "EMPRESA TESTE", XFant: "TESTE",
+			EnderEmit: EnderEmit{XLgr: "RUA A", Nro: "1", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP", CEP: "01001000", CPais: "1058", XPais: "BRASIL"},
+			IE:        "123456789", CRT: "3",
+		},
+		Dest: Dest{
+			CPF: "12345678909", XNome: "CONSUMIDOR <FINAL>",
+			EnderDest: EnderDest{XLgr: "RUA B", Nro: "2", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP"},
+			IndIEDest: "9", Email: "consumidor@example.com",
+		},
+		Entrega: &Local{CNPJ: "44555666000199", XLgr: "RUA C", Nro: "3", XBairro: "CENTRO", CMun: "3550308", XMun: "SAO PAULO", UF: "SP"},
+		AutXML:  []AutXML{{CNPJ: "99999999000191"}},
+		Det: []Det{
+			{
+				NItem: "1",
+				Prod: Prod{
+					CProd: "001", CEAN: "SEM GTIN", XProd: "PRODUTO A", NCM: "61091000", CEST: "2806300", CBenef: "SP000001", CFOP: "5102", UCom: "UN",
+					QCom: 2, VUnCom: 50, VProd: 100, CEANTrib: "SEM GTIN", UTrib: "UN", QTrib: 2, VUnTrib: 50,
+					VFrete: 10, VSeg: 1.5, VDesc: 5, VOutro: 2, IndTot: "1", XPed: "PED-1", NItemPed: "1",
+					Rastro: []Rastro{{NLote: "L1", QLote: 2, DFab: "2026-01-01", DVal: "2027-01-01"}},
+				},
+				Imposto: &Imposto{
+					VTotTrib: 30.5,
+					ICMS: &ICMS{Grupo: ICMSGrupo{
+						XMLName: xml.Name{Local: "ICMS00"}, Orig: "0", CST: "00", ModBC: "3", VBC: 108.5, PICMS: 18, VICMS: 19.53,
+					}},
+					IPI: &IPI{CEnq: "999", IPITrib: &IPITrib{CST: "50", VBC: 100, PIPI: 5, VIPI: 5}},
+					II:  &II{VBC: 100, VDespAdu: 10, VII: 12, VIOF: 0},
+					PIS: &PIS{Grupo: PISCOFINSGrupo{
+						XMLName: xml.Name{Local: "PISAliq"}, CST: "01", VBC: 100, PPIS: 1.65, VPIS: 1.65,
+					}},
+					COFINS: &COFINS{Grupo: PISCOFINSGrupo{
+						XMLName: xml.Name{Local: "COFINSOutr"}, CST: "99", QBCProd: 2, VAliqProd: 0.5, VCOFINS: 1,
+					}},
+					ICMSUFDest: &ICMSUFDest{VBCUFDest: 100, PICMSUFDest: 18, PICMSInter: 12, PICMSInterPart: 100, VICMSUFDest: 6},
+					IS:         &IS{CSTIS: "000", CClassTribIS: "000001", VBCIS: 100, PIS: 1, VIS: 1},
+				},
+				InfAdProd: "ITEM COM DESCONTO",
+			},
+			{
+				NItem: "2",
+				Prod: Prod{
+					CProd: "002", CEAN: "SEM GTIN", XProd: "PRODUTO B", NCM: "61091000", CFOP: "5102", UCom: "UN",
+					QCom: 1, VUnCom: 20, VProd: 20, CEANTrib: "SEM GTIN", UTrib: "UN", QTrib: 1, VUnTrib: 20, IndTot: "1",
+				},
+				Imposto: &Imposto{
+					ICMS: &ICMS{Grupo: ICMSGrupo{
+						XMLName: xml.Name{Local: "ICMS90"}, Orig: "0", CST: "90", ModBC: "3", VBC: 20,
+					}},
+					IPI:    &IPI{CEnq: "999", IPINT: &IPINT{CST: "53"}},
+					PIS:    &PIS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "PISNT"}, CST: "07"}},
+					COFINS: &COFINS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "COFINSNT"}, CST: "07"}},
+				},
+			},
+			{
+				NItem: "3",
+				Prod: Prod{
+					CProd: "003", CEAN: "SEM GTIN", XProd: "SERVICO", NCM: "00", CFOP: "5933", UCom: "UN",
+					QCom: 1, VUnCom: 30, VProd: 30, CEANTrib: "SEM GTIN", UTrib: "UN", QTrib: 1, VUnTrib: 30, IndTot: "1",
+				},
+				Imposto: &Imposto{
+					ISSQN:  &ISSQN{VBC: 30, VAliq: 5, VISSQN: 1.5, CMunFG: "3550308", CListServ: "14.01", IndISS: "1", IndIncentivo: "2"},
+					PIS:    &PIS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "PISNT"}, CST: "07"}},
+					COFINS: &COFINS{Grupo: PISCOFINSGrupo{XMLName: xml.Name{Local: "COFINSNT"}, CST: "07"}},
+				},
+			},
+		},
+		Total: Total{
+			ICMSTot: ICMSTot{VBC: 128.5, VICMS: 19.53, VICMSUFDest: 6, VProd: 120, VFrete: 10, VSeg: 1.5, VDesc: 5, VII: 12, VIPI: 5,
+				VPIS: 1.65, VCOFINS: 1, VOutro: 2, VNF: 175.5, VTotTrib: 30.5},
+			ISSQNtot: &ISSQNtot{VServ: 30, VBC: 30, VISS: 1.5, DCompet: "2026-10-19"},
+		},
+		Transp: &Transp{
+			ModFrete:   "0",
+			Transporta: Transporta{CNPJ: "11111111000191", XNome: "TRANSPORTADORA", UF: "SP"},
+			Vol:        []Vol{{QVol: "1", Esp: "CAIXA"}},
+		},
+		Cobr:        &Cobr{Fat: Fat{NFat: "123", VOrig: "133.50", VLiq: "133.50"}, Dup: []Dup{{NDup: "001", DVenc: "2026-11-19", VDup: "133.50"}}},
+		Pag:         &Pag{DetPag: []DetPag{{IndPag: "1", TPag: "15", VPag: "133.50"}}},
+		InfIntermed: &InfIntermed{CNPJ: "22222222000191", IdCadIntTran: "LOJA"},
+		InfAdic: &InfAdic{
+			InfCpl:  "PEDIDO 1",
+			ObsCont: []ObsCont{{XCampo: "Vendedor", XTexto: "JOAO"}},
+		},
+		Compra:     &Compra{XPed: "PED-1"},
+		InfRespTec: &InfRespTec{CNPJ: "33333333000191", XContato: "SUPORTE", Email: "suporte@example.com", Fone: "11999999999"},
+	}
+}
+
+func escreverNFeTeste(t testing.TB, infNFe InfNFe) string {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	if err := EscreverNFe(buffer, infNFe); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+func TestEscreverNFeIgualArvore(t *testing.T) {
+	infNFe := nfeCompletaTeste()
+	arvore, err := GenerateCompactXML(arvoreNFeTeste(t, infNFe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escrito := escreverNFeTeste(t, infNFe); escrito != arvore {
+		t.Fatalf("EscreverNFe diverge de GenerateCompactXML:\n%s\n%s", escrito, arvore)
+	}
+}
+
+func TestEscreverNFeTributos(t *testing.T) {
+	xmlNFe := escreverNFeTeste(t, nfeCompletaTeste())
+	for _, trecho := range []string{
+		`<prod><cProd>001</cProd><cEAN>SEM GTIN</cEAN><xProd>PRODUTO A</xProd><NCM>61091000</NCM><CEST>2806300</CEST>` +
+			`<cBenef>SP000001</cBenef><CFOP>5102</CFOP><uCom>UN</uCom><qCom>2.0000</qCom><vUnCom>50.0000000000</vUnCom><vProd>100.00</vProd><cEANTrib>SEM GTIN</cEANTrib>` +
+			`<uTrib>UN</uTrib><qTrib>2.0000</qTrib><vUnTrib>50.0000000000</vUnTrib><vFrete>10.00</vFrete><vSeg>1.50</vSeg>` +
+			`<vDesc>5.00</vDesc><vOutro>2.00</vOutro><indTot>1</indTot><xPed>PED-1</xPed><nItemPed>1</nItemPed><rastro>`,
+		`<imposto><vTotTrib>30.50</vTotTrib><ICMS><ICMS00><orig>0</orig><CST>00</CST><modBC>3</modBC><vBC>108.50</vBC>` +
+			`<pICMS>18.0000</pICMS><vICMS>19.53</vICMS></ICMS00></ICMS>`,
+		`<IPI><cEnq>999</cEnq><IPITrib><CST>50</CST><vBC>100.00</vBC><pIPI>5.0000</pIPI><vIPI>5.00</vIPI></IPITrib></IPI>`,
+		`<PIS><PISAliq><CST>01</CST><vBC>100.00</vBC><pPIS>1.6500</pPIS><vPIS>1.65</vPIS></PISAliq></PIS>`,
+		`<COFINS><COFINSOutr><CST>99</CST><qBCProd>2.0000</qBCProd><vAliqProd>0.5000</vAliqProd><vCOFINS>1.00</vCOFINS></COFINSOutr></COFINS><ICMSUFDest>`,
+		`</imposto><infAdProd>ITEM COM DESCONTO</infAdProd></det>`,
+		`<rastro><nLote>L1</nLote><qLote>2.000</qLote><dFab>2026-01-01</dFab><dVal>2027-01-01</dVal></rastro></prod>`,
+		`</IPITrib></IPI><II><vBC>100.00</vBC><vDespAdu>10.00</vDespAdu><vII>12.00</vII><vIOF>0.00</vIOF></II><PIS>`,
+		`</COFINS><ICMSUFDest><vBCUFDest>100.00</vBCUFDest><pICMSUFDest>18.0000</pICMSUFDest><pICMSInter>12.00</pICMSInter>` +
+			`<pICMSInterPart>100.00</pICMSInterPart><vICMSUFDest>6.00</vICMSUFDest><vICMSUFRemet>0.00</vICMSUFRemet></ICMSUFDest><IS>`,
+		`<imposto><ISSQN><vBC>30.00</vBC><vAliq>5.0000</vAliq><vISSQN>1.50</vISSQN><cMunFG>3550308</cMunFG><cListServ>14.01</cListServ>` +
+			`<indISS>1</indISS><indIncentivo>2</indIncentivo></ISSQN><PIS>`,
+		`</ICMSTot><ISSQNtot><vServ>30.00</vServ><vBC>30.00</vBC><vISS>1.50</vISS><dCompet>2026-10-19</dCompet></ISSQNtot>`,
+		// Bloco opcional preenchido: os campos obrigatórios com valor zero também são escritos
+		`<ICMS><ICMS90><orig>0</orig><CST>90</CST><modBC>3</modBC><vBC>20.00</vBC><pICMS>0.0000</pICMS><vICMS>0.00</vICMS></ICMS90></ICMS>` +
+			`<IPI><cEnq>999</cEnq><IPINT><CST>53</CST></IPINT></IPI><PIS><PISNT><CST>07</CST></PISNT></PIS><COFINS><COFINSNT><CST>07</CST></COFINSNT></COFINS></imposto></det>`,
+	} {
+		if !strings.Contains(xmlNFe, trecho) {
+			t.Errorf("XML sem o trecho esperado %s\n%s", trecho, xmlNFe)
+		}
+	}
+}
+
+// Todos os campos das estruturas devem voltar iguais na leitura do XML gerado
+func TestEscreverNFeLeitura(t *testing.T) {
+	infNFe := nfeCompletaTeste()
+	nfe, err := ParseNFe([]byte(escreverNFeTeste(t, infNFe)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lido := nfe.InfNFe
+	for i := range infNFe.Det {
+		// O namespace da NFe é herdado pelo XMLName dos grupos de tributo
+		if imposto := lido.Det[i].Imposto; imposto != nil {
+			if imposto.ICMS != nil {
+				imposto.ICMS.Grupo.XMLName.Space = ""
+			}
+			imposto.PIS.Grupo.XMLName.Space = ""
+			imposto.COFINS.Grupo.XMLName.Space = ""
+		}
+		if !reflect.DeepEqual(lido.Det[i].Prod, infNFe.Det[i].Prod) {
+			t.Errorf("prod do item %d:\n%+v\n%+v", i+1, lido.Det[i].Prod, infNFe.Det[i].Prod)
+		}
+		if !reflect.DeepEqual(lido.Det[i].Imposto, infNFe.Det[i].Imposto) {
+			t.Errorf("imposto do item %d:\n%+v\n%+v", i+1, lido.Det[i].Imposto, infNFe.Det[i].Imposto)
+		}
+		if lido.Det[i].InfAdProd != infNFe.Det[i].InfAdProd {
+			t.Errorf("infAdProd do item %d: %q", i+1, lido.Det[i].InfAdProd)
+		}
+	}
+}
+
+func TestEscreverNFeGrupoInvalido(t *testing.T) {
+	infNFe := nfeCompletaTeste()
+	infNFe.Det[0].Imposto.ICMS.Grupo.XMLName.Local = "ICMS99"
+	if err := EscreverNFe(&bytes.Buffer{}, infNFe); err == nil || !strings.Contains(err.Error(), "ICMS99") {
+		t.Fatalf("esperado erro de grupo de ICMS inválido, obtido %v", err)
+	}
+	infNFe = nfeCompletaTeste()
+	infNFe.Det[0].Imposto.PIS.Grupo.XMLName.Local = "COFINSAliq"
+	if err := EscreverNFe(&bytes.Buffer{}, infNFe); err == nil {
+		t.Fatal("esperado erro de grupo de PIS inválido")
+	}
+}
+
+// Nota com 50 itens, para comparar a escrita direta com a montagem da árvore
+func nfeBenchmark() InfNFe {
+	infNFe := nfeCompletaTeste()
+	det := infNFe.Det[0]
+	infNFe.Det = nil
+	for i := 0; i < 50; i++ {
+		infNFe.Det = append(infNFe.Det, det)
+	}
+	return infNFe
+}
+
+func BenchmarkEscreverNFe(b *testing.B) {
+	infNFe := nfeBenchmark()
+	buffer := &bytes.Buffer{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer.Reset()
+		if err := EscreverNFe(buffer, infNFe); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateDynamicXML(b *testing.B) {
+	infNFe := nfeBenchmark()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GenerateDynamicXML(arvoreNFeTeste(b, infNFe)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateCompactXML(b *testing.B) {
+	infNFe := nfeBenchmark()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GenerateCompactXML(arvoreNFeTeste(b, infNFe)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
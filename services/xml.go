@@ -1,41 +1,89 @@
 package services
 
 import (
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"strconv"
-	"time"
 )
 
 // Estruturas do XML da NFe
 type Ide struct {
-	CUF      string `xml:"cUF"`
-	CNF      string `xml:"cNF"`
-	NatOp    string `xml:"natOp"`
-	Mod      string `xml:"mod"`
-	Serie    string `xml:"serie"`
-	NNF      string `xml:"nNF"`
-	DhEmi    string `xml:"dhEmi"`
-	TpNF     string `xml:"tpNF"`
-	IdDest   string `xml:"idDest"`
-	CMunFG   string `xml:"cMunFG"`
-	TpImp    string `xml:"tpImp"`
-	TpEmis   string `xml:"tpEmis"`
-	CDV      string `xml:"cDV"`
-	TpAmb    string `xml:"tpAmb"`
-	FinNFe   string `xml:"finNFe"`
-	IndFinal string `xml:"indFinal"`
-	IndPres  string `xml:"indPres"`
-	ProcEmi  string `xml:"procEmi"`
-	VerProc  string `xml:"verProc"`
+	CUF         string  `xml:"cUF"`
+	CNF         string  `xml:"cNF"`
+	NatOp       string  `xml:"natOp"`
+	Mod         string  `xml:"mod"`
+	Serie       string  `xml:"serie"`
+	NNF         string  `xml:"nNF"`
+	DhEmi       string  `xml:"dhEmi"`
+	DhSaiEnt    string  `xml:"dhSaiEnt,omitempty"`
+	TpNF        string  `xml:"tpNF"`
+	IdDest      string  `xml:"idDest"`
+	CMunFG      string  `xml:"cMunFG"`
+	TpImp       string  `xml:"tpImp"`
+	TpEmis      string  `xml:"tpEmis"`
+	CDV         string  `xml:"cDV"`
+	TpAmb       string  `xml:"tpAmb"`
+	FinNFe      string  `xml:"finNFe"`
+	TpNFDebito  string  `xml:"tpNFDebito,omitempty"`
+	TpNFCredito string  `xml:"tpNFCredito,omitempty"`
+	IndFinal    string  `xml:"indFinal"`
+	IndPres     string  `xml:"indPres"`
+	IndIntermed string  `xml:"indIntermed,omitempty"`
+	ProcEmi     string  `xml:"procEmi"`
+	VerProc     string  `xml:"verProc"`
+	DhCont      string  `xml:"dhCont,omitempty"` // Entrada em contingência, com a justificativa em xJust
+	XJust       string  `xml:"xJust,omitempty"`
+	NFref       []NFref `xml:"NFref,omitempty"`
+}
+
+// Documento fiscal referenciado. Apenas um dos grupos é informado em cada NFref
+type NFref struct {
+	RefNFe string  `xml:"refNFe,omitempty"`
+	RefNF  *RefNF  `xml:"refNF,omitempty"`
+	RefNFP *RefNFP `xml:"refNFP,omitempty"`
+	RefCTe string  `xml:"refCTe,omitempty"`
+	RefECF *RefECF `xml:"refECF,omitempty"`
+}
+
+// Nota fiscal modelo 1/1A referenciada
+type RefNF struct {
+	CUF   string `xml:"cUF"`
+	AAMM  string `xml:"AAMM"`
+	CNPJ  string `xml:"CNPJ"`
+	Mod   string `xml:"mod"`
+	Serie string `xml:"serie"`
+	NNF   string `xml:"nNF"`
+}
+
+// Nota fiscal de produtor rural referenciada
+type RefNFP struct {
+	CUF   string `xml:"cUF"`
+	AAMM  string `xml:"AAMM"`
+	CNPJ  string `xml:"CNPJ,omitempty"`
+	CPF   string `xml:"CPF,omitempty"`
+	IE    string `xml:"IE"`
+	Mod   string `xml:"mod"`
+	Serie string `xml:"serie"`
+	NNF   string `xml:"nNF"`
+}
+
+// Cupom fiscal referenciado
+type RefECF struct {
+	Mod  string `xml:"mod"`
+	NECF string `xml:"nECF"`
+	NCOO string `xml:"nCOO"`
 }
 
 type Emit struct {
 	CNPJ      string    `xml:"CNPJ"`
+	CPF       string    `xml:"CPF,omitempty"`
 	XNome     string    `xml:"xNome"`
 	XFant     string    `xml:"xFant"`
 	EnderEmit EnderEmit `xml:"enderEmit"`
 	IE        string    `xml:"IE"`
+	IEST      string    `xml:"IEST,omitempty"`
 	CRT       string    `xml:"CRT"`
 }
 
@@ -54,17 +102,22 @@ type EnderEmit struct {
 }
 
 type Dest struct {
-	CNPJ      string    `xml:"CNPJ"`
-	XNome     string    `xml:"xNome"`
-	EnderDest EnderDest `xml:"enderDest"`
-	IndIEDest string    `xml:"indIEDest"`
-	IE        string    `xml:"IE"`
-	Email     string    `xml:"email,omitempty"`
+	CNPJ          string    `xml:"CNPJ"`
+	CPF           string    `xml:"CPF,omitempty"`
+	IdEstrangeiro string    `xml:"idEstrangeiro,omitempty"`
+	XNome         string    `xml:"xNome"`
+	EnderDest     EnderDest `xml:"enderDest"`
+	IndIEDest     string    `xml:"indIEDest"`
+	IE            string    `xml:"IE"`
+	ISUF          string    `xml:"ISUF,omitempty"`
+	IM            string    `xml:"IM,omitempty"`
+	Email         string    `xml:"email,omitempty"`
 }
 
 type EnderDest struct {
 	XLgr    string `xml:"xLgr"`
 	Nro     string `xml:"nro"`
+	XCpl    string `xml:"xCpl,omitempty"`
 	XBairro string `xml:"xBairro"`
 	CMun    string `xml:"cMun"`
 	XMun    string `xml:"xMun"`
@@ -75,72 +128,511 @@ type EnderDest struct {
 	Fone    string `xml:"fone"`
 }
 
+// Local de retirada ou de entrega, quando diferente do endereço do emitente ou do destinatário
+type Local struct {
+	CNPJ    string `xml:"CNPJ,omitempty"`
+	CPF     string `xml:"CPF,omitempty"`
+	XNome   string `xml:"xNome,omitempty"`
+	XLgr    string `xml:"xLgr"`
+	Nro     string `xml:"nro"`
+	XCpl    string `xml:"xCpl,omitempty"`
+	XBairro string `xml:"xBairro"`
+	CMun    string `xml:"cMun"`
+	XMun    string `xml:"xMun"`
+	UF      string `xml:"UF"`
+	CEP     string `xml:"CEP,omitempty"`
+	CPais   string `xml:"cPais,omitempty"`
+	XPais   string `xml:"xPais,omitempty"`
+	Fone    string `xml:"fone,omitempty"`
+	Email   string `xml:"email,omitempty"`
+	IE      string `xml:"IE,omitempty"`
+}
+
 type Det struct {
-	NItem string `xml:"nItem,attr"`
-	Prod  Prod   `xml:"prod"`
+	NItem     string   `xml:"nItem,attr"`
+	Prod      Prod     `xml:"prod"`
+	Imposto   *Imposto `xml:"imposto,omitempty"`
+	InfAdProd string   `xml:"infAdProd,omitempty"`
+}
+
+// Tributos do item. Item de serviço informa ISSQN no lugar de ICMS e II. IS e IBSCBS
+// foram incluídos pela reforma tributária (NT 2025.002)
+type Imposto struct {
+	VTotTrib   float64     `xml:"vTotTrib,omitempty"`
+	ICMS       *ICMS       `xml:"ICMS,omitempty"`
+	IPI        *IPI        `xml:"IPI,omitempty"`
+	II         *II         `xml:"II,omitempty"`
+	ISSQN      *ISSQN      `xml:"ISSQN,omitempty"`
+	PIS        *PIS        `xml:"PIS,omitempty"`
+	COFINS     *COFINS     `xml:"COFINS,omitempty"`
+	ICMSUFDest *ICMSUFDest `xml:"ICMSUFDest,omitempty"`
+	IS         *IS         `xml:"IS,omitempty"`
+	IBSCBS     *IBSCBS     `xml:"IBSCBS,omitempty"`
+}
+
+// ICMS do item. O grupo informado (ICMS00, ICMS20, ICMSSN102...) fica em Grupo.XMLName
+type ICMS struct {
+	Grupo ICMSGrupo `xml:",any"`
+}
+
+type ICMSGrupo struct {
+	XMLName  xml.Name
+	Orig     string  `xml:"orig"`
+	CST      string  `xml:"CST,omitempty"`
+	CSOSN    string  `xml:"CSOSN,omitempty"`
+	ModBC    string  `xml:"modBC,omitempty"`
+	PRedBC   float64 `xml:"pRedBC,omitempty"`
+	VBC      float64 `xml:"vBC,omitempty"`
+	PICMS    float64 `xml:"pICMS,omitempty"`
+	VICMSOp  float64 `xml:"vICMSOp,omitempty"` // Diferimento (ICMS51)
+	PDif     float64 `xml:"pDif,omitempty"`
+	VICMSDif float64 `xml:"vICMSDif,omitempty"`
+	VICMS    float64 `xml:"vICMS,omitempty"`
+	VBCFCP   float64 `xml:"vBCFCP,omitempty"`
+	PFCP     float64 `xml:"pFCP,omitempty"`
+	VFCP     float64 `xml:"vFCP,omitempty"`
+	ModBCST  string  `xml:"modBCST,omitempty"`
+	PMVAST   float64 `xml:"pMVAST,omitempty"`
+	PRedBCST float64 `xml:"pRedBCST,omitempty"`
+	VBCST    float64 `xml:"vBCST,omitempty"`
+	PICMSST  float64 `xml:"pICMSST,omitempty"`
+	VICMSST  float64 `xml:"vICMSST,omitempty"`
+	VBCFCPST float64 `xml:"vBCFCPST,omitempty"`
+	PFCPST   float64 `xml:"pFCPST,omitempty"`
+	VFCPST   float64 `xml:"vFCPST,omitempty"`
+	// ICMS-ST retido anteriormente (ICMS60 e ICMSSN500)
+	VBCSTRet        float64 `xml:"vBCSTRet,omitempty"`
+	PST             float64 `xml:"pST,omitempty"`
+	VICMSSubstituto float64 `xml:"vICMSSubstituto,omitempty"`
+	VICMSSTRet      float64 `xml:"vICMSSTRet,omitempty"`
+	VBCFCPSTRet     float64 `xml:"vBCFCPSTRet,omitempty"`
+	PFCPSTRet       float64 `xml:"pFCPSTRet,omitempty"`
+	VFCPSTRet       float64 `xml:"vFCPSTRet,omitempty"`
+	// ICMS efetivo, para o consumidor final (ICMS60 e ICMSSN500)
+	PRedBCEfet  float64 `xml:"pRedBCEfet,omitempty"`
+	VBCEfet     float64 `xml:"vBCEfet,omitempty"`
+	PICMSEfet   float64 `xml:"pICMSEfet,omitempty"`
+	VICMSEfet   float64 `xml:"vICMSEfet,omitempty"`
+	VICMSDeson  float64 `xml:"vICMSDeson,omitempty"`
+	MotDesICMS  string  `xml:"motDesICMS,omitempty"`
+	PCredSN     float64 `xml:"pCredSN,omitempty"`
+	VCredICMSSN float64 `xml:"vCredICMSSN,omitempty"`
+}
+
+// Imposto de importação
+type II struct {
+	VBC      float64 `xml:"vBC"`
+	VDespAdu float64 `xml:"vDespAdu"`
+	VII      float64 `xml:"vII"`
+	VIOF     float64 `xml:"vIOF"`
+}
+
+// ISSQN do item de serviço
+type ISSQN struct {
+	VBC          float64 `xml:"vBC"`
+	VAliq        float64 `xml:"vAliq"`
+	VISSQN       float64 `xml:"vISSQN"`
+	CMunFG       string  `xml:"cMunFG"`
+	CListServ    string  `xml:"cListServ"`
+	VDeducao     float64 `xml:"vDeducao,omitempty"`
+	VOutro       float64 `xml:"vOutro,omitempty"`
+	VDescIncond  float64 `xml:"vDescIncond,omitempty"`
+	VDescCond    float64 `xml:"vDescCond,omitempty"`
+	VISSRet      float64 `xml:"vISSRet,omitempty"`
+	IndISS       string  `xml:"indISS"`
+	CServico     string  `xml:"cServico,omitempty"`
+	CMun         string  `xml:"cMun,omitempty"`
+	CPais        string  `xml:"cPais,omitempty"`
+	NProcesso    string  `xml:"nProcesso,omitempty"`
+	IndIncentivo string  `xml:"indIncentivo"`
 }
 
+// ICMS devido à UF de destino na venda interestadual a consumidor final não contribuinte
+type ICMSUFDest struct {
+	VBCUFDest      float64 `xml:"vBCUFDest"`
+	VBCFCPUFDest   float64 `xml:"vBCFCPUFDest,omitempty"`
+	PFCPUFDest     float64 `xml:"pFCPUFDest,omitempty"`
+	PICMSUFDest    float64 `xml:"pICMSUFDest"`
+	PICMSInter     float64 `xml:"pICMSInter"`
+	PICMSInterPart float64 `xml:"pICMSInterPart"`
+	VFCPUFDest     float64 `xml:"vFCPUFDest,omitempty"`
+	VICMSUFDest    float64 `xml:"vICMSUFDest"`
+	VICMSUFRemet   float64 `xml:"vICMSUFRemet"`
+}
+
+type IPI struct {
+	CNPJProd string   `xml:"CNPJProd,omitempty"`
+	CEnq     string   `xml:"cEnq"`
+	IPITrib  *IPITrib `xml:"IPITrib,omitempty"`
+	IPINT    *IPINT   `xml:"IPINT,omitempty"`
+}
+
+type IPITrib struct {
+	CST   string  `xml:"CST"`
+	VBC   float64 `xml:"vBC,omitempty"`
+	PIPI  float64 `xml:"pIPI,omitempty"`
+	QUnid float64 `xml:"qUnid,omitempty"`
+	VUnid float64 `xml:"vUnid,omitempty"`
+	VIPI  float64 `xml:"vIPI"`
+}
+
+type IPINT struct {
+	CST string `xml:"CST"`
+}
+
+// PIS do item. O grupo informado (PISAliq, PISQtde, PISNT, PISOutr) fica em Grupo.XMLName
+type PIS struct {
+	Grupo PISCOFINSGrupo `xml:",any"`
+}
+
+// COFINS do item. O grupo informado (COFINSAliq, COFINSQtde, COFINSNT, COFINSOutr) fica em Grupo.XMLName
+type COFINS struct {
+	Grupo PISCOFINSGrupo `xml:",any"`
+}
+
+type PISCOFINSGrupo struct {
+	XMLName   xml.Name
+	CST       string  `xml:"CST"`
+	VBC       float64 `xml:"vBC,omitempty"`
+	PPIS      float64 `xml:"pPIS,omitempty"`
+	VPIS      float64 `xml:"vPIS,omitempty"`
+	PCOFINS   float64 `xml:"pCOFINS,omitempty"`
+	VCOFINS   float64 `xml:"vCOFINS,omitempty"`
+	QBCProd   float64 `xml:"qBCProd,omitempty"`
+	VAliqProd float64 `xml:"vAliqProd,omitempty"`
+}
+
+// Imposto Seletivo
+type IS struct {
+	CSTIS        string  `xml:"CSTIS"`
+	CClassTribIS string  `xml:"cClassTribIS"`
+	VBCIS        float64 `xml:"vBCIS"`
+	PIS          float64 `xml:"pIS"`
+	PISEspec     float64 `xml:"pISEspec,omitempty"`
+	UTrib        string  `xml:"uTrib,omitempty"`
+	QTrib        float64 `xml:"qTrib,omitempty"`
+	VIS          float64 `xml:"vIS"`
+}
+
+// IBS e CBS do item
+type IBSCBS struct {
+	CST        string   `xml:"CST"`
+	CClassTrib string   `xml:"cClassTrib"`
+	GIBSCBS    *GIBSCBS `xml:"gIBSCBS,omitempty"`
+}
+
+type GIBSCBS struct {
+	VBC     float64 `xml:"vBC"`
+	GIBSUF  GIBSUF  `xml:"gIBSUF"`
+	GIBSMun GIBSMun `xml:"gIBSMun"`
+	VIBS    float64 `xml:"vIBS"`
+	GCBS    GCBS    `xml:"gCBS"`
+}
+
+type GIBSUF struct {
+	PIBSUF float64 `xml:"pIBSUF"`
+	GRed   *GRed   `xml:"gRed,omitempty"`
+	VIBSUF float64 `xml:"vIBSUF"`
+}
+
+type GIBSMun struct {
+	PIBSMun float64 `xml:"pIBSMun"`
+	GRed    *GRed   `xml:"gRed,omitempty"`
+	VIBSMun float64 `xml:"vIBSMun"`
+}
+
+type GCBS struct {
+	PCBS float64 `xml:"pCBS"`
+	GRed *GRed   `xml:"gRed,omitempty"`
+	VCBS float64 `xml:"vCBS"`
+}
+
+// Redução de alíquota do IBS/CBS
+type GRed struct {
+	PRedAliq  float64 `xml:"pRedAliq"`
+	PAliqEfet float64 `xml:"pAliqEfet"`
+}
+
+// Produto do item, na ordem do leiaute
 type Prod struct {
-	CProd    string  `xml:"cProd"`
-	XProd    string  `xml:"xProd"`
-	CEAN     string  `xml:"cEAN"`
-	CEANTrib string  `xml:"cEANTrib"`
-	NCM      string  `xml:"NCM"`
-	CFOP     string  `xml:"CFOP"`
-	UCom     string  `xml:"uCom"`
-	QCom     float64 `xml:"qCom"`
-	VUnCom   float64 `xml:"vUnCom"`
-	VProd    float64 `xml:"vProd"`
-	UTrib    string  `xml:"uTrib"`
-	QTrib    float64 `xml:"qTrib"`
-	VUnTrib  float64 `xml:"vUnTrib"`
-	IndTot   string  `xml:"indTot"`
+	CProd     string   `xml:"cProd"`
+	CEAN      string   `xml:"cEAN"`
+	XProd     string   `xml:"xProd"`
+	NCM       string   `xml:"NCM"`
+	CEST      string   `xml:"CEST,omitempty"`
+	IndEscala string   `xml:"indEscala,omitempty"`
+	CNPJFab   string   `xml:"CNPJFab,omitempty"`
+	CBenef    string   `xml:"cBenef,omitempty"`
+	CFOP      string   `xml:"CFOP"`
+	UCom      string   `xml:"uCom"`
+	QCom      float64  `xml:"qCom"`
+	VUnCom    float64  `xml:"vUnCom"`
+	VProd     float64  `xml:"vProd"`
+	CEANTrib  string   `xml:"cEANTrib"`
+	UTrib     string   `xml:"uTrib"`
+	QTrib     float64  `xml:"qTrib"`
+	VUnTrib   float64  `xml:"vUnTrib"`
+	VFrete    float64  `xml:"vFrete,omitempty"`
+	VSeg      float64  `xml:"vSeg,omitempty"`
+	VDesc     float64  `xml:"vDesc,omitempty"`
+	VOutro    float64  `xml:"vOutro,omitempty"`
+	IndTot    string   `xml:"indTot"`
+	DI        []DI     `xml:"DI,omitempty"`
+	XPed      string   `xml:"xPed,omitempty"`
+	NItemPed  string   `xml:"nItemPed,omitempty"`
+	Rastro    []Rastro `xml:"rastro,omitempty"`
+	Med       *Med     `xml:"med,omitempty"`
+}
+
+// Declaração de importação
+type DI struct {
+	NDI          string  `xml:"nDI"`
+	DDI          string  `xml:"dDI"`
+	XLocDesemb   string  `xml:"xLocDesemb"`
+	UFDesemb     string  `xml:"UFDesemb"`
+	DDesemb      string  `xml:"dDesemb"`
+	TpViaTransp  string  `xml:"tpViaTransp"`
+	VAFRMM       float64 `xml:"vAFRMM,omitempty"`
+	TpIntermedio string  `xml:"tpIntermedio"`
+	CNPJ         string  `xml:"CNPJ,omitempty"`
+	UFTerceiro   string  `xml:"UFTerceiro,omitempty"`
+	CExportador  string  `xml:"cExportador"`
+	Adi          []Adi   `xml:"adi"`
+}
+
+// Adição da declaração de importação
+type Adi struct {
+	NAdicao     string  `xml:"nAdicao,omitempty"`
+	NSeqAdic    string  `xml:"nSeqAdic"`
+	CFabricante string  `xml:"cFabricante"`
+	VDescDI     float64 `xml:"vDescDI,omitempty"`
+	NDraw       string  `xml:"nDraw,omitempty"`
+}
+
+// Rastreabilidade do produto (lote, fabricação e validade)
+type Rastro struct {
+	NLote  string  `xml:"nLote"`
+	QLote  float64 `xml:"qLote"`
+	DFab   string  `xml:"dFab"`
+	DVal   string  `xml:"dVal"`
+	CAgreg string  `xml:"cAgreg,omitempty"`
+}
+
+// Medicamento
+type Med struct {
+	CProdANVISA    string  `xml:"cProdANVISA"`
+	XMotivoIsencao string  `xml:"xMotivoIsencao,omitempty"`
+	VPMC           float64 `xml:"vPMC"`
 }
 
 type Total struct {
-	XMLName xml.Name `xml:"total"`
-	ICMSTot ICMSTot  `xml:"ICMSTot"`
+	XMLName   xml.Name   `xml:"total"`
+	ICMSTot   ICMSTot    `xml:"ICMSTot"`
+	ISSQNtot  *ISSQNtot  `xml:"ISSQNtot,omitempty"`
+	ISTot     *ISTot     `xml:"ISTot,omitempty"`
+	IBSCBSTot *IBSCBSTot `xml:"IBSCBSTot,omitempty"`
+	VNFTot    float64    `xml:"vNFTot,omitempty"`
+}
+
+// Totais dos itens de serviço (ISSQN)
+type ISSQNtot struct {
+	VServ       float64 `xml:"vServ,omitempty"`
+	VBC         float64 `xml:"vBC,omitempty"`
+	VISS        float64 `xml:"vISS,omitempty"`
+	VPIS        float64 `xml:"vPIS,omitempty"`
+	VCOFINS     float64 `xml:"vCOFINS,omitempty"`
+	DCompet     string  `xml:"dCompet"`
+	VDeducao    float64 `xml:"vDeducao,omitempty"`
+	VOutro      float64 `xml:"vOutro,omitempty"`
+	VDescIncond float64 `xml:"vDescIncond,omitempty"`
+	VDescCond   float64 `xml:"vDescCond,omitempty"`
+	VISSRet     float64 `xml:"vISSRet,omitempty"`
+	CRegTrib    string  `xml:"cRegTrib,omitempty"`
+}
+
+type ISTot struct {
+	VIS float64 `xml:"vIS"`
+}
+
+type IBSCBSTot struct {
+	VBCIBSCBS float64 `xml:"vBCIBSCBS"`
+	GIBS      GIBSTot `xml:"gIBS"`
+	GCBS      GCBSTot `xml:"gCBS"`
+}
+
+type GIBSTot struct {
+	GIBSUF           GIBSUFTot  `xml:"gIBSUF"`
+	GIBSMun          GIBSMunTot `xml:"gIBSMun"`
+	VIBS             float64    `xml:"vIBS"`
+	VCredPres        float64    `xml:"vCredPres"`
+	VCredPresCondSus float64    `xml:"vCredPresCondSus"`
+}
+
+type GIBSUFTot struct {
+	VDif     float64 `xml:"vDif"`
+	VDevTrib float64 `xml:"vDevTrib"`
+	VIBSUF   float64 `xml:"vIBSUF"`
+}
+
+type GIBSMunTot struct {
+	VDif     float64 `xml:"vDif"`
+	VDevTrib float64 `xml:"vDevTrib"`
+	VIBSMun  float64 `xml:"vIBSMun"`
 }
 
+type GCBSTot struct {
+	VDif             float64 `xml:"vDif"`
+	VDevTrib         float64 `xml:"vDevTrib"`
+	VCBS             float64 `xml:"vCBS"`
+	VCredPres        float64 `xml:"vCredPres"`
+	VCredPresCondSus float64 `xml:"vCredPresCondSus"`
+}
+
+// Totais do ICMS e dos demais tributos da nota. Os valores são float64 (eram string até a
+// inclusão do NFeBuilder, que os calcula) e são escritos com 2 casas decimais
 type ICMSTot struct {
-	XMLName    xml.Name `xml:"ICMSTot"`
-	VBC        string   `xml:"vBC"`
-	VICMS      string   `xml:"vICMS"`
-	VICMSDeson string   `xml:"vICMSDeson,omitempty"`
-	VFCP       string   `xml:"vFCP,omitempty"`
-	VBSCST     string   `xml:"vBCST,omitempty"`
-	VST        string   `xml:"vST,omitempty"`
-	VFCPST     string   `xml:"vFCPST,omitempty"`
-	VFCPSTRet  string   `xml:"vFCPSTRet,omitempty"`
-	VProd      string   `xml:"vProd"`
-	VFrete     string   `xml:"vFrete,omitempty"`
-	VSeg       string   `xml:"vSeg,omitempty"`
-	VDesc      string   `xml:"vDesc,omitempty"`
-	VII        string   `xml:"vII,omitempty"`
-	VIPI       string   `xml:"vIPI,omitempty"`
-	VIPIDevol  string   `xml:"vIPIDevol,omitempty"`
-	VPIS       string   `xml:"vPIS,omitempty"`
-	VCOFINS    string   `xml:"vCOFINS,omitempty"`
-	VOutro     string   `xml:"vOutro,omitempty"`
-	VNF        string   `xml:"vNF"`
-	VTotTrib   string   `xml:"vTotTrib,omitempty"`
+	XMLName      xml.Name `xml:"ICMSTot"`
+	VBC          float64  `xml:"vBC"`
+	VICMS        float64  `xml:"vICMS"`
+	VICMSDeson   float64  `xml:"vICMSDeson,omitempty"`
+	VFCPUFDest   float64  `xml:"vFCPUFDest,omitempty"`
+	VICMSUFDest  float64  `xml:"vICMSUFDest,omitempty"`
+	VICMSUFRemet float64  `xml:"vICMSUFRemet,omitempty"`
+	VFCP         float64  `xml:"vFCP,omitempty"`
+	VBSCST       float64  `xml:"vBCST,omitempty"` // vBCST, com o nome de campo original mantido por compatibilidade
+	VST          float64  `xml:"vST,omitempty"`
+	VFCPST       float64  `xml:"vFCPST,omitempty"`
+	VFCPSTRet    float64  `xml:"vFCPSTRet,omitempty"`
+	VProd        float64  `xml:"vProd"`
+	VFrete       float64  `xml:"vFrete,omitempty"`
+	VSeg         float64  `xml:"vSeg,omitempty"`
+	VDesc        float64  `xml:"vDesc,omitempty"`
+	VII          float64  `xml:"vII,omitempty"`
+	VIPI         float64  `xml:"vIPI,omitempty"`
+	VIPIDevol    float64  `xml:"vIPIDevol,omitempty"`
+	VPIS         float64  `xml:"vPIS,omitempty"`
+	VCOFINS      float64  `xml:"vCOFINS,omitempty"`
+	VOutro       float64  `xml:"vOutro,omitempty"`
+	VNF          float64  `xml:"vNF"`
+	VTotTrib     float64  `xml:"vTotTrib,omitempty"`
 }
 
 type InfNFe struct {
-	XMLName xml.Name `xml:"infNFe"`
-	Id      string   `xml:"Id,attr"`
-	Versao  string   `xml:"versao,attr"`
-	Ide     Ide      `xml:"ide"`
-	Emit    Emit     `xml:"emit"`
-	Dest    Dest     `xml:"dest"`
-	Det     []Det    `xml:"det"`
-	Total   Total    `xml:"total"`
+	XMLName     xml.Name     `xml:"infNFe"`
+	Id          string       `xml:"Id,attr"`
+	Versao      string       `xml:"versao,attr"`
+	Ide         Ide          `xml:"ide"`
+	Emit        Emit         `xml:"emit"`
+	Dest        Dest         `xml:"dest"`
+	Retirada    *Local       `xml:"retirada,omitempty"`
+	Entrega     *Local       `xml:"entrega,omitempty"`
+	AutXML      []AutXML     `xml:"autXML,omitempty"`
+	Det         []Det        `xml:"det"`
+	Total       Total        `xml:"total"`
+	Transp      *Transp      `xml:"transp,omitempty"`
+	Cobr        *Cobr        `xml:"cobr,omitempty"`
+	Pag         *Pag         `xml:"pag,omitempty"`
+	InfIntermed *InfIntermed `xml:"infIntermed,omitempty"`
+	InfAdic     *InfAdic     `xml:"infAdic,omitempty"`
+	Exporta     *Exporta     `xml:"exporta,omitempty"`
+	Compra      *Compra      `xml:"compra,omitempty"`
+	InfRespTec  *InfRespTec  `xml:"infRespTec,omitempty"`
 }
 
 type NFe struct {
-	XMLName xml.Name `xml:"NFe"`
-	Xmlns   string   `xml:"xmlns,attr"`
-	InfNFe  InfNFe   `xml:"infNFe"`
+	XMLName    xml.Name    `xml:"NFe"`
+	Xmlns      string      `xml:"xmlns,attr"`
+	InfNFe     InfNFe      `xml:"infNFe"`
+	InfNFeSupl *InfNFeSupl `xml:"infNFeSupl,omitempty"` // Somente na NFC-e
+	Signature  *Signature  `xml:"Signature,omitempty"`
+}
+
+// Assinatura digital XMLDSig do documento
+type Signature struct {
+	XMLName    xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	SignedInfo struct {
+		Reference struct {
+			URI         string `xml:"URI,attr"`
+			DigestValue string `xml:"DigestValue"`
+		} `xml:"Reference"`
+	} `xml:"SignedInfo"`
+	SignatureValue  string `xml:"SignatureValue"`
+	X509Certificate string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
+
+// NFe autorizada com o protocolo de autorização da SEFAZ
+type NFeProc struct {
+	XMLName xml.Name `xml:"nfeProc"`
+	Versao  string   `xml:"versao,attr"`
+	NFe     NFe      `xml:"NFe"`
+	ProtNFe ProtNFe  `xml:"protNFe"`
+}
+
+type ProtNFe struct {
+	XMLName xml.Name `xml:"protNFe"`
+	Versao  string   `xml:"versao,attr"`
+	InfProt InfProt  `xml:"infProt"`
+}
+
+// Retorno do envio do lote (enviNFe). No modo síncrono traz o protNFe, no assíncrono o recibo
+type RetEnviNFe struct {
+	XMLName  xml.Name `xml:"retEnviNFe"`
+	Versao   string   `xml:"versao,attr"`
+	TpAmb    string   `xml:"tpAmb"`
+	VerAplic string   `xml:"verAplic"`
+	CStat    string   `xml:"cStat"`
+	XMotivo  string   `xml:"xMotivo"`
+	CUF      string   `xml:"cUF"`
+	DhRecbto string   `xml:"dhRecbto"`
+	InfRec   *InfRec  `xml:"infRec,omitempty"`
+	ProtNFe  *ProtNFe `xml:"protNFe,omitempty"`
+}
+
+type InfRec struct {
+	NRec string `xml:"nRec"`
+	TMed string `xml:"tMed"`
+}
+
+// Retorno da consulta do recibo do lote (consReciNFe)
+type RetConsReciNFe struct {
+	XMLName  xml.Name  `xml:"retConsReciNFe"`
+	Versao   string    `xml:"versao,attr"`
+	TpAmb    string    `xml:"tpAmb"`
+	VerAplic string    `xml:"verAplic"`
+	NRec     string    `xml:"nRec"`
+	CStat    string    `xml:"cStat"`
+	XMotivo  string    `xml:"xMotivo"`
+	CUF      string    `xml:"cUF"`
+	DhRecbto string    `xml:"dhRecbto"`
+	ProtNFe  []ProtNFe `xml:"protNFe"`
+}
+
+// Retorno da consulta do status do serviço (consStatServ)
+type RetConsStatServ struct {
+	XMLName   xml.Name `xml:"retConsStatServ"`
+	Versao    string   `xml:"versao,attr"`
+	TpAmb     string   `xml:"tpAmb"`
+	VerAplic  string   `xml:"verAplic"`
+	CStat     string   `xml:"cStat"`
+	XMotivo   string   `xml:"xMotivo"`
+	CUF       string   `xml:"cUF"`
+	DhRecbto  string   `xml:"dhRecbto"`
+	TMed      string   `xml:"tMed,omitempty"`
+	DhRetorno string   `xml:"dhRetorno,omitempty"`
+	XObs      string   `xml:"xObs,omitempty"`
+}
+
+type InfProt struct {
+	XMLName  xml.Name `xml:"infProt"`
+	Id       string   `xml:"Id,attr,omitempty"`
+	TpAmb    string   `xml:"tpAmb"`
+	VerAplic string   `xml:"verAplic"`
+	ChNFe    string   `xml:"chNFe"`
+	DhRecbto string   `xml:"dhRecbto"`
+	NProt    string   `xml:"nProt,omitempty"`
+	DigVal   string   `xml:"digVal,omitempty"`
+	CStat    string   `xml:"cStat"`
+	XMotivo  string   `xml:"xMotivo"`
 }
 
 type AutXML struct {
@@ -152,13 +644,15 @@ type Transp struct {
 	XMLName    xml.Name   `xml:"transp"`
 	ModFrete   string     `xml:"modFrete"`
 	Transporta Transporta `xml:"transporta"`
-	Vol        Vol        `xml:"vol"`
+	Vol        []Vol      `xml:"vol"`
 }
 
 type Transporta struct {
 	XMLName xml.Name `xml:"transporta"`
 	CNPJ    string   `xml:"CNPJ"`
+	CPF     string   `xml:"CPF,omitempty"`
 	XNome   string   `xml:"xNome"`
+	IE      string   `xml:"IE,omitempty"`
 	XEnder  string   `xml:"xEnder"`
 	XMun    string   `xml:"xMun"`
 	UF      string   `xml:"UF"`
@@ -195,7 +689,8 @@ type Dup struct {
 
 type Pag struct {
 	XMLName xml.Name `xml:"pag"`
-	DetPag  DetPag   `xml:"detPag"`
+	DetPag  []DetPag `xml:"detPag"`
+	VTroco  string   `xml:"vTroco,omitempty"`
 }
 
 type DetPag struct {
@@ -205,9 +700,58 @@ type DetPag struct {
 	VPag    string   `xml:"vPag"`
 }
 
+// Intermediador da transação (vendas em marketplace)
+type InfIntermed struct {
+	XMLName      xml.Name `xml:"infIntermed"`
+	CNPJ         string   `xml:"CNPJ"`
+	IdCadIntTran string   `xml:"idCadIntTran"`
+}
+
 type InfAdic struct {
-	XMLName xml.Name `xml:"infAdic"`
-	InfCpl  string   `xml:"infCpl"`
+	XMLName    xml.Name   `xml:"infAdic"`
+	InfAdFisco string     `xml:"infAdFisco,omitempty"`
+	InfCpl     string     `xml:"infCpl"`
+	ObsCont    []ObsCont  `xml:"obsCont,omitempty"`
+	ObsFisco   []ObsFisco `xml:"obsFisco,omitempty"`
+	ProcRef    []ProcRef  `xml:"procRef,omitempty"`
+}
+
+// Observações de interesse do contribuinte (máximo 10)
+type ObsCont struct {
+	XMLName xml.Name `xml:"obsCont"`
+	XCampo  string   `xml:"xCampo,attr"`
+	XTexto  string   `xml:"xTexto"`
+}
+
+// Observações de interesse do fisco (máximo 10)
+type ObsFisco struct {
+	XMLName xml.Name `xml:"obsFisco"`
+	XCampo  string   `xml:"xCampo,attr"`
+	XTexto  string   `xml:"xTexto"`
+}
+
+// Processo referenciado (máximo 100)
+type ProcRef struct {
+	XMLName xml.Name `xml:"procRef"`
+	NProc   string   `xml:"nProc"`
+	IndProc string   `xml:"indProc"`
+	TpAto   string   `xml:"tpAto,omitempty"`
+}
+
+// Exportação: UF e local de embarque ou de transposição de fronteira
+type Exporta struct {
+	XMLName      xml.Name `xml:"exporta"`
+	UFSaidaPais  string   `xml:"UFSaidaPais"`
+	XLocExporta  string   `xml:"xLocExporta"`
+	XLocDespacho string   `xml:"xLocDespacho,omitempty"`
+}
+
+// Informações de compras públicas: nota de empenho, pedido e contrato
+type Compra struct {
+	XMLName xml.Name `xml:"compra"`
+	XNEmp   string   `xml:"xNEmp,omitempty"`
+	XPed    string   `xml:"xPed,omitempty"`
+	XCont   string   `xml:"xCont,omitempty"`
 }
 
 type InfRespTec struct {
@@ -216,17 +760,59 @@ type InfRespTec struct {
 	XContato string   `xml:"xContato"`
 	Email    string   `xml:"email"`
 	Fone     string   `xml:"fone"`
+	IdCSRT   string   `xml:"idCSRT,omitempty"`
+	HashCSRT string   `xml:"hashCSRT,omitempty"`
+}
+
+// Código de Segurança do Responsável Técnico fornecido pela UF
+type CSRT struct {
+	ID    string // Identificador do CSRT (idCSRT)
+	Token string // Código CSRT
+}
+
+// GerarHashCSRT calcula o hashCSRT: Base64 do SHA-1 do CSRT concatenado com a chave de acesso
+func GerarHashCSRT(csrt string, chaveAcesso string) string {
+	hash := sha1.Sum([]byte(csrt + chaveAcesso))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// AplicarCSRT preenche idCSRT e hashCSRT do responsável técnico para a chave informada
+func (c CSRT) AplicarCSRT(infRespTec InfRespTec, chaveAcesso string) (InfRespTec, error) {
+	if c.ID == "" || c.Token == "" {
+		return infRespTec, fmt.Errorf("CSRT não configurado")
+	}
+	if len(chaveAcesso) != 44 {
+		return infRespTec, fmt.Errorf("a chave de acesso deve ter 44 caracteres para o cálculo do hashCSRT")
+	}
+	infRespTec.IdCSRT = c.ID
+	infRespTec.HashCSRT = GerarHashCSRT(c.Token, chaveAcesso)
+	return infRespTec, nil
+}
+
+// AplicarCSRTUF preenche idCSRT e hashCSRT com o CSRT configurado (por sigla da UF) para a
+// UF da nota, que é a do cUF da chave de acesso. Sem CSRT para a UF, infRespTec volta inalterado
+func AplicarCSRTUF(csrts map[string]CSRT, infRespTec InfRespTec, chaveAcesso string) (InfRespTec, error) {
+	if len(csrts) == 0 {
+		return infRespTec, nil
+	}
+	if len(chaveAcesso) != 44 {
+		return infRespTec, fmt.Errorf("a chave de acesso deve ter 44 caracteres para o cálculo do hashCSRT")
+	}
+	csrt, ok := csrts[SiglaUF(chaveAcesso[:2])]
+	if !ok {
+		return infRespTec, nil
+	}
+	return csrt.AplicarCSRT(infRespTec, chaveAcesso)
 }
 
 // Função para gerar a chave de acesso da NFe
 func GerarChaveAcesso(ide Ide, emit Emit, nNF string, tpEmis string) (string, error) {
-	// Validar e formatar a data de emissão
-	// Data no formato AAAAMM (ano e mês)
-	anoMes, err := time.Parse("2006-01-02", ide.DhEmi[:10])
+	// Validar a data de emissão: o AAMM é o da data local do emitente
+	dhEmi, err := ParseDataHora(ide.DhEmi)
 	if err != nil {
 		return "", fmt.Errorf("data de emissão inválida: %v", err)
 	}
-	anoMesFormatado := anoMes.Format("200601")
+	anoMesFormatado := dhEmi.AAMM()
 	// Código aleatório de 8 dígitos (cNF)
 	cNF := ide.CNF
 	if len(cNF) != 8 {
@@ -234,16 +820,16 @@ func GerarChaveAcesso(ide Ide, emit Emit, nNF string, tpEmis string) (string, er
 	}
 	// Montar a chave de acesso sem o dígito verificador
 	chaveSemDV := fmt.Sprintf(
-		"%02s%s%s%s%02s%03s%09s%08s%s",
-		ide.CUF,         // Código da UF
-		anoMesFormatado, // Ano e mês (AAAAMM)
-		emit.CNPJ,       // CNPJ do emitente
-		ide.Mod,         // Modelo (55 ou 65)
-		ide.Serie,       // Série da nota
-		nNF,             // Número da nota fiscal
-		tpEmis,          // Tipo de emissão
-		cNF,             // Código numérico
-		"0",             // Placeholder para o dígito verificador
+		"%02s%s%s%02s%03s%09s%s%08s%s",
+		ide.CUF,              // Código da UF
+		anoMesFormatado,      // Ano e mês (AAMM)
+		documentoChave(emit), // CNPJ (ou CPF) do emitente
+		ide.Mod,              // Modelo (55 ou 65)
+		ide.Serie,            // Série da nota
+		nNF,                  // Número da nota fiscal
+		tpEmis,               // Tipo de emissão
+		cNF,                  // Código numérico
+		"0",                  // Placeholder para o dígito verificador
 	)
 	// Calcular o dígito verificador (DV) da chave
 	dv, err := calcularDV(chaveSemDV[:43])
@@ -255,19 +841,23 @@ func GerarChaveAcesso(ide Ide, emit Emit, nNF string, tpEmis string) (string, er
 	return chaveAcesso, nil
 }
 
-// Função para calcular o Dígito Verificador (DV) da chave de acesso
+// Função para calcular o Dígito Verificador (DV) da chave de acesso: módulo 11 com os
+// pesos de 2 a 9 aplicados a partir do último dígito, recomeçando em 2 após o 9. Com o
+// CNPJ alfanumérico, cada caractere vale o seu código ASCII menos 48 ('0' = 0, 'A' = 17)
 func calcularDV(chave string) (int, error) {
 	if len(chave) != 43 {
 		return 0, fmt.Errorf("a chave de acesso deve ter exatamente 43 caracteres")
 	}
-	pesos := []int{4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
-	total := 0
-	for i, r := range chave {
-		valor, err := strconv.Atoi(string(r))
-		if err != nil {
-			return 0, fmt.Errorf("erro ao converter caractere para número: %v", err)
+	total, peso := 0, 2
+	for i := len(chave) - 1; i >= 0; i-- {
+		valor, ok := valorCaractere(rune(chave[i]))
+		if !ok {
+			return 0, fmt.Errorf("caractere inválido na chave de acesso: %q", chave[i])
+		}
+		total += valor * peso
+		if peso++; peso > 9 {
+			peso = 2
 		}
-		total += valor * pesos[i%len(pesos)]
 	}
 	resto := total % 11
 	if resto == 0 || resto == 1 {
@@ -0,0 +1,49 @@
+package services
+
+import "testing"
+
+func TestAplicarCSRTUF(t *testing.T) {
+	csrts := map[string]CSRT{
+		"PR": {ID: "01", Token: "TOKEN-PR"},
+		"SP": {ID: "02", Token: "TOKEN-SP"},
+	}
+	respTec := InfRespTec{CNPJ: "33333333000191", XContato: "SUPORTE"}
+	casos := []struct {
+		nome, chave, idCSRT string
+	}{
+		{"UF da chave", "41261012345678000199550010000001231000000019", "01"},
+		{"outra UF", "35261012345678000199550010000001231000000011", "02"},
+		{"UF sem CSRT", "42261012345678000199550010000001231000000016", ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			resultado, err := AplicarCSRTUF(csrts, respTec, c.chave)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resultado.IdCSRT != c.idCSRT {
+				t.Fatalf("idCSRT = %q, esperado %q", resultado.IdCSRT, c.idCSRT)
+			}
+			if c.idCSRT != "" && resultado.HashCSRT != GerarHashCSRT(csrts[SiglaUF(c.chave[:2])].Token, c.chave) {
+				t.Fatalf("hashCSRT calculado com o CSRT de outra UF")
+			}
+			if c.idCSRT == "" && resultado != respTec {
+				t.Fatalf("infRespTec alterado sem CSRT para a UF: %+v", resultado)
+			}
+		})
+	}
+	if _, err := AplicarCSRTUF(csrts, respTec, "4126"); err == nil {
+		t.Fatal("esperado erro para chave incompleta")
+	}
+}
+
+func TestICMSTotVBCST(t *testing.T) {
+	nfe, err := ParseNFe([]byte(`<NFe xmlns="http://www.portalfiscal.inf.br/nfe"><infNFe Id="NFe1" versao="4.00">` +
+		`<total><ICMSTot><vBC>0.00</vBC><vBCST>150.25</vBCST><vNF>10.00</vNF></ICMSTot></total></infNFe></NFe>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nfe.InfNFe.Total.ICMSTot.VBSCST != 150.25 {
+		t.Fatalf("vBCST lido em VBSCST = %v", nfe.InfNFe.Total.ICMSTot.VBSCST)
+	}
+}
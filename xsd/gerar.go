@@ -0,0 +1,589 @@
+package xsd
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Opções da geração de tipos Go a partir do schema
+type OpcoesGeracao struct {
+	Pacote    string // Nome do pacote Go gerado
+	Namespace string // Namespace principal; elementos de outros namespaces levam o namespace na tag
+	Origem    string // Arquivo de origem informado no cabeçalho do código gerado
+}
+
+// GerarGo escreve structs Go para os tipos e elementos globais do schema, com os
+// campos na ordem das sequências, enumerações como constantes tipadas, funções de
+// formatação para os tipos decimais e os grupos xs:choice como campos opcionais
+func (s *Schema) GerarGo(w io.Writer, opcoes OpcoesGeracao) error {
+	if opcoes.Pacote == "" {
+		return fmt.Errorf("nome do pacote não informado")
+	}
+	g := &gerador{
+		schema:  s,
+		opcoes:  opcoes,
+		usados:  map[string]bool{},
+		simples: map[*no]string{},
+		complex: map[*no]string{},
+	}
+	g.registrarGlobais()
+
+	for _, nome := range chavesOrdenadas(s.tiposSimples) {
+		g.tipoSimples(g.simples[s.tiposSimples[nome]], s.tiposSimples[nome], nome)
+	}
+	for _, nome := range chavesOrdenadas(s.tiposComplexo) {
+		g.tipoComplexo(g.complex[s.tiposComplexo[nome]], s.tiposComplexo[nome], nome)
+	}
+	for _, nome := range chavesOrdenadas(s.elementos) {
+		g.elementoGlobal(s.elementos[nome])
+	}
+	// Tipos anônimos encontrados durante a geração
+	for len(g.pendentes) > 0 {
+		p := g.pendentes[0]
+		g.pendentes = g.pendentes[1:]
+		if p.decl.nome == "simpleType" {
+			g.tipoSimples(p.nome, p.decl, p.origem)
+		} else {
+			g.tipoComplexo(p.nome, p.decl, p.origem)
+		}
+	}
+
+	cabecalho := &bytes.Buffer{}
+	fmt.Fprintf(cabecalho, "// Code generated by nfe-xsdgen DO NOT EDIT.\n")
+	if opcoes.Origem != "" {
+		fmt.Fprintf(cabecalho, "// Origem: %s\n", opcoes.Origem)
+	}
+	fmt.Fprintf(cabecalho, "\npackage %s\n\nimport (\n\t\"encoding/xml\"\n", opcoes.Pacote)
+	if g.usaStrconv {
+		fmt.Fprintf(cabecalho, "\t\"strconv\"\n")
+	}
+	fmt.Fprintf(cabecalho, ")\n\n// against \"unused imports\"\nvar _ xml.Name\n\n")
+	cabecalho.Write(g.saida.Bytes())
+
+	codigo, err := format.Source(cabecalho.Bytes())
+	if err != nil {
+		return fmt.Errorf("erro ao formatar o código gerado: %v", err)
+	}
+	_, err = w.Write(codigo)
+	return err
+}
+
+type gerador struct {
+	schema     *Schema
+	opcoes     OpcoesGeracao
+	saida      bytes.Buffer
+	usados     map[string]bool // nomes Go já atribuídos
+	simples    map[*no]string  // tipo simples -> nome Go
+	complex    map[*no]string  // tipo complexo -> nome Go
+	pendentes  []pendente
+	usaStrconv bool
+}
+
+// Tipo anônimo aguardando geração
+type pendente struct {
+	nome   string
+	decl   *no
+	origem string // caminho do elemento no schema, usado no comentário
+}
+
+// Campo de uma struct gerada
+type campo struct {
+	nome       string
+	tipo       string
+	tag        string
+	comentario string
+}
+
+func chavesOrdenadas(m map[string]*no) []string {
+	chaves := make([]string, 0, len(m))
+	for chave := range m {
+		chaves = append(chaves, chave)
+	}
+	sort.Strings(chaves)
+	return chaves
+}
+
+// Os nomes dos tipos globais são reservados antes dos tipos anônimos
+func (g *gerador) registrarGlobais() {
+	for _, nome := range chavesOrdenadas(g.schema.tiposSimples) {
+		g.simples[g.schema.tiposSimples[nome]] = g.nomeUnico(nomeGo(nome), "")
+	}
+	for _, nome := range chavesOrdenadas(g.schema.tiposComplexo) {
+		g.complex[g.schema.tiposComplexo[nome]] = g.nomeUnico(nomeGo(nome), "")
+	}
+}
+
+func (g *gerador) nomeUnico(base, sufixo string) string {
+	if !g.usados[base] {
+		g.usados[base] = true
+		return base
+	}
+	base += sufixo
+	nome := base
+	for i := 2; g.usados[nome]; i++ {
+		nome = base + strconv.Itoa(i)
+	}
+	g.usados[nome] = true
+	return nome
+}
+
+// Converte um nome do schema em identificador Go exportado: TDec_1302 -> TDec1302, infNFe -> InfNFe
+func nomeGo(nome string) string {
+	nomeGo := juntarPalavras(nome)
+	if nomeGo == "" {
+		return "Valor"
+	}
+	if unicode.IsDigit(rune(nomeGo[0])) {
+		nomeGo = "V" + nomeGo
+	}
+	return nomeGo
+}
+
+// Sufixo da constante de uma enumeração: "AC" -> AC, "4.00" -> 400
+func sufixoConstante(valor string) string {
+	if sufixo := juntarPalavras(valor); sufixo != "" {
+		return sufixo
+	}
+	return "Vazio"
+}
+
+// Remove os caracteres que não podem compor um identificador, iniciando cada palavra em maiúscula
+func juntarPalavras(nome string) string {
+	var b strings.Builder
+	maiuscula := true
+	for _, r := range nome {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			maiuscula = true
+			continue
+		}
+		if maiuscula {
+			r = unicode.ToUpper(r)
+			maiuscula = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Tipo Go correspondente aos tipos embutidos do XML Schema
+func tipoBuiltin(local string) string {
+	switch local {
+	case "boolean":
+		return "bool"
+	case "integer", "int", "long", "short", "byte", "nonNegativeInteger", "positiveInteger",
+		"unsignedInt", "unsignedLong", "unsignedShort", "unsignedByte", "negativeInteger", "nonPositiveInteger":
+		return "int64"
+	}
+	// Os valores decimais da NFe são transmitidos com a formatação exata, por isso ficam como texto
+	return "string"
+}
+
+func (g *gerador) tipoSimples(nome string, st *no, origem string) {
+	base, facetas, enumeracoes := g.restricao(st)
+	casas := casasDecimais(facetas)
+
+	fmt.Fprintf(&g.saida, "// %s corresponde ao tipo simples %s\n", nome, origem)
+	for _, faceta := range facetas {
+		fmt.Fprintf(&g.saida, "//   %s: %s\n", faceta[0], faceta[1])
+	}
+	fmt.Fprintf(&g.saida, "type %s %s\n\n", nome, base)
+
+	if len(enumeracoes) > 0 {
+		fmt.Fprintf(&g.saida, "const (\n")
+		constantes := map[string]bool{}
+		for _, valor := range enumeracoes {
+			constante := nome + sufixoConstante(valor)
+			for i := 2; constantes[constante]; i++ {
+				constante = nome + sufixoConstante(valor) + strconv.Itoa(i)
+			}
+			constantes[constante] = true
+			literal := valor
+			if base == "string" {
+				literal = strconv.Quote(valor)
+			}
+			fmt.Fprintf(&g.saida, "\t%s %s = %s\n", constante, nome, literal)
+		}
+		fmt.Fprintf(&g.saida, ")\n\n")
+	}
+
+	if casas >= 0 && base == "string" {
+		g.usaStrconv = true
+		fmt.Fprintf(&g.saida, "// Novo%s formata o valor com %d casas decimais\n", nome, casas)
+		fmt.Fprintf(&g.saida, "func Novo%s(v float64) %s {\n\treturn %s(strconv.FormatFloat(v, 'f', %d, 64))\n}\n\n", nome, nome, nome, casas)
+		fmt.Fprintf(&g.saida, "// Float64 converte o valor decimal\n")
+		fmt.Fprintf(&g.saida, "func (v %s) Float64() (float64, error) {\n\treturn strconv.ParseFloat(string(v), 64)\n}\n\n", nome)
+	}
+}
+
+// Resolve o tipo Go de base, as facetas e as enumerações de um xs:simpleType
+func (g *gerador) restricao(st *no) (base string, facetas [][2]string, enumeracoes []string) {
+	base = "string"
+	for _, filho := range st.filhos {
+		if filho.nome != "restriction" {
+			// xs:list e xs:union são tratados como texto
+			continue
+		}
+		if b := filho.attr("base"); b != "" {
+			local, builtin := filho.resolverQName(b)
+			if builtin {
+				base = tipoBuiltin(local)
+			} else if pai, ok := g.schema.tiposSimples[local]; ok {
+				base, facetas, _ = g.restricao(pai)
+			}
+		}
+		for _, faceta := range filho.filhos {
+			switch faceta.nome {
+			case "enumeration":
+				enumeracoes = append(enumeracoes, faceta.attr("value"))
+			case "simpleType":
+				base, facetas, enumeracoes = g.restricao(faceta)
+			case "pattern", "length", "minLength", "maxLength", "totalDigits", "fractionDigits",
+				"minInclusive", "maxInclusive", "minExclusive", "maxExclusive", "whiteSpace":
+				facetas = append(facetas, [2]string{faceta.nome, faceta.attr("value")})
+			}
+		}
+	}
+	return base, facetas, enumeracoes
+}
+
+// Casas decimais de um tipo pela faceta fractionDigits ou pelo pattern dos TDec da NFe
+// (ex.: 0|0\.[0-9]{2}|[1-9]{1}[0-9]{0,12}(\.[0-9]{2})?). Retorna -1 se o tipo não é decimal
+var padraoCasas = regexp.MustCompile(`\\\.\[0-9\]\{(\d+)(?:,(\d+))?\}`)
+
+func casasDecimais(facetas [][2]string) int {
+	casas := -1
+	for _, faceta := range facetas {
+		switch faceta[0] {
+		case "fractionDigits":
+			if n, err := strconv.Atoi(faceta[1]); err == nil {
+				return n
+			}
+		case "pattern":
+			for _, m := range padraoCasas.FindAllStringSubmatch(faceta[1], -1) {
+				limite := m[1]
+				if m[2] != "" {
+					limite = m[2]
+				}
+				if n, _ := strconv.Atoi(limite); n > casas {
+					casas = n
+				}
+			}
+		}
+	}
+	return casas
+}
+
+func (g *gerador) tipoComplexo(nome string, ct *no, origem string) {
+	campos := g.camposComplexo(nome, ct)
+	fmt.Fprintf(&g.saida, "// %s corresponde ao tipo complexo %s\n", nome, origem)
+	g.escreverStruct(nome, campos)
+}
+
+func (g *gerador) elementoGlobal(decl *no) {
+	nomeXML := decl.attr("name")
+	nome := g.nomeUnico(nomeGo(nomeXML), "Elemento")
+	tag := nomeXML
+	if decl.alvo != "" {
+		tag = decl.alvo + " " + nomeXML
+	}
+	campos := []campo{{nome: "XMLName", tipo: "xml.Name", tag: tag}}
+
+	if tipo := decl.attr("type"); tipo != "" {
+		local, builtin := decl.resolverQName(tipo)
+		if ct, ok := g.schema.tiposComplexo[local]; ok && !builtin {
+			// Tipo nomeado: os campos são promovidos pela struct embutida
+			campos = append(campos, campo{tipo: g.complex[ct]})
+		} else {
+			campos = append(campos, campo{nome: "Valor", tipo: g.tipoNomeado(decl, local, builtin), tag: ",chardata"})
+		}
+	} else {
+		for _, filho := range decl.filhos {
+			switch filho.nome {
+			case "complexType":
+				campos = append(campos, g.camposComplexo(nome, filho)...)
+			case "simpleType":
+				campos = append(campos, campo{nome: "Valor", tipo: g.tipoAnonimoSimples(nome+"Valor", filho, nomeXML), tag: ",chardata"})
+			}
+		}
+	}
+	fmt.Fprintf(&g.saida, "// %s é o elemento global %s\n", nome, nomeXML)
+	g.escreverStruct(nome, campos)
+}
+
+func (g *gerador) escreverStruct(nome string, campos []campo) {
+	fmt.Fprintf(&g.saida, "type %s struct {\n", nome)
+	for i, c := range campos {
+		if c.comentario != "" {
+			if i > 0 {
+				fmt.Fprintf(&g.saida, "\n")
+			}
+			fmt.Fprintf(&g.saida, "\t// %s\n", c.comentario)
+		}
+		switch {
+		case c.nome == "":
+			fmt.Fprintf(&g.saida, "\t%s\n", c.tipo)
+		default:
+			fmt.Fprintf(&g.saida, "\t%s %s `xml:%q`\n", c.nome, c.tipo, c.tag)
+		}
+	}
+	fmt.Fprintf(&g.saida, "}\n\n")
+}
+
+// Contexto de uma partícula: opcional dentro de choice ou de grupo com minOccurs 0,
+// repetida dentro de grupo com maxOccurs maior que 1
+type contexto struct {
+	opcional bool
+	repetido bool
+}
+
+// Lista os campos de um xs:complexType na ordem do schema
+func (g *gerador) camposComplexo(nome string, ct *no) []campo {
+	var campos []campo
+	for _, filho := range ct.filhos {
+		switch filho.nome {
+		case "sequence", "choice", "all", "group":
+			campos = g.camposParticula(nome, filho, contexto{}, campos)
+		case "attribute", "attributeGroup":
+			campos = g.camposAtributo(nome, filho, campos)
+		case "simpleContent", "complexContent":
+			for _, derivacao := range filho.filhos {
+				if derivacao.nome != "extension" && derivacao.nome != "restriction" {
+					continue
+				}
+				local, builtin := derivacao.resolverQName(derivacao.attr("base"))
+				if filho.nome == "simpleContent" {
+					campos = append(campos, campo{nome: "Valor", tipo: g.tipoNomeado(derivacao, local, builtin), tag: ",chardata"})
+				} else if base, ok := g.schema.tiposComplexo[local]; ok && derivacao.nome == "extension" {
+					// Na extensão, os campos do tipo base vêm antes dos campos próprios
+					campos = append(campos, g.camposComplexo(nome, base)...)
+				}
+				for _, d := range derivacao.filhos {
+					switch d.nome {
+					case "attribute", "attributeGroup":
+						campos = g.camposAtributo(nome, d, campos)
+					case "sequence", "choice", "all", "group":
+						campos = g.camposParticula(nome, d, contexto{}, campos)
+					}
+				}
+			}
+		}
+	}
+	return campos
+}
+
+func (g *gerador) camposParticula(pai string, p *no, ctx contexto, campos []campo) []campo {
+	min, max := ocorrencias(p)
+	ctx.opcional = ctx.opcional || min == 0
+	switch p.nome {
+	case "element":
+		return g.campoElemento(pai, p, ctx, max, campos)
+	case "any":
+		if !campoComTag(campos, ",innerxml") {
+			campos = append(campos, campo{nome: "Conteudo", tipo: "string", tag: ",innerxml"})
+		}
+		return campos
+	case "group":
+		local, _ := p.resolverQName(p.attr("ref"))
+		grupo, ok := g.schema.grupos[local]
+		if !ok {
+			return campos
+		}
+		ctx.repetido = ctx.repetido || max < 0 || max > 1
+		for _, filho := range grupo.filhos {
+			campos = g.camposParticula(pai, filho, ctx, campos)
+		}
+		return campos
+	}
+	ctx.repetido = ctx.repetido || max < 0 || max > 1
+	inicio := len(campos)
+	if p.nome == "choice" {
+		// Apenas uma das alternativas é informada: todas viram campos opcionais
+		ctx.opcional = true
+	}
+	for _, filho := range p.filhos {
+		campos = g.camposParticula(pai, filho, ctx, campos)
+	}
+	if p.nome == "choice" && len(campos) > inicio {
+		var alternativas []string
+		for _, filho := range p.filhos {
+			alternativas = append(alternativas, descreverParticula(filho))
+		}
+		campos[inicio].comentario = "Escolha: " + strings.Join(alternativas, " | ")
+	}
+	return campos
+}
+
+// Descrição curta de uma alternativa de xs:choice
+func descreverParticula(p *no) string {
+	switch p.nome {
+	case "element":
+		return nomeElemento(p)
+	case "any":
+		return "qualquer elemento"
+	case "group":
+		local, _ := p.resolverQName(p.attr("ref"))
+		return "grupo " + local
+	}
+	var partes []string
+	for _, filho := range p.filhos {
+		partes = append(partes, descreverParticula(filho))
+	}
+	separador := ", "
+	if p.nome == "choice" {
+		separador = " | "
+	}
+	return "(" + strings.Join(partes, separador) + ")"
+}
+
+func campoComNome(campos []campo, nome string) bool {
+	for _, c := range campos {
+		if c.nome == nome {
+			return true
+		}
+	}
+	return false
+}
+
+func campoComTag(campos []campo, tags ...string) bool {
+	for _, c := range campos {
+		for _, tag := range tags {
+			if c.tag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *gerador) campoElemento(pai string, p *no, ctx contexto, max int, campos []campo) []campo {
+	nomeXML := nomeElemento(p)
+	decl := p
+	tag := nomeXML
+	if p.attr("ref") != "" {
+		decl = g.schema.elementos[nomeXML]
+		if decl == nil {
+			return campos
+		}
+		if decl.alvo != "" && decl.alvo != g.opcoes.Namespace {
+			tag = decl.alvo + " " + nomeXML
+		}
+	}
+	// O mesmo elemento em alternativas diferentes de um choice gera um único campo
+	if campoComTag(campos, tag, tag+",omitempty") {
+		return campos
+	}
+
+	nome := nomeGo(nomeXML)
+	for i := 2; campoComNome(campos, nome); i++ {
+		nome = nomeGo(nomeXML) + strconv.Itoa(i)
+	}
+	tipo, estrutura := g.tipoElemento(pai+nomeGo(nomeXML), decl, pai+"/"+nomeXML)
+	switch {
+	case ctx.repetido || max < 0 || max > 1:
+		tipo = "[]" + tipo
+		if ctx.opcional {
+			tag += ",omitempty"
+		}
+	case ctx.opcional && estrutura:
+		tipo = "*" + tipo
+		tag += ",omitempty"
+	case ctx.opcional:
+		tag += ",omitempty"
+	}
+	return append(campos, campo{nome: nome, tipo: tipo, tag: tag})
+}
+
+// Tipo Go de um xs:element e se o tipo é uma struct
+func (g *gerador) tipoElemento(nomeAnonimo string, decl *no, origem string) (string, bool) {
+	if tipo := decl.attr("type"); tipo != "" {
+		local, builtin := decl.resolverQName(tipo)
+		if ct, ok := g.schema.tiposComplexo[local]; ok && !builtin {
+			return g.complex[ct], true
+		}
+		return g.tipoNomeado(decl, local, builtin), false
+	}
+	for _, filho := range decl.filhos {
+		switch filho.nome {
+		case "complexType":
+			nome := g.nomeUnico(nomeAnonimo, "")
+			g.pendentes = append(g.pendentes, pendente{nome: nome, decl: filho, origem: "anônimo de " + origem})
+			return nome, true
+		case "simpleType":
+			return g.tipoAnonimoSimples(nomeAnonimo, filho, origem), false
+		}
+	}
+	return "string", false
+}
+
+// Tipo Go de uma referência a tipo simples (embutido ou nomeado)
+func (g *gerador) tipoNomeado(decl *no, local string, builtin bool) string {
+	if builtin {
+		return tipoBuiltin(local)
+	}
+	if st, ok := g.schema.tiposSimples[local]; ok {
+		return g.simples[st]
+	}
+	return "string"
+}
+
+// Restrições anônimas com enumeração ou casas decimais próprias viram tipos nomeados;
+// as demais usam o tipo de base
+func (g *gerador) tipoAnonimoSimples(nomeAnonimo string, st *no, origem string) string {
+	_, facetas, enumeracoes := g.restricao(st)
+	if len(enumeracoes) == 0 && casasDecimais(facetas) < 0 {
+		for _, filho := range st.filhos {
+			if filho.nome != "restriction" {
+				continue
+			}
+			local, builtin := filho.resolverQName(filho.attr("base"))
+			return g.tipoNomeado(filho, local, builtin)
+		}
+		return "string"
+	}
+	nome := g.nomeUnico(nomeAnonimo, "")
+	g.pendentes = append(g.pendentes, pendente{nome: nome, decl: st, origem: "anônimo de " + origem})
+	return nome
+}
+
+func (g *gerador) camposAtributo(pai string, a *no, campos []campo) []campo {
+	if a.nome == "attributeGroup" {
+		local, _ := a.resolverQName(a.attr("ref"))
+		if grupo, ok := g.schema.grupoAtrib[local]; ok {
+			for _, filho := range grupo.filhos {
+				campos = g.camposAtributo(pai, filho, campos)
+			}
+		}
+		return campos
+	}
+	if a.nome != "attribute" || a.attr("name") == "" {
+		return campos
+	}
+	nomeXML := a.attr("name")
+	tipo := "string"
+	if t := a.attr("type"); t != "" {
+		local, builtin := a.resolverQName(t)
+		tipo = g.tipoNomeado(a, local, builtin)
+	} else {
+		for _, filho := range a.filhos {
+			if filho.nome == "simpleType" {
+				tipo = g.tipoAnonimoSimples(pai+nomeGo(nomeXML), filho, pai+"/@"+nomeXML)
+			}
+		}
+	}
+	tag := nomeXML + ",attr"
+	if a.attr("use") != "required" {
+		tag += ",omitempty"
+	}
+	nome := nomeGo(nomeXML)
+	if campoComNome(campos, nome) {
+		nome += "Atributo"
+	}
+	return append(campos, campo{nome: nome, tipo: tipo, tag: tag})
+}
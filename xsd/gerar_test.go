@@ -0,0 +1,76 @@
+package xsd
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Confere que o código gerado compila, sem depender de um pacote versionado
+func compilarGerado(t *testing.T, pacote string, codigo []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	arquivo, err := parser.ParseFile(fset, pacote+".go", codigo, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check(pacote, fset, []*ast.File{arquivo}, nil); err != nil {
+		t.Fatalf("código gerado não compila: %v", err)
+	}
+}
+
+// xsd/internal/nfereduzida é a saída versionada do gerador para o schema reduzido;
+// após mudanças no gerador, regere com go generate ./xsd/...
+func TestGerarGoReduzido(t *testing.T) {
+	s := carregarReduzido(t)
+	codigo := &bytes.Buffer{}
+	if err := s.GerarGo(codigo, OpcoesGeracao{Pacote: "nfereduzida", Namespace: "http://www.portalfiscal.inf.br/nfe", Origem: "nfe.xsd"}); err != nil {
+		t.Fatal(err)
+	}
+	compilarGerado(t, "nfereduzida", codigo.Bytes())
+
+	versionado, err := os.ReadFile(filepath.Join("internal", "nfereduzida", "nfereduzida.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(codigo.Bytes(), versionado) {
+		t.Fatal("internal/nfereduzida/nfereduzida.go desatualizado, execute go generate ./xsd/...")
+	}
+}
+
+// O pacote leiaute, na raiz do módulo, é a saída versionada do gerador para o pacote de
+// schemas embutido; regere com go generate ./leiaute/... ao trocar os XSDs ou o gerador
+func TestGerarGoPacote(t *testing.T) {
+	pacoteEmbutido(t)
+	s, err := CarregarPacote(PacoteNFe, "nfe_v4.00.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigo := &bytes.Buffer{}
+	opcoes := OpcoesGeracao{Pacote: "leiaute", Namespace: "http://www.portalfiscal.inf.br/nfe", Origem: PacoteNFe + "/nfe_v4.00.xsd"}
+	if err := s.GerarGo(codigo, opcoes); err != nil {
+		t.Fatal(err)
+	}
+	compilarGerado(t, "leiaute", codigo.Bytes())
+
+	versionado, err := os.ReadFile(filepath.Join("..", "leiaute", "leiaute.go"))
+	if err != nil {
+		t.Fatalf("leiaute/leiaute.go ausente, execute go generate ./leiaute/...: %v", err)
+	}
+	if !bytes.Equal(codigo.Bytes(), versionado) {
+		t.Fatal("leiaute/leiaute.go desatualizado, execute go generate ./leiaute/...")
+	}
+}
+
+func TestGerarGoSemPacote(t *testing.T) {
+	if err := carregarReduzido(t).GerarGo(&bytes.Buffer{}, OpcoesGeracao{}); err == nil {
+		t.Fatal("esperado erro sem o nome do pacote")
+	}
+}
@@ -0,0 +1,6 @@
+// Package nfereduzida contém os tipos gerados pelo nfe-xsdgen a partir do schema reduzido
+// de xsd/testdata/nfe_reduzido. O pacote é versionado para que os testes confiram que a
+// saída do gerador compila e lê e escreve notas válidas contra o mesmo schema
+package nfereduzida
+
+//go:generate go run ../../../cmd/nfe-xsdgen -xsd ../../testdata/nfe_reduzido/nfe.xsd -pkg nfereduzida -o nfereduzida.go
@@ -0,0 +1,158 @@
+// Code generated by nfe-xsdgen DO NOT EDIT.
+// Origem: nfe.xsd
+
+package nfereduzida
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// against "unused imports"
+var _ xml.Name
+
+// TCnpj corresponde ao tipo simples TCnpj
+//
+//	whiteSpace: preserve
+//	maxLength: 14
+//	pattern: [0-9A-Z]{12}[0-9]{2}
+type TCnpj string
+
+// TCpf corresponde ao tipo simples TCpf
+//
+//	whiteSpace: preserve
+//	maxLength: 11
+//	pattern: [0-9]{11}
+type TCpf string
+
+// TDec1104v corresponde ao tipo simples TDec_1104v
+//
+//	whiteSpace: preserve
+//	pattern: 0|0\.[0-9]{1,4}|[1-9]{1}[0-9]{0,10}|[1-9]{1}[0-9]{0,10}(\.[0-9]{1,4})?
+type TDec1104v string
+
+// NovoTDec1104v formata o valor com 4 casas decimais
+func NovoTDec1104v(v float64) TDec1104v {
+	return TDec1104v(strconv.FormatFloat(v, 'f', 4, 64))
+}
+
+// Float64 converte o valor decimal
+func (v TDec1104v) Float64() (float64, error) {
+	return strconv.ParseFloat(string(v), 64)
+}
+
+// TDec1302 corresponde ao tipo simples TDec_1302
+//
+//	whiteSpace: preserve
+//	pattern: 0|0\.[0-9]{2}|[1-9]{1}[0-9]{0,12}(\.[0-9]{2})?
+type TDec1302 string
+
+// NovoTDec1302 formata o valor com 2 casas decimais
+func NovoTDec1302(v float64) TDec1302 {
+	return TDec1302(strconv.FormatFloat(v, 'f', 2, 64))
+}
+
+// Float64 converte o valor decimal
+func (v TDec1302) Float64() (float64, error) {
+	return strconv.ParseFloat(string(v), 64)
+}
+
+// TString corresponde ao tipo simples TString
+//
+//	whiteSpace: preserve
+//	pattern: [!-ÿ]{1}[ -ÿ]{0,}[!-ÿ]{1}|[!-ÿ]{1}
+type TString string
+
+// TUf corresponde ao tipo simples TUf
+//
+//	whiteSpace: preserve
+type TUf string
+
+const (
+	TUfPR TUf = "PR"
+	TUfRS TUf = "RS"
+	TUfSC TUf = "SC"
+	TUfSP TUf = "SP"
+	TUfEX TUf = "EX"
+)
+
+// SignatureType corresponde ao tipo complexo SignatureType
+type SignatureType struct {
+	SignedInfo     string `xml:"SignedInfo"`
+	SignatureValue string `xml:"SignatureValue"`
+	KeyInfo        string `xml:"KeyInfo,omitempty"`
+	Id             string `xml:"Id,attr,omitempty"`
+}
+
+// TNFe corresponde ao tipo complexo TNFe
+type TNFe struct {
+	InfNFe    TNFeInfNFe    `xml:"infNFe"`
+	Signature SignatureType `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+}
+
+// NFe é o elemento global NFe
+type NFe struct {
+	XMLName xml.Name `xml:"http://www.portalfiscal.inf.br/nfe NFe"`
+	TNFe
+}
+
+// Signature é o elemento global Signature
+type Signature struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	SignatureType
+}
+
+// TNFeInfNFe corresponde ao tipo complexo anônimo de TNFe/infNFe
+type TNFeInfNFe struct {
+	Ide    TNFeInfNFeIde   `xml:"ide"`
+	Emit   TNFeInfNFeEmit  `xml:"emit"`
+	Det    []TNFeInfNFeDet `xml:"det"`
+	Total  TNFeInfNFeTotal `xml:"total"`
+	Versao string          `xml:"versao,attr"`
+	Id     string          `xml:"Id,attr"`
+}
+
+// TNFeInfNFeIde corresponde ao tipo complexo anônimo de TNFeInfNFe/ide
+type TNFeInfNFeIde struct {
+	CUF   TUf                `xml:"cUF"`
+	NNF   string             `xml:"nNF"`
+	TpAmb TNFeInfNFeIdeTpAmb `xml:"tpAmb"`
+}
+
+// TNFeInfNFeEmit corresponde ao tipo complexo anônimo de TNFeInfNFe/emit
+type TNFeInfNFeEmit struct {
+	// Escolha: CNPJ | CPF
+	CNPJ  TCnpj   `xml:"CNPJ,omitempty"`
+	CPF   TCpf    `xml:"CPF,omitempty"`
+	XNome TString `xml:"xNome"`
+	XFant TString `xml:"xFant,omitempty"`
+}
+
+// TNFeInfNFeDet corresponde ao tipo complexo anônimo de TNFeInfNFe/det
+type TNFeInfNFeDet struct {
+	Prod  TNFeInfNFeDetProd `xml:"prod"`
+	NItem string            `xml:"nItem,attr"`
+}
+
+// TNFeInfNFeTotal corresponde ao tipo complexo anônimo de TNFeInfNFe/total
+type TNFeInfNFeTotal struct {
+	VNF TDec1302 `xml:"vNF"`
+}
+
+// TNFeInfNFeIdeTpAmb corresponde ao tipo simples anônimo de TNFeInfNFeIde/tpAmb
+//
+//	whiteSpace: preserve
+type TNFeInfNFeIdeTpAmb string
+
+const (
+	TNFeInfNFeIdeTpAmb1 TNFeInfNFeIdeTpAmb = "1"
+	TNFeInfNFeIdeTpAmb2 TNFeInfNFeIdeTpAmb = "2"
+)
+
+// TNFeInfNFeDetProd corresponde ao tipo complexo anônimo de TNFeInfNFeDet/prod
+type TNFeInfNFeDetProd struct {
+	CProd TString   `xml:"cProd"`
+	QCom  TDec1104v `xml:"qCom"`
+	VProd TDec1302  `xml:"vProd"`
+	VDesc TDec1302  `xml:"vDesc,omitempty"`
+}
@@ -0,0 +1,46 @@
+package nfereduzida
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eugustavokeller/nfe-go/xsd"
+)
+
+func TestLerEscreverNFe(t *testing.T) {
+	original, err := os.ReadFile(filepath.Join("..", "..", "testdata", "nfe_valida.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nfe NFe
+	if err := xml.Unmarshal(original, &nfe); err != nil {
+		t.Fatal(err)
+	}
+	if nfe.InfNFe.Ide.CUF != TUfPR || nfe.InfNFe.Emit.CNPJ != "44555666000170" || len(nfe.InfNFe.Det) != 2 {
+		t.Fatalf("NFe lida: %+v", nfe.InfNFe)
+	}
+	if v, err := nfe.InfNFe.Det[0].Prod.VProd.Float64(); err != nil || v != 25 {
+		t.Errorf("vProd: %v %v", v, err)
+	}
+
+	nfe.InfNFe.Det[1].Prod.VDesc = NovoTDec1302(0.5)
+	nfe.InfNFe.Total.VNF = NovoTDec1302(33.5)
+	escrito, err := xml.Marshal(nfe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(escrito, []byte("<vProd>10.00</vProd><vDesc>0.50</vDesc>")) {
+		t.Errorf("vDesc fora da sequência do schema:\n%s", escrito)
+	}
+
+	schema, err := xsd.Carregar(os.DirFS(filepath.Join("..", "..", "testdata", "nfe_reduzido")), "nfe.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validar(escrito, xsd.Opcoes{}); err != nil {
+		t.Fatalf("XML escrito pelos tipos gerados é inválido: %v\n%s", err, escrito)
+	}
+}
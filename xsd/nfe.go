@@ -0,0 +1,62 @@
+package xsd
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// Pacote de schemas da NFe embutido. Cada versão do pacote (PL) fica em um
+// subdiretório próprio de schemas/, para que a troca de versão seja explícita
+//
+//go:embed schemas
+var pacotes embed.FS
+
+// Versão do pacote de schemas usada na validação da NFe 4.00
+const PacoteNFe = "PL_009_V4"
+
+// ErrPacoteAusente indica que os arquivos XSD do pacote não foram copiados para
+// xsd/schemas (ver schemas/PL_009_V4/LEIAME.md)
+var ErrPacoteAusente = errors.New("arquivos XSD não embutidos")
+
+var (
+	cacheSchemas = map[string]*Schema{}
+	cacheMutex   sync.Mutex
+)
+
+// CarregarPacote carrega um arquivo XSD do pacote embutido, mantendo o schema em cache
+func CarregarPacote(pacote string, arquivo string) (*Schema, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	chave := path.Join(pacote, arquivo)
+	if s, ok := cacheSchemas[chave]; ok {
+		return s, nil
+	}
+	origem := path.Join("schemas", pacote, arquivo)
+	if _, err := fs.Stat(pacotes, origem); errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("pacote de schemas %s: %w: %s", pacote, ErrPacoteAusente, arquivo)
+	}
+	s, err := Carregar(pacotes, origem)
+	if err != nil {
+		return nil, fmt.Errorf("pacote de schemas %s: %v", pacote, err)
+	}
+	cacheSchemas[chave] = s
+	return s, nil
+}
+
+// ValidarNFe valida o XML da NFe contra o nfe_v4.00.xsd do pacote embutido. Antes da
+// assinatura, a ausência do elemento Signature é desconsiderada
+func ValidarNFe(xmlContent string, assinada bool) error {
+	s, err := CarregarPacote(PacoteNFe, "nfe_v4.00.xsd")
+	if err != nil {
+		return err
+	}
+	opcoes := Opcoes{}
+	if !assinada {
+		opcoes.IgnorarAusentes = []string{"Signature"}
+	}
+	return s.Validar([]byte(xmlContent), opcoes)
+}
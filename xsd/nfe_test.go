@@ -0,0 +1,68 @@
+package xsd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Os arquivos oficiais do pacote são copiados para xsd/schemas conforme o LEIAME.md;
+// enquanto não estiverem presentes, ValidarNFe informa ErrPacoteAusente. Com a variável
+// NFE_XSD_OBRIGATORIO definida (como na integração contínua), a ausência é uma falha
+func pacoteEmbutido(t *testing.T) {
+	t.Helper()
+	_, err := CarregarPacote(PacoteNFe, "nfe_v4.00.xsd")
+	if errors.Is(err, ErrPacoteAusente) {
+		if ValidarNFe("<NFe/>", false) == nil {
+			t.Fatal("ValidarNFe aceitou a nota sem o pacote de schemas")
+		}
+		if os.Getenv("NFE_XSD_OBRIGATORIO") != "" {
+			t.Fatalf("pacote %s sem os arquivos XSD: %v", PacoteNFe, err)
+		}
+		t.Skipf("pacote %s sem os arquivos XSD: %v", PacoteNFe, err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Notas do leiaute 4.00 usadas nos testes do pacote services
+func lerNotaServices(t *testing.T, arquivo string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "services", "testdata", arquivo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nota := string(data)
+	inicio := strings.Index(nota, "<NFe ")
+	fim := strings.Index(nota, "</NFe>") + len("</NFe>")
+	return nota[inicio:fim]
+}
+
+func TestValidarNFe(t *testing.T) {
+	pacoteEmbutido(t)
+	if err := ValidarNFe(lerNotaServices(t, "nfe_compra_proc.xml"), true); err != nil {
+		t.Errorf("nota assinada rejeitada: %v", err)
+	}
+	for _, arquivo := range []string{"nfe_importacao.xml", "nfe_conjugada.xml", "nfe_exportacao.xml"} {
+		if err := ValidarNFe(lerNotaServices(t, arquivo), false); err != nil {
+			t.Errorf("%s rejeitada: %v", arquivo, err)
+		}
+	}
+}
+
+func TestValidarNFeInvalida(t *testing.T) {
+	pacoteEmbutido(t)
+	nota := strings.Replace(lerNotaServices(t, "nfe_importacao.xml"), "<vProd>6000.00</vProd>", "<vProd>6000.000</vProd>", 1)
+	err := ValidarNFe(nota, false)
+	if !contemErro(err, Erro{Caminho: "/NFe/infNFe/det/prod/vProd", Faceta: "pattern"}) {
+		t.Fatalf("esperado erro de pattern em vProd, obtido: %v", err)
+	}
+
+	semAssinatura := lerNotaServices(t, "nfe_conjugada.xml")
+	if err := ValidarNFe(semAssinatura, true); !contemErro(err, Erro{Caminho: "/NFe/Signature", Faceta: "minOccurs"}) {
+		t.Fatalf("esperado erro de Signature ausente, obtido: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const namespaceXSD = "http://www.w3.org/2001/XMLSchema"
+
+// Schema reúne as declarações globais de um conjunto de arquivos XSD (incluindo
+// os arquivos referenciados por xs:include e xs:import)
+type Schema struct {
+	elementos     map[string]*no
+	tiposComplexo map[string]*no
+	tiposSimples  map[string]*no
+	grupos        map[string]*no
+	grupoAtrib    map[string]*no
+	regex         map[string]*padrao
+}
+
+// Nó genérico de um arquivo XSD
+type no struct {
+	nome   string // nome local do elemento XSD (element, sequence, restriction...)
+	attrs  map[string]string
+	filhos []*no
+	ns     map[string]string // prefixos declarados (prefixo -> namespace)
+	alvo   string            // targetNamespace do arquivo, nas declarações globais
+}
+
+func (n *no) attr(nome string) string {
+	return n.attrs[nome]
+}
+
+// Carregar lê o arquivo XSD informado e todos os arquivos incluídos ou importados a partir dele
+func Carregar(fsys fs.FS, arquivo string) (*Schema, error) {
+	s := &Schema{
+		elementos:     map[string]*no{},
+		tiposComplexo: map[string]*no{},
+		tiposSimples:  map[string]*no{},
+		grupos:        map[string]*no{},
+		grupoAtrib:    map[string]*no{},
+		regex:         map[string]*padrao{},
+	}
+	if err := s.carregarArquivo(fsys, arquivo, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) carregarArquivo(fsys fs.FS, arquivo string, carregados map[string]bool) error {
+	arquivo = path.Clean(arquivo)
+	if carregados[arquivo] {
+		return nil
+	}
+	carregados[arquivo] = true
+	data, err := fs.ReadFile(fsys, arquivo)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o schema %s: %v", arquivo, err)
+	}
+	raiz, err := lerXSD(data)
+	if err != nil {
+		return fmt.Errorf("erro ao parsear o schema %s: %v", arquivo, err)
+	}
+	for _, filho := range raiz.filhos {
+		nome := filho.attr("name")
+		filho.alvo = raiz.attr("targetNamespace")
+		switch filho.nome {
+		case "include", "import":
+			if local := filho.attr("schemaLocation"); local != "" {
+				if err := s.carregarArquivo(fsys, path.Join(path.Dir(arquivo), local), carregados); err != nil {
+					return err
+				}
+			}
+		case "element":
+			s.elementos[nome] = filho
+		case "complexType":
+			s.tiposComplexo[nome] = filho
+		case "simpleType":
+			s.tiposSimples[nome] = filho
+		case "group":
+			s.grupos[nome] = filho
+		case "attributeGroup":
+			s.grupoAtrib[nome] = filho
+		}
+	}
+	return nil
+}
+
+// Lê um arquivo XSD em uma árvore de nós, mantendo apenas os elementos do namespace XMLSchema
+func lerXSD(data []byte) (*no, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var pilha []*no
+	var raiz *no
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			atual := &no{nome: t.Name.Local, attrs: map[string]string{}, ns: map[string]string{}}
+			if len(pilha) > 0 {
+				for prefixo, uri := range pilha[len(pilha)-1].ns {
+					atual.ns[prefixo] = uri
+				}
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					atual.ns[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					atual.ns[""] = a.Value
+				case a.Name.Space == "":
+					atual.attrs[a.Name.Local] = a.Value
+				}
+			}
+			if t.Name.Space != namespaceXSD {
+				// xs:annotation/xs:documentation e conteúdos de outros namespaces são ignorados
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if atual.nome == "annotation" {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if len(pilha) > 0 {
+				pai := pilha[len(pilha)-1]
+				pai.filhos = append(pai.filhos, atual)
+			} else {
+				raiz = atual
+			}
+			pilha = append(pilha, atual)
+		case xml.EndElement:
+			if len(pilha) > 0 {
+				pilha = pilha[:len(pilha)-1]
+			}
+		}
+	}
+	if raiz == nil || raiz.nome != "schema" {
+		return nil, fmt.Errorf("elemento xs:schema não encontrado")
+	}
+	return raiz, nil
+}
+
+// Separa um QName (prefixo:nome) e indica se pertence ao namespace XMLSchema
+func (n *no) resolverQName(qname string) (local string, builtin bool) {
+	prefixo := ""
+	local = qname
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefixo, local = qname[:i], qname[i+1:]
+	}
+	return local, n.ns[prefixo] == namespaceXSD
+}
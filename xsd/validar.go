@@ -0,0 +1,661 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Erro de validação, com o caminho do elemento e a faceta ou regra violada
+type Erro struct {
+	Caminho  string // Ex.: /NFe/infNFe/det[2]/prod/vProd
+	Faceta   string // pattern, enumeration, maxLength, minOccurs, sequence...
+	Mensagem string
+}
+
+func (e Erro) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Caminho, e.Mensagem, e.Faceta)
+}
+
+// Erros agrupa todas as violações encontradas em um documento
+type Erros []Erro
+
+func (e Erros) Error() string {
+	mensagens := make([]string, len(e))
+	for i, erro := range e {
+		mensagens[i] = erro.Error()
+	}
+	return strings.Join(mensagens, "; ")
+}
+
+// Opções de validação
+type Opcoes struct {
+	// Elementos obrigatórios que podem estar ausentes, como a Signature antes da assinatura
+	IgnorarAusentes []string
+}
+
+// Elemento do documento validado
+type elemento struct {
+	nome   string
+	attrs  []xml.Attr
+	filhos []*elemento
+	texto  string
+}
+
+type padrao struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// Validar verifica o documento contra as declarações do schema
+func (s *Schema) Validar(data []byte, opcoes Opcoes) error {
+	raiz, err := lerDocumento(data)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o XML: %v", err)
+	}
+	v := &validador{schema: s, ignorar: map[string]bool{}}
+	for _, nome := range opcoes.IgnorarAusentes {
+		v.ignorar[nome] = true
+	}
+	decl, ok := s.elementos[raiz.nome]
+	if !ok {
+		return Erros{{Caminho: "/" + raiz.nome, Faceta: "element", Mensagem: "elemento raiz não declarado no schema"}}
+	}
+	v.validarElemento(raiz, decl, "/"+raiz.nome)
+	if len(v.erros) > 0 {
+		return v.erros
+	}
+	return nil
+}
+
+func lerDocumento(data []byte) (*elemento, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var pilha []*elemento
+	var raiz *elemento
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			atual := &elemento{nome: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+					continue
+				}
+				atual.attrs = append(atual.attrs, a)
+			}
+			if len(pilha) > 0 {
+				pai := pilha[len(pilha)-1]
+				pai.filhos = append(pai.filhos, atual)
+			} else {
+				raiz = atual
+			}
+			pilha = append(pilha, atual)
+		case xml.CharData:
+			if len(pilha) > 0 {
+				pilha[len(pilha)-1].texto += string(t)
+			}
+		case xml.EndElement:
+			pilha = pilha[:len(pilha)-1]
+		}
+	}
+	if raiz == nil {
+		return nil, fmt.Errorf("documento vazio")
+	}
+	return raiz, nil
+}
+
+type validador struct {
+	schema  *Schema
+	ignorar map[string]bool
+	erros   Erros
+}
+
+func (v *validador) erro(caminho, faceta, formato string, args ...interface{}) {
+	v.erros = append(v.erros, Erro{Caminho: caminho, Faceta: faceta, Mensagem: fmt.Sprintf(formato, args...)})
+}
+
+// Valida o elemento contra sua declaração xs:element
+func (v *validador) validarElemento(el *elemento, decl *no, caminho string) {
+	if tipo := decl.attr("type"); tipo != "" {
+		local, builtin := decl.resolverQName(tipo)
+		if builtin {
+			v.validarSimplesSemFilhos(el, caminho)
+			v.validarBuiltin(el.texto, local, caminho)
+			return
+		}
+		if ct, ok := v.schema.tiposComplexo[local]; ok {
+			v.validarComplexo(el, ct, caminho)
+			return
+		}
+		if st, ok := v.schema.tiposSimples[local]; ok {
+			v.validarSimplesSemFilhos(el, caminho)
+			v.validarSimples(el.texto, st, caminho)
+			return
+		}
+		v.erro(caminho, "type", "tipo %s não declarado no schema", tipo)
+		return
+	}
+	for _, filho := range decl.filhos {
+		switch filho.nome {
+		case "complexType":
+			v.validarComplexo(el, filho, caminho)
+			return
+		case "simpleType":
+			v.validarSimplesSemFilhos(el, caminho)
+			v.validarSimples(el.texto, filho, caminho)
+			return
+		}
+	}
+}
+
+func (v *validador) validarSimplesSemFilhos(el *elemento, caminho string) {
+	if len(el.filhos) > 0 {
+		v.erro(caminho, "simpleType", "elemento de conteúdo simples não pode ter elementos filhos")
+	}
+}
+
+func (v *validador) validarComplexo(el *elemento, ct *no, caminho string) {
+	var atributos []*no
+	for _, filho := range ct.filhos {
+		switch filho.nome {
+		case "sequence", "choice", "all", "group":
+			fim := v.casarParticula(filho, el.filhos, 0, caminho, true)
+			if fim < len(el.filhos) {
+				v.erro(caminhoItem(caminho, el.filhos, fim), "sequence", "elemento %s não esperado nesta posição", el.filhos[fim].nome)
+			}
+		case "attribute", "attributeGroup":
+			atributos = append(atributos, filho)
+		case "simpleContent", "complexContent":
+			for _, derivacao := range filho.filhos {
+				if derivacao.nome != "extension" && derivacao.nome != "restriction" {
+					continue
+				}
+				local, builtin := derivacao.resolverQName(derivacao.attr("base"))
+				if filho.nome == "simpleContent" {
+					if builtin {
+						v.validarBuiltin(el.texto, local, caminho)
+					} else if st, ok := v.schema.tiposSimples[local]; ok {
+						v.validarSimples(el.texto, st, caminho)
+					}
+				}
+				for _, d := range derivacao.filhos {
+					switch d.nome {
+					case "attribute", "attributeGroup":
+						atributos = append(atributos, d)
+					case "sequence", "choice", "all", "group":
+						fim := v.casarParticula(d, el.filhos, 0, caminho, true)
+						if fim < len(el.filhos) {
+							v.erro(caminhoItem(caminho, el.filhos, fim), "sequence", "elemento %s não esperado nesta posição", el.filhos[fim].nome)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(el.filhos) > 0 && !temConteudo(ct) {
+		v.erro(caminho, "complexType", "elemento não admite elementos filhos")
+	}
+	v.validarAtributos(el, atributos, caminho)
+}
+
+func temConteudo(ct *no) bool {
+	for _, filho := range ct.filhos {
+		switch filho.nome {
+		case "sequence", "choice", "all", "group", "complexContent":
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validador) validarAtributos(el *elemento, decls []*no, caminho string) {
+	declarados := map[string]*no{}
+	var expandir func(lista []*no)
+	expandir = func(lista []*no) {
+		for _, d := range lista {
+			if d.nome == "attributeGroup" {
+				local, _ := d.resolverQName(d.attr("ref"))
+				if grupo, ok := v.schema.grupoAtrib[local]; ok {
+					expandir(grupo.filhos)
+				}
+				continue
+			}
+			if d.nome == "attribute" {
+				declarados[d.attr("name")] = d
+			}
+		}
+	}
+	expandir(decls)
+	presentes := map[string]string{}
+	for _, a := range el.attrs {
+		presentes[a.Name.Local] = a.Value
+		d, ok := declarados[a.Name.Local]
+		if !ok {
+			if a.Name.Space == "" {
+				v.erro(caminho+"/@"+a.Name.Local, "attribute", "atributo não declarado")
+			}
+			continue
+		}
+		v.validarValorAtributo(a.Value, d, caminho+"/@"+a.Name.Local)
+	}
+	for nome, d := range declarados {
+		if _, ok := presentes[nome]; !ok && d.attr("use") == "required" {
+			v.erro(caminho+"/@"+nome, "use", "atributo obrigatório ausente")
+		}
+	}
+}
+
+func (v *validador) validarValorAtributo(valor string, d *no, caminho string) {
+	if fixo := d.attr("fixed"); fixo != "" && valor != fixo {
+		v.erro(caminho, "fixed", "valor %q difere do valor fixo %q", valor, fixo)
+	}
+	if tipo := d.attr("type"); tipo != "" {
+		local, builtin := d.resolverQName(tipo)
+		if builtin {
+			v.validarBuiltin(valor, local, caminho)
+		} else if st, ok := v.schema.tiposSimples[local]; ok {
+			v.validarSimples(valor, st, caminho)
+		}
+		return
+	}
+	for _, filho := range d.filhos {
+		if filho.nome == "simpleType" {
+			v.validarSimples(valor, filho, caminho)
+		}
+	}
+}
+
+// Limites de ocorrência de uma partícula
+func ocorrencias(p *no) (min int, max int) {
+	min, max = 1, 1
+	if s := p.attr("minOccurs"); s != "" {
+		min, _ = strconv.Atoi(s)
+	}
+	if s := p.attr("maxOccurs"); s == "unbounded" {
+		max = -1
+	} else if s != "" {
+		max, _ = strconv.Atoi(s)
+	}
+	return min, max
+}
+
+// Nome do elemento declarado por uma partícula xs:element (por name ou ref)
+func nomeElemento(p *no) string {
+	if ref := p.attr("ref"); ref != "" {
+		local, _ := p.resolverQName(ref)
+		return local
+	}
+	return p.attr("name")
+}
+
+// Conjunto de nomes de elementos que podem iniciar a partícula
+func (v *validador) primeiros(p *no, conjunto map[string]bool) (vazio bool) {
+	min, _ := ocorrencias(p)
+	switch p.nome {
+	case "element":
+		conjunto[nomeElemento(p)] = true
+		return min == 0 || v.ignorar[nomeElemento(p)]
+	case "any":
+		conjunto["*"] = true
+		return min == 0
+	case "group":
+		local, _ := p.resolverQName(p.attr("ref"))
+		if grupo, ok := v.schema.grupos[local]; ok && len(grupo.filhos) > 0 {
+			return v.primeiros(grupo.filhos[0], conjunto) || min == 0
+		}
+		return true
+	case "sequence":
+		for _, filho := range p.filhos {
+			if !v.primeiros(filho, conjunto) {
+				return min == 0
+			}
+		}
+		return true
+	case "choice", "all":
+		vazio = false
+		for _, filho := range p.filhos {
+			if v.primeiros(filho, conjunto) {
+				vazio = true
+			}
+		}
+		return vazio || min == 0 || len(p.filhos) == 0
+	}
+	return true
+}
+
+func (v *validador) podeIniciar(p *no, el *elemento) bool {
+	conjunto := map[string]bool{}
+	v.primeiros(p, conjunto)
+	return conjunto[el.nome] || conjunto["*"]
+}
+
+// Casa a partícula com os elementos a partir de inicio e retorna a posição seguinte.
+// As partículas do NFe são determinísticas, então o casamento guloso é suficiente
+func (v *validador) casarParticula(p *no, els []*elemento, inicio int, caminho string, reportar bool) int {
+	min, max := ocorrencias(p)
+	i := inicio
+	switch p.nome {
+	case "element":
+		nome := nomeElemento(p)
+		decl := p
+		if p.attr("ref") != "" {
+			decl = v.schema.elementos[nome]
+		}
+		n := 0
+		for i < len(els) && els[i].nome == nome && (max < 0 || n < max) {
+			if decl != nil {
+				v.validarElemento(els[i], decl, caminhoItem(caminho, els, i))
+			}
+			i++
+			n++
+		}
+		if i < len(els) && els[i].nome == nome && max >= 0 && n >= max {
+			v.erro(caminhoItem(caminho, els, i), "maxOccurs", "elemento %s excede o máximo de %d ocorrências", nome, max)
+		}
+		if n < min && reportar && !v.ignorar[nome] {
+			v.erro(caminho+"/"+nome, "minOccurs", "elemento obrigatório %s ausente", nome)
+		}
+		return i
+	case "any":
+		n := 0
+		for i < len(els) && (max < 0 || n < max) {
+			i++
+			n++
+		}
+		return i
+	case "group":
+		local, _ := p.resolverQName(p.attr("ref"))
+		grupo, ok := v.schema.grupos[local]
+		if !ok {
+			return i
+		}
+		for _, filho := range grupo.filhos {
+			i = v.casarRepeticoes(filho, els, i, caminho, reportar, min, max)
+		}
+		return i
+	}
+	return v.casarRepeticoes(p, els, i, caminho, reportar, min, max)
+}
+
+// Casa as repetições de xs:sequence, xs:choice e xs:all
+func (v *validador) casarRepeticoes(p *no, els []*elemento, i int, caminho string, reportar bool, min, max int) int {
+	if p.nome == "element" || p.nome == "any" || p.nome == "group" {
+		return v.casarParticula(p, els, i, caminho, reportar)
+	}
+	n := 0
+	for max < 0 || n < max {
+		obrigatoria := n < min
+		if !obrigatoria && (i >= len(els) || !v.podeIniciar(p, els[i])) {
+			break
+		}
+		anterior := i
+		switch p.nome {
+		case "sequence":
+			for _, filho := range p.filhos {
+				i = v.casarParticula(filho, els, i, caminho, reportar)
+			}
+		case "choice":
+			escolhido := false
+			if i < len(els) {
+				for _, filho := range p.filhos {
+					if v.podeIniciar(filho, els[i]) {
+						i = v.casarParticula(filho, els, i, caminho, reportar)
+						escolhido = true
+						break
+					}
+				}
+			}
+			if !escolhido && obrigatoria && reportar {
+				var opcoes []string
+				conjunto := map[string]bool{}
+				if !v.primeiros(p, conjunto) {
+					for nome := range conjunto {
+						opcoes = append(opcoes, nome)
+					}
+					v.erro(caminho, "choice", "nenhuma das opções informada (%s)", strings.Join(ordenar(opcoes), ", "))
+				}
+			}
+		case "all":
+			restantes := append([]*no(nil), p.filhos...)
+			for i < len(els) {
+				casou := false
+				for k, filho := range restantes {
+					if nomeElemento(filho) == els[i].nome {
+						i = v.casarParticula(filho, els, i, caminho, reportar)
+						restantes = append(restantes[:k], restantes[k+1:]...)
+						casou = true
+						break
+					}
+				}
+				if !casou {
+					break
+				}
+			}
+			for _, filho := range restantes {
+				if m, _ := ocorrencias(filho); m > 0 && reportar && !v.ignorar[nomeElemento(filho)] {
+					v.erro(caminho+"/"+nomeElemento(filho), "minOccurs", "elemento obrigatório %s ausente", nomeElemento(filho))
+				}
+			}
+		}
+		n++
+		if i == anterior {
+			break
+		}
+	}
+	return i
+}
+
+func caminhoItem(caminho string, els []*elemento, i int) string {
+	nome := els[i].nome
+	total, posicao := 0, 0
+	for k, el := range els {
+		if el.nome == nome {
+			total++
+			if k == i {
+				posicao = total
+			}
+		}
+	}
+	if total > 1 {
+		return fmt.Sprintf("%s/%s[%d]", caminho, nome, posicao)
+	}
+	return caminho + "/" + nome
+}
+
+func ordenar(lista []string) []string {
+	for i := 1; i < len(lista); i++ {
+		for j := i; j > 0 && lista[j] < lista[j-1]; j-- {
+			lista[j], lista[j-1] = lista[j-1], lista[j]
+		}
+	}
+	return lista
+}
+
+// Valida um valor contra um xs:simpleType (restrição, lista ou união)
+func (v *validador) validarSimples(valor string, st *no, caminho string) {
+	for _, filho := range st.filhos {
+		switch filho.nome {
+		case "restriction":
+			v.validarRestricao(valor, filho, caminho)
+		case "list":
+			for _, item := range strings.Fields(valor) {
+				if tipo := filho.attr("itemType"); tipo != "" {
+					local, builtin := filho.resolverQName(tipo)
+					if builtin {
+						v.validarBuiltin(item, local, caminho)
+					} else if base, ok := v.schema.tiposSimples[local]; ok {
+						v.validarSimples(item, base, caminho)
+					}
+				}
+			}
+		case "union":
+			// Uniões são aceitas se ao menos um dos tipos membros aceitar o valor
+			membros := strings.Fields(filho.attr("memberTypes"))
+			aceito := len(membros) == 0
+			for _, membro := range membros {
+				local, builtin := filho.resolverQName(membro)
+				teste := &validador{schema: v.schema}
+				if builtin {
+					teste.validarBuiltin(valor, local, caminho)
+				} else if base, ok := v.schema.tiposSimples[local]; ok {
+					teste.validarSimples(valor, base, caminho)
+				}
+				if len(teste.erros) == 0 {
+					aceito = true
+					break
+				}
+			}
+			if !aceito {
+				v.erro(caminho, "union", "valor %q não corresponde a nenhum dos tipos da união", valor)
+			}
+		}
+	}
+}
+
+func (v *validador) validarRestricao(valor string, r *no, caminho string) {
+	if base := r.attr("base"); base != "" {
+		local, builtin := r.resolverQName(base)
+		if builtin {
+			v.validarBuiltin(valor, local, caminho)
+		} else if st, ok := v.schema.tiposSimples[local]; ok {
+			v.validarSimples(valor, st, caminho)
+		}
+	}
+	for _, filho := range r.filhos {
+		if filho.nome == "simpleType" {
+			v.validarSimples(valor, filho, caminho)
+		}
+	}
+
+	var enumeracoes, padroes []string
+	for _, faceta := range r.filhos {
+		valorFaceta := faceta.attr("value")
+		switch faceta.nome {
+		case "enumeration":
+			enumeracoes = append(enumeracoes, valorFaceta)
+		case "pattern":
+			padroes = append(padroes, valorFaceta)
+		case "whiteSpace":
+			if valorFaceta == "collapse" {
+				valor = strings.Join(strings.Fields(valor), " ")
+			}
+		case "length":
+			if n, _ := strconv.Atoi(valorFaceta); utf8.RuneCountInString(valor) != n {
+				v.erro(caminho, "length", "tamanho %d difere do tamanho exigido %d", utf8.RuneCountInString(valor), n)
+			}
+		case "minLength":
+			if n, _ := strconv.Atoi(valorFaceta); utf8.RuneCountInString(valor) < n {
+				v.erro(caminho, "minLength", "tamanho %d menor que o mínimo %d", utf8.RuneCountInString(valor), n)
+			}
+		case "maxLength":
+			if n, _ := strconv.Atoi(valorFaceta); utf8.RuneCountInString(valor) > n {
+				v.erro(caminho, "maxLength", "tamanho %d maior que o máximo %d", utf8.RuneCountInString(valor), n)
+			}
+		case "totalDigits", "fractionDigits":
+			v.validarDigitos(valor, faceta.nome, valorFaceta, caminho)
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			v.validarLimite(valor, faceta.nome, valorFaceta, caminho)
+		}
+	}
+	if len(enumeracoes) > 0 {
+		encontrado := false
+		for _, e := range enumeracoes {
+			if e == valor {
+				encontrado = true
+				break
+			}
+		}
+		if !encontrado {
+			v.erro(caminho, "enumeration", "valor %q não pertence à enumeração [%s]", valor, strings.Join(enumeracoes, ", "))
+		}
+	}
+	// Vários xs:pattern na mesma restrição são alternativas
+	if len(padroes) > 0 {
+		casou := false
+		for _, p := range padroes {
+			re, err := v.schema.compilarPadrao(p)
+			if err != nil {
+				v.erro(caminho, "pattern", "padrão %q não suportado: %v", p, err)
+				return
+			}
+			if re.MatchString(valor) {
+				casou = true
+				break
+			}
+		}
+		if !casou {
+			v.erro(caminho, "pattern", "valor %q não corresponde ao padrão %s", valor, strings.Join(padroes, " | "))
+		}
+	}
+}
+
+// Padrões XSD são implicitamente ancorados no início e no fim do valor
+func (s *Schema) compilarPadrao(p string) (*regexp.Regexp, error) {
+	if c, ok := s.regex[p]; ok {
+		return c.re, c.err
+	}
+	re, err := regexp.Compile(`^(?:` + p + `)$`)
+	s.regex[p] = &padrao{re: re, err: err}
+	return re, err
+}
+
+func (v *validador) validarDigitos(valor, faceta, limite, caminho string) {
+	n, _ := strconv.Atoi(limite)
+	numero := strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(valor, "-"), "+"), "0")
+	inteiro, fracao, _ := strings.Cut(numero, ".")
+	fracao = strings.TrimRight(fracao, "0")
+	switch faceta {
+	case "totalDigits":
+		if len(inteiro)+len(fracao) > n {
+			v.erro(caminho, faceta, "valor %q excede %d dígitos", valor, n)
+		}
+	case "fractionDigits":
+		if len(fracao) > n {
+			v.erro(caminho, faceta, "valor %q excede %d casas decimais", valor, n)
+		}
+	}
+}
+
+func (v *validador) validarLimite(valor, faceta, limite, caminho string) {
+	x, err1 := strconv.ParseFloat(valor, 64)
+	l, err2 := strconv.ParseFloat(limite, 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	invalido := (faceta == "minInclusive" && x < l) || (faceta == "maxInclusive" && x > l) ||
+		(faceta == "minExclusive" && x <= l) || (faceta == "maxExclusive" && x >= l)
+	if invalido {
+		v.erro(caminho, faceta, "valor %q fora do limite %s %s", valor, faceta, limite)
+	}
+}
+
+// Valida os tipos primitivos do XMLSchema usados nos schemas da NFe
+func (v *validador) validarBuiltin(valor, tipo, caminho string) {
+	switch tipo {
+	case "decimal", "double", "float":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(valor), 64); err != nil {
+			v.erro(caminho, tipo, "valor %q não é numérico", valor)
+		}
+	case "integer", "int", "long", "short", "byte", "nonNegativeInteger", "positiveInteger", "unsignedInt", "unsignedLong", "unsignedShort", "unsignedByte":
+		if _, err := strconv.ParseInt(strings.TrimSpace(valor), 10, 64); err != nil {
+			v.erro(caminho, tipo, "valor %q não é inteiro", valor)
+		}
+	case "base64Binary":
+		compacto := strings.Join(strings.Fields(valor), "")
+		if _, err := base64.StdEncoding.DecodeString(compacto); err != nil {
+			v.erro(caminho, tipo, "valor não está em Base64")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package xsd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Schema reduzido, no formato do pacote de liberação (include, import do xmldsig e tipos básicos)
+func carregarReduzido(t *testing.T) *Schema {
+	t.Helper()
+	s, err := Carregar(os.DirFS(filepath.Join("testdata", "nfe_reduzido")), "nfe.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func lerNotaValida(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "nfe_valida.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestValidarNotaValida(t *testing.T) {
+	if err := carregarReduzido(t).Validar([]byte(lerNotaValida(t)), Opcoes{}); err != nil {
+		t.Fatalf("nota válida rejeitada: %v", err)
+	}
+}
+
+func TestValidarSemAssinatura(t *testing.T) {
+	s := carregarReduzido(t)
+	nota := lerNotaValida(t)
+	inicio := strings.Index(nota, "<Signature")
+	fim := strings.Index(nota, "</Signature>") + len("</Signature>")
+	semAssinatura := nota[:inicio] + nota[fim:]
+
+	if err := s.Validar([]byte(semAssinatura), Opcoes{IgnorarAusentes: []string{"Signature"}}); err != nil {
+		t.Fatalf("nota antes da assinatura rejeitada: %v", err)
+	}
+	err := s.Validar([]byte(semAssinatura), Opcoes{})
+	if !contemErro(err, Erro{Caminho: "/NFe/Signature", Faceta: "minOccurs"}) {
+		t.Fatalf("esperado erro de Signature ausente, obtido: %v", err)
+	}
+}
+
+func TestValidarErros(t *testing.T) {
+	s := carregarReduzido(t)
+	nota := lerNotaValida(t)
+	casos := []struct {
+		nome       string
+		de, para   string
+		esperado   Erro
+		quantidade int
+	}{
+		{"casas decimais", "<vProd>25.00</vProd>", "<vProd>25.0</vProd>",
+			Erro{Caminho: "/NFe/infNFe/det[1]/prod/vProd", Faceta: "pattern"}, 1},
+		{"enumeração", "<cUF>PR</cUF>", "<cUF>MG</cUF>",
+			Erro{Caminho: "/NFe/infNFe/ide/cUF", Faceta: "enumeration"}, 1},
+		{"tamanho máximo", "<xNome>FORNECEDOR TESTE LTDA</xNome>", "<xNome>" + strings.Repeat("X", 61) + "</xNome>",
+			Erro{Caminho: "/NFe/infNFe/emit/xNome", Faceta: "maxLength"}, 1},
+		{"obrigatório ausente", "<xNome>FORNECEDOR TESTE LTDA</xNome>", "",
+			Erro{Caminho: "/NFe/infNFe/emit/xNome", Faceta: "minOccurs"}, 1},
+		{"escolha ausente", "<CNPJ>44555666000170</CNPJ>", "",
+			Erro{Caminho: "/NFe/infNFe/emit", Faceta: "choice"}, -1},
+		{"fora de ordem", "<vProd>25.00</vProd><vDesc>1.00</vDesc>", "<vDesc>1.00</vDesc><vProd>25.00</vProd>",
+			Erro{Caminho: "/NFe/infNFe/det[1]/prod/vProd", Faceta: "minOccurs"}, -1},
+		{"atributo obrigatório", ` nItem="1"`, "",
+			Erro{Caminho: "/NFe/infNFe/det[1]/@nItem", Faceta: "use"}, 1},
+		{"atributo inválido", `versao="4.00"`, `versao="4.01"`,
+			Erro{Caminho: "/NFe/infNFe/@versao", Faceta: "pattern"}, 1},
+		{"chave de acesso", `Id="NFe4126`, `Id="NF4126`,
+			Erro{Caminho: "/NFe/infNFe/@Id", Faceta: "pattern"}, 1},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if !strings.Contains(nota, c.de) {
+				t.Fatalf("trecho %q não encontrado na nota", c.de)
+			}
+			err := s.Validar([]byte(strings.Replace(nota, c.de, c.para, 1)), Opcoes{})
+			if !contemErro(err, c.esperado) {
+				t.Fatalf("esperado erro %s (%s), obtido: %v", c.esperado.Caminho, c.esperado.Faceta, err)
+			}
+			var erros Erros
+			errors.As(err, &erros)
+			if c.quantidade >= 0 && len(erros) != c.quantidade {
+				t.Errorf("esperados %d erros, obtidos %d: %v", c.quantidade, len(erros), err)
+			}
+		})
+	}
+}
+
+func contemErro(err error, esperado Erro) bool {
+	var erros Erros
+	if !errors.As(err, &erros) {
+		return false
+	}
+	for _, e := range erros {
+		if e.Caminho == esperado.Caminho && e.Faceta == esperado.Faceta {
+			return true
+		}
+	}
+	return false
+}